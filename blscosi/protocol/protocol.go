@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"go.dedis.ch/cothority/v3/metrics"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign"
@@ -24,6 +25,15 @@ import (
 const defaultTimeout = 10 * time.Second
 const defaultSubleaderFailures = 2
 
+var (
+	metricRoundTime = metrics.NewHistogram("blscosi_round_seconds",
+		"Time taken by the root to collect and aggregate the signatures of a round.", nil)
+	metricRoundFailures = metrics.NewCounter("blscosi_round_failures_total",
+		"Number of rounds that didn't produce a signature.")
+	metricRefusals = metrics.NewCounter("blscosi_refusals_total",
+		"Number of refusals to sign received by the subleaders.")
+)
+
 // VerificationFn is called on every node. Where msg is the message that is
 // co-signed and the data is additional data for verification.
 type VerificationFn func(msg, data []byte) bool
@@ -185,6 +195,7 @@ func (p *BlsCosi) Start() error {
 
 func (p *BlsCosi) runSubProtocols() {
 	defer p.Done()
+	start := time.Now()
 
 	// Verification of the data is done before contacting the children
 	if ok := p.verificationFn(p.Msg, p.Data); !ok {
@@ -213,6 +224,7 @@ func (p *BlsCosi) runSubProtocols() {
 	responses, err := p.collectSignatures()
 	if err != nil {
 		log.Error(err)
+		metricRoundFailures.Inc()
 		return
 	}
 
@@ -222,9 +234,11 @@ func (p *BlsCosi) runSubProtocols() {
 	sig, err := p.generateSignature(responses)
 	if err != nil {
 		log.Error(err)
+		metricRoundFailures.Inc()
 		return
 	}
 
+	metricRoundTime.ObserveSince(start)
 	p.FinalSignature <- sig
 }
 
@@ -304,6 +304,7 @@ func (p *SubBlsCosi) dispatchSubLeader() error {
 					// The child gives an empty signature as a mark of refusal
 					responses[pubIndex] = &Response{}
 					done++
+					metricRefusals.Inc()
 				} else {
 					log.Warnf("Tentative to send a unsigned refusal from %v", reply.ServerIdentity.ID)
 				}
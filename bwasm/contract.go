@@ -0,0 +1,144 @@
+package bwasm
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractWasmID denotes a contract whose code is a WebAssembly module stored
+// in the instance.
+const ContractWasmID = "wasm"
+
+// GasLimit is the gas available to the module for the execution of one
+// instruction. Each executed WebAssembly instruction costs one unit of gas.
+const GasLimit = 10000000
+
+// initFunction is the function of the module called when the instance is
+// spawned, if it is exported.
+const initFunction = "init"
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(ContractWasmID, contractWasmFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+type contractWasm struct {
+	byzcoin.BasicContract
+	Instance
+}
+
+func contractWasmFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractWasm{}
+	err := protobuf.Decode(in, &c.Instance)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// Spawn creates a new instance with the module given in the "code" argument.
+// If the module exports an init function, it is called with the arguments of
+// the instruction so that it can initialize the state.
+func (c *contractWasm) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	code := inst.Spawn.Args.Search("code")
+	m, err := decodeModule(code)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("invalid module: %v", err)
+	}
+
+	h := newHost(rst, inst.Spawn.Args, inst.DeriveID(""),
+		darc.ID(inst.InstanceID.Slice()), coins)
+	if _, ok := m.exports[initFunction]; ok {
+		err = h.execute(m, initFunction)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("initializing: %v", err)
+		}
+	}
+
+	buf, err := protobuf.Encode(&Instance{Code: code, State: h.state})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding instance: %v", err)
+	}
+
+	sc = append([]byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, h.instanceID, ContractWasmID, buf, h.darcID),
+	}, h.scs...)
+	return sc, h.coins, nil
+}
+
+// Invoke calls the function of the module named after the command of the
+// instruction. The function must not have any parameter or result.
+func (c *contractWasm) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	if inst.Invoke.Command == initFunction {
+		return nil, nil, xerrors.New("init can only be called when spawning")
+	}
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+
+	m, err := decodeModule(c.Code)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("invalid module: %v", err)
+	}
+
+	h := newHost(rst, inst.Invoke.Args, inst.InstanceID, darcID, coins)
+	h.state = c.State
+	err = h.execute(m, inst.Invoke.Command)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("executing %s: %v", inst.Invoke.Command, err)
+	}
+
+	buf, err := protobuf.Encode(&Instance{Code: c.Code, State: h.state})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding instance: %v", err)
+	}
+
+	sc = append([]byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractWasmID, buf, darcID),
+	}, h.scs...)
+	return sc, h.coins, nil
+}
+
+// Delete removes the instance. The module is not called.
+func (c *contractWasm) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractWasmID, nil, darcID),
+	}
+	return
+}
+
+// execute instantiates the module and calls the function.
+func (h *host) execute(m *module, function string) error {
+	typ, err := m.exportType(function)
+	if err != nil {
+		return err
+	}
+	if len(typ.params) != 0 || len(typ.results) != 0 {
+		return xerrors.Errorf("function %s must not have parameters or results", function)
+	}
+
+	v, err := newVM(m, h.functions(), GasLimit)
+	if err != nil {
+		return xerrors.Errorf("instantiating module: %v", err)
+	}
+	_, err = v.invoke(function)
+	return err
+}
@@ -0,0 +1,138 @@
+package bwasm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+)
+
+// testStateModule returns a module whose init and set functions store the
+// "value" argument as the state of the instance, and whose fail function
+// aborts.
+func testStateModule() []byte {
+	setState := []byte{
+		0x41, 0x00, // i32.const 0 (name_ptr)
+		0x41, 0x05, // i32.const 5 (name_len)
+		0x41, 0xc0, 0x00, // i32.const 64 (out_ptr)
+		0x41, 0x80, 0x02, // i32.const 256 (out_cap)
+		0x10, 0x00, // call arg
+		0x21, 0x00, // local.set 0
+		0x41, 0xc0, 0x00, // i32.const 64
+		0x20, 0x00, // local.get 0
+		0x10, 0x01, // call set_state
+		0x0b, // end
+	}
+	return wasm(
+		section(1,
+			typeEntry(i32x4, i32x1),
+			typeEntry(i32x2, nil),
+			typeEntry(nil, nil),
+		),
+		section(2,
+			importEntry(HostModule, "arg", 0),
+			importEntry(HostModule, "set_state", 1),
+			importEntry(HostModule, "abort", 1),
+		),
+		section(3, leb(2), leb(2), leb(2)),
+		section(5, []byte{0x00, 0x01}),
+		section(7,
+			exportEntry("init", 3),
+			exportEntry("set", 4),
+			exportEntry("fail", 5),
+		),
+		section(10,
+			bodyEntry([]byte{valI32}, setState...),
+			bodyEntry([]byte{valI32}, setState...),
+			bodyEntry(nil,
+				0x41, 0x00, // i32.const 0
+				0x41, 0x05, // i32.const 5
+				0x10, 0x02, // call abort
+				0x0b, // end
+			),
+		),
+		section(11, append([]byte{0x00, 0x41, 0x00, 0x0b}, nameEntry("value")...)),
+	)
+}
+
+func TestContractWasm(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:" + ContractWasmID, "invoke:" + ContractWasmID + ".set",
+			"invoke:" + ContractWasmID + ".fail"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	genesisMsg.BlockInterval = time.Second
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	code := testStateModule()
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractWasmID,
+			Args: byzcoin.Arguments{
+				{Name: "code", Value: code},
+				{Name: "value", Value: []byte("hello")},
+			},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	id := ctx.Instructions[0].DeriveID("")
+	expected, err := protobuf.Encode(&Instance{Code: code, State: []byte("hello")})
+	require.NoError(t, err)
+	_, err = cl.WaitProof(id, genesisMsg.BlockInterval, expected)
+	require.NoError(t, err)
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractWasmID,
+			Command:    "set",
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte("world")}},
+		},
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	expected, err = protobuf.Encode(&Instance{Code: code, State: []byte("world")})
+	require.NoError(t, err)
+	_, err = cl.WaitProof(id, genesisMsg.BlockInterval, expected)
+	require.NoError(t, err)
+
+	// An aborted execution refuses the transaction.
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractWasmID,
+			Command:    "fail",
+		},
+		SignerCounter: []uint64{3},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "aborted: value")
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
@@ -0,0 +1,323 @@
+package bwasm
+
+import (
+	"crypto/sha256"
+	"math"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// HostModule is the name of the module from which the host functions are
+// imported.
+const HostModule = "env"
+
+// gasByte is the cost of each byte copied between the host and the memory of
+// the module.
+const gasByte = 1
+
+var (
+	i32x0  = []byte{}
+	i32x1  = []byte{valI32}
+	i32x2  = []byte{valI32, valI32}
+	i32x3  = []byte{valI32, valI32, valI32}
+	i32x4  = []byte{valI32, valI32, valI32, valI32}
+	i32x6  = []byte{valI32, valI32, valI32, valI32, valI32, valI32}
+	i64x1  = []byte{valI64}
+	i32i64 = []byte{valI32, valI64}
+)
+
+// host holds what the functions of the host can access during the execution
+// of one instruction.
+type host struct {
+	rst        byzcoin.ReadOnlyStateTrie
+	args       byzcoin.Arguments
+	instanceID byzcoin.InstanceID
+	darcID     darc.ID
+	state      []byte
+	// input holds the coins given to the instruction, the module cannot
+	// output more coins of a type than it received.
+	input []byzcoin.Coin
+	coins []byzcoin.Coin
+	scs   []byzcoin.StateChange
+}
+
+// newHost returns a host for an execution of the contract of the instance.
+func newHost(rst byzcoin.ReadOnlyStateTrie, args byzcoin.Arguments,
+	instanceID byzcoin.InstanceID, darcID darc.ID, coins []byzcoin.Coin) *host {
+	return &host{
+		rst:        rst,
+		args:       args,
+		instanceID: instanceID,
+		darcID:     darcID,
+		input:      append([]byzcoin.Coin{}, coins...),
+		coins:      append([]byzcoin.Coin{}, coins...),
+	}
+}
+
+// functions returns the host functions that can be imported by a module.
+// Buffers are given as a pointer and a length in the memory of the module.
+// The functions returning a variable amount of data write at most out_cap
+// bytes and return the full length, so that the module can call them again
+// with a larger buffer.
+func (h *host) functions() map[string]hostFunc {
+	return map[string]hostFunc{
+		// arg(name_ptr, name_len, out_ptr, out_cap) -> len, or -1 if the
+		// argument is missing
+		HostModule + ".arg": {i32x4, i32x1, h.arg},
+		// get_state(out_ptr, out_cap) -> len
+		HostModule + ".get_state": {i32x2, i32x1, h.getState},
+		// set_state(ptr, len)
+		HostModule + ".set_state": {i32x2, i32x0, h.setState},
+		// instance_id(out_ptr) writes the 32 bytes of the instance ID
+		HostModule + ".instance_id": {i32x1, i32x0, h.instanceIDFn},
+		// block_index() -> index of the latest block
+		HostModule + ".block_index": {i32x0, i32x1, h.blockIndex},
+		// get_value(iid_ptr, out_ptr, out_cap) -> len, or -1 if the
+		// instance doesn't exist
+		HostModule + ".get_value": {i32x3, i32x1, h.getValue},
+		// get_contract_id(iid_ptr, out_ptr, out_cap) -> len, or -1 if the
+		// instance doesn't exist
+		HostModule + ".get_contract_id": {i32x3, i32x1, h.getContractID},
+		// derive_id(key_ptr, out_ptr) writes the 32 bytes of the ID of the
+		// instance owned by the contract with the 32 bytes key
+		HostModule + ".derive_id": {i32x2, i32x0, h.deriveIDFn},
+		// state_change(action, key_ptr, cid_ptr, cid_len, val_ptr, val_len)
+		HostModule + ".state_change": {i32x6, i32x0, h.stateChange},
+		// coin_count() -> number of coins
+		HostModule + ".coin_count": {i32x0, i32x1, h.coinCount},
+		// coin_name(index, out_ptr) writes the 32 bytes of the name
+		HostModule + ".coin_name": {i32x2, i32x0, h.coinName},
+		// coin_value(index) -> value
+		HostModule + ".coin_value": {i32x1, i64x1, h.coinValue},
+		// coin_add(name_ptr, value)
+		HostModule + ".coin_add": {i32i64, i32x0, h.coinAdd},
+		// coin_sub(name_ptr, value) -> 0, or -1 if there are not enough
+		// coins
+		HostModule + ".coin_sub": {i32i64, i32x1, h.coinSub},
+		// abort(msg_ptr, msg_len) refuses the instruction
+		HostModule + ".abort": {i32x2, i32x0, h.abort},
+		// log(msg_ptr, msg_len)
+		HostModule + ".log": {i32x2, i32x0, h.log},
+	}
+}
+
+// output copies the data in the memory of the module and returns its length.
+func output(v *vm, data []byte, ptr, size uint64) []uint64 {
+	n := len(data)
+	if uint64(n) > uint64(uint32(size)) {
+		n = int(uint32(size))
+	}
+	v.useGas(uint64(n) * gasByte)
+	v.write(uint32(ptr), data[:n])
+	return []uint64{uint64(uint32(len(data)))}
+}
+
+// input returns a copy of the memory of the module.
+func input(v *vm, ptr, n uint64) []byte {
+	v.useGas(uint64(uint32(n)) * gasByte)
+	return v.read(uint32(ptr), uint32(n))
+}
+
+// notFound is the i32 returned when a value doesn't exist.
+var notFound = []uint64{math.MaxUint32}
+
+func (h *host) arg(v *vm, args []uint64) ([]uint64, error) {
+	name := input(v, args[0], args[1])
+	for _, arg := range h.args {
+		if arg.Name == string(name) {
+			return output(v, arg.Value, args[2], args[3]), nil
+		}
+	}
+	return notFound, nil
+}
+
+func (h *host) getState(v *vm, args []uint64) ([]uint64, error) {
+	return output(v, h.state, args[0], args[1]), nil
+}
+
+func (h *host) setState(v *vm, args []uint64) ([]uint64, error) {
+	h.state = input(v, args[0], args[1])
+	return nil, nil
+}
+
+func (h *host) instanceIDFn(v *vm, args []uint64) ([]uint64, error) {
+	v.write(uint32(args[0]), h.instanceID.Slice())
+	return nil, nil
+}
+
+func (h *host) blockIndex(v *vm, args []uint64) ([]uint64, error) {
+	return []uint64{uint64(uint32(h.rst.GetIndex()))}, nil
+}
+
+// readInstanceID reads an instance ID in the memory of the module.
+func readInstanceID(v *vm, ptr uint64) byzcoin.InstanceID {
+	return byzcoin.NewInstanceID(input(v, ptr, 32))
+}
+
+// getValues returns the values of the instance, or nil if it doesn't exist.
+func (h *host) getValues(id byzcoin.InstanceID) ([]byte, string, error) {
+	pr, err := h.rst.GetProof(id.Slice())
+	if err != nil {
+		return nil, "", xerrors.Errorf("getting proof: %v", err)
+	}
+	ok, err := pr.Exists(id.Slice())
+	if err != nil {
+		return nil, "", xerrors.Errorf("checking proof: %v", err)
+	}
+	if !ok {
+		return nil, "", nil
+	}
+	value, _, contractID, _, err := h.rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, "", xerrors.Errorf("getting values: %v", err)
+	}
+	return value, contractID, nil
+}
+
+func (h *host) getValue(v *vm, args []uint64) ([]uint64, error) {
+	value, contractID, err := h.getValues(readInstanceID(v, args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if contractID == "" {
+		return notFound, nil
+	}
+	return output(v, value, args[1], args[2]), nil
+}
+
+func (h *host) getContractID(v *vm, args []uint64) ([]uint64, error) {
+	_, contractID, err := h.getValues(readInstanceID(v, args[0]))
+	if err != nil {
+		return nil, err
+	}
+	if contractID == "" {
+		return notFound, nil
+	}
+	return output(v, []byte(contractID), args[1], args[2]), nil
+}
+
+// deriveID returns the ID of the instance owned by the contract with the
+// key. The contract can only change the instances with such IDs, so that it
+// cannot modify the instances of the other contracts.
+func (h *host) deriveID(key []byte) byzcoin.InstanceID {
+	hash := sha256.New()
+	hash.Write(h.instanceID.Slice())
+	hash.Write(key)
+	return byzcoin.NewInstanceID(hash.Sum(nil))
+}
+
+func (h *host) deriveIDFn(v *vm, args []uint64) ([]uint64, error) {
+	v.write(uint32(args[1]), h.deriveID(input(v, args[0], 32)).Slice())
+	return nil, nil
+}
+
+func (h *host) stateChange(v *vm, args []uint64) ([]uint64, error) {
+	action := byzcoin.StateAction(uint32(args[0]))
+	if action != byzcoin.Create && action != byzcoin.Update && action != byzcoin.Remove {
+		return nil, xerrors.Errorf("invalid action %d", action)
+	}
+	id := h.deriveID(input(v, args[1], 32))
+	contractID := string(input(v, args[2], args[3]))
+	if contractID != ContractWasmID {
+		return nil, xerrors.Errorf("cannot change an instance of contract %s", contractID)
+	}
+	value := input(v, args[4], args[5])
+
+	h.scs = append(h.scs, byzcoin.NewStateChange(action, id, contractID, value, h.darcID))
+	return nil, nil
+}
+
+func (h *host) coinCount(v *vm, args []uint64) ([]uint64, error) {
+	return []uint64{uint64(len(h.coins))}, nil
+}
+
+// coin returns the coin with the given index.
+func (h *host) coin(index uint64) (*byzcoin.Coin, error) {
+	i := uint32(index)
+	if int(i) >= len(h.coins) {
+		return nil, xerrors.Errorf("unknown coin %d", i)
+	}
+	return &h.coins[i], nil
+}
+
+func (h *host) coinName(v *vm, args []uint64) ([]uint64, error) {
+	c, err := h.coin(args[0])
+	if err != nil {
+		return nil, err
+	}
+	v.write(uint32(args[1]), c.Name.Slice())
+	return nil, nil
+}
+
+func (h *host) coinValue(v *vm, args []uint64) ([]uint64, error) {
+	c, err := h.coin(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []uint64{c.Value}, nil
+}
+
+// coinTotal returns the sum of the values of the coins with the name.
+func coinTotal(coins []byzcoin.Coin, name byzcoin.InstanceID) (uint64, error) {
+	var total uint64
+	for _, c := range coins {
+		if c.Name.Equal(name) {
+			sum := byzcoin.Coin{Value: total}
+			err := sum.SafeAdd(c.Value)
+			if err != nil {
+				return 0, err
+			}
+			total = sum.Value
+		}
+	}
+	return total, nil
+}
+
+// coinAdd gives back coins to the output. The module can only pass on the
+// coins it received, so the output cannot hold more coins of a type than
+// the input.
+func (h *host) coinAdd(v *vm, args []uint64) ([]uint64, error) {
+	name := readInstanceID(v, args[0])
+	in, err := coinTotal(h.input, name)
+	if err != nil {
+		return nil, err
+	}
+	out, err := coinTotal(h.coins, name)
+	if err != nil {
+		return nil, err
+	}
+	if out > in || args[1] > in-out {
+		return nil, xerrors.Errorf("cannot output more coins than the input for %x", name.Slice())
+	}
+	for i := range h.coins {
+		if h.coins[i].Name.Equal(name) {
+			h.coins[i].Value += args[1]
+			return nil, nil
+		}
+	}
+	h.coins = append(h.coins, byzcoin.Coin{Name: name, Value: args[1]})
+	return nil, nil
+}
+
+func (h *host) coinSub(v *vm, args []uint64) ([]uint64, error) {
+	name := readInstanceID(v, args[0])
+	for i := range h.coins {
+		if h.coins[i].Name.Equal(name) && h.coins[i].Value >= args[1] {
+			h.coins[i].Value -= args[1]
+			return []uint64{0}, nil
+		}
+	}
+	return notFound, nil
+}
+
+func (h *host) abort(v *vm, args []uint64) ([]uint64, error) {
+	return nil, xerrors.Errorf("aborted: %s", input(v, args[0], args[1]))
+}
+
+func (h *host) log(v *vm, args []uint64) ([]uint64, error) {
+	log.Lvlf2("wasm contract %x: %s", h.instanceID.Slice(), input(v, args[0], args[1]))
+	return nil, nil
+}
@@ -0,0 +1,95 @@
+package bwasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+// testHostModule returns a module whose "change" function adds a state
+// change with the key at address 0 and the contract ID of the data, and
+// whose "mint" function gives one coin with the name at address 0.
+func testHostModule(contractID string) []byte {
+	return wasm(
+		section(1,
+			typeEntry(i32x6, nil),
+			typeEntry(i32i64, nil),
+			typeEntry(nil, nil),
+		),
+		section(2,
+			importEntry(HostModule, "state_change", 0),
+			importEntry(HostModule, "coin_add", 1),
+		),
+		section(3, leb(2), leb(2)),
+		section(5, []byte{0x00, 0x01}),
+		section(7,
+			exportEntry("change", 2),
+			exportEntry("mint", 3),
+		),
+		section(10,
+			bodyEntry(nil,
+				0x41, 0x02, // i32.const 2 (update)
+				0x41, 0x00, // i32.const 0 (key_ptr)
+				0x41, 0x20, // i32.const 32 (cid_ptr)
+				0x41, byte(len(contractID)), // i32.const (cid_len)
+				0x41, 0x00, // i32.const 0 (val_ptr)
+				0x41, 0x04, // i32.const 4 (val_len)
+				0x10, 0x00, // call state_change
+				0x0b, // end
+			),
+			bodyEntry(nil,
+				0x41, 0x00, // i32.const 0 (name_ptr)
+				0x42, 0x01, // i64.const 1
+				0x10, 0x01, // call coin_add
+				0x0b, // end
+			),
+		),
+		section(11, append([]byte{0x00, 0x41, 0x20, 0x0b}, nameEntry(contractID)...)),
+	)
+}
+
+func TestHost_StateChange(t *testing.T) {
+	m, err := decodeModule(testHostModule(ContractWasmID))
+	require.NoError(t, err)
+	iid := byzcoin.NewInstanceID([]byte("wasm instance"))
+	h := newHost(nil, nil, iid, darc.ID(iid.Slice()), nil)
+	require.NoError(t, h.execute(m, "change"))
+	require.Equal(t, 1, len(h.scs))
+	require.Equal(t, h.deriveID(make([]byte, 32)).Slice(), h.scs[0].InstanceID)
+	require.NotEqual(t, iid.Slice(), h.scs[0].InstanceID)
+
+	// A module cannot rewrite the instances of other contracts, such as a
+	// darc.
+	m, err = decodeModule(testHostModule(byzcoin.ContractDarcID))
+	require.NoError(t, err)
+	h = newHost(nil, nil, iid, darc.ID(iid.Slice()), nil)
+	err = h.execute(m, "change")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot change an instance of contract darc")
+	require.Empty(t, h.scs)
+}
+
+func TestHost_Coins(t *testing.T) {
+	m, err := decodeModule(testHostModule(ContractWasmID))
+	require.NoError(t, err)
+	iid := byzcoin.NewInstanceID([]byte("wasm instance"))
+	name := byzcoin.NewInstanceID(make([]byte, 32))
+
+	// Coins cannot be created.
+	h := newHost(nil, nil, iid, darc.ID(iid.Slice()), nil)
+	require.Error(t, h.execute(m, "mint"))
+	h = newHost(nil, nil, iid, darc.ID(iid.Slice()),
+		[]byzcoin.Coin{{Name: name, Value: 10}})
+	require.Error(t, h.execute(m, "mint"))
+	require.Equal(t, uint64(10), h.coins[0].Value)
+
+	// But the coins taken from the input can be given back.
+	h = newHost(nil, nil, iid, darc.ID(iid.Slice()),
+		[]byzcoin.Coin{{Name: name, Value: 10}})
+	h.coins[0].Value = 9
+	require.NoError(t, h.execute(m, "mint"))
+	require.Equal(t, uint64(10), h.coins[0].Value)
+	require.Error(t, h.execute(m, "mint"))
+}
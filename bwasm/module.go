@@ -0,0 +1,721 @@
+package bwasm
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/xerrors"
+)
+
+// Value types supported by the interpreter. Floating point numbers are not
+// supported as their results might depend on the platform.
+const (
+	valI32 byte = 0x7f
+	valI64 byte = 0x7e
+	// blockEmpty is the block type of a block without result.
+	blockEmpty byte = 0x40
+)
+
+// Limits applied to the modules when they are decoded.
+const (
+	maxFunctions = 4096
+	maxLocals    = 1024
+	maxGlobals   = 1024
+	maxExports   = 1024
+)
+
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+type funcType struct {
+	params  []byte
+	results []byte
+}
+
+type importFunc struct {
+	module string
+	name   string
+	typ    uint32
+}
+
+// blockInfo holds the positions of the else and end opcodes of a block, loop
+// or if, so that the interpreter can jump over them.
+type blockInfo struct {
+	elsePos int
+	endPos  int
+}
+
+type function struct {
+	typ    uint32
+	locals []byte
+	code   []byte
+	blocks map[int]blockInfo
+}
+
+type global struct {
+	typ     byte
+	mutable bool
+	value   uint64
+}
+
+type dataSegment struct {
+	offset uint32
+	data   []byte
+}
+
+// module is a decoded WebAssembly module. Only the subset of the
+// specification needed by the contracts is supported: one memory, integer
+// values, functions imported from the host and no tables.
+type module struct {
+	types   []funcType
+	imports []importFunc
+	funcs   []function
+	hasMem  bool
+	memMin  uint32
+	memMax  uint32
+	globals []global
+	exports map[string]uint32
+	data    []dataSegment
+}
+
+// funcType returns the type of the function with the given index, imported
+// functions coming first.
+func (m *module) funcType(idx uint32) (funcType, error) {
+	var typ uint32
+	switch {
+	case int(idx) < len(m.imports):
+		typ = m.imports[idx].typ
+	case int(idx) < len(m.imports)+len(m.funcs):
+		typ = m.funcs[int(idx)-len(m.imports)].typ
+	default:
+		return funcType{}, xerrors.Errorf("unknown function %d", idx)
+	}
+	return m.types[typ], nil
+}
+
+// exportType returns the type of the exported function.
+func (m *module) exportType(name string) (funcType, error) {
+	idx, ok := m.exports[name]
+	if !ok {
+		return funcType{}, xerrors.Errorf("unknown function %s", name)
+	}
+	return m.funcType(idx)
+}
+
+// decodeModule decodes and validates the binary format of a module.
+func decodeModule(code []byte) (*module, error) {
+	if !bytes.HasPrefix(code, wasmMagic) {
+		return nil, xerrors.New("not a wasm module of version 1")
+	}
+
+	m := &module{exports: make(map[string]uint32)}
+	r := &reader{buf: code, pos: len(wasmMagic)}
+	var funcTypes []uint32
+	lastID := byte(0)
+	for !r.eof() {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		content, err := r.bytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+		if id != 0 {
+			if id <= lastID {
+				return nil, xerrors.Errorf("section %d is out of order", id)
+			}
+			lastID = id
+		}
+
+		sr := &reader{buf: content}
+		switch id {
+		case 0, 12:
+			// Custom sections and the data count are ignored.
+			continue
+		case 1:
+			err = m.decodeTypes(sr)
+		case 2:
+			err = m.decodeImports(sr)
+		case 3:
+			funcTypes, err = m.decodeFunctions(sr)
+		case 5:
+			err = m.decodeMemory(sr)
+		case 6:
+			err = m.decodeGlobals(sr)
+		case 7:
+			err = m.decodeExports(sr)
+		case 10:
+			err = m.decodeCode(sr, funcTypes)
+		case 11:
+			err = m.decodeData(sr)
+		default:
+			return nil, xerrors.Errorf("section %d is not supported", id)
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("section %d: %v", id, err)
+		}
+		if !sr.eof() {
+			return nil, xerrors.Errorf("section %d is too long", id)
+		}
+	}
+
+	if len(funcTypes) != len(m.funcs) {
+		return nil, xerrors.New("function and code sections don't match")
+	}
+	for name, idx := range m.exports {
+		if int(idx) >= len(m.imports)+len(m.funcs) {
+			return nil, xerrors.Errorf("export %s of unknown function", name)
+		}
+	}
+	if len(m.data) > 0 && !m.hasMem {
+		return nil, xerrors.New("data segments without memory")
+	}
+	for i := range m.funcs {
+		err := m.scanFunction(&m.funcs[i])
+		if err != nil {
+			return nil, xerrors.Errorf("function %d: %v", len(m.imports)+i, err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *module) decodeTypes(r *reader) error {
+	n, err := r.count(maxFunctions)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		form, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return xerrors.New("invalid function type")
+		}
+		params, err := r.valueTypes()
+		if err != nil {
+			return err
+		}
+		results, err := r.valueTypes()
+		if err != nil {
+			return err
+		}
+		if len(results) > 1 {
+			return xerrors.New("multiple results are not supported")
+		}
+		m.types = append(m.types, funcType{params: params, results: results})
+	}
+	return nil
+}
+
+func (m *module) decodeImports(r *reader) error {
+	n, err := r.count(maxFunctions)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		mod, err := r.name()
+		if err != nil {
+			return err
+		}
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if kind != 0 {
+			return xerrors.Errorf("import %s.%s: only functions can be imported", mod, name)
+		}
+		typ, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if int(typ) >= len(m.types) {
+			return xerrors.Errorf("import %s.%s: unknown type", mod, name)
+		}
+		m.imports = append(m.imports, importFunc{module: mod, name: name, typ: typ})
+	}
+	return nil
+}
+
+func (m *module) decodeFunctions(r *reader) ([]uint32, error) {
+	n, err := r.count(maxFunctions)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]uint32, n)
+	for i := range types {
+		types[i], err = r.u32()
+		if err != nil {
+			return nil, err
+		}
+		if int(types[i]) >= len(m.types) {
+			return nil, xerrors.New("unknown type")
+		}
+	}
+	return types, nil
+}
+
+func (m *module) decodeMemory(r *reader) error {
+	n, err := r.count(1)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	flag, err := r.byte()
+	if err != nil {
+		return err
+	}
+	m.hasMem = true
+	m.memMin, err = r.u32()
+	if err != nil {
+		return err
+	}
+	m.memMax = maxPages
+	switch flag {
+	case 0:
+	case 1:
+		m.memMax, err = r.u32()
+		if err != nil {
+			return err
+		}
+		if m.memMax > maxPages {
+			m.memMax = maxPages
+		}
+	default:
+		return xerrors.New("invalid memory limits")
+	}
+	if m.memMin > m.memMax {
+		return xerrors.Errorf("memory of %d pages is too large", m.memMin)
+	}
+	return nil
+}
+
+func (m *module) decodeGlobals(r *reader) error {
+	n, err := r.count(maxGlobals)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		var g global
+		g.typ, err = r.valueType()
+		if err != nil {
+			return err
+		}
+		mut, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if mut > 1 {
+			return xerrors.New("invalid mutability")
+		}
+		g.mutable = mut == 1
+		g.value, err = r.constExpr(g.typ)
+		if err != nil {
+			return err
+		}
+		m.globals = append(m.globals, g)
+	}
+	return nil
+}
+
+func (m *module) decodeExports(r *reader) error {
+	n, err := r.count(maxExports)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		name, err := r.name()
+		if err != nil {
+			return err
+		}
+		kind, err := r.byte()
+		if err != nil {
+			return err
+		}
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		// Only the functions can be called by the contract, the other
+		// exports are ignored.
+		if kind == 0 {
+			if _, exists := m.exports[name]; exists {
+				return xerrors.Errorf("duplicate export %s", name)
+			}
+			m.exports[name] = idx
+		}
+	}
+	return nil
+}
+
+func (m *module) decodeCode(r *reader, types []uint32) error {
+	n, err := r.count(maxFunctions)
+	if err != nil {
+		return err
+	}
+	if n != len(types) {
+		return xerrors.New("function and code sections don't match")
+	}
+	for i := 0; i < n; i++ {
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		body, err := r.bytes(int(size))
+		if err != nil {
+			return err
+		}
+		br := &reader{buf: body}
+
+		f := function{typ: types[i]}
+		groups, err := br.count(maxLocals)
+		if err != nil {
+			return err
+		}
+		for j := 0; j < groups; j++ {
+			count, err := br.u32()
+			if err != nil {
+				return err
+			}
+			typ, err := br.valueType()
+			if err != nil {
+				return err
+			}
+			if len(f.locals)+int(count) > maxLocals {
+				return xerrors.New("too many locals")
+			}
+			for k := uint32(0); k < count; k++ {
+				f.locals = append(f.locals, typ)
+			}
+		}
+		f.code = body[br.pos:]
+		m.funcs = append(m.funcs, f)
+	}
+	return nil
+}
+
+func (m *module) decodeData(r *reader) error {
+	n, err := r.count(maxFunctions)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n; i++ {
+		flag, err := r.u32()
+		if err != nil {
+			return err
+		}
+		if flag != 0 {
+			return xerrors.New("only active data segments are supported")
+		}
+		offset, err := r.constExpr(valI32)
+		if err != nil {
+			return err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return err
+		}
+		data, err := r.bytes(int(size))
+		if err != nil {
+			return err
+		}
+		m.data = append(m.data, dataSegment{offset: uint32(offset), data: data})
+	}
+	return nil
+}
+
+// scanFunction goes through the instructions of the function to make sure
+// they are supported and to find the positions of the blocks.
+func (m *module) scanFunction(f *function) error {
+	f.blocks = make(map[int]blockInfo)
+	r := &reader{buf: f.code}
+	var open []int
+	numLocals := len(m.types[f.typ].params) + len(f.locals)
+
+	for !r.eof() {
+		pos := r.pos
+		op, _ := r.byte()
+
+		var err error
+		switch {
+		case op == 0x02 || op == 0x03 || op == 0x04:
+			var bt byte
+			bt, err = r.byte()
+			if err == nil && bt != blockEmpty && bt != valI32 && bt != valI64 {
+				err = xerrors.New("unsupported block type")
+			}
+			open = append(open, pos)
+			f.blocks[pos] = blockInfo{}
+		case op == 0x05:
+			if len(open) == 0 || f.code[open[len(open)-1]] != 0x04 {
+				return xerrors.New("else without if")
+			}
+			bi := f.blocks[open[len(open)-1]]
+			if bi.elsePos != 0 {
+				return xerrors.New("duplicate else")
+			}
+			bi.elsePos = pos
+			f.blocks[open[len(open)-1]] = bi
+		case op == 0x0b:
+			if len(open) == 0 {
+				if !r.eof() {
+					return xerrors.New("code after the end of the function")
+				}
+				return nil
+			}
+			bi := f.blocks[open[len(open)-1]]
+			bi.endPos = pos
+			f.blocks[open[len(open)-1]] = bi
+			open = open[:len(open)-1]
+		case op == 0x0c || op == 0x0d:
+			_, err = r.u32()
+		case op == 0x0e:
+			var n int
+			n, err = r.count(maxLocals)
+			for i := 0; i <= n && err == nil; i++ {
+				_, err = r.u32()
+			}
+		case op == 0x10:
+			var idx uint32
+			idx, err = r.u32()
+			if err == nil {
+				_, err = m.funcType(idx)
+			}
+		case op >= 0x20 && op <= 0x22:
+			var idx uint32
+			idx, err = r.u32()
+			if err == nil && int(idx) >= numLocals {
+				err = xerrors.Errorf("unknown local %d", idx)
+			}
+		case op == 0x23 || op == 0x24:
+			var idx uint32
+			idx, err = r.u32()
+			if err == nil && int(idx) >= len(m.globals) {
+				err = xerrors.Errorf("unknown global %d", idx)
+			}
+			if err == nil && op == 0x24 && !m.globals[idx].mutable {
+				err = xerrors.Errorf("global %d is immutable", idx)
+			}
+		case op >= 0x28 && op <= 0x3e:
+			if op == 0x2a || op == 0x2b || op == 0x38 || op == 0x39 {
+				return xerrors.New("floating point numbers are not supported")
+			}
+			if !m.hasMem {
+				return xerrors.New("memory access without memory")
+			}
+			_, err = r.u32()
+			if err == nil {
+				_, err = r.u32()
+			}
+		case op == 0x3f || op == 0x40:
+			if !m.hasMem {
+				return xerrors.New("memory access without memory")
+			}
+			var zero byte
+			zero, err = r.byte()
+			if err == nil && zero != 0 {
+				err = xerrors.New("invalid memory index")
+			}
+		case op == 0x41:
+			_, err = r.s32()
+		case op == 0x42:
+			_, err = r.s64()
+		case op == 0x00 || op == 0x01 || op == 0x0f || op == 0x1a || op == 0x1b:
+		case op >= 0x45 && op <= 0x5a:
+		case op >= 0x67 && op <= 0x8a:
+		case op == 0xa7 || op == 0xac || op == 0xad:
+		case op >= 0xc0 && op <= 0xc4:
+		default:
+			return xerrors.Errorf("unsupported instruction 0x%x", op)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return xerrors.New("missing end of function")
+}
+
+// reader decodes the primitive values of the binary format.
+type reader struct {
+	buf []byte
+	pos int
+}
+
+var errEOF = xerrors.New("unexpected end of module")
+
+func (r *reader) eof() bool {
+	return r.pos >= len(r.buf)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.eof() {
+		return 0, errEOF
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || len(r.buf)-r.pos < n {
+		return nil, errEOF
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// u32 decodes an unsigned LEB128 integer of at most 32 bits.
+func (r *reader) u32() (uint32, error) {
+	var v uint64
+	for shift := uint(0); shift < 35; shift += 7 {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if v > 0xffffffff {
+				return 0, xerrors.New("integer too large")
+			}
+			return uint32(v), nil
+		}
+	}
+	return 0, xerrors.New("integer too large")
+}
+
+// s32 decodes a signed LEB128 integer of at most 32 bits.
+func (r *reader) s32() (int32, error) {
+	v, err := r.signed(35)
+	if err != nil {
+		return 0, err
+	}
+	if v < -1<<31 || v > 1<<31-1 {
+		return 0, xerrors.New("integer too large")
+	}
+	return int32(v), nil
+}
+
+// s64 decodes a signed LEB128 integer of at most 64 bits.
+func (r *reader) s64() (int64, error) {
+	return r.signed(70)
+}
+
+func (r *reader) signed(maxBits uint) (int64, error) {
+	var v int64
+	var shift uint
+	for {
+		if shift >= maxBits {
+			return 0, xerrors.New("integer too large")
+		}
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		v |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			if shift < 64 && b&0x40 != 0 {
+				v |= -1 << shift
+			}
+			return v, nil
+		}
+	}
+}
+
+// count decodes the length of a vector and makes sure it is below the limit.
+func (r *reader) count(limit int) (int, error) {
+	n, err := r.u32()
+	if err != nil {
+		return 0, err
+	}
+	if int(n) > limit {
+		return 0, xerrors.Errorf("too many elements: %d > %d", n, limit)
+	}
+	return int(n), nil
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", xerrors.New("invalid name")
+	}
+	return string(b), nil
+}
+
+func (r *reader) valueType() (byte, error) {
+	t, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	if t != valI32 && t != valI64 {
+		return 0, xerrors.Errorf("unsupported value type 0x%x", t)
+	}
+	return t, nil
+}
+
+func (r *reader) valueTypes() ([]byte, error) {
+	n, err := r.count(maxLocals)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]byte, n)
+	for i := range types {
+		types[i], err = r.valueType()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return types, nil
+}
+
+// constExpr decodes the constant expression used to initialize globals and
+// the offsets of data segments.
+func (r *reader) constExpr(typ byte) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	switch {
+	case op == 0x41 && typ == valI32:
+		var c int32
+		c, err = r.s32()
+		v = uint64(uint32(c))
+	case op == 0x42 && typ == valI64:
+		var c int64
+		c, err = r.s64()
+		v = uint64(c)
+	default:
+		return 0, xerrors.New("unsupported constant expression")
+	}
+	if err != nil {
+		return 0, err
+	}
+	end, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	if end != 0x0b {
+		return 0, xerrors.New("unsupported constant expression")
+	}
+	return v, nil
+}
@@ -0,0 +1,155 @@
+package bwasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The helpers below assemble the binary format of small modules for the
+// tests.
+
+func leb(x uint32) []byte {
+	var out []byte
+	for {
+		b := byte(x & 0x7f)
+		x >>= 7
+		if x == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	out := leb(uint32(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func section(id byte, items ...[]byte) []byte {
+	content := vec(items...)
+	return append(append([]byte{id}, leb(uint32(len(content)))...), content...)
+}
+
+func wasm(sections ...[]byte) []byte {
+	out := append([]byte{}, wasmMagic...)
+	for _, s := range sections {
+		out = append(out, s...)
+	}
+	return out
+}
+
+func typeEntry(params, results []byte) []byte {
+	out := append([]byte{0x60}, leb(uint32(len(params)))...)
+	out = append(out, params...)
+	out = append(out, leb(uint32(len(results)))...)
+	return append(out, results...)
+}
+
+func nameEntry(s string) []byte {
+	return append(leb(uint32(len(s))), s...)
+}
+
+func importEntry(module, name string, typ uint32) []byte {
+	out := append(nameEntry(module), nameEntry(name)...)
+	return append(append(out, 0x00), leb(typ)...)
+}
+
+func exportEntry(name string, idx uint32) []byte {
+	return append(append(nameEntry(name), 0x00), leb(idx)...)
+}
+
+// bodyEntry returns the body of a function with one local of each of the
+// given types.
+func bodyEntry(locals []byte, code ...byte) []byte {
+	var groups [][]byte
+	for _, l := range locals {
+		groups = append(groups, []byte{1, l})
+	}
+	content := append(vec(groups...), code...)
+	return append(leb(uint32(len(content))), content...)
+}
+
+// singleFunc returns a module exporting one function with the given name.
+func singleFunc(name string, params, results, locals []byte, code ...byte) []byte {
+	return wasm(
+		section(1, typeEntry(params, results)),
+		section(3, leb(0)),
+		section(7, exportEntry(name, 0)),
+		section(10, bodyEntry(locals, code...)),
+	)
+}
+
+func TestModule_Decode(t *testing.T) {
+	code := wasm(
+		section(1, typeEntry([]byte{valI32, valI32}, []byte{valI32}), typeEntry(nil, nil)),
+		section(2, importEntry(HostModule, "add", 0)),
+		section(3, leb(1)),
+		section(5, []byte{0x01, 0x01, 0x02}),
+		section(6, []byte{valI32, 0x01, 0x41, 0x2a, 0x0b}),
+		section(7, exportEntry("run", 1)),
+		section(10, bodyEntry(nil, 0x0b)),
+		section(11, []byte{0x00, 0x41, 0x10, 0x0b, 0x02, 'h', 'i'}),
+	)
+	m, err := decodeModule(code)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(m.types))
+	require.Equal(t, 1, len(m.imports))
+	require.Equal(t, "add", m.imports[0].name)
+	require.Equal(t, 1, len(m.funcs))
+	require.True(t, m.hasMem)
+	require.Equal(t, uint32(1), m.memMin)
+	require.Equal(t, uint32(2), m.memMax)
+	require.Equal(t, 1, len(m.globals))
+	require.True(t, m.globals[0].mutable)
+	require.Equal(t, uint64(42), m.globals[0].value)
+	require.Equal(t, uint32(16), m.data[0].offset)
+	require.Equal(t, []byte("hi"), m.data[0].data)
+
+	typ, err := m.exportType("run")
+	require.NoError(t, err)
+	require.Empty(t, typ.params)
+	_, err = m.exportType("missing")
+	require.Error(t, err)
+}
+
+func TestModule_DecodeErrors(t *testing.T) {
+	_, err := decodeModule([]byte("not wasm"))
+	require.Error(t, err)
+
+	// Truncated module.
+	code := singleFunc("run", nil, nil, nil, 0x0b)
+	_, err = decodeModule(code[:len(code)-1])
+	require.Error(t, err)
+
+	// Floating point instructions are refused.
+	_, err = decodeModule(singleFunc("run", nil, nil, nil, 0x43, 0, 0, 0, 0, 0x1a, 0x0b))
+	require.Error(t, err)
+
+	// call_indirect is refused.
+	_, err = decodeModule(singleFunc("run", nil, nil, nil, 0x41, 0, 0x11, 0, 0, 0x0b))
+	require.Error(t, err)
+
+	// Tables are refused.
+	_, err = decodeModule(wasm(section(4, []byte{0x70, 0x00, 0x01})))
+	require.Error(t, err)
+
+	// Too much memory.
+	_, err = decodeModule(wasm(section(5, []byte{0x00, 0x11})))
+	require.Error(t, err)
+
+	// Sections out of order.
+	_, err = decodeModule(wasm(
+		section(3, leb(0)),
+		section(1, typeEntry(nil, nil)),
+		section(10, bodyEntry(nil, 0x0b)),
+	))
+	require.Error(t, err)
+
+	// Unbalanced blocks.
+	_, err = decodeModule(singleFunc("run", nil, nil, nil, 0x02, 0x40, 0x0b))
+	require.Error(t, err)
+}
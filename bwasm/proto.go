@@ -0,0 +1,14 @@
+package bwasm
+
+// PROTOSTART
+// package bwasm;
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "BWasmProto";
+
+// Instance is the value stored in a wasm instance: the WebAssembly module of
+// the contract and its state, which is only modified by the module.
+type Instance struct {
+	Code  []byte
+	State []byte
+}
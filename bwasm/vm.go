@@ -0,0 +1,718 @@
+package bwasm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// Limits of the execution of a contract.
+const (
+	pageSize     = 65536
+	maxPages     = 16
+	maxCallDepth = 256
+	maxStackSize = 64 * 1024
+)
+
+// Cost in gas of the operations. Every instruction costs one unit.
+const (
+	gasPage     = 1024
+	gasHostCall = 16
+)
+
+// ErrOutOfGas is returned when the execution of a contract uses more than the
+// gas it has been given.
+var ErrOutOfGas = xerrors.New("out of gas")
+
+// hostFunc is a function of the host that can be imported by the modules.
+type hostFunc struct {
+	params  []byte
+	results []byte
+	call    func(v *vm, args []uint64) ([]uint64, error)
+}
+
+// trap is used to stop the execution of the module from anywhere in the
+// interpreter. It is recovered by vm.invoke.
+type trap struct {
+	err error
+}
+
+func trapf(format string, args ...interface{}) {
+	panic(trap{xerrors.Errorf(format, args...)})
+}
+
+// vm is an instance of a module that can be executed. The execution is
+// deterministic: for the same module, host functions and gas, it always gives
+// the same result.
+type vm struct {
+	module  *module
+	memory  []byte
+	memMax  uint32
+	globals []uint64
+	host    []hostFunc
+	gas     uint64
+	depth   int
+	stack   []uint64
+}
+
+// newVM instantiates the module, resolving the imports with the host
+// functions.
+func newVM(m *module, host map[string]hostFunc, gas uint64) (*vm, error) {
+	v := &vm{
+		module: m,
+		gas:    gas,
+		memMax: m.memMax,
+	}
+
+	for _, imp := range m.imports {
+		f, ok := host[imp.module+"."+imp.name]
+		if !ok {
+			return nil, xerrors.Errorf("unknown import %s.%s", imp.module, imp.name)
+		}
+		typ := m.types[imp.typ]
+		if !bytes.Equal(typ.params, f.params) || !bytes.Equal(typ.results, f.results) {
+			return nil, xerrors.Errorf("wrong type for import %s.%s", imp.module, imp.name)
+		}
+		v.host = append(v.host, f)
+	}
+
+	if m.hasMem {
+		v.memory = make([]byte, int(m.memMin)*pageSize)
+	}
+	for _, d := range m.data {
+		end := uint64(d.offset) + uint64(len(d.data))
+		if end > uint64(len(v.memory)) {
+			return nil, xerrors.New("data segment out of memory")
+		}
+		copy(v.memory[d.offset:], d.data)
+	}
+
+	v.globals = make([]uint64, len(m.globals))
+	for i, g := range m.globals {
+		v.globals[i] = g.value
+	}
+
+	return v, nil
+}
+
+// invoke calls the exported function with the arguments and returns its
+// results.
+func (v *vm) invoke(name string, args ...uint64) (res []uint64, err error) {
+	typ, err := v.module.exportType(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(typ.params) {
+		return nil, xerrors.Errorf("function %s expects %d arguments", name, len(typ.params))
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(trap)
+			if !ok {
+				panic(r)
+			}
+			res = nil
+			err = t.err
+		}
+	}()
+
+	return v.call(v.module.exports[name], args), nil
+}
+
+func (v *vm) useGas(n uint64) {
+	if v.gas < n {
+		v.gas = 0
+		panic(trap{ErrOutOfGas})
+	}
+	v.gas -= n
+}
+
+// read returns a copy of the memory at the given position.
+func (v *vm) read(ptr, n uint32) []byte {
+	end := uint64(ptr) + uint64(n)
+	if end > uint64(len(v.memory)) {
+		trapf("memory access out of bounds")
+	}
+	return append([]byte{}, v.memory[ptr:end]...)
+}
+
+// write copies the data in the memory at the given position.
+func (v *vm) write(ptr uint32, data []byte) {
+	end := uint64(ptr) + uint64(len(data))
+	if end > uint64(len(v.memory)) {
+		trapf("memory access out of bounds")
+	}
+	copy(v.memory[ptr:], data)
+}
+
+// mem returns the slice of memory accessed by a load or a store.
+func (v *vm) mem(addr uint64, n uint64) []byte {
+	if addr+n > uint64(len(v.memory)) {
+		trapf("memory access out of bounds")
+	}
+	return v.memory[addr : addr+n]
+}
+
+func (v *vm) push(x uint64) {
+	if len(v.stack) >= maxStackSize {
+		trapf("stack overflow")
+	}
+	v.stack = append(v.stack, x)
+}
+
+func (v *vm) pop() uint64 {
+	if len(v.stack) == 0 {
+		trapf("stack underflow")
+	}
+	x := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	return x
+}
+
+func (v *vm) pop32() uint32 {
+	return uint32(v.pop())
+}
+
+func (v *vm) push32(x uint32) {
+	v.push(uint64(x))
+}
+
+func (v *vm) pushBool(b bool) {
+	if b {
+		v.push(1)
+	} else {
+		v.push(0)
+	}
+}
+
+// popN removes the n values at the top of the stack and returns them in the
+// order they were pushed.
+func (v *vm) popN(n int) []uint64 {
+	if len(v.stack) < n {
+		trapf("stack underflow")
+	}
+	vals := append([]uint64{}, v.stack[len(v.stack)-n:]...)
+	v.stack = v.stack[:len(v.stack)-n]
+	return vals
+}
+
+// call executes the function with the given index.
+func (v *vm) call(idx uint32, args []uint64) []uint64 {
+	typ, err := v.module.funcType(idx)
+	if err != nil {
+		panic(trap{err})
+	}
+
+	if int(idx) < len(v.module.imports) {
+		v.useGas(gasHostCall)
+		res, err := v.host[idx].call(v, args)
+		if err != nil {
+			panic(trap{err})
+		}
+		if len(res) != len(typ.results) {
+			trapf("host function returned %d values", len(res))
+		}
+		return res
+	}
+
+	v.depth++
+	if v.depth > maxCallDepth {
+		trapf("call stack exhausted")
+	}
+	defer func() { v.depth-- }()
+
+	f := &v.module.funcs[int(idx)-len(v.module.imports)]
+	locals := make([]uint64, len(typ.params)+len(f.locals))
+	copy(locals, args)
+	return v.run(f, locals, len(typ.results))
+}
+
+// label is the target of a branch.
+type label struct {
+	target int
+	arity  int
+	height int
+	loop   bool
+}
+
+// branch unwinds the stack to the label at the given depth and returns the
+// position to continue the execution at. The labels are updated.
+func (v *vm) branch(labels *[]label, depth uint32) int {
+	if int(depth) >= len(*labels) {
+		trapf("invalid branch depth")
+	}
+	l := (*labels)[len(*labels)-1-int(depth)]
+	arity := l.arity
+	if l.loop {
+		arity = 0
+	}
+	vals := v.popN(arity)
+	if len(v.stack) < l.height {
+		trapf("stack underflow")
+	}
+	v.stack = append(v.stack[:l.height], vals...)
+
+	if l.loop {
+		// The loop label stays as the loop starts again.
+		*labels = (*labels)[:len(*labels)-int(depth)]
+	} else {
+		*labels = (*labels)[:len(*labels)-1-int(depth)]
+	}
+	return l.target
+}
+
+func readU32(code []byte, pc *int) uint32 {
+	r := reader{buf: code, pos: *pc}
+	x, err := r.u32()
+	if err != nil {
+		panic(trap{err})
+	}
+	*pc = r.pos
+	return x
+}
+
+// memArg reads the immediates of a load or a store and returns the effective
+// address.
+func (v *vm) memArg(code []byte, pc *int) uint64 {
+	readU32(code, pc)
+	offset := readU32(code, pc)
+	return uint64(v.pop32()) + uint64(offset)
+}
+
+// run executes the code of a function. The instructions have been checked
+// by scanFunction so only the dynamic errors are detected here.
+func (v *vm) run(f *function, locals []uint64, arity int) []uint64 {
+	code := f.code
+	base := len(v.stack)
+	labels := []label{{target: len(code), arity: arity, height: base}}
+	pc := 0
+
+	for {
+		v.useGas(1)
+		if pc >= len(code) {
+			trapf("missing end of function")
+		}
+		op := code[pc]
+		pc++
+
+		switch op {
+		case 0x00:
+			trapf("unreachable")
+		case 0x01:
+		case 0x02, 0x03:
+			bi := f.blocks[pc-1]
+			bt := code[pc]
+			pc++
+			l := label{height: len(v.stack)}
+			if bt != blockEmpty {
+				l.arity = 1
+			}
+			if op == 0x03 {
+				l.loop = true
+				l.target = pc
+			} else {
+				l.target = bi.endPos + 1
+			}
+			labels = append(labels, l)
+		case 0x04:
+			bi := f.blocks[pc-1]
+			bt := code[pc]
+			pc++
+			l := label{height: len(v.stack) - 1, target: bi.endPos + 1}
+			if bt != blockEmpty {
+				l.arity = 1
+			}
+			if v.pop32() != 0 {
+				labels = append(labels, l)
+			} else if bi.elsePos != 0 {
+				labels = append(labels, l)
+				pc = bi.elsePos + 1
+			} else {
+				pc = bi.endPos + 1
+			}
+		case 0x05:
+			// The end of the then branch of an if.
+			l := labels[len(labels)-1]
+			labels = labels[:len(labels)-1]
+			pc = l.target
+		case 0x0b:
+			if len(labels) == 1 {
+				return v.ret(base, arity)
+			}
+			labels = labels[:len(labels)-1]
+		case 0x0c:
+			depth := readU32(code, &pc)
+			if int(depth) == len(labels)-1 {
+				return v.ret(base, arity)
+			}
+			pc = v.branch(&labels, depth)
+		case 0x0d:
+			depth := readU32(code, &pc)
+			if v.pop32() != 0 {
+				if int(depth) == len(labels)-1 {
+					return v.ret(base, arity)
+				}
+				pc = v.branch(&labels, depth)
+			}
+		case 0x0e:
+			n := readU32(code, &pc)
+			targets := make([]uint32, n+1)
+			for i := range targets {
+				targets[i] = readU32(code, &pc)
+			}
+			i := v.pop32()
+			if i > n {
+				i = n
+			}
+			depth := targets[i]
+			if int(depth) == len(labels)-1 {
+				return v.ret(base, arity)
+			}
+			pc = v.branch(&labels, depth)
+		case 0x0f:
+			return v.ret(base, arity)
+		case 0x10:
+			idx := readU32(code, &pc)
+			typ, err := v.module.funcType(idx)
+			if err != nil {
+				panic(trap{err})
+			}
+			args := v.popN(len(typ.params))
+			for _, r := range v.call(idx, args) {
+				v.push(r)
+			}
+		case 0x1a:
+			v.pop()
+		case 0x1b:
+			c := v.pop32()
+			b := v.pop()
+			a := v.pop()
+			if c != 0 {
+				v.push(a)
+			} else {
+				v.push(b)
+			}
+		case 0x20:
+			v.push(locals[readU32(code, &pc)])
+		case 0x21:
+			locals[readU32(code, &pc)] = v.pop()
+		case 0x22:
+			x := v.pop()
+			v.push(x)
+			locals[readU32(code, &pc)] = x
+		case 0x23:
+			v.push(v.globals[readU32(code, &pc)])
+		case 0x24:
+			v.globals[readU32(code, &pc)] = v.pop()
+		case 0x28:
+			v.push32(binary.LittleEndian.Uint32(v.mem(v.memArg(code, &pc), 4)))
+		case 0x29:
+			v.push(binary.LittleEndian.Uint64(v.mem(v.memArg(code, &pc), 8)))
+		case 0x2c:
+			v.push32(uint32(int32(int8(v.mem(v.memArg(code, &pc), 1)[0]))))
+		case 0x2d:
+			v.push32(uint32(v.mem(v.memArg(code, &pc), 1)[0]))
+		case 0x2e:
+			v.push32(uint32(int32(int16(binary.LittleEndian.Uint16(v.mem(v.memArg(code, &pc), 2))))))
+		case 0x2f:
+			v.push32(uint32(binary.LittleEndian.Uint16(v.mem(v.memArg(code, &pc), 2))))
+		case 0x30:
+			v.push(uint64(int64(int8(v.mem(v.memArg(code, &pc), 1)[0]))))
+		case 0x31:
+			v.push(uint64(v.mem(v.memArg(code, &pc), 1)[0]))
+		case 0x32:
+			v.push(uint64(int64(int16(binary.LittleEndian.Uint16(v.mem(v.memArg(code, &pc), 2))))))
+		case 0x33:
+			v.push(uint64(binary.LittleEndian.Uint16(v.mem(v.memArg(code, &pc), 2))))
+		case 0x34:
+			v.push(uint64(int64(int32(binary.LittleEndian.Uint32(v.mem(v.memArg(code, &pc), 4))))))
+		case 0x35:
+			v.push(uint64(binary.LittleEndian.Uint32(v.mem(v.memArg(code, &pc), 4))))
+		case 0x36, 0x37, 0x3a, 0x3b, 0x3c, 0x3d, 0x3e:
+			x := v.pop()
+			addr := v.memArg(code, &pc)
+			switch op {
+			case 0x36, 0x3e:
+				binary.LittleEndian.PutUint32(v.mem(addr, 4), uint32(x))
+			case 0x37:
+				binary.LittleEndian.PutUint64(v.mem(addr, 8), x)
+			case 0x3a, 0x3c:
+				v.mem(addr, 1)[0] = byte(x)
+			case 0x3b, 0x3d:
+				binary.LittleEndian.PutUint16(v.mem(addr, 2), uint16(x))
+			}
+		case 0x3f:
+			pc++
+			v.push32(uint32(len(v.memory) / pageSize))
+		case 0x40:
+			pc++
+			n := v.pop32()
+			old := uint32(len(v.memory) / pageSize)
+			if uint64(old)+uint64(n) > uint64(v.memMax) {
+				v.push32(math.MaxUint32)
+				break
+			}
+			v.useGas(uint64(n) * gasPage)
+			v.memory = append(v.memory, make([]byte, int(n)*pageSize)...)
+			v.push32(old)
+		case 0x41:
+			r := reader{buf: code, pos: pc}
+			c, err := r.s32()
+			if err != nil {
+				panic(trap{err})
+			}
+			pc = r.pos
+			v.push32(uint32(c))
+		case 0x42:
+			r := reader{buf: code, pos: pc}
+			c, err := r.s64()
+			if err != nil {
+				panic(trap{err})
+			}
+			pc = r.pos
+			v.push(uint64(c))
+		case 0xa7:
+			v.push32(uint32(v.pop()))
+		case 0xac:
+			v.push(uint64(int64(int32(v.pop32()))))
+		case 0xad:
+			v.push(uint64(v.pop32()))
+		case 0xc0:
+			v.push32(uint32(int32(int8(v.pop32()))))
+		case 0xc1:
+			v.push32(uint32(int32(int16(v.pop32()))))
+		case 0xc2:
+			v.push(uint64(int64(int8(v.pop()))))
+		case 0xc3:
+			v.push(uint64(int64(int16(v.pop()))))
+		case 0xc4:
+			v.push(uint64(int64(int32(v.pop()))))
+		default:
+			switch {
+			case op >= 0x45 && op <= 0x4f:
+				v.compare32(op)
+			case op >= 0x50 && op <= 0x5a:
+				v.compare64(op)
+			case op >= 0x67 && op <= 0x78:
+				v.arith32(op)
+			case op >= 0x79 && op <= 0x8a:
+				v.arith64(op)
+			default:
+				trapf("unsupported instruction 0x%x", op)
+			}
+		}
+	}
+}
+
+// ret returns the results of the function and restores the stack of the
+// caller.
+func (v *vm) ret(base, arity int) []uint64 {
+	res := v.popN(arity)
+	if len(v.stack) < base {
+		trapf("stack underflow")
+	}
+	v.stack = v.stack[:base]
+	return res
+}
+
+func (v *vm) compare32(op byte) {
+	if op == 0x45 {
+		v.pushBool(v.pop32() == 0)
+		return
+	}
+	b := v.pop32()
+	a := v.pop32()
+	switch op {
+	case 0x46:
+		v.pushBool(a == b)
+	case 0x47:
+		v.pushBool(a != b)
+	case 0x48:
+		v.pushBool(int32(a) < int32(b))
+	case 0x49:
+		v.pushBool(a < b)
+	case 0x4a:
+		v.pushBool(int32(a) > int32(b))
+	case 0x4b:
+		v.pushBool(a > b)
+	case 0x4c:
+		v.pushBool(int32(a) <= int32(b))
+	case 0x4d:
+		v.pushBool(a <= b)
+	case 0x4e:
+		v.pushBool(int32(a) >= int32(b))
+	case 0x4f:
+		v.pushBool(a >= b)
+	}
+}
+
+func (v *vm) compare64(op byte) {
+	if op == 0x50 {
+		v.pushBool(v.pop() == 0)
+		return
+	}
+	b := v.pop()
+	a := v.pop()
+	switch op {
+	case 0x51:
+		v.pushBool(a == b)
+	case 0x52:
+		v.pushBool(a != b)
+	case 0x53:
+		v.pushBool(int64(a) < int64(b))
+	case 0x54:
+		v.pushBool(a < b)
+	case 0x55:
+		v.pushBool(int64(a) > int64(b))
+	case 0x56:
+		v.pushBool(a > b)
+	case 0x57:
+		v.pushBool(int64(a) <= int64(b))
+	case 0x58:
+		v.pushBool(a <= b)
+	case 0x59:
+		v.pushBool(int64(a) >= int64(b))
+	case 0x5a:
+		v.pushBool(a >= b)
+	}
+}
+
+func (v *vm) arith32(op byte) {
+	switch op {
+	case 0x67:
+		v.push32(uint32(bits.LeadingZeros32(v.pop32())))
+		return
+	case 0x68:
+		v.push32(uint32(bits.TrailingZeros32(v.pop32())))
+		return
+	case 0x69:
+		v.push32(uint32(bits.OnesCount32(v.pop32())))
+		return
+	}
+
+	b := v.pop32()
+	a := v.pop32()
+	switch op {
+	case 0x6a:
+		v.push32(a + b)
+	case 0x6b:
+		v.push32(a - b)
+	case 0x6c:
+		v.push32(a * b)
+	case 0x6d:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			trapf("integer overflow")
+		}
+		v.push32(uint32(int32(a) / int32(b)))
+	case 0x6e:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		v.push32(a / b)
+	case 0x6f:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		if int32(b) == -1 {
+			v.push32(0)
+		} else {
+			v.push32(uint32(int32(a) % int32(b)))
+		}
+	case 0x70:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		v.push32(a % b)
+	case 0x71:
+		v.push32(a & b)
+	case 0x72:
+		v.push32(a | b)
+	case 0x73:
+		v.push32(a ^ b)
+	case 0x74:
+		v.push32(a << (b % 32))
+	case 0x75:
+		v.push32(uint32(int32(a) >> (b % 32)))
+	case 0x76:
+		v.push32(a >> (b % 32))
+	case 0x77:
+		v.push32(bits.RotateLeft32(a, int(b%32)))
+	case 0x78:
+		v.push32(bits.RotateLeft32(a, -int(b%32)))
+	}
+}
+
+func (v *vm) arith64(op byte) {
+	switch op {
+	case 0x79:
+		v.push(uint64(bits.LeadingZeros64(v.pop())))
+		return
+	case 0x7a:
+		v.push(uint64(bits.TrailingZeros64(v.pop())))
+		return
+	case 0x7b:
+		v.push(uint64(bits.OnesCount64(v.pop())))
+		return
+	}
+
+	b := v.pop()
+	a := v.pop()
+	switch op {
+	case 0x7c:
+		v.push(a + b)
+	case 0x7d:
+		v.push(a - b)
+	case 0x7e:
+		v.push(a * b)
+	case 0x7f:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			trapf("integer overflow")
+		}
+		v.push(uint64(int64(a) / int64(b)))
+	case 0x80:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		v.push(a / b)
+	case 0x81:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		if int64(b) == -1 {
+			v.push(0)
+		} else {
+			v.push(uint64(int64(a) % int64(b)))
+		}
+	case 0x82:
+		if b == 0 {
+			trapf("integer divide by zero")
+		}
+		v.push(a % b)
+	case 0x83:
+		v.push(a & b)
+	case 0x84:
+		v.push(a | b)
+	case 0x85:
+		v.push(a ^ b)
+	case 0x86:
+		v.push(a << (b % 64))
+	case 0x87:
+		v.push(uint64(int64(a) >> (b % 64)))
+	case 0x88:
+		v.push(a >> (b % 64))
+	case 0x89:
+		v.push(bits.RotateLeft64(a, int(b%64)))
+	case 0x8a:
+		v.push(bits.RotateLeft64(a, -int(b%64)))
+	}
+}
@@ -0,0 +1,215 @@
+package bwasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func newTestVM(t *testing.T, code []byte, host map[string]hostFunc, gas uint64) *vm {
+	m, err := decodeModule(code)
+	require.NoError(t, err)
+	v, err := newVM(m, host, gas)
+	require.NoError(t, err)
+	return v
+}
+
+func TestVM_Factorial(t *testing.T) {
+	// Recursive factorial with if/else and i64 arithmetic.
+	code := singleFunc("fac", []byte{valI64}, []byte{valI64}, nil,
+		0x20, 0x00, // local.get 0
+		0x50,       // i64.eqz
+		0x04, 0x7e, // if (result i64)
+		0x42, 0x01, // i64.const 1
+		0x05,       // else
+		0x20, 0x00, // local.get 0
+		0x20, 0x00, // local.get 0
+		0x42, 0x01, // i64.const 1
+		0x7d,       // i64.sub
+		0x10, 0x00, // call 0
+		0x7e, // i64.mul
+		0x0b, // end
+		0x0b, // end
+	)
+	v := newTestVM(t, code, nil, GasLimit)
+	res, err := v.invoke("fac", 20)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2432902008176640000}, res)
+
+	_, err = v.invoke("fac")
+	require.Error(t, err)
+	_, err = v.invoke("missing")
+	require.Error(t, err)
+}
+
+func TestVM_Loop(t *testing.T) {
+	// Sum of the numbers from 1 to n with block, loop and br_if.
+	code := singleFunc("sum", []byte{valI32}, []byte{valI32}, []byte{valI32},
+		0x02, 0x40, // block
+		0x03, 0x40, // loop
+		0x20, 0x00, // local.get 0
+		0x45,       // i32.eqz
+		0x0d, 0x01, // br_if 1
+		0x20, 0x01, // local.get 1
+		0x20, 0x00, // local.get 0
+		0x6a,       // i32.add
+		0x21, 0x01, // local.set 1
+		0x20, 0x00, // local.get 0
+		0x41, 0x01, // i32.const 1
+		0x6b,       // i32.sub
+		0x21, 0x00, // local.set 0
+		0x0c, 0x00, // br 0
+		0x0b,       // end
+		0x0b,       // end
+		0x20, 0x01, // local.get 1
+		0x0b, // end
+	)
+	v := newTestVM(t, code, nil, GasLimit)
+	res, err := v.invoke("sum", 100)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{5050}, res)
+
+	// The same execution always uses the same gas.
+	used := GasLimit - v.gas
+	v = newTestVM(t, code, nil, GasLimit)
+	_, err = v.invoke("sum", 100)
+	require.NoError(t, err)
+	require.Equal(t, used, GasLimit-v.gas)
+
+	v = newTestVM(t, code, nil, used-1)
+	_, err = v.invoke("sum", 100)
+	require.True(t, xerrors.Is(err, ErrOutOfGas))
+}
+
+func TestVM_BrTable(t *testing.T) {
+	code := singleFunc("switch", []byte{valI32}, []byte{valI32}, nil,
+		0x02, 0x40, 0x02, 0x40, 0x02, 0x40, // block block block
+		0x20, 0x00, // local.get 0
+		0x0e, 0x02, 0x00, 0x01, 0x02, // br_table 0 1 2
+		0x0b,             // end
+		0x41, 0x0a, 0x0f, // i32.const 10 return
+		0x0b,             // end
+		0x41, 0x14, 0x0f, // i32.const 20 return
+		0x0b,       // end
+		0x41, 0x1e, // i32.const 30
+		0x0b, // end
+	)
+	v := newTestVM(t, code, nil, GasLimit)
+	for in, out := range map[uint64]uint64{0: 10, 1: 20, 2: 30, 5: 30} {
+		res, err := v.invoke("switch", in)
+		require.NoError(t, err)
+		require.Equal(t, []uint64{out}, res)
+	}
+}
+
+func TestVM_Memory(t *testing.T) {
+	// Stores the argument at address 32 and returns the sum of the byte at
+	// address 16, initialized by the data segment, and the stored value.
+	code := wasm(
+		section(1, typeEntry([]byte{valI32}, []byte{valI32})),
+		section(3, leb(0)),
+		section(5, []byte{0x00, 0x01}),
+		section(7, exportEntry("mem", 0)),
+		section(10, bodyEntry(nil,
+			0x41, 0x20, // i32.const 32
+			0x20, 0x00, // local.get 0
+			0x36, 0x02, 0x00, // i32.store
+			0x41, 0x10, // i32.const 16
+			0x2d, 0x00, 0x00, // i32.load8_u
+			0x41, 0x20, // i32.const 32
+			0x28, 0x02, 0x00, // i32.load
+			0x6a, // i32.add
+			0x0b, // end
+		)),
+		section(11, []byte{0x00, 0x41, 0x10, 0x0b, 0x01, 0x07}),
+	)
+	v := newTestVM(t, code, nil, GasLimit)
+	res, err := v.invoke("mem", 1000)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1007}, res)
+	require.Equal(t, []byte{0xe8, 0x03, 0, 0}, v.read(32, 4))
+}
+
+func TestVM_Traps(t *testing.T) {
+	code := singleFunc("div", []byte{valI32}, []byte{valI32}, nil,
+		0x41, 0x01, // i32.const 1
+		0x20, 0x00, // local.get 0
+		0x6d, // i32.div_s
+		0x0b, // end
+	)
+	v := newTestVM(t, code, nil, GasLimit)
+	res, err := v.invoke("div", 1)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1}, res)
+	_, err = v.invoke("div", 0)
+	require.Error(t, err)
+
+	code = singleFunc("run", nil, nil, nil, 0x00, 0x0b)
+	_, err = newTestVM(t, code, nil, GasLimit).invoke("run")
+	require.Error(t, err)
+
+	// Load out of the memory.
+	code = wasm(
+		section(1, typeEntry(nil, nil)),
+		section(3, leb(0)),
+		section(5, []byte{0x00, 0x01}),
+		section(7, exportEntry("run", 0)),
+		section(10, bodyEntry(nil,
+			0x41, 0xfe, 0xff, 0x03, // i32.const 65534
+			0x28, 0x02, 0x00, // i32.load
+			0x1a, // drop
+			0x0b, // end
+		)),
+	)
+	_, err = newTestVM(t, code, nil, GasLimit).invoke("run")
+	require.Error(t, err)
+
+	// Infinite loop.
+	code = singleFunc("run", nil, nil, nil, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b)
+	_, err = newTestVM(t, code, nil, GasLimit).invoke("run")
+	require.True(t, xerrors.Is(err, ErrOutOfGas))
+
+	// Infinite recursion.
+	code = singleFunc("run", nil, nil, nil, 0x10, 0x00, 0x0b)
+	_, err = newTestVM(t, code, nil, GasLimit).invoke("run")
+	require.Error(t, err)
+}
+
+func TestVM_Host(t *testing.T) {
+	code := wasm(
+		section(1, typeEntry([]byte{valI32, valI32}, []byte{valI32})),
+		section(2, importEntry(HostModule, "add", 0)),
+		section(3, leb(0)),
+		section(7, exportEntry("run", 1)),
+		section(10, bodyEntry(nil,
+			0x20, 0x00, 0x20, 0x01, // local.get 0, local.get 1
+			0x10, 0x00, // call 0
+			0x0b, // end
+		)),
+	)
+	m, err := decodeModule(code)
+	require.NoError(t, err)
+
+	_, err = newVM(m, nil, GasLimit)
+	require.Error(t, err)
+	_, err = newVM(m, map[string]hostFunc{
+		HostModule + ".add": {i32x1, i32x1, nil},
+	}, GasLimit)
+	require.Error(t, err)
+
+	v, err := newVM(m, map[string]hostFunc{
+		HostModule + ".add": {i32x2, i32x1, func(v *vm, args []uint64) ([]uint64, error) {
+			if args[1] == 0 {
+				return nil, xerrors.New("zero")
+			}
+			return []uint64{uint64(uint32(args[0] + args[1]))}, nil
+		}},
+	}, GasLimit)
+	require.NoError(t, err)
+	res, err := v.invoke("run", 40, 2)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{42}, res)
+	_, err = v.invoke("run", 40, 0)
+	require.Error(t, err)
+}
@@ -10,6 +10,7 @@ import (
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/cothority/v3/darc/expression"
 	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/sign/schnorr"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -653,6 +654,306 @@ func (c *Client) ResolveInstanceID(darcID darc.ID, name string) (InstanceID, err
 	return reply.InstanceID, cothority.ErrorOrNil(err, "request failed")
 }
 
+// ListNames returns the names given under the darc with the naming contract.
+// If the prefix is not empty, only the names equal to it or below it in the
+// hierarchy are returned: the prefix "team" matches "team" and
+// "team.project" but not "teammate".
+func (c *Client) ListNames(darcID darc.ID, prefix string) ([]NamedInstance, error) {
+	req := ListNames{
+		SkipChainID: c.ID,
+		DarcID:      darcID,
+		Prefix:      prefix,
+	}
+	reply := ListNamesResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return reply.Names, cothority.ErrorOrNil(err, "request failed")
+}
+
+// ResolveNames returns the names given to the instance with the naming
+// contract. It is the reverse of ResolveInstanceID.
+func (c *Client) ResolveNames(id InstanceID) ([]NamedInstance, error) {
+	req := ResolveNames{
+		SkipChainID: c.ID,
+		InstanceID:  id,
+	}
+	reply := ResolvedNames{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return reply.Names, cothority.ErrorOrNil(err, "request failed")
+}
+
+// GetLogEntry returns the entry at the index of the log instance. The proof
+// of its inclusion in the log is verified.
+func (c *Client) GetLogEntry(logID InstanceID, index uint64) (*GetLogEntryResponse, error) {
+	req := GetLogEntry{
+		SkipChainID: c.ID,
+		LogID:       logID,
+		Index:       index,
+	}
+	reply := GetLogEntryResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	if err != nil {
+		return nil, xerrors.Errorf("request failed: %v", err)
+	}
+
+	err = reply.Verify(c.ID, logID, index)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid entry: %v", err)
+	}
+	return &reply, nil
+}
+
+// GetAbsenceProof returns a proof starting from the genesis block that the
+// key is absent from the global state of the block at the index. It returns
+// an error if the key exists. The global states of the older blocks are
+// rebuilt from the history of the state changes, so only the absence in the
+// latest blocks can be proven.
+func (c *Client) GetAbsenceProof(key []byte, index int) (*GetProofResponse, error) {
+	if c.Genesis == nil {
+		if err := c.fetchGenesis(); err != nil {
+			return nil, xerrors.Errorf("fetching genesis block: %v", err)
+		}
+	}
+
+	req := GetAbsenceProof{
+		ID:    c.Genesis.Hash,
+		Key:   key,
+		Index: index,
+	}
+	reply := GetProofResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	if err != nil {
+		return nil, xerrors.Errorf("request failed: %v", err)
+	}
+
+	err = reply.Proof.VerifyFromBlock(c.Genesis)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid proof: %v", err)
+	}
+	if reply.Proof.Latest.Index != index {
+		return nil, xerrors.Errorf("proof is for block %d instead of %d",
+			reply.Proof.Latest.Index, index)
+	}
+	err = reply.Proof.VerifyAbsence(key)
+	if err != nil {
+		return nil, xerrors.Errorf("verifying absence: %v", err)
+	}
+	return &reply, nil
+}
+
+// GetDeletionProof returns the proof starting from the genesis block that
+// the instance has been removed in a block and is still absent from the
+// global state. The proof is verified.
+func (c *Client) GetDeletionProof(id InstanceID) (*GetDeletionProofResponse, error) {
+	if c.Genesis == nil {
+		if err := c.fetchGenesis(); err != nil {
+			return nil, xerrors.Errorf("fetching genesis block: %v", err)
+		}
+	}
+
+	req := GetDeletionProof{
+		ID:         c.Genesis.Hash,
+		InstanceID: id,
+	}
+	reply := GetDeletionProofResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	if err != nil {
+		return nil, xerrors.Errorf("request failed: %v", err)
+	}
+
+	err = reply.Proof.VerifyFromBlock(c.Genesis, id)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid proof: %v", err)
+	}
+	return &reply, nil
+}
+
+// GetStateDiff returns the instances which differ between the global states
+// of the blocks at the indexes from and to, as seen by one of the nodes of the
+// roster. Use UseNode to choose which node is asked, e.g., to compare the
+// states of nodes which disagree. As rebuilding old states is expensive, the
+// request is signed with private, which must be the private key of a member
+// of the roster of the latest block.
+func (c *Client) GetStateDiff(from, to int, private kyber.Scalar) (*GetStateDiffResponse, error) {
+	req := GetStateDiff{
+		ID:        c.ID,
+		From:      from,
+		To:        to,
+		Timestamp: time.Now().UnixNano(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, private, req.Hash())
+	if err != nil {
+		return nil, xerrors.Errorf("sign error: %v", err)
+	}
+	req.Signature = sig
+	reply := GetStateDiffResponse{}
+
+	_, err = c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// CheckRosterConsistency asks the node to compare the global states of all
+// the members of the roster at the block at the index, or the latest block if
+// index is negative. As the verification loads the whole roster, the request
+// is signed with the private key of the node, so si must hold it, as when it
+// is read from the private.toml of the node.
+func CheckRosterConsistency(si *network.ServerIdentity, byzcoinID skipchain.SkipBlockID,
+	index int) (*VerifyRosterConsistencyResponse, error) {
+	req := &VerifyRosterConsistency{
+		ID:        byzcoinID,
+		Index:     index,
+		Timestamp: time.Now().UnixNano(),
+	}
+	sig, err := schnorr.Sign(cothority.Suite, si.GetPrivate(), req.Hash())
+	if err != nil {
+		return nil, xerrors.Errorf("sign error: %v", err)
+	}
+	req.Signature = sig
+	reply := &VerifyRosterConsistencyResponse{}
+	err = onet.NewClient(cothority.Suite, ServiceName).SendProtobuf(si, req, reply)
+	return reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// GetChainHealth returns the health metrics of the chain, as seen by one of
+// the nodes of the roster. Use UseNode to choose which node is asked. The
+// statistics are computed over the latest blocks, or the default window if
+// blocks is 0.
+func (c *Client) GetChainHealth(blocks int) (*GetChainHealthResponse, error) {
+	req := GetChainHealth{
+		ByzCoinID: c.ID,
+		Blocks:    blocks,
+	}
+	reply := GetChainHealthResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// GetTxTrace returns the spans recorded by the members of the roster during
+// the lifecycle of the transaction. The hash is the one returned by
+// ClientTransaction.Instructions.Hash.
+func (c *Client) GetTxTrace(txHash []byte) (*GetTxTraceResponse, error) {
+	req := GetTxTrace{
+		ByzCoinID: c.ID,
+		TxHash:    txHash,
+	}
+	reply := GetTxTraceResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// ProposeDeferred registers the deferred instance in the signature collection
+// service of the nodes, so that the co-signers can submit their signatures
+// with AddDeferredSignature instead of invoking addProof.
+func (c *Client) ProposeDeferred(id InstanceID) (*DeferredProposalResponse, error) {
+	req := ProposeDeferred{
+		ByzCoinID:  c.ID,
+		InstanceID: id,
+	}
+	reply := DeferredProposalResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// GetDeferredProposal returns the signatures collected off-chain for the
+// deferred instance.
+func (c *Client) GetDeferredProposal(id InstanceID) (*DeferredProposalResponse, error) {
+	req := GetDeferredProposal{
+		ByzCoinID:  c.ID,
+		InstanceID: id,
+	}
+	reply := DeferredProposalResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// AddDeferredSignature signs the instruction with the given index of the
+// proposed transaction and submits the signature to the signature collection
+// service.
+func (c *Client) AddDeferredSignature(id InstanceID, hash []byte, index uint32, signer darc.Signer) (*DeferredProposalResponse, error) {
+	signature, err := signer.Sign(hash)
+	if err != nil {
+		return nil, xerrors.Errorf("signing: %v", err)
+	}
+	req := AddDeferredSignature{
+		ByzCoinID:  c.ID,
+		InstanceID: id,
+		Proof: DeferredProof{
+			Index:     index,
+			Identity:  signer.Identity(),
+			Signature: signature,
+		},
+	}
+	reply := DeferredProposalResponse{}
+
+	_, err = c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// GetPendingDeferred returns the deferred instances waiting for the signature
+// of the identity.
+func (c *Client) GetPendingDeferred(id darc.Identity) (*GetPendingDeferredResponse, error) {
+	req := GetPendingDeferred{
+		ByzCoinID: c.ID,
+		Identity:  id,
+	}
+	reply := GetPendingDeferredResponse{}
+
+	_, err := c.SendProtobufParallel(c.Roster.List, &req, &reply, c.options)
+	return &reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// StreamPendingDeferred sends a streaming request for the deferred instances
+// waiting for the signature of the identity. The handler is called with the
+// current list, and then each time it changes. This function blocks until
+// the client or the service stops the streaming.
+//
+// It contacts any random node by default. A specific node can be chosen by
+// using `c.UseNode`.
+func (c *Client) StreamPendingDeferred(id darc.Identity, handler func(GetPendingDeferredResponse, error)) error {
+	req := StreamPendingDeferred{
+		ByzCoinID: c.ID,
+		Identity:  id,
+	}
+	n := int(rand.Int31n(int32(len(c.Roster.List))))
+	if c.options != nil {
+		if c.options.DontShuffle {
+			n = c.options.StartNode
+		}
+	}
+
+	conn, err := c.Stream(c.Roster.List[n], &req)
+	if err != nil {
+		handler(GetPendingDeferredResponse{}, err)
+		return xerrors.Errorf("stream error: %v", err)
+	}
+	for {
+		resp := GetPendingDeferredResponse{}
+		if err := conn.ReadMessage(&resp); err != nil {
+			handler(GetPendingDeferredResponse{}, err)
+			return nil
+		}
+		handler(resp, nil)
+	}
+}
+
+// ExecArgs returns the arguments of the execProposedTx invocation carrying the
+// signatures collected off-chain.
+func (r DeferredProposalResponse) ExecArgs() (Arguments, error) {
+	buf, err := protobuf.Encode(&DeferredProofs{Proofs: r.Proofs})
+	if err != nil {
+		return nil, xerrors.Errorf("encoding proofs: %v", err)
+	}
+	return Arguments{{Name: "proofs", Value: buf}}, nil
+}
+
 // WaitPropagation contacts all nodes in the cl.Roster until they all
 // have the same latest block. If there is an error when calling
 // `GetProof`, the error will be ignored. This helps when waiting
@@ -758,6 +1059,9 @@ func DefaultGenesisMsg(v Version, r *onet.Roster, rules []string, ids ...darc.Id
 		log.Error(err)
 		return nil, xerrors.Errorf("adding rule: %v", err)
 	}
+	if err := rs.AddRule("invoke:"+ContractConfigID+"."+cmdConfigUpgradeContract, ownerExpr); err != nil {
+		return nil, xerrors.Errorf("adding rule: %v", err)
+	}
 	if err := rs.AddRule("spawn:"+ContractDarcID, ownerExpr); err != nil {
 		return nil, xerrors.Errorf("adding rule: %v", err)
 	}
@@ -376,6 +376,7 @@ func newTestService(c *onet.Context) (onet.Service, error) {
 		viewChangeMan:          newViewChangeManager(),
 		streamingMan:           streamingManager{},
 		closed:                 true,
+		txTracer:               newTxTracer(defaultTxTraceSize),
 	}
 
 	cs := &corruptedService{Service: s}
@@ -449,6 +449,47 @@ func DeferredGet(c *cli.Context) error {
 	return nil
 }
 
+// DeferredPending lists the deferred instances waiting for the signature of
+// an identity.
+func DeferredPending(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	identity := cfg.AdminIdentity
+	if idStr := c.String("identity"); idStr != "" {
+		identity, err = darc.ParseIdentity(idStr)
+		if err != nil {
+			return xerrors.Errorf("couldn't parse identity: %v", err)
+		}
+	}
+
+	resp, err := cl.GetPendingDeferred(identity)
+	if err != nil {
+		return xerrors.Errorf("couldn't get pending deferred instances: %v", err)
+	}
+
+	if len(resp.Pending) == 0 {
+		log.Infof("No deferred instance waiting for %s", identity.String())
+		return nil
+	}
+	for _, p := range resp.Pending {
+		log.Infof("Deferred instance %x, expires after block %d:", p.InstanceID.Slice(), p.ExpireBlockIndex)
+		for _, idx := range p.Indexes {
+			log.Infof("- instruction %d: %s, hash %x", idx,
+				p.ProposedTransaction.Instructions[idx].Action(), p.InstructionHashes[idx])
+		}
+	}
+
+	return nil
+}
+
 // DeferredDelete delete the deferred instance
 func DeferredDelete(c *cli.Context) error {
 	bcArg := c.String("bc")
@@ -4,6 +4,7 @@ testContractDeferred() {
     run testDeferredSpawn
     run testDeferredInvoke
     run testDeferredGet
+    run testDeferredPending
     run testDeferredDel
     run testDeferredInvokeDeferred
 }
@@ -55,6 +56,44 @@ Here is the deferred data:
 
 }
 
+testDeferredPending() {
+    # In this test we spawn a deferred contract whose proposed transaction
+    # needs the signature of a new identity, and check that it is listed as
+    # pending for this identity until it adds its proof.
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "spawn:value" --identity "$KEY" --darc "$ID" --sign "$KEY"
+    testOK runBA darc rule -rule "spawn:deferred" --identity "$KEY" --darc "$ID" --sign "$KEY"
+    testOK runBA darc rule -rule "invoke:deferred.addProof" --identity "$KEY" --darc "$ID" --sign "$KEY"
+
+    testGrep "No deferred instance waiting" runBA contract deferred pending --identity "$KEY"
+
+    OUTRES=`runBA0 contract -x value spawn --value "myValue" --darc "$ID" --sign "$KEY" | runBA0 contract deferred spawn --darc "$ID" --sign "$KEY"`
+    DEFERRED_INSTANCE_ID=`echo "$OUTRES" | sed -n '
+        /Spawned a new deferred contract/ {
+            n
+            p
+        }'`
+    matchOK "$DEFERRED_INSTANCE_ID" ^[0-9a-f]{64}$
+
+    testGrep "Deferred instance $DEFERRED_INSTANCE_ID" runBA contract deferred pending --identity "$KEY"
+    testGrep "instruction 0: spawn:value" runBA contract deferred pending --identity "$KEY"
+    # The admin identity is not in the rules of the darc.
+    testGrep "No deferred instance waiting" runBA contract deferred pending
+
+    HASH=`runBA0 contract deferred pending --identity "$KEY" | sed -n 's/.*hash \([0-9a-f]*\)$/\1/p'`
+    matchOK "$HASH" ^[0-9a-f]{64}$
+    testOK runBA contract deferred invoke addProof --instid "$DEFERRED_INSTANCE_ID" --hash "$HASH" --instrIdx 0 --sign "$KEY" --darc "$ID"
+
+    testGrep "No deferred instance waiting" runBA contract deferred pending --identity "$KEY"
+}
+
 # This method relies on testDeferredSpawn() and performs an addProof
 # on the proposed transaction and an execProposedTx.
 testDeferredInvoke() {
@@ -291,3 +291,154 @@ func NameGet(c *cli.Context) error {
 
 	return nil
 }
+
+// NameUpgrade activates the version of the name contract that checks the
+// hierarchical names and keeps the indexes used by the list and resolve
+// commands.
+func NameUpgrade(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	var signer *darc.Signer
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return err
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return xerrors.Errorf("failed to get signer counters: %v", err)
+	}
+
+	index := c.Int("index")
+	if index == 0 {
+		pr, err := cl.GetProofFromLatest(byzcoin.ConfigInstanceID.Slice())
+		if err != nil {
+			return xerrors.Errorf("failed to get the latest block: %v", err)
+		}
+		// Leave a few blocks for the transaction to be included.
+		index = pr.Proof.Latest.Index + 3
+	}
+
+	cvBuf, err := protobuf.Encode(&byzcoin.ContractVersion{
+		ContractID: byzcoin.ContractNamingID,
+		Version:    byzcoin.ContractNamingIndexedVersion,
+		Index:      index,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to encode the version: %v", err)
+	}
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.ConfigInstanceID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: byzcoin.ContractConfigID,
+			Command:    "upgrade_contract",
+			Args: byzcoin.Arguments{
+				{
+					Name:  "version",
+					Value: cvBuf,
+				},
+			},
+		},
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("The hierarchical names are active from block %d", index)
+
+	return lib.WaitPropagation(c, cl)
+}
+
+// NameList displays the names given under a darc, optionally only the ones
+// below a prefix in the hierarchy.
+func NameList(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	ndstr := c.String("namingDarc")
+	if ndstr == "" {
+		ndstr = cfg.AdminDarc.GetIdentityString()
+	}
+	nd, err := lib.GetDarcByString(cl, ndstr)
+	if err != nil {
+		return err
+	}
+
+	names, err := cl.ListNames(nd.GetBaseID(), c.String("prefix"))
+	if err != nil {
+		return xerrors.Errorf("failed to list the names: %v", err)
+	}
+
+	for _, named := range names {
+		log.Infof("%s: %s", named.Name, named.InstanceID)
+	}
+
+	return nil
+}
+
+// NameResolve displays the names given to an instance.
+func NameResolve(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instID := c.String("instid")
+	if instID == "" {
+		return xerrors.New("--instid flag required")
+	}
+
+	instIDBuf, err := hex.DecodeString(instID)
+	if err != nil {
+		return xerrors.New("failed to decode the instID string" + instID)
+	}
+
+	names, err := cl.ResolveNames(byzcoin.NewInstanceID(instIDBuf))
+	if err != nil {
+		return xerrors.Errorf("failed to resolve the names: %v", err)
+	}
+
+	for _, named := range names {
+		log.Infof("%s (darc:%x)", named.Name, named.DarcID)
+	}
+
+	return nil
+}
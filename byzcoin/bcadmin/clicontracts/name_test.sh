@@ -5,6 +5,7 @@ testContractName() {
     run tesNameInvokeAdd
     run testNameInvokeRemove
     run testNameGet
+    run testNameList
 }
 
 testNameSpawn() {
@@ -141,4 +142,41 @@ testNameGet() {
     matchOK "$OUTRES" "Here is the naming data:
 - ContractNamingBody:
 -- Latest: 0000000000000000000000000000000000000000000000000000000000000000"
-}
\ No newline at end of file
+}
+# Rely on:
+# - bcadmin contract name spawn
+# - bcadmin contract value spawn
+testNameList() {
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    testOK runBA contract name spawn
+    testOK runBA contract name upgrade
+
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    testOK runBA darc rule -rule "_name:value" --identity "$KEY" --darc "$ID" --sign "$KEY"
+    testOK runBA darc rule -rule "spawn:value" --identity "$KEY" --darc "$ID" --sign "$KEY"
+
+    OUTRES=`runBA0 contract value spawn --value "Hello world" --darc "$ID" --sign "$KEY"`
+    VALUE_INSTANCE_ID=$( echo "$OUTRES" | grep -A 1 "instance id" | sed -n 2p )
+    matchOK "$VALUE_INSTANCE_ID" ^[0-9a-f]{64}$
+
+    # Names must be hierarchical
+    testFail runBA contract name invoke add --name "team..config" --sign "$KEY" -i "$VALUE_INSTANCE_ID"
+    testOK runBA contract name invoke add --name "team.config" --sign "$KEY" -i "$VALUE_INSTANCE_ID"
+    testOK runBA contract name invoke add --name "team.other" --sign "$KEY" -i "$VALUE_INSTANCE_ID"
+    testOK runBA contract name invoke add --name "teammate" --sign "$KEY" -i "$VALUE_INSTANCE_ID"
+
+    OUTRES=`runBA0 contract name list --namingDarc "$ID" --prefix "team"`
+    matchOK "$OUTRES" "^team.config: $VALUE_INSTANCE_ID
+team.other: $VALUE_INSTANCE_ID$"
+
+    testOK runBA contract name invoke remove --name "team.other" --sign "$KEY" -i "$VALUE_INSTANCE_ID"
+    OUTRES=`runBA0 contract name resolve -i "$VALUE_INSTANCE_ID"`
+    matchOK "$OUTRES" "^team.config \(darc:[0-9a-f]{64}\)
+teammate \(darc:[0-9a-f]{64}\)$"
+}
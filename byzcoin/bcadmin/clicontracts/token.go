@@ -0,0 +1,335 @@
+package clicontracts
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// TokenSpawn is used to spawn a new token.
+func TokenSpawn(c *cli.Context) error {
+	name := c.String("name")
+	symbol := c.String("symbol")
+	if name == "" || symbol == "" {
+		return xerrors.New("--name and --symbol flags are required")
+	}
+
+	args := byzcoin.Arguments{
+		{Name: "name", Value: []byte(name)},
+		{Name: "symbol", Value: []byte(symbol)},
+		{Name: "decimals", Value: uint64Buf(c.Uint64("decimals"))},
+	}
+	if c.IsSet("cap") {
+		args = append(args, byzcoin.Argument{Name: "cap", Value: uint64Buf(c.Uint64("cap"))})
+	}
+
+	ctx, err := tokenSpawn(c, contracts.ContractTokenID, args)
+	if err != nil || ctx == nil {
+		return err
+	}
+
+	instID := ctx.Instructions[0].DeriveID("").Slice()
+	log.Infof("Spawned a new token contract. Its instance id is:\n%x", instID)
+	return nil
+}
+
+// TokenInvokeMint is used to create new tokens in an account.
+func TokenInvokeMint(c *cli.Context) error {
+	destination, err := hexFlag(c, "destination")
+	if err != nil {
+		return err
+	}
+	args := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(c.Uint64("coins"))},
+		{Name: "destination", Value: destination},
+	}
+
+	ctx, err := tokenInvoke(c, contracts.ContractTokenID, "mint", args)
+	if err != nil || ctx == nil {
+		return err
+	}
+	log.Infof("Minted %d tokens", c.Uint64("coins"))
+	return nil
+}
+
+// TokenAccountSpawn is used to spawn a new account holding the given token.
+func TokenAccountSpawn(c *cli.Context) error {
+	token, err := hexFlag(c, "token")
+	if err != nil {
+		return err
+	}
+
+	ctx, err := tokenSpawn(c, contracts.ContractTokenAccountID,
+		byzcoin.Arguments{{Name: "token", Value: token}})
+	if err != nil || ctx == nil {
+		return err
+	}
+
+	instID := ctx.Instructions[0].DeriveID("").Slice()
+	log.Infof("Spawned a new token account. Its instance id is:\n%x", instID)
+	return nil
+}
+
+// TokenAccountInvokeTransfer is used to send tokens to another account.
+func TokenAccountInvokeTransfer(c *cli.Context) error {
+	destination, err := hexFlag(c, "destination")
+	if err != nil {
+		return err
+	}
+	args := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(c.Uint64("coins"))},
+		{Name: "destination", Value: destination},
+	}
+
+	ctx, err := tokenInvoke(c, contracts.ContractTokenAccountID, "transfer", args)
+	if err != nil || ctx == nil {
+		return err
+	}
+	log.Infof("Transferred %d tokens", c.Uint64("coins"))
+	return nil
+}
+
+// TokenAccountInvokeApprove is used to allow another account to transfer
+// tokens on behalf of this one.
+func TokenAccountInvokeApprove(c *cli.Context) error {
+	spender, err := hexFlag(c, "spender")
+	if err != nil {
+		return err
+	}
+	args := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(c.Uint64("coins"))},
+		{Name: "spender", Value: spender},
+	}
+
+	ctx, err := tokenInvoke(c, contracts.ContractTokenAccountID, "approve", args)
+	if err != nil || ctx == nil {
+		return err
+	}
+	log.Infof("Approved %d tokens", c.Uint64("coins"))
+	return nil
+}
+
+// TokenAccountInvokeTransferFrom is used by a spender to transfer tokens of
+// another account.
+func TokenAccountInvokeTransferFrom(c *cli.Context) error {
+	from, err := hexFlag(c, "from")
+	if err != nil {
+		return err
+	}
+	destination, err := hexFlag(c, "destination")
+	if err != nil {
+		return err
+	}
+	args := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(c.Uint64("coins"))},
+		{Name: "from", Value: from},
+		{Name: "destination", Value: destination},
+	}
+
+	ctx, err := tokenInvoke(c, contracts.ContractTokenAccountID, "transferFrom", args)
+	if err != nil || ctx == nil {
+		return err
+	}
+	log.Infof("Transferred %d tokens", c.Uint64("coins"))
+	return nil
+}
+
+// TokenAccountInvokeBurn is used to destroy tokens of an account.
+func TokenAccountInvokeBurn(c *cli.Context) error {
+	args := byzcoin.Arguments{
+		{Name: "coins", Value: uint64Buf(c.Uint64("coins"))},
+	}
+
+	ctx, err := tokenInvoke(c, contracts.ContractTokenAccountID, "burn", args)
+	if err != nil || ctx == nil {
+		return err
+	}
+	log.Infof("Burnt %d tokens", c.Uint64("coins"))
+	return nil
+}
+
+// TokenGet displays a token or a token account.
+func TokenGet(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	_, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	instIDBuf, err := hexFlag(c, "instid")
+	if err != nil {
+		return err
+	}
+
+	pr, err := cl.GetProofFromLatest(instIDBuf)
+	if err != nil {
+		return xerrors.Errorf("couldn't get proof: %v", err)
+	}
+	if !pr.Proof.InclusionProof.Match(instIDBuf) {
+		return xerrors.New("proof does not match")
+	}
+
+	_, value, contractID, _, err := pr.Proof.KeyValue()
+	if err != nil {
+		return xerrors.Errorf("couldn't get value out of proof: %v", err)
+	}
+
+	switch contractID {
+	case contracts.ContractTokenID:
+		var token contracts.Token
+		err = protobuf.Decode(value, &token)
+		if err != nil {
+			return xerrors.Errorf("couldn't decode token: %v", err)
+		}
+		log.Infof("%s", token)
+	case contracts.ContractTokenAccountID:
+		var account contracts.TokenAccount
+		err = protobuf.Decode(value, &account)
+		if err != nil {
+			return xerrors.Errorf("couldn't decode account: %v", err)
+		}
+		log.Infof("%s", account)
+	default:
+		return xerrors.Errorf("instance is a %s contract", contractID)
+	}
+
+	return nil
+}
+
+// tokenSpawn sends the spawn of the contract to the darc given by --darc. The
+// transaction is nil when it has been exported.
+func tokenSpawn(c *cli.Context, contractID string, args byzcoin.Arguments) (*byzcoin.ClientTransaction, error) {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return nil, xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return nil, err
+	}
+
+	dstr := c.String("darc")
+	if dstr == "" {
+		dstr = cfg.AdminDarc.GetIdentityString()
+	}
+	d, err := lib.GetDarcByString(cl, dstr)
+	if err != nil {
+		return nil, err
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(d.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contractID,
+			Args:       args,
+		},
+	}
+	ctx, err := tokenSend(c, cfg, cl, instr)
+	return ctx, cothority.ErrorOrNil(err, "spawn failed")
+}
+
+// tokenInvoke sends the invoke of the command to the instance given by
+// --instid. The transaction is nil when it has been exported.
+func tokenInvoke(c *cli.Context, contractID, command string, args byzcoin.Arguments) (*byzcoin.ClientTransaction, error) {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return nil, xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return nil, err
+	}
+
+	instIDBuf, err := hexFlag(c, "instid")
+	if err != nil {
+		return nil, err
+	}
+
+	instr := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(instIDBuf),
+		Invoke: &byzcoin.Invoke{
+			ContractID: contractID,
+			Command:    command,
+			Args:       args,
+		},
+	}
+	ctx, err := tokenSend(c, cfg, cl, instr)
+	return ctx, cothority.ErrorOrNil(err, "invoke failed")
+}
+
+// tokenSend signs the instruction with the key given by --sign and sends it,
+// or exports it if --export is set.
+func tokenSend(c *cli.Context, cfg lib.Config, cl *byzcoin.Client, instr byzcoin.Instruction) (*byzcoin.ClientTransaction, error) {
+	var signer *darc.Signer
+	var err error
+
+	sstr := c.String("sign")
+	if sstr == "" {
+		signer, err = lib.LoadKey(cfg.AdminIdentity)
+	} else {
+		signer, err = lib.LoadKeyFromString(sstr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get signer counters: %v", err)
+	}
+	instr.SignerCounter = []uint64{counters.Counters[0] + 1}
+
+	ctx, err := cl.CreateTransaction(instr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctx.FillSignersAndSignWith(*signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if lib.FindRecursivefBool("export", c) {
+		return nil, lib.ExportTransaction(ctx)
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctx, lib.WaitPropagation(c, cl)
+}
+
+func hexFlag(c *cli.Context, name string) ([]byte, error) {
+	str := c.String(name)
+	if str == "" {
+		return nil, xerrors.Errorf("--%s flag is required", name)
+	}
+	buf, err := hex.DecodeString(str)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode the %s string: %v", name, err)
+	}
+	return buf, nil
+}
+
+func uint64Buf(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
@@ -0,0 +1,81 @@
+# This method should be called from the byzcoin/bcadmin/test.sh script
+
+testContractToken() {
+    run testTokenSpawn
+    run testTokenTransfer
+    run testTokenAllowance
+}
+
+# tokenSetup creates a darc with the token rules, and spawns a token and two
+# accounts.
+tokenSetup() {
+    runCoBG 1 2 3
+    runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+    eval $SED
+    [ -z "$BC" ] && exit 1
+
+    testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+    ID=`cat ./darc_id.txt`
+    KEY=`cat ./darc_key.txt`
+    for rule in spawn:token spawn:token_account invoke:token.mint \
+        invoke:token_account.transfer invoke:token_account.approve \
+        invoke:token_account.transferFrom invoke:token_account.burn; do
+        testOK runBA darc rule -rule "$rule" --identity "$KEY" --darc "$ID" --sign "$KEY"
+    done
+
+    OUTRES=`runBA0 contract token spawn --name "Test token" --symbol TST --decimals 2 --cap 1000 --darc "$ID" --sign "$KEY"`
+    matchOK "$OUTRES" "^Spawned a new token contract. Its instance id is:
+[0-9a-f]{64}$"
+    TOKEN=$( echo "$OUTRES" | grep -A 1 "instance id" | sed -n 2p )
+
+    OUTRES=`runBA0 contract token account spawn --token "$TOKEN" --darc "$ID" --sign "$KEY"`
+    ACCOUNT1=$( echo "$OUTRES" | grep -A 1 "instance id" | sed -n 2p )
+    matchOK "$ACCOUNT1" ^[0-9a-f]{64}$
+    OUTRES=`runBA0 contract token account spawn --token "$TOKEN" --darc "$ID" --sign "$KEY"`
+    ACCOUNT2=$( echo "$OUTRES" | grep -A 1 "instance id" | sed -n 2p )
+    matchOK "$ACCOUNT2" ^[0-9a-f]{64}$
+}
+
+testTokenSpawn() {
+    tokenSetup
+
+    # The symbol is required
+    testFail runBA contract token spawn --name "Test token" --darc "$ID" --sign "$KEY"
+
+    testOK runBA contract token invoke mint -i "$TOKEN" --coins 600 --destination "$ACCOUNT1" --sign "$KEY"
+    # The cap is 1000
+    testFail runBA contract token invoke mint -i "$TOKEN" --coins 600 --destination "$ACCOUNT1" --sign "$KEY"
+
+    OUTRES=`runBA0 contract token get -i "$TOKEN"`
+    matchOK "$OUTRES" "Symbol: TST"
+    matchOK "$OUTRES" "Supply: 600"
+}
+
+testTokenTransfer() {
+    tokenSetup
+    testOK runBA contract token invoke mint -i "$TOKEN" --coins 100 --destination "$ACCOUNT1" --sign "$KEY"
+
+    testOK runBA contract token account invoke transfer -i "$ACCOUNT1" --coins 40 --destination "$ACCOUNT2" --sign "$KEY"
+    testFail runBA contract token account invoke transfer -i "$ACCOUNT1" --coins 100 --destination "$ACCOUNT2" --sign "$KEY"
+    testOK runBA contract token account invoke burn -i "$ACCOUNT2" --coins 10 --sign "$KEY"
+
+    matchOK "`runBA0 contract token get -i "$ACCOUNT1"`" "Balance: 60"
+    matchOK "`runBA0 contract token get -i "$ACCOUNT2"`" "Balance: 30"
+    matchOK "`runBA0 contract token get -i "$TOKEN"`" "Supply: 90"
+}
+
+testTokenAllowance() {
+    tokenSetup
+    testOK runBA contract token invoke mint -i "$TOKEN" --coins 100 --destination "$ACCOUNT1" --sign "$KEY"
+
+    # Nothing is approved yet
+    testFail runBA contract token account invoke transferFrom -i "$ACCOUNT2" --from "$ACCOUNT1" --destination "$ACCOUNT2" --coins 10 --sign "$KEY"
+
+    testOK runBA contract token account invoke approve -i "$ACCOUNT1" --spender "$ACCOUNT2" --coins 20 --sign "$KEY"
+    testOK runBA contract token account invoke transferFrom -i "$ACCOUNT2" --from "$ACCOUNT1" --destination "$ACCOUNT2" --coins 15 --sign "$KEY"
+    testFail runBA contract token account invoke transferFrom -i "$ACCOUNT2" --from "$ACCOUNT1" --destination "$ACCOUNT2" --coins 10 --sign "$KEY"
+
+    OUTRES=`runBA0 contract token get -i "$ACCOUNT1"`
+    matchOK "$OUTRES" "Balance: 85"
+    matchOK "$OUTRES" "Allowance: 5 for $ACCOUNT2"
+}
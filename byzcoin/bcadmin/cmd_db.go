@@ -14,8 +14,10 @@ import (
 	"github.com/urfave/cli"
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/onet/v3/network"
 	"go.etcd.io/bbolt"
@@ -84,6 +86,12 @@ func dbReplay(c *cli.Context) error {
 	if err != nil {
 		return xerrors.Errorf("couldn't initialize fetchBlocks: %v", err)
 	}
+	if url := c.String("url"); url != "" {
+		err = fb.addURL(url)
+		if err != nil {
+			return xerrors.Errorf("couldn't add URL connection: %+v", err)
+		}
+	}
 
 	log.Info("Preparing db")
 	start := *fb.bcID
@@ -133,8 +141,16 @@ func dbReplay(c *cli.Context) error {
 	}
 
 	log.Info("Replaying blocks")
-	_, err = fb.service.ReplayStateContLog(start,
-		&sumFetcher{summarizeBlocks: c.Int("summarize"), bff: fb.blockFetcher})
+	sf := &sumFetcher{
+		summarizeBlocks:    c.Int("summarize"),
+		checkpointInterval: fb.flagCheckpoint,
+		bff:                fb.blockFetcher,
+		lastCheckpoint:     time.Now(),
+	}
+	if fb.latest != nil {
+		sf.latestIndex = fb.latest.Index
+	}
+	_, err = fb.service.ReplayStateContLog(start, sf)
 	if err != nil {
 		return xerrors.Errorf("couldn't replay blocks: %+v", err)
 	}
@@ -144,16 +160,23 @@ func dbReplay(c *cli.Context) error {
 }
 
 type sumFetcher struct {
-	summarizeBlocks int
-	bff             byzcoin.BlockFetcherFunc
-	totalTXs        int
-	accepted        int
-	seenBlocks      int
-	timeLastBlock   int64
-	timeLastSum     int64
-	maxTPS          float64
-	maxBlockSize    int
-	totalBlockSize  int
+	summarizeBlocks    int
+	checkpointInterval int
+	bff                byzcoin.BlockFetcherFunc
+	totalTXs           int
+	accepted           int
+	seenBlocks         int
+	timeLastBlock      int64
+	timeLastSum        int64
+	maxTPS             float64
+	maxBlockSize       int
+	totalBlockSize     int
+	// latestIndex is the index of the latest block of the chain, if it is
+	// known.
+	latestIndex      int
+	lastCheckpoint   time.Time
+	checkpointTXs    int
+	checkpointBlocks int
 }
 
 func (sf sumFetcher) BlockFetcherFunc(sid skipchain.SkipBlockID) (*skipchain.
@@ -189,6 +212,8 @@ func (sf *sumFetcher) LogAppliedBlock(sb *skipchain.SkipBlock,
 	}
 	sf.totalTXs += len(body.TxResults)
 	sf.seenBlocks++
+	sf.checkpointTXs += len(body.TxResults)
+	sf.checkpointBlocks++
 	if sf.timeLastBlock == 0 {
 		sf.timeLastBlock = head.Timestamp
 		sf.timeLastSum = head.Timestamp
@@ -233,6 +258,26 @@ func (sf *sumFetcher) LogAppliedBlock(sb *skipchain.SkipBlock,
 	}
 }
 
+func (sf *sumFetcher) CheckpointInterval() int {
+	return sf.checkpointInterval
+}
+
+// LogCheckpoint reports the progress of the replay and its throughput since
+// the previous checkpoint.
+func (sf *sumFetcher) LogCheckpoint(cp byzcoin.ReplayCheckpoint) {
+	progress := fmt.Sprintf("%d", cp.Index)
+	if sf.latestIndex > 0 {
+		progress = fmt.Sprintf("%d/%d", cp.Index, sf.latestIndex)
+	}
+	elapsed := time.Since(sf.lastCheckpoint).Seconds()
+	log.Infof("Checkpoint at block %s: %.1f blocks/s, %.1f txs/s",
+		progress, float64(sf.checkpointBlocks)/elapsed,
+		float64(sf.checkpointTXs)/elapsed)
+	sf.lastCheckpoint = time.Now()
+	sf.checkpointTXs = 0
+	sf.checkpointBlocks = 0
+}
+
 // dbMerge takes new blocks from a conode-db and applies them to the replay-db.
 func dbMerge(c *cli.Context) error {
 	if c.NArg() < 3 {
@@ -305,6 +350,114 @@ func dbMerge(c *cli.Context) error {
 	return nil
 }
 
+// dbMigrateTrie moves the global state of the chain from the bbolt database
+// of a stopped conode to its LevelDB storage.
+func dbMigrateTrie(c *cli.Context) error {
+	fb, err := newFetchBlocks(c)
+	if err != nil {
+		return xerrors.Errorf("couldn't create fetchBlock: %+v", err)
+	}
+
+	err = byzcoin.MigrateTrieDB(fb.boltDB, *fb.bcID)
+	if err != nil {
+		return xerrors.Errorf("couldn't migrate global state: %+v", err)
+	}
+	log.Infof("Moved global state to %s",
+		byzcoin.TrieLevelDBPath(fb.boltDB.Path()))
+	return nil
+}
+
+// dbGC removes the unreachable nodes of the global state of the chain from
+// the db of a stopped conode.
+func dbGC(c *cli.Context) error {
+	fb, err := newFetchBlocks(c)
+	if err != nil {
+		return xerrors.Errorf("couldn't create fetchBlock: %+v", err)
+	}
+
+	dryRun := c.Bool("dryRun")
+	res, err := byzcoin.CollectTrieGarbage(fb.boltDB, *fb.bcID, dryRun)
+	if err != nil {
+		return xerrors.Errorf("couldn't collect garbage: %+v", err)
+	}
+	if dryRun {
+		log.Infof("Found %d nodes and %d unreachable nodes using %d bytes",
+			res.Reachable, res.Garbage, res.GarbageSize)
+	} else {
+		log.Infof("Found %d nodes and removed %d unreachable nodes using %d bytes",
+			res.Reachable, res.Garbage, res.GarbageSize)
+	}
+	return nil
+}
+
+// dbVerifyRoster asks a node to compare the global states of all the members
+// of the roster, and prints the members which diverge. The request is signed
+// with the private key of the node.
+func dbVerifyRoster(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return xerrors.New("please give the private.toml of the node")
+	}
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		bcArg = c.Args().Get(1)
+		if bcArg == "" {
+			return xerrors.New("--bc flag is required")
+		}
+	}
+
+	cfg, _, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	ccfg, err := app.LoadCothority(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("couldn't load the node config: %v", err)
+	}
+	si, err := ccfg.GetServerIdentity()
+	if err != nil {
+		return xerrors.Errorf("couldn't read the node identity: %v", err)
+	}
+
+	resp, err := byzcoin.CheckRosterConsistency(si, cfg.ByzCoinID, c.Int("index"))
+	if err != nil {
+		return xerrors.Errorf("couldn't verify the roster: %+v", err)
+	}
+	log.Info(fmtRosterConsistency(resp))
+	for _, node := range resp.Nodes {
+		if !node.Consistent {
+			return xerrors.New("the global states of the roster are not consistent")
+		}
+	}
+	return nil
+}
+
+// fmtRosterConsistency returns a human readable representation of the
+// global state of each member of the roster.
+func fmtRosterConsistency(resp *byzcoin.VerifyRosterConsistencyResponse) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Global state at block %d: %x\n", resp.Index, resp.TrieRoot)
+	for _, node := range resp.Nodes {
+		switch {
+		case node.Consistent:
+			fmt.Fprintf(&sb, "\t%s: consistent\n", node.ServerIdentity.Address)
+		case node.Root == nil:
+			fmt.Fprintf(&sb, "\t%s: unreachable: %s\n", node.ServerIdentity.Address, node.Error)
+		default:
+			fmt.Fprintf(&sb, "\t%s: divergent since block %d: %x\n",
+				node.ServerIdentity.Address, node.FirstDivergence, node.Root)
+			for _, iid := range node.DivergentInstances {
+				fmt.Fprintf(&sb, "\t\tinstance %x\n", iid[:])
+			}
+			if node.Error != "" {
+				fmt.Fprintf(&sb, "\t\tincomplete: %s\n", node.Error)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
 // dbReset removes dangling forward-links from the db
 func dbReset(c *cli.Context) error {
 	fb, err := newFetchBlocks(c)
@@ -469,6 +622,22 @@ type fetchBlocks struct {
 	flagCatchupBatch int
 	flagReplayBlocks int
 	flagReplayCont   bool
+	flagCheckpoint   int
+	// nextIndex is the index of the block following the latest one given
+	// to the replay.
+	nextIndex int
+	// jobs are the batches of blocks being fetched in the background,
+	// stored by the index of their first block.
+	jobs map[int]*fetchJob
+	// scheduled is the index of the first block of the next batch to fetch.
+	scheduled int
+}
+
+// fetchJob is a batch of blocks fetched in the background from one node.
+type fetchJob struct {
+	done   chan struct{}
+	blocks []*skipchain.SkipBlock
+	err    error
 }
 
 func newFetchBlocks(c *cli.Context) (*fetchBlocks,
@@ -484,6 +653,8 @@ func newFetchBlocks(c *cli.Context) (*fetchBlocks,
 		flagCatchupBatch: c.Int("batch"),
 		flagReplayBlocks: c.Int("blocks"),
 		flagReplayCont:   c.Bool("continue"),
+		flagCheckpoint:   c.Int("checkpoint"),
+		jobs:             make(map[int]*fetchJob),
 	}
 
 	var err error
@@ -583,12 +754,124 @@ func (fb *fetchBlocks) blockFetcher(sib skipchain.SkipBlockID) (*skipchain.SkipB
 		return nil, nil
 	}
 	sb := fb.db.GetByID(sib)
+	if sb == nil && fb.cl != nil {
+		var err error
+		sb, err = fb.fetchParallel(sib)
+		if err != nil {
+			return nil, xerrors.Errorf("couldn't get blocks from network: %+v", err)
+		}
+	}
 	if sb == nil {
 		return nil, nil
 	}
+	fb.nextIndex = sb.Index + 1
 	return sb, nil
 }
 
+// fetchParallel returns the missing block following the latest one given to
+// the replay. The batches of blocks after it are fetched in the background,
+// each one from another node of the roster, so that all the nodes send
+// blocks while the previous ones are applied. As the batches are requested
+// by index, each one must start with the block the previous one links to.
+// If a batch is missing, the blocks are fetched sequentially.
+func (fb *fetchBlocks) fetchParallel(sib skipchain.SkipBlockID) (
+	*skipchain.SkipBlock, error) {
+	job, ok := fb.jobs[fb.nextIndex]
+	if !ok {
+		// The batches don't start at this block, for example because a
+		// node returned fewer blocks than asked, so they are dropped.
+		fb.jobs = make(map[int]*fetchJob)
+		fb.scheduled = fb.nextIndex
+		fb.scheduleJobs()
+		job, ok = fb.jobs[fb.nextIndex]
+		if !ok {
+			// The block is after the latest one known when the replay
+			// started.
+			return fb.fetchSequential(sib)
+		}
+	}
+	delete(fb.jobs, fb.nextIndex)
+	fb.scheduleJobs()
+
+	<-job.done
+	if job.err == nil && !job.blocks[0].Hash.Equal(sib) {
+		job.err = xerrors.New("batch doesn't start with the next block")
+	}
+	if job.err != nil {
+		log.Warnf("Couldn't fetch blocks from index %d in parallel: %v",
+			fb.nextIndex, job.err)
+		return fb.fetchSequential(sib)
+	}
+
+	_, err := fb.db.StoreBlocks(job.blocks)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't store blocks: %+v", err)
+	}
+	return job.blocks[0], nil
+}
+
+// fetchSequential fetches the next batch of blocks starting with the given
+// block from the next node of the roster.
+func (fb *fetchBlocks) fetchSequential(sib skipchain.SkipBlockID) (
+	*skipchain.SkipBlock, error) {
+	_, err := fb.gbMulti(sib)
+	if err != nil {
+		return nil, err
+	}
+	fb.nextNode()
+	return fb.db.GetByID(sib), nil
+}
+
+// scheduleJobs starts fetching the next batches of blocks, so that there is
+// one batch for each node of the roster.
+func (fb *fetchBlocks) scheduleJobs() {
+	for len(fb.jobs) < len(fb.roster.List) {
+		if fb.latest != nil && fb.scheduled > fb.latest.Index {
+			return
+		}
+		index := fb.scheduled
+		node := (index / fb.flagCatchupBatch) % len(fb.roster.List)
+		job := &fetchJob{done: make(chan struct{})}
+		fb.jobs[index] = job
+		fb.scheduled += fb.flagCatchupBatch
+		go func() {
+			defer close(job.done)
+			job.blocks, job.err = fb.fetchBatch(node, index)
+		}()
+	}
+}
+
+// fetchBatch returns a batch of blocks starting at the given index, fetched
+// from one node of the roster.
+func (fb *fetchBlocks) fetchBatch(node, index int) ([]*skipchain.SkipBlock,
+	error) {
+	// The clients are not shared between the batches, as each one asks
+	// another node.
+	cl := skipchain.NewClient()
+	cl.UseNode(node)
+	reply, err := cl.GetSingleBlockByIndex(fb.roster, *fb.bcID, index)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get block: %v", err)
+	}
+	blocks, err := cl.GetUpdateChainLevel(fb.roster, reply.SkipBlock.Hash,
+		1, fb.flagCatchupBatch)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get blocks: %v", err)
+	}
+	if len(blocks) == 0 {
+		return nil, xerrors.New("got no blocks")
+	}
+	for i, sb := range blocks {
+		if sb.Index != index+i {
+			return nil, xerrors.Errorf("blocks out of order: %d instead of %d",
+				sb.Index, index+i)
+		}
+	}
+	log.Infof("Got %d blocks from %s, starting at index %d",
+		len(blocks), fb.roster.List[node].Address, index)
+	return blocks, nil
+}
+
 func (fb *fetchBlocks) openDB(name string) (*skipchain.SkipBlockDB,
 	*bbolt.DB, error) {
 	db, err := bbolt.Open(name, 0600, nil)
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// status prints the health metrics of the chain as seen by every node of the
+// roster, or only by the one given with --server.
+func status(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		bcArg = c.Args().First()
+		if bcArg == "" {
+			return xerrors.New("--bc flag is required")
+		}
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	servers := make([]int, len(cfg.Roster.List))
+	for i := range servers {
+		servers[i] = i
+	}
+	if sn := c.Int("server"); sn >= 0 {
+		if sn >= len(servers) {
+			return xerrors.Errorf("server number %d out of roster", sn)
+		}
+		servers = []int{sn}
+	}
+
+	for _, sn := range servers {
+		err := cl.UseNode(sn)
+		if err != nil {
+			return err
+		}
+
+		resp, err := cl.GetChainHealth(c.Int("blocks"))
+		if err != nil {
+			log.Infof("Server %s: %v\n", cfg.Roster.List[sn].Address, err)
+			continue
+		}
+		log.Info(fmtChainHealth(cfg.Roster.List[sn].Address.String(), resp))
+	}
+
+	return nil
+}
+
+// fmtChainHealth returns a human readable representation of the health
+// metrics returned by the given server.
+func fmtChainHealth(server string, resp *byzcoin.GetChainHealthResponse) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Server %s\n", server)
+	fmt.Fprintf(&sb, "\tLatest block: %d (trie %d), %s since last block\n",
+		resp.LatestIndex, resp.TrieIndex, resp.SinceLatest.Round(time.Millisecond))
+	fmt.Fprintf(&sb, "\tBlock interval: configured %s, observed %s over %d blocks\n",
+		resp.BlockInterval, resp.ObservedInterval.Round(time.Millisecond), resp.WindowBlocks)
+	fmt.Fprintf(&sb, "\tTransactions: %d pending, %d accepted, %d refused (%.1f%% refused)\n",
+		resp.PendingTxs, resp.AcceptedTxs, resp.RefusedTxs, resp.RefusedRate*100)
+	fmt.Fprintf(&sb, "\tView changes: %d\n", resp.ViewChanges)
+	fmt.Fprintf(&sb, "\tCatching up: %t\n", resp.CatchingUp)
+	fmt.Fprintf(&sb, "\tRoster:\n")
+	for _, node := range resp.Nodes {
+		if node.Error != "" {
+			fmt.Fprintf(&sb, "\t\t%s: unreachable: %s\n", node.ServerIdentity.Address, node.Error)
+			continue
+		}
+		fmt.Fprintf(&sb, "\t\t%s: index %d, lag %d\n", node.ServerIdentity.Address,
+			node.LatestIndex, node.Lag)
+	}
+
+	return sb.String()
+}
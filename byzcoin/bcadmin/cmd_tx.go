@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// txBuild reads a transaction exported with --export, sets its signers and
+// their counters, and writes it unsigned to a transaction file.
+func txBuild(c *cli.Context) error {
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+	out := c.String("out")
+	if out == "" {
+		return xerrors.New("--out flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	if in := c.String("in"); in != "" {
+		buf, err = ioutil.ReadFile(in)
+	} else {
+		buf, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return xerrors.Errorf("failed to read transaction: %v", err)
+	}
+	var exported byzcoin.ClientTransaction
+	err = protobuf.Decode(buf, &exported)
+	if err != nil {
+		return xerrors.Errorf("failed to decode transaction, did you use --export ?: %v", err)
+	}
+	if len(exported.Instructions) == 0 {
+		return xerrors.New("the transaction has no instruction")
+	}
+
+	ids := []darc.Identity{cfg.AdminIdentity}
+	if signers := c.StringSlice("sign"); len(signers) > 0 {
+		ids = make([]darc.Identity, len(signers))
+		for i, s := range signers {
+			ids[i], err = darc.ParseIdentity(s)
+			if err != nil {
+				return xerrors.Errorf("failed to parse identity %s: %v", s, err)
+			}
+		}
+	}
+	idStrs := make([]string, len(ids))
+	for i, id := range ids {
+		idStrs[i] = id.String()
+	}
+	counters, err := cl.GetSignerCounters(idStrs...)
+	if err != nil {
+		return xerrors.Errorf("couldn't get counters: %v", err)
+	}
+	if len(counters.Counters) != len(ids) {
+		return xerrors.New("wrong number of counters")
+	}
+
+	// Each instruction uses the next counter of every signer.
+	instrs := make([]byzcoin.Instruction, len(exported.Instructions))
+	for i, instr := range exported.Instructions {
+		instrs[i] = byzcoin.Instruction{
+			InstanceID:       instr.InstanceID,
+			Spawn:            instr.Spawn,
+			Invoke:           instr.Invoke,
+			Delete:           instr.Delete,
+			SignerIdentities: ids,
+			SignerCounter:    make([]uint64, len(ids)),
+		}
+		for j := range ids {
+			instrs[i].SignerCounter[j] = counters.Counters[j] + uint64(i) + 1
+		}
+	}
+	tx, err := cl.CreateTransaction(instrs...)
+	if err != nil {
+		return xerrors.Errorf("couldn't create transaction: %v", err)
+	}
+	// The version of the transaction is the one of the latest block.
+	var header byzcoin.DataHeader
+	err = protobuf.Decode(cl.Latest.Data, &header)
+	if err != nil {
+		return xerrors.Errorf("couldn't decode header: %v", err)
+	}
+
+	tf, err := lib.NewTxFile(cfg.ByzCoinID, header.Version, tx)
+	if err != nil {
+		return err
+	}
+	err = tf.Save(out)
+	if err != nil {
+		return err
+	}
+	log.Info(lib.FormatTransaction(tf, tx))
+	return nil
+}
+
+// txSign adds the signatures of a signer to a transaction file. It doesn't
+// need a connection to the chain, so the key can stay on an offline
+// machine.
+func txSign(c *cli.Context) error {
+	fn := c.Args().First()
+	if fn == "" {
+		return xerrors.New("please give the transaction file")
+	}
+
+	var signer *darc.Signer
+	var err error
+	switch {
+	case c.String("key") != "":
+		signer, err = lib.LoadSigner(c.String("key"))
+	case c.String("sign") != "":
+		signer, err = lib.LoadKeyFromString(c.String("sign"))
+	default:
+		return xerrors.New("--key or --sign flag is required")
+	}
+	if err != nil {
+		return xerrors.Errorf("couldn't load signer: %v", err)
+	}
+
+	tf, err := lib.LoadTxFile(fn)
+	if err != nil {
+		return err
+	}
+	tx, err := tf.ClientTransaction()
+	if err != nil {
+		return err
+	}
+	log.Info(lib.FormatTransaction(tf, tx))
+
+	signed, err := lib.SignTransaction(&tx, *signer)
+	if err != nil {
+		return err
+	}
+	err = tf.SetTransaction(tx)
+	if err != nil {
+		return err
+	}
+	out := c.String("out")
+	if out == "" {
+		out = fn
+	}
+	err = tf.Save(out)
+	if err != nil {
+		return err
+	}
+	log.Infof("Added %d signatures of %s, %d signatures missing",
+		signed, signer.Identity(), lib.MissingSignatures(tx))
+	return nil
+}
+
+// txSubmit sends a signed transaction file to the chain.
+func txSubmit(c *cli.Context) error {
+	fn := c.Args().First()
+	if fn == "" {
+		return xerrors.New("please give the transaction file")
+	}
+	bcArg := c.String("bc")
+	if bcArg == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	cfg, cl, err := lib.LoadConfig(bcArg)
+	if err != nil {
+		return err
+	}
+	tf, err := lib.LoadTxFile(fn)
+	if err != nil {
+		return err
+	}
+	id, err := tf.ID()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(id, cfg.ByzCoinID) {
+		return xerrors.Errorf("the transaction is for the chain %x, not %x",
+			id, cfg.ByzCoinID)
+	}
+	tx, err := tf.ClientTransaction()
+	if err != nil {
+		return err
+	}
+	if missing := lib.MissingSignatures(tx); missing > 0 {
+		return xerrors.Errorf("%d signatures are missing", missing)
+	}
+
+	_, err = cl.AddTransactionAndWait(tx, c.Int("wait"))
+	if err != nil {
+		return xerrors.Errorf("couldn't submit transaction: %v", err)
+	}
+	log.Infof("Submitted transaction %x", tx.Instructions.Hash())
+	return nil
+}
+
+// txShow prints the preview of a transaction file.
+func txShow(c *cli.Context) error {
+	fn := c.Args().First()
+	if fn == "" {
+		return xerrors.New("please give the transaction file")
+	}
+	tf, err := lib.LoadTxFile(fn)
+	if err != nil {
+		return err
+	}
+	tx, err := tf.ClientTransaction()
+	if err != nil {
+		return err
+	}
+	log.Info(lib.FormatTransaction(tf, tx))
+	return nil
+}
@@ -277,6 +277,22 @@ var cmds = cli.Commands{
 						},
 					},
 
+					{
+						Name:   "pending",
+						Usage:  "list the deferred contracts waiting for the signature of an identity",
+						Action: clicontracts.DeferredPending,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "identity, id",
+								Usage: "the identity that must sign (default is the admin identity)",
+							},
+						},
+					},
 					{
 						Name:   "delete",
 						Usage:  "delete a deferred contract",
@@ -447,6 +463,302 @@ var cmds = cli.Commands{
 							},
 						},
 					},
+					{
+						Name:   "upgrade",
+						Usage:  "activate the hierarchical names, needed by the list and resolve commands",
+						Action: clicontracts.NameUpgrade,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "sign",
+								Usage: "public key of the signing entity (default is the admin public key)",
+							},
+							cli.IntFlag{
+								Name:  "index",
+								Usage: "the index of the first block using the hierarchical names (default is a few blocks after the latest one)",
+							},
+						},
+					},
+					{
+						Name:   "list",
+						Usage:  "list the names given under a darc",
+						Action: clicontracts.NameList,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "namingDarc",
+								Usage: "the DARC ID that 'guards' the instances (default is the admin darc)",
+							},
+							cli.StringFlag{
+								Name:  "prefix",
+								Usage: "only list the names equal to the prefix or below it, like 'team.project'",
+							},
+						},
+					},
+					{
+						Name:   "resolve",
+						Usage:  "list the names given to an instance",
+						Action: clicontracts.NameResolve,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "instid, i",
+								Usage: "the instance id of the named instance (required)",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "token",
+				Usage: "Manipulate a token contract",
+				Subcommands: cli.Commands{
+					{
+						Name:   "spawn",
+						Usage:  "spawn a token",
+						Action: clicontracts.TokenSpawn,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "sign",
+								Usage: "public key of the signing entity (default is the admin public key)",
+							},
+							cli.StringFlag{
+								Name:  "darc",
+								Usage: "DARC with the right to spawn a token (default is the admin DARC)",
+							},
+							cli.StringFlag{
+								Name:  "name",
+								Usage: "the name of the token (required)",
+							},
+							cli.StringFlag{
+								Name:  "symbol",
+								Usage: "the symbol of the token (required)",
+							},
+							cli.Uint64Flag{
+								Name:  "decimals",
+								Usage: "the number of decimals used to display the amounts",
+							},
+							cli.Uint64Flag{
+								Name:  "cap",
+								Usage: "the maximum supply (default is no maximum)",
+							},
+						},
+					},
+					{
+						Name:  "invoke",
+						Usage: "invoke on a token contract",
+						Subcommands: cli.Commands{
+							{
+								Name:   "mint",
+								Usage:  "create tokens in an account",
+								Action: clicontracts.TokenInvokeMint,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "sign",
+										Usage: "public key of the signing entity (default is the admin public key)",
+									},
+									cli.StringFlag{
+										Name:  "instid, i",
+										Usage: "the instance id of the token (required)",
+									},
+									cli.Uint64Flag{
+										Name:  "coins",
+										Usage: "the number of tokens",
+									},
+									cli.StringFlag{
+										Name:  "destination",
+										Usage: "the instance id of the account receiving the tokens (required)",
+									},
+								},
+							},
+						},
+					},
+					{
+						Name:  "account",
+						Usage: "Manipulate a token account",
+						Subcommands: cli.Commands{
+							{
+								Name:   "spawn",
+								Usage:  "spawn an account holding a token",
+								Action: clicontracts.TokenAccountSpawn,
+								Flags: []cli.Flag{
+									cli.StringFlag{
+										Name:   "bc",
+										EnvVar: "BC",
+										Usage:  "the ByzCoin config to use (required)",
+									},
+									cli.StringFlag{
+										Name:  "sign",
+										Usage: "public key of the signing entity (default is the admin public key)",
+									},
+									cli.StringFlag{
+										Name:  "darc",
+										Usage: "DARC with the right to spawn a token account (default is the admin DARC)",
+									},
+									cli.StringFlag{
+										Name:  "token",
+										Usage: "the instance id of the token (required)",
+									},
+								},
+							},
+							{
+								Name:  "invoke",
+								Usage: "invoke on a token account",
+								Subcommands: cli.Commands{
+									{
+										Name:   "transfer",
+										Usage:  "send tokens to another account",
+										Action: clicontracts.TokenAccountInvokeTransfer,
+										Flags: []cli.Flag{
+											cli.StringFlag{
+												Name:   "bc",
+												EnvVar: "BC",
+												Usage:  "the ByzCoin config to use (required)",
+											},
+											cli.StringFlag{
+												Name:  "sign",
+												Usage: "public key of the signing entity (default is the admin public key)",
+											},
+											cli.StringFlag{
+												Name:  "instid, i",
+												Usage: "the instance id of the account (required)",
+											},
+											cli.Uint64Flag{
+												Name:  "coins",
+												Usage: "the number of tokens",
+											},
+											cli.StringFlag{
+												Name:  "destination",
+												Usage: "the instance id of the receiving account (required)",
+											},
+										},
+									},
+									{
+										Name:   "approve",
+										Usage:  "allow another account to transfer tokens of this account",
+										Action: clicontracts.TokenAccountInvokeApprove,
+										Flags: []cli.Flag{
+											cli.StringFlag{
+												Name:   "bc",
+												EnvVar: "BC",
+												Usage:  "the ByzCoin config to use (required)",
+											},
+											cli.StringFlag{
+												Name:  "sign",
+												Usage: "public key of the signing entity (default is the admin public key)",
+											},
+											cli.StringFlag{
+												Name:  "instid, i",
+												Usage: "the instance id of the account (required)",
+											},
+											cli.Uint64Flag{
+												Name:  "coins",
+												Usage: "the number of tokens, 0 removes the allowance",
+											},
+											cli.StringFlag{
+												Name:  "spender",
+												Usage: "the instance id of the account allowed to transfer (required)",
+											},
+										},
+									},
+									{
+										Name:   "transferFrom",
+										Usage:  "transfer the tokens another account approved",
+										Action: clicontracts.TokenAccountInvokeTransferFrom,
+										Flags: []cli.Flag{
+											cli.StringFlag{
+												Name:   "bc",
+												EnvVar: "BC",
+												Usage:  "the ByzCoin config to use (required)",
+											},
+											cli.StringFlag{
+												Name:  "sign",
+												Usage: "public key of the signing entity (default is the admin public key)",
+											},
+											cli.StringFlag{
+												Name:  "instid, i",
+												Usage: "the instance id of the spender account (required)",
+											},
+											cli.Uint64Flag{
+												Name:  "coins",
+												Usage: "the number of tokens",
+											},
+											cli.StringFlag{
+												Name:  "from",
+												Usage: "the instance id of the account that approved the transfer (required)",
+											},
+											cli.StringFlag{
+												Name:  "destination",
+												Usage: "the instance id of the receiving account (required)",
+											},
+										},
+									},
+									{
+										Name:   "burn",
+										Usage:  "destroy tokens of an account",
+										Action: clicontracts.TokenAccountInvokeBurn,
+										Flags: []cli.Flag{
+											cli.StringFlag{
+												Name:   "bc",
+												EnvVar: "BC",
+												Usage:  "the ByzCoin config to use (required)",
+											},
+											cli.StringFlag{
+												Name:  "sign",
+												Usage: "public key of the signing entity (default is the admin public key)",
+											},
+											cli.StringFlag{
+												Name:  "instid, i",
+												Usage: "the instance id of the account (required)",
+											},
+											cli.Uint64Flag{
+												Name:  "coins",
+												Usage: "the number of tokens",
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					{
+						Name:   "get",
+						Usage:  "displays a token or a token account",
+						Action: clicontracts.TokenGet,
+						Flags: []cli.Flag{
+							cli.StringFlag{
+								Name:   "bc",
+								EnvVar: "BC",
+								Usage:  "the ByzCoin config to use (required)",
+							},
+							cli.StringFlag{
+								Name:  "instid, i",
+								Usage: "the instance id of the token or the account (required)",
+							},
+						},
+					},
 				},
 			},
 		},
@@ -669,6 +981,23 @@ var cmds = cli.Commands{
 						Usage: "summarize this many blocks in output",
 						Value: 1,
 					},
+					cli.IntFlag{
+						Name: "checkpoint",
+						Usage: "how many blocks are applied between two" +
+							" checkpoints of the global state",
+						Value: 100,
+					},
+					cli.StringFlag{
+						Name: "url",
+						Usage: "fetch the blocks missing from the db from" +
+							" this node and the other nodes of the roster",
+					},
+					cli.IntFlag{
+						Name: "batch",
+						Usage: "how many blocks will be fetched with each" +
+							" request",
+						Value: 100,
+					},
 				},
 			},
 			{
@@ -687,6 +1016,43 @@ var cmds = cli.Commands{
 					},
 				},
 			},
+			{
+				Name: "migrateTrie",
+				Usage: "Move the global state of the chain to the LevelDB " +
+					"storage used when COTHORITY_BYZCOIN_TRIE_DB=leveldb",
+				Action: dbMigrateTrie,
+			},
+			{
+				Name: "gc",
+				Usage: "Remove the nodes of the global state that are not " +
+					"reachable anymore - the conode must be stopped",
+				Action: dbGC,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "dryRun",
+						Usage: "only report the nodes that would be removed",
+					},
+				},
+			},
+			{
+				Name: "verify-roster",
+				Usage: "Compare the global states of the members of the " +
+					"roster and find where they diverge",
+				ArgsUsage: "private.toml [bc.cfg]",
+				Action:    dbVerifyRoster,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use",
+					},
+					cli.IntFlag{
+						Name:  "index",
+						Usage: "index of the block to verify (default: -1 = latest)",
+						Value: -1,
+					},
+				},
+			},
 			{
 				Name:      "resetBlock",
 				Usage:     "Clean latest block of dangling forward-links",
@@ -987,4 +1353,103 @@ var cmds = cli.Commands{
 			},
 		},
 	},
+
+	{
+		Name:      "status",
+		Usage:     "show the health of the chain as seen by the nodes of the roster",
+		ArgsUsage: "[bc.cfg]",
+		Action:    status,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "bc",
+				EnvVar: "BC",
+				Usage:  "the ByzCoin config to use",
+			},
+			cli.IntFlag{
+				Name:  "server",
+				Usage: "which server number from the roster to contact (default: -1 = all)",
+				Value: -1,
+			},
+			cli.IntFlag{
+				Name:  "blocks",
+				Usage: "number of latest blocks used for the statistics (default: 100)",
+			},
+		},
+	},
+
+	{
+		Name:  "tx",
+		Usage: "build, sign and submit a transaction in separate steps",
+		Subcommands: cli.Commands{
+			{
+				Name: "build",
+				Usage: "set the signers of a transaction exported with --export " +
+					"and write it unsigned to a file",
+				Action: txBuild,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.StringFlag{
+						Name:  "in",
+						Usage: "file of the exported transaction (default: stdin)",
+					},
+					cli.StringFlag{
+						Name:  "out",
+						Usage: "file of the unsigned transaction (required)",
+					},
+					cli.StringSliceFlag{
+						Name:  "sign",
+						Usage: "identity of a signer, can be repeated (default is the admin identity)",
+					},
+				},
+			},
+			{
+				Name:      "sign",
+				Usage:     "sign a transaction file, without connecting to the chain",
+				ArgsUsage: "tx.json",
+				Action:    txSign,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "file of the key of the signer",
+					},
+					cli.StringFlag{
+						Name:  "sign",
+						Usage: "identity of the signer, whose key is in the config directory",
+					},
+					cli.StringFlag{
+						Name:  "out",
+						Usage: "file of the signed transaction (default: overwrite tx.json)",
+					},
+				},
+			},
+			{
+				Name:      "submit",
+				Usage:     "send a signed transaction file to the chain",
+				ArgsUsage: "tx.json",
+				Action:    txSubmit,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:   "bc",
+						EnvVar: "BC",
+						Usage:  "the ByzCoin config to use (required)",
+					},
+					cli.IntFlag{
+						Name:  "wait",
+						Usage: "number of blocks to wait for the transaction",
+						Value: 10,
+					},
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "print a transaction file",
+				ArgsUsage: "tx.json",
+				Action:    txShow,
+			},
+		},
+	},
 }
@@ -0,0 +1,169 @@
+package lib
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// TxFileFormat is the version of the format of the transaction files.
+const TxFileFormat = 1
+
+// TxFile is the format of the files holding the transactions built, signed
+// and submitted in different steps by "bcadmin tx". The transaction is
+// stored protobuf-encoded, as it is sent to the nodes, along with the
+// ByzCoin version that is needed to compute its hash.
+type TxFile struct {
+	// Format is TxFileFormat.
+	Format int `json:"format"`
+	// ByzCoinID is the hexadecimal ID of the chain.
+	ByzCoinID string `json:"byzcoin_id"`
+	// Version is the ByzCoin version of the transaction.
+	Version byzcoin.Version `json:"version"`
+	// Transaction is the protobuf encoding of the ClientTransaction, in
+	// base64 in the JSON file.
+	Transaction []byte `json:"transaction"`
+}
+
+// NewTxFile returns the file holding the transaction of the chain.
+func NewTxFile(id skipchain.SkipBlockID, version byzcoin.Version, tx byzcoin.ClientTransaction) (*TxFile, error) {
+	tf := &TxFile{
+		Format:    TxFileFormat,
+		ByzCoinID: hex.EncodeToString(id),
+		Version:   version,
+	}
+	err := tf.SetTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+// LoadTxFile reads a transaction file.
+func LoadTxFile(fn string) (*TxFile, error) {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read this path: '%s': %v", fn, err)
+	}
+	tf := &TxFile{}
+	err = json.Unmarshal(buf, tf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode transaction file: %v", err)
+	}
+	if tf.Format != TxFileFormat {
+		return nil, xerrors.Errorf("unknown transaction file format %d", tf.Format)
+	}
+	return tf, nil
+}
+
+// Save writes the transaction file.
+func (tf *TxFile) Save(fn string) error {
+	buf, err := json.MarshalIndent(tf, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("failed to encode transaction file: %v", err)
+	}
+	err = ioutil.WriteFile(fn, append(buf, '\n'), 0600)
+	if err != nil {
+		return xerrors.Errorf("failed to write transaction file: %v", err)
+	}
+	return nil
+}
+
+// ID returns the ID of the chain of the transaction.
+func (tf *TxFile) ID() (skipchain.SkipBlockID, error) {
+	id, err := hex.DecodeString(tf.ByzCoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode ByzCoin ID: %v", err)
+	}
+	return id, nil
+}
+
+// ClientTransaction decodes the transaction, ready to be hashed.
+func (tf *TxFile) ClientTransaction() (byzcoin.ClientTransaction, error) {
+	var tx byzcoin.ClientTransaction
+	err := protobuf.Decode(tf.Transaction, &tx)
+	if err != nil {
+		return tx, xerrors.Errorf("failed to decode transaction: %v", err)
+	}
+	tx.Instructions.SetVersion(tf.Version)
+	return tx, nil
+}
+
+// SetTransaction replaces the transaction of the file.
+func (tf *TxFile) SetTransaction(tx byzcoin.ClientTransaction) error {
+	buf, err := protobuf.Encode(&tx)
+	if err != nil {
+		return xerrors.Errorf("failed to encode tx: %v", err)
+	}
+	tf.Transaction = buf
+	return nil
+}
+
+// SignTransaction adds the signatures of the signer to the instructions where
+// its identity is one of the signers. It returns the number of signatures
+// added.
+func SignTransaction(tx *byzcoin.ClientTransaction, signer darc.Signer) (int, error) {
+	digest := tx.Instructions.Hash()
+	id := signer.Identity()
+	signed := 0
+	for i := range tx.Instructions {
+		instr := &tx.Instructions[i]
+		for j, sid := range instr.SignerIdentities {
+			if !sid.Equal(&id) {
+				continue
+			}
+			if len(instr.Signatures) != len(instr.SignerIdentities) {
+				sigs := make([][]byte, len(instr.SignerIdentities))
+				copy(sigs, instr.Signatures)
+				instr.Signatures = sigs
+			}
+			sig, err := signer.Sign(digest)
+			if err != nil {
+				return signed, xerrors.Errorf("signing failed: %v", err)
+			}
+			instr.Signatures[j] = sig
+			signed++
+		}
+	}
+	if signed == 0 {
+		return 0, xerrors.Errorf("%s is not a signer of the transaction", id)
+	}
+	return signed, nil
+}
+
+// MissingSignatures returns the number of signatures which are still needed
+// by the transaction.
+func MissingSignatures(tx byzcoin.ClientTransaction) int {
+	missing := 0
+	for _, instr := range tx.Instructions {
+		for j := range instr.SignerIdentities {
+			if j >= len(instr.Signatures) || len(instr.Signatures[j]) == 0 {
+				missing++
+			}
+		}
+	}
+	return missing
+}
+
+// FormatTransaction returns a human readable preview of the transaction,
+// where the method of each instruction is formatted by its contract.
+func FormatTransaction(tf *TxFile, tx byzcoin.ClientTransaction) string {
+	var out strings.Builder
+	out.WriteString("- Transaction:\n")
+	fmt.Fprintf(&out, "-- ByzCoinID: %s\n", tf.ByzCoinID)
+	fmt.Fprintf(&out, "-- version: %d\n", tf.Version)
+	fmt.Fprintf(&out, "-- hash: %x\n", tx.Instructions.Hash())
+	fmt.Fprintf(&out, "-- missing signatures: %d\n", MissingSignatures(tx))
+	for _, instr := range tx.Instructions {
+		out.WriteString(instr.String())
+	}
+	return out.String()
+}
@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestTxFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bcadmin-tx")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	signers := []darc.Signer{darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil)}
+	ids := []darc.Identity{signers[0].Identity(), signers[1].Identity()}
+	tx := byzcoin.NewClientTransaction(byzcoin.CurrentVersion,
+		byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID([]byte("darc")),
+			Spawn: &byzcoin.Spawn{
+				ContractID: "value",
+				Args:       byzcoin.Arguments{{Name: "value", Value: []byte("1")}},
+			},
+			SignerIdentities: ids,
+			SignerCounter:    []uint64{1, 1},
+		},
+		byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID([]byte("value")),
+			Delete:     &byzcoin.Delete{ContractID: "value"},
+			// Only the first signer signs the second instruction.
+			SignerIdentities: ids[:1],
+			SignerCounter:    []uint64{2},
+		},
+	)
+	require.Equal(t, 3, MissingSignatures(tx))
+
+	id := []byte("byzcoin-id")
+	tf, err := NewTxFile(id, byzcoin.CurrentVersion, tx)
+	require.NoError(t, err)
+	fn := filepath.Join(dir, "tx.json")
+	require.NoError(t, tf.Save(fn))
+
+	tf, err = LoadTxFile(fn)
+	require.NoError(t, err)
+	loadedID, err := tf.ID()
+	require.NoError(t, err)
+	require.Equal(t, id, []byte(loadedID))
+	loaded, err := tf.ClientTransaction()
+	require.NoError(t, err)
+	require.Equal(t, tx.Instructions.Hash(), loaded.Instructions.Hash())
+
+	// An unknown signer cannot sign.
+	_, err = SignTransaction(&loaded, darc.NewSignerEd25519(nil, nil))
+	require.Error(t, err)
+
+	signed, err := SignTransaction(&loaded, signers[1])
+	require.NoError(t, err)
+	require.Equal(t, 1, signed)
+	require.Equal(t, 2, MissingSignatures(loaded))
+	require.NoError(t, tf.SetTransaction(loaded))
+	require.NoError(t, tf.Save(fn))
+
+	// The second signer signs on another machine.
+	tf, err = LoadTxFile(fn)
+	require.NoError(t, err)
+	loaded, err = tf.ClientTransaction()
+	require.NoError(t, err)
+	signed, err = SignTransaction(&loaded, signers[0])
+	require.NoError(t, err)
+	require.Equal(t, 2, signed)
+	require.Equal(t, 0, MissingSignatures(loaded))
+
+	// The signatures are the ones of the whole transaction.
+	digest := tx.Instructions.Hash()
+	for _, instr := range loaded.Instructions {
+		for i, sig := range instr.Signatures {
+			require.NoError(t, instr.SignerIdentities[i].Verify(digest, sig))
+		}
+	}
+	require.Contains(t, FormatTransaction(tf, loaded), "missing signatures: 0")
+
+	tf.Format = TxFileFormat + 1
+	require.NoError(t, tf.Save(fn))
+	_, err = LoadTxFile(fn)
+	require.Error(t, err)
+}
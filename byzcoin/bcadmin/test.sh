@@ -22,6 +22,7 @@ export BC_WAIT=true
 . "../clicontracts/deferred_test.sh"
 . "../clicontracts/value_test.sh"
 . "../clicontracts/name_test.sh"
+. "../clicontracts/token_test.sh"
 
 main(){
     startTest
@@ -31,6 +32,10 @@ main(){
     run testDbReplay
     run testDbMerge
     run testDbCatchup
+    run testDbMigrateTrie
+    run testDbGC
+    run testDbVerifyRoster
+    run testTx
     run testDebugBlock
     run testLink
     run testLinkScenario
@@ -49,10 +54,12 @@ main(){
     run testUpdateDarcDesc
     run testResolveiid
     run testInstructionGet
+    run testStatus
     run testContractValue
     run testContractDeferred
     run testContractConfig
     run testContractName
+    run testContractToken
     stopTest
 }
 
@@ -93,6 +100,16 @@ testDbReplay(){
   testReGrep "Replaying block at index 1"
   testGrep "Replaying block at index 0" runBA db replay conode.db $bcID
   testOK runBA db replay conode.db $bcID --cont
+
+  # checkpoints of the replay
+  testGrep "Checkpoint at block 0:" runBA db replay conode.db $bcID --checkpoint 1
+  testNGrep "Checkpoint at block 0:" runBA db replay conode.db $bcID
+
+  # the missing blocks are fetched from all the nodes in parallel
+  rm -f parallel.db
+  testGrep "Got 1 blocks from .*, starting at index 2" runBA db replay parallel.db $bcID \
+    --url http://localhost:2003 --batch 1
+  rm -f parallel.db
 }
 
 testDbMerge(){
@@ -134,6 +151,87 @@ testDbCatchup(){
   testGrep "Last block is: 3" runBA db status conode.db $bcID
 }
 
+testDbMigrateTrie(){
+  rm -f config/*
+  runCoBG 1 2 3
+  testOK runBA create public.toml --interval .5s
+  bc=config/bc*cfg
+  key=config/key*cfg
+  bcID=$( echo $bc | sed -e "s/.*bc-\(.*\).cfg/\1/" )
+  keyPub=$( echo $key | sed -e "s/.*:\(.*\).cfg/\1/" )
+  pkill conode 2> /dev/null
+
+  for db in $CONODE_SERVICE_PATH/*.db; do
+    testOK runBA db migrateTrie $db $bcID
+  done
+  testFail runBA db migrateTrie $db $bcID
+
+  export COTHORITY_BYZCOIN_TRIE_DB=leveldb
+  runCoBG 1 2 3
+  testOK runBA mint $bc $key $keyPub 1000
+  pkill conode 2> /dev/null
+  unset COTHORITY_BYZCOIN_TRIE_DB
+  rm -rf $CONODE_SERVICE_PATH/*.trie
+}
+
+testDbGC(){
+  rm -f config/*
+  runCoBG 1 2 3
+  testOK runBA create public.toml --interval .5s
+  bc=config/bc*cfg
+  key=config/key*cfg
+  bcID=$( echo $bc | sed -e "s/.*bc-\(.*\).cfg/\1/" )
+  keyPub=$( echo $key | sed -e "s/.*:\(.*\).cfg/\1/" )
+  testOK runBA mint $bc $key $keyPub 1000
+  pkill conode 2> /dev/null
+
+  db=$( ls $CONODE_SERVICE_PATH/*.db | head -n 1 )
+  testFail runBA db gc $db
+  testGrep "removed 0 unreachable" runBA db gc $db $bcID
+  testGrep "and 0 unreachable" runBA db gc --dryRun $db $bcID
+}
+
+testDbVerifyRoster(){
+  rm -f config/*
+  runCoBG 1 2 3
+  testOK runBA create public.toml --interval .5s
+  bc=config/bc*cfg
+  key=config/key*cfg
+  keyPub=$( echo $key | sed -e "s/.*:\(.*\).cfg/\1/" )
+  testOK runBA mint $bc $key $keyPub 1000
+
+  testGrep "consistent" runBA db verify-roster co1/private.toml $bc
+  testNGrep "divergent" runBA db verify-roster co1/private.toml $bc
+  testGrep "Global state at block 0" runBA db verify-roster --index 0 co2/private.toml $bc
+  testFail runBA db verify-roster co1/private.toml
+  testFail runBA db verify-roster $bc
+}
+
+testTx(){
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK runBA darc add -out_id ./darc_id.txt -out_key ./darc_key.txt -unrestricted
+  ID=`cat ./darc_id.txt`
+  KEY=`cat ./darc_key.txt`
+  testOK runBA darc rule -rule "spawn:value" --identity "$KEY" --darc "$ID" --sign "$KEY"
+
+  # Build the transaction, then sign and submit it in separate steps.
+  runBA0 contract -x value spawn --value "offline" --darc "$ID" --sign "$KEY" > tx.bin
+  testOK runBA tx build --in tx.bin --out tx.json --sign "$KEY"
+  testGrep "missing signatures: 1" runBA tx show tx.json
+  testGrep "spawn:value" runBA tx show tx.json
+  testFail runBA tx submit tx.json
+  OTHER=`runBA0 key`
+  testFail runBA tx sign tx.json --sign "$OTHER"
+  testOK runBA tx sign tx.json --sign "$KEY" --out tx_signed.json
+  testGrep "missing signatures: 0" runBA tx show tx_signed.json
+  testOK runBA tx submit tx_signed.json
+  testFail runBA tx submit tx_signed.json
+}
+
 testDebugBlock(){
   rm -f config/*
   runCoBG 1 2 3
@@ -564,5 +662,17 @@ testInstructionGet() {
   testOK runBA0 instance get -i 0000000000000000000000000000000000000000000000000000000000000000 --hex
 }
 
+testStatus() {
+  runCoBG 1 2 3
+  runGrepSed "export BC=" "" runBA create --roster public.toml --interval .5s
+  eval $SED
+  [ -z "$BC" ] && exit 1
+
+  testOK runBA status
+  testGrep "configured 500ms" runBA status --server 0
+  testGrep "lag 0" runBA status --server 1
+  testFail runBA status --server 3
+}
+
 main
 
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// maxBodySize is the maximal size of a transaction sent to the gateway.
+const maxBodySize = 4 * 1e6
+
+// maxWaitTime is the longest a transaction request can wait for its
+// transaction to be accepted. The nodes wait up to twice the block interval
+// for each block, which bounds the wait parameter of a chain.
+const maxWaitTime = 2 * time.Minute
+
+// chain is a ledger served by the gateway.
+type chain struct {
+	id     skipchain.SkipBlockID
+	roster onet.Roster
+
+	// genesis is fetched by the first request.
+	genesis     *skipchain.SkipBlock
+	genesisLock sync.Mutex
+}
+
+// client returns a new client of the chain. Each request uses its own
+// client, as a client cannot be shared between goroutines.
+func (c *chain) client() (*byzcoin.Client, error) {
+	c.genesisLock.Lock()
+	defer c.genesisLock.Unlock()
+	if c.genesis == nil {
+		sb, err := skipchain.NewClient().GetSingleBlock(&c.roster, c.id)
+		if err != nil {
+			return nil, xerrors.Errorf("fetching genesis block: %v", err)
+		}
+		c.genesis = sb
+	}
+	cl := byzcoin.NewClient(c.id, c.roster)
+	cl.Genesis = c.genesis
+	cl.Latest = c.genesis
+	return cl, nil
+}
+
+// httpError is an error returned to the client with its HTTP status.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{status: http.StatusBadRequest, err: xerrors.Errorf(format, args...)}
+}
+
+// route is an endpoint of a chain. The elements of the pattern are matched
+// against the path following /v1/byzcoin/<ByzCoinID>/, where "*" matches any
+// element, which is then given to the handler.
+type route struct {
+	method  string
+	pattern []string
+	handle  func(c *chain, req *http.Request, args []string) (interface{}, error)
+}
+
+// match returns the elements of the path matched by the wildcards of the
+// route.
+func (rt route) match(path []string) ([]string, bool) {
+	if len(path) != len(rt.pattern) {
+		return nil, false
+	}
+	var args []string
+	for i, p := range rt.pattern {
+		switch p {
+		case "*":
+			args = append(args, path[i])
+		case path[i]:
+		default:
+			return nil, false
+		}
+	}
+	return args, true
+}
+
+// gateway answers the HTTP requests by sending them to the nodes of the
+// chains.
+type gateway struct {
+	chains map[string]*chain
+	routes []route
+}
+
+// newGateway returns a gateway serving the chains of the configs.
+func newGateway(cfgs ...lib.Config) *gateway {
+	g := &gateway{chains: make(map[string]*chain)}
+	for _, cfg := range cfgs {
+		g.chains[hex.EncodeToString(cfg.ByzCoinID)] = &chain{
+			id:     cfg.ByzCoinID,
+			roster: cfg.Roster,
+		}
+	}
+	g.routes = []route{
+		{http.MethodGet, []string{"proof", "*"}, getProof},
+		{http.MethodGet, []string{"counters"}, getCounters},
+		{http.MethodGet, []string{"instance", "*", "version", "*"}, getInstanceVersion},
+		{http.MethodGet, []string{"block", "*"}, getBlock},
+		{http.MethodPost, []string{"transaction"}, addTransaction},
+	}
+	return g
+}
+
+// ServeHTTP implements http.Handler.
+func (g *gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/openapi.json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(openAPI))
+		return
+	}
+
+	path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(path) < 4 || path[0] != "v1" || path[1] != "byzcoin" {
+		writeError(w, &httpError{http.StatusNotFound, xerrors.New("unknown endpoint")})
+		return
+	}
+	c, ok := g.chains[strings.ToLower(path[2])]
+	if !ok {
+		writeError(w, &httpError{http.StatusNotFound, xerrors.Errorf("unknown ByzCoin ID %s", path[2])})
+		return
+	}
+
+	found := false
+	for _, rt := range g.routes {
+		args, ok := rt.match(path[3:])
+		if !ok {
+			continue
+		}
+		found = true
+		if rt.method != req.Method {
+			continue
+		}
+		reply, err := rt.handle(c, req, args)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, reply)
+		return
+	}
+	if found {
+		writeError(w, &httpError{http.StatusMethodNotAllowed,
+			xerrors.Errorf("method %s not allowed", req.Method)})
+		return
+	}
+	writeError(w, &httpError{http.StatusNotFound, xerrors.New("unknown endpoint")})
+}
+
+func writeJSON(w http.ResponseWriter, status int, reply interface{}) {
+	buf, err := json.Marshal(reply)
+	if err != nil {
+		status = http.StatusInternalServerError
+		buf, _ = json.Marshal(errorReply{Error: "encoding reply: " + err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(buf, '\n'))
+}
+
+// errorReply is sent when a request fails.
+type errorReply struct {
+	Error string
+}
+
+// writeError sends the error. The errors which are not an httpError come
+// from the nodes.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	if he, ok := err.(*httpError); ok {
+		status = he.status
+	}
+	log.Lvl2("request failed:", err)
+	writeJSON(w, status, errorReply{Error: err.Error()})
+}
+
+func parseInstanceID(s string) (byzcoin.InstanceID, error) {
+	var iid byzcoin.InstanceID
+	err := iid.UnmarshalText([]byte(s))
+	if err != nil {
+		return iid, badRequest("invalid instance ID: %v", err)
+	}
+	return iid, nil
+}
+
+// proofReply is the reply of the proof endpoint. The value of the instance
+// is taken from the proof, which has been verified by the gateway.
+type proofReply struct {
+	// Exists is false if the proof is a proof of absence.
+	Exists     bool
+	ContractID string
+	Value      []byte
+	DarcID     darc.ID
+	Proof      byzcoin.Proof
+}
+
+func getProof(c *chain, req *http.Request, args []string) (interface{}, error) {
+	iid, err := parseInstanceID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	cl, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cl.GetProof(iid.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("getting proof: %v", err)
+	}
+
+	reply := &proofReply{Proof: resp.Proof}
+	if resp.Proof.InclusionProof.Match(iid.Slice()) {
+		reply.Exists = true
+		reply.Value, reply.ContractID, reply.DarcID, err = resp.Proof.Get(iid.Slice())
+		if err != nil {
+			return nil, xerrors.Errorf("reading proof: %v", err)
+		}
+	}
+	return reply, nil
+}
+
+func getCounters(c *chain, req *http.Request, args []string) (interface{}, error) {
+	signers := req.URL.Query()["signer"]
+	if len(signers) == 0 {
+		return nil, badRequest("missing signer parameter")
+	}
+	for _, s := range signers {
+		_, err := darc.ParseIdentity(s)
+		if err != nil {
+			return nil, badRequest("invalid signer %s: %v", s, err)
+		}
+	}
+	cl, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cl.GetSignerCounters(signers...)
+	if err != nil {
+		return nil, xerrors.Errorf("getting counters: %v", err)
+	}
+	return resp, nil
+}
+
+// getInstanceVersion returns a version of an instance, or its last version
+// if the version is "last". Unlike the proofs, the versions are not
+// verified by the gateway.
+func getInstanceVersion(c *chain, req *http.Request, args []string) (interface{}, error) {
+	iid, err := parseInstanceID(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var msg interface{}
+	if args[1] == "last" {
+		msg = &byzcoin.GetLastInstanceVersion{SkipChainID: c.id, InstanceID: iid}
+	} else {
+		version, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return nil, badRequest("invalid version: %v", err)
+		}
+		msg = &byzcoin.GetInstanceVersion{SkipChainID: c.id, InstanceID: iid,
+			Version: version}
+	}
+	cl, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	reply := &byzcoin.GetInstanceVersionResponse{}
+	_, err = cl.SendProtobufParallel(c.roster.List, msg, reply, nil)
+	if err != nil {
+		return nil, xerrors.Errorf("getting instance version: %v", err)
+	}
+	return reply, nil
+}
+
+// blockReply describes a block of the chain. The block is also given in its
+// protobuf encoding, so that it can be verified.
+type blockReply struct {
+	Index        int
+	Hash         string
+	Timestamp    int64
+	Version      byzcoin.Version
+	TrieRoot     string
+	Transactions []byzcoin.TxResult
+	SkipBlock    []byte
+}
+
+// getBlock returns the block at an index, or the latest block if the index
+// is "latest".
+func getBlock(c *chain, req *http.Request, args []string) (interface{}, error) {
+	cl, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	var sb *skipchain.SkipBlock
+	if args[0] == "latest" {
+		// The proof of the config instance holds the verified latest block.
+		resp, err := cl.GetProof(byzcoin.ConfigInstanceID.Slice())
+		if err != nil {
+			return nil, xerrors.Errorf("getting latest block: %v", err)
+		}
+		sb = &resp.Proof.Latest
+	} else {
+		index, err := strconv.Atoi(args[0])
+		if err != nil || index < 0 {
+			return nil, badRequest("invalid block index %s", args[0])
+		}
+		resp, err := skipchain.NewClient().GetSingleBlockByIndex(&c.roster, c.id, index)
+		if err != nil {
+			return nil, xerrors.Errorf("getting block: %v", err)
+		}
+		sb = resp.SkipBlock
+	}
+
+	var header byzcoin.DataHeader
+	err = protobuf.Decode(sb.Data, &header)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding header: %v", err)
+	}
+	var body byzcoin.DataBody
+	err = protobuf.DecodeWithConstructors(sb.Payload, &body,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("decoding body: %v", err)
+	}
+	buf, err := protobuf.Encode(sb)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding block: %v", err)
+	}
+	return &blockReply{
+		Index:        sb.Index,
+		Hash:         hex.EncodeToString(sb.Hash),
+		Timestamp:    header.Timestamp,
+		Version:      header.Version,
+		TrieRoot:     hex.EncodeToString(header.TrieRoot),
+		Transactions: body.TxResults,
+		SkipBlock:    buf,
+	}, nil
+}
+
+// txReply is the reply of the transaction endpoint.
+type txReply struct {
+	// Hash is the hash of the instructions of the transaction.
+	Hash string
+}
+
+// latestConfig returns the latest block of the chain and its config, both
+// verified by the proof of the config instance.
+func latestConfig(cl *byzcoin.Client) (*skipchain.SkipBlock, *byzcoin.ChainConfig, error) {
+	resp, err := cl.GetProof(byzcoin.ConfigInstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting config: %v", err)
+	}
+	_, buf, _, _, err := resp.Proof.KeyValue()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading config: %v", err)
+	}
+	var config byzcoin.ChainConfig
+	err = protobuf.DecodeWithConstructors(buf, &config,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding config: %v", err)
+	}
+	return &resp.Proof.Latest, &config, nil
+}
+
+// addTransaction sends the transaction to the nodes. If the wait parameter is
+// given, it waits up to this number of blocks for the transaction to be
+// accepted, else it returns as soon as the transaction has been sent.
+func addTransaction(c *chain, req *http.Request, args []string) (interface{}, error) {
+	wait := 0
+	if w := req.URL.Query().Get("wait"); w != "" {
+		var err error
+		wait, err = strconv.Atoi(w)
+		if err != nil || wait < 0 {
+			return nil, badRequest("invalid wait %s", w)
+		}
+	}
+
+	var tx byzcoin.ClientTransaction
+	dec := json.NewDecoder(io.LimitReader(req.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&tx)
+	if err != nil {
+		return nil, badRequest("decoding transaction: %v", err)
+	}
+	if len(tx.Instructions) == 0 {
+		return nil, badRequest("the transaction has no instruction")
+	}
+
+	cl, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	latest, config, err := latestConfig(cl)
+	if err != nil {
+		return nil, err
+	}
+	if time.Duration(wait)*config.BlockInterval*2 > maxWaitTime {
+		return nil, badRequest("wait %d is above the maximum of %d blocks", wait,
+			maxWaitTime/(config.BlockInterval*2))
+	}
+	var header byzcoin.DataHeader
+	err = protobuf.Decode(latest.Data, &header)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding header: %v", err)
+	}
+
+	// The client only sends instructions of the current version, which the
+	// nodes then hash with the version of the chain, as it is done here.
+	tx.Instructions.SetVersion(byzcoin.CurrentVersion)
+	resp, err := cl.AddTransactionAndWait(tx, wait)
+	if err != nil {
+		if resp != nil && resp.Error != "" {
+			return nil, &httpError{http.StatusUnprocessableEntity,
+				xerrors.Errorf("transaction refused: %s", resp.Error)}
+		}
+		return nil, xerrors.Errorf("sending transaction: %v", err)
+	}
+	tx.Instructions.SetVersion(header.Version)
+	return &txReply{Hash: hex.EncodeToString(tx.Instructions.Hash())}, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/byzcoin/contracts"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestGateway(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:value"}, signer.Identity())
+	require.NoError(t, err)
+	genesisMsg.BlockInterval = 500 * time.Millisecond
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(newGateway(lib.Config{ByzCoinID: cl.ID, Roster: *roster}))
+	defer srv.Close()
+	url := srv.URL + "/v1/byzcoin/" + hex.EncodeToString(cl.ID)
+
+	get := func(path string, status int, reply interface{}) {
+		resp, err := http.Get(url + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode)
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(reply))
+	}
+
+	var block blockReply
+	get("/block/latest", http.StatusOK, &block)
+	require.Equal(t, 0, block.Index)
+	require.Equal(t, hex.EncodeToString(cl.ID), block.Hash)
+
+	var counters byzcoin.GetSignerCountersResponse
+	get("/counters?signer="+signer.Identity().String(), http.StatusOK, &counters)
+	require.Equal(t, []uint64{0}, counters.Counters)
+
+	// Send a transaction in JSON and wait for it.
+	tx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(genesisMsg.GenesisDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte("gateway")}},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.FillSignersAndSignWith(signer))
+	buf, err := json.Marshal(tx)
+	require.NoError(t, err)
+	resp, err := http.Post(url+"/transaction?wait=10", "application/json",
+		bytes.NewReader(buf))
+	require.NoError(t, err)
+	var txResp txReply
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&txResp))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, hex.EncodeToString(tx.Instructions.Hash()), txResp.Hash)
+
+	// A transaction with a wrong counter is refused.
+	refused, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(genesisMsg.GenesisDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ContractValueID,
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte("refused")}},
+		},
+		SignerCounter: []uint64{5},
+	})
+	require.NoError(t, err)
+	require.NoError(t, refused.FillSignersAndSignWith(signer))
+	buf, err = json.Marshal(refused)
+	require.NoError(t, err)
+	resp, err = http.Post(url+"/transaction?wait=10", "application/json",
+		bytes.NewReader(buf))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// The wait is limited to one minute of blocks, so 120 blocks of 500ms.
+	resp, err = http.Post(url+"/transaction?wait=121", "application/json",
+		bytes.NewReader(buf))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	iid := tx.Instructions[0].DeriveID("")
+	var proof proofReply
+	get("/proof/"+iid.String(), http.StatusOK, &proof)
+	require.True(t, proof.Exists)
+	require.Equal(t, contracts.ContractValueID, proof.ContractID)
+	require.Equal(t, []byte("gateway"), proof.Value)
+	require.NoError(t, proof.Proof.Verify(cl.ID))
+
+	get("/proof/"+byzcoin.NewInstanceID([]byte("absent")).String(), http.StatusOK, &proof)
+	require.False(t, proof.Exists)
+
+	var version byzcoin.GetInstanceVersionResponse
+	get("/instance/"+iid.String()+"/version/0", http.StatusOK, &version)
+	require.Equal(t, []byte("gateway"), version.StateChange.Value)
+	get("/instance/"+iid.String()+"/version/last", http.StatusOK, &version)
+	require.Equal(t, byzcoin.Create, version.StateChange.StateAction)
+
+	get("/block/1", http.StatusOK, &block)
+	require.Equal(t, 1, block.Index)
+	require.Equal(t, 1, len(block.Transactions))
+	require.True(t, block.Transactions[0].Accepted)
+
+	get("/counters?signer="+signer.Identity().String(), http.StatusOK, &counters)
+	require.Equal(t, []uint64{1}, counters.Counters)
+
+	// Invalid requests.
+	var errReply errorReply
+	get("/proof/1234", http.StatusBadRequest, &errReply)
+	require.Contains(t, errReply.Error, "invalid instance ID")
+	get("/block/-1", http.StatusBadRequest, &errReply)
+	get("/counters", http.StatusBadRequest, &errReply)
+	get("/transaction", http.StatusMethodNotAllowed, &errReply)
+	get("/unknown", http.StatusNotFound, &errReply)
+	resp, err = http.Get(srv.URL + "/v1/byzcoin/1234/block/latest")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/openapi.json")
+	require.NoError(t, err)
+	var spec map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&spec))
+	resp.Body.Close()
+	require.Equal(t, "3.0.3", spec["openapi"])
+}
@@ -0,0 +1,88 @@
+// Package main implements bcgateway, an HTTP gateway which gives access to
+// ByzCoin ledgers with JSON messages, for the clients which cannot use the
+// websocket and protobuf protocol of the nodes.
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/urfave/cli"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	network.RegisterMessages(&darc.Darc{}, &darc.Identity{}, &darc.Signer{})
+}
+
+var cliApp = cli.NewApp()
+
+var gitTag = "dev"
+
+func init() {
+	cliApp.Name = "bcgateway"
+	cliApp.Usage = "Serve ByzCoin ledgers over HTTP with JSON messages."
+	cliApp.Version = gitTag
+	cliApp.Flags = []cli.Flag{
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+		cli.StringSliceFlag{
+			Name:   "bc",
+			EnvVar: "BC",
+			Usage:  "the ByzCoin config of a served ledger, can be repeated (required)",
+		},
+		cli.StringFlag{
+			Name:  "listen",
+			Value: "localhost:7770",
+			Usage: "address on which the gateway listens",
+		},
+	}
+	cliApp.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		return nil
+	}
+	cliApp.Action = serve
+}
+
+func main() {
+	err := cliApp.Run(os.Args)
+	if err != nil {
+		log.Fatalf("error: %+v", err)
+	}
+}
+
+func serve(c *cli.Context) error {
+	bcArgs := c.StringSlice("bc")
+	if len(bcArgs) == 0 {
+		return xerrors.New("--bc flag is required")
+	}
+	cfgs := make([]lib.Config, len(bcArgs))
+	for i, bcArg := range bcArgs {
+		cfg, _, err := lib.LoadConfig(bcArg)
+		if err != nil {
+			return xerrors.Errorf("loading %s: %v", bcArg, err)
+		}
+		cfgs[i] = cfg
+		log.Infof("Serving ByzCoin %x", cfg.ByzCoinID)
+	}
+
+	addr := c.String("listen")
+	log.Infof("Listening on http://%s, API described at /openapi.json", addr)
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     newGateway(cfgs...),
+		ReadTimeout: time.Minute,
+		// A transaction request can wait for maxWaitTime, and then needs
+		// the time to send the reply.
+		WriteTimeout: maxWaitTime + time.Minute,
+	}
+	return srv.ListenAndServe()
+}
@@ -0,0 +1,253 @@
+package main
+
+// openAPI describes the API of the gateway, it is served at /openapi.json.
+const openAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "ByzCoin gateway",
+    "description": "Reads and writes ByzCoin ledgers with JSON messages. Instance IDs, darc IDs and hashes are in hexadecimal, identities are written like 'ed25519:<hex>', and the other binary values are in base64.",
+    "version": "1"
+  },
+  "paths": {
+    "/v1/byzcoin/{byzcoinID}/proof/{instanceID}": {
+      "get": {
+        "summary": "Get the proof of an instance, verified by the gateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/ByzCoinID"},
+          {"$ref": "#/components/parameters/InstanceID"}
+        ],
+        "responses": {
+          "200": {
+            "description": "The proof of existence or of absence of the instance",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ProofReply"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/byzcoin/{byzcoinID}/counters": {
+      "get": {
+        "summary": "Get the last counters used by signers",
+        "parameters": [
+          {"$ref": "#/components/parameters/ByzCoinID"},
+          {
+            "name": "signer",
+            "in": "query",
+            "required": true,
+            "description": "Identity of a signer, can be repeated",
+            "schema": {"type": "array", "items": {"type": "string"}},
+            "style": "form",
+            "explode": true
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The counters, in the order of the signers",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Counters"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/byzcoin/{byzcoinID}/instance/{instanceID}/version/{version}": {
+      "get": {
+        "summary": "Get a version of an instance, not verified by the gateway",
+        "parameters": [
+          {"$ref": "#/components/parameters/ByzCoinID"},
+          {"$ref": "#/components/parameters/InstanceID"},
+          {
+            "name": "version",
+            "in": "path",
+            "required": true,
+            "description": "Version of the instance, or 'last'",
+            "schema": {"type": "string"}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The state change of the version",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/InstanceVersion"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/byzcoin/{byzcoinID}/block/{index}": {
+      "get": {
+        "summary": "Get a block",
+        "parameters": [
+          {"$ref": "#/components/parameters/ByzCoinID"},
+          {
+            "name": "index",
+            "in": "path",
+            "required": true,
+            "description": "Index of the block, or 'latest'",
+            "schema": {"type": "string"}
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The block",
+            "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Block"}}}
+          },
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/byzcoin/{byzcoinID}/transaction": {
+      "post": {
+        "summary": "Send a signed transaction",
+        "parameters": [
+          {"$ref": "#/components/parameters/ByzCoinID"},
+          {
+            "name": "wait",
+            "in": "query",
+            "description": "Number of blocks to wait for the transaction to be accepted, it is only sent if 0. It is limited to one minute of blocks",
+            "schema": {"type": "integer", "minimum": 0, "default": 0}
+          }
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/ClientTransaction"}}}
+        },
+        "responses": {
+          "200": {
+            "description": "The transaction has been sent, or accepted if wait is given",
+            "content": {"application/json": {"schema": {
+              "type": "object",
+              "properties": {"Hash": {"type": "string", "description": "Hash of the instructions"}}
+            }}}
+          },
+          "422": {"$ref": "#/components/responses/Error"},
+          "default": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "ByzCoinID": {
+        "name": "byzcoinID",
+        "in": "path",
+        "required": true,
+        "description": "ID of the ledger, in hexadecimal",
+        "schema": {"type": "string"}
+      },
+      "InstanceID": {
+        "name": "instanceID",
+        "in": "path",
+        "required": true,
+        "description": "ID of the instance, 32 bytes in hexadecimal",
+        "schema": {"type": "string"}
+      }
+    },
+    "responses": {
+      "Error": {
+        "description": "The request failed: 400 for an invalid request, 404 for an unknown ledger, 422 for a refused transaction and 502 if the nodes failed",
+        "content": {"application/json": {"schema": {
+          "type": "object",
+          "properties": {"Error": {"type": "string"}}
+        }}}
+      }
+    },
+    "schemas": {
+      "Argument": {
+        "type": "object",
+        "properties": {
+          "Name": {"type": "string"},
+          "Value": {"type": "string", "format": "byte"}
+        }
+      },
+      "Instruction": {
+        "type": "object",
+        "properties": {
+          "InstanceID": {"type": "string"},
+          "Spawn": {"type": "object", "nullable": true, "properties": {
+            "ContractID": {"type": "string"},
+            "Args": {"type": "array", "items": {"$ref": "#/components/schemas/Argument"}}
+          }},
+          "Invoke": {"type": "object", "nullable": true, "properties": {
+            "ContractID": {"type": "string"},
+            "Command": {"type": "string"},
+            "Args": {"type": "array", "items": {"$ref": "#/components/schemas/Argument"}}
+          }},
+          "Delete": {"type": "object", "nullable": true, "properties": {
+            "ContractID": {"type": "string"}
+          }},
+          "SignerIdentities": {"type": "array", "items": {"type": "string"}},
+          "SignerCounter": {"type": "array", "items": {"type": "integer"}},
+          "Signatures": {"type": "array", "items": {"type": "string", "format": "byte"}}
+        }
+      },
+      "ClientTransaction": {
+        "type": "object",
+        "properties": {
+          "Instructions": {"type": "array", "items": {"$ref": "#/components/schemas/Instruction"}}
+        }
+      },
+      "StateChange": {
+        "type": "object",
+        "properties": {
+          "StateAction": {"type": "string", "enum": ["Create", "Update", "Remove"]},
+          "InstanceID": {"type": "string"},
+          "ContractID": {"type": "string"},
+          "Value": {"type": "string", "format": "byte"},
+          "DarcID": {"type": "string"},
+          "Version": {"type": "integer"}
+        }
+      },
+      "Proof": {
+        "type": "object",
+        "description": "The skipblock and the forward links are protobuf-encoded",
+        "properties": {
+          "InclusionProof": {"type": "object"},
+          "Latest": {"type": "string", "format": "byte"},
+          "Links": {"type": "array", "items": {"type": "string", "format": "byte"}}
+        }
+      },
+      "ProofReply": {
+        "type": "object",
+        "properties": {
+          "Exists": {"type": "boolean"},
+          "ContractID": {"type": "string"},
+          "Value": {"type": "string", "format": "byte"},
+          "DarcID": {"type": "string"},
+          "Proof": {"$ref": "#/components/schemas/Proof"}
+        }
+      },
+      "Counters": {
+        "type": "object",
+        "properties": {
+          "Counters": {"type": "array", "items": {"type": "integer"}},
+          "Index": {"type": "integer", "description": "Index of the block of the counters"}
+        }
+      },
+      "InstanceVersion": {
+        "type": "object",
+        "properties": {
+          "StateChange": {"$ref": "#/components/schemas/StateChange"},
+          "BlockIndex": {"type": "integer"}
+        }
+      },
+      "Block": {
+        "type": "object",
+        "properties": {
+          "Index": {"type": "integer"},
+          "Hash": {"type": "string"},
+          "Timestamp": {"type": "integer", "description": "Nanoseconds since the epoch"},
+          "Version": {"type": "integer"},
+          "TrieRoot": {"type": "string"},
+          "Transactions": {"type": "array", "items": {
+            "type": "object",
+            "properties": {
+              "ClientTransaction": {"$ref": "#/components/schemas/ClientTransaction"},
+              "Accepted": {"type": "boolean"}
+            }
+          }},
+          "SkipBlock": {"type": "string", "format": "byte", "description": "Protobuf encoding of the block"}
+        }
+      }
+    }
+  }
+}
+`
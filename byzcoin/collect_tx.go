@@ -24,15 +24,18 @@ type CollectTxProtocol struct {
 	*onet.TreeNodeInstance
 	TxsChan           chan []ClientTransaction
 	CommonVersionChan chan Version
-	SkipchainID       skipchain.SkipBlockID
-	LatestID          skipchain.SkipBlockID
-	MaxNumTxs         int
-	requestChan       chan structCollectTxRequest
-	responseChan      chan structCollectTxResponse
-	getTxs            getTxsCallback
-	Finish            chan bool
-	closing           chan bool
-	version           int
+	// ContractVersionsChan receives the contract versions supported by the
+	// nodes that replied.
+	ContractVersionsChan chan contractVersionBuffer
+	SkipchainID          skipchain.SkipBlockID
+	LatestID             skipchain.SkipBlockID
+	MaxNumTxs            int
+	requestChan          chan structCollectTxRequest
+	responseChan         chan structCollectTxResponse
+	getTxs               getTxsCallback
+	Finish               chan bool
+	closing              chan bool
+	version              int
 }
 
 // CollectTxRequest is the request message that asks the receiver to send their
@@ -47,8 +50,9 @@ type CollectTxRequest struct {
 // CollectTxResponse is the response message that contains all the pending
 // transactions on the node.
 type CollectTxResponse struct {
-	Txs            []ClientTransaction
-	ByzcoinVersion Version
+	Txs              []ClientTransaction
+	ByzcoinVersion   Version
+	ContractVersions []ContractVersion
 }
 
 type structCollectTxRequest struct {
@@ -69,13 +73,14 @@ func NewCollectTxProtocol(getTxs getTxsCallback) func(*onet.TreeNodeInstance) (o
 			// If we do not buffer this channel then the protocol
 			// might be blocked from stopping when the receiver
 			// stops reading from this channel.
-			TxsChan:           make(chan []ClientTransaction, len(node.List())),
-			CommonVersionChan: make(chan Version, len(node.List())),
-			MaxNumTxs:         defaultMaxNumTxs,
-			getTxs:            getTxs,
-			Finish:            make(chan bool),
-			closing:           make(chan bool),
-			version:           1,
+			TxsChan:              make(chan []ClientTransaction, len(node.List())),
+			CommonVersionChan:    make(chan Version, len(node.List())),
+			ContractVersionsChan: make(chan contractVersionBuffer, 1),
+			MaxNumTxs:            defaultMaxNumTxs,
+			getTxs:               getTxs,
+			Finish:               make(chan bool),
+			closing:              make(chan bool),
+			version:              1,
 		}
 		if err := node.RegisterChannels(&c.requestChan, &c.responseChan); err != nil {
 			return c, xerrors.Errorf("registering channels: %v", err)
@@ -140,8 +145,9 @@ func (p *CollectTxProtocol) Dispatch() error {
 
 	// send the result of the callback to the root
 	resp := &CollectTxResponse{
-		Txs:            p.getTxs(req.ServerIdentity, p.Roster(), req.SkipchainID, req.LatestID, maxOut),
-		ByzcoinVersion: p.getByzcoinVersion(),
+		Txs:              p.getTxs(req.ServerIdentity, p.Roster(), req.SkipchainID, req.LatestID, maxOut),
+		ByzcoinVersion:   p.getByzcoinVersion(),
+		ContractVersions: p.getContractVersions(),
 	}
 	log.Lvl3(p.ServerIdentity(), "sends back", len(resp.Txs), "transactions")
 	if p.IsRoot() {
@@ -162,12 +168,16 @@ func (p *CollectTxProtocol) Dispatch() error {
 		leaderVersion := p.getByzcoinVersion()
 		vb.add(p.ServerIdentity(), leaderVersion)
 
+		cvb := newContractVersionBuffer(len(p.Children()) + 1)
+		cvb.add(p.ServerIdentity(), p.getContractVersions())
+
 		finish := false
 
 		for i := 0; i < len(p.List()) && !finish; i++ {
 			select {
 			case resp := <-p.responseChan:
 				vb.add(resp.ServerIdentity, resp.ByzcoinVersion)
+				cvb.add(resp.ServerIdentity, resp.ContractVersions)
 
 				// If more than the limit is sent, we simply drop all of them
 				// as the conode is not behaving correctly.
@@ -184,6 +194,9 @@ func (p *CollectTxProtocol) Dispatch() error {
 		if vb.hasThresholdFor(leaderVersion) {
 			p.CommonVersionChan <- leaderVersion
 		}
+		// It is sent before TxsChan is closed, so that the leader can read
+		// it once the channel is closed.
+		p.ContractVersionsChan <- cvb
 	}
 	return nil
 }
@@ -203,6 +216,15 @@ func (p *CollectTxProtocol) getByzcoinVersion() Version {
 	return srv.(*Service).GetProtocolVersion()
 }
 
+func (p *CollectTxProtocol) getContractVersions() []ContractVersion {
+	srv := p.Host().Service(ServiceName)
+	if srv == nil {
+		panic("Byzcoin should always be available as a service for this protocol")
+	}
+
+	return srv.(*Service).contracts.supportedVersions()
+}
+
 type versionBuffer struct {
 	versions   map[Version]int
 	identities map[network.ServerIdentityID]bool
@@ -237,3 +259,46 @@ func (vb versionBuffer) hasThresholdFor(version Version) bool {
 
 	return sum >= vb.threshold
 }
+
+type contractVersionKey struct {
+	contractID string
+	version    int
+}
+
+// contractVersionBuffer counts the nodes supporting each version of the
+// contracts, so that the leader only proposes upgrades that a threshold of
+// the roster can execute.
+type contractVersionBuffer struct {
+	versions   map[contractVersionKey]int
+	identities map[network.ServerIdentityID]bool
+	threshold  int
+}
+
+func newContractVersionBuffer(n int) contractVersionBuffer {
+	return contractVersionBuffer{
+		versions:   make(map[contractVersionKey]int),
+		identities: make(map[network.ServerIdentityID]bool),
+		threshold:  byzcoinx.Threshold(n),
+	}
+}
+
+func (cvb contractVersionBuffer) add(si *network.ServerIdentity, cvs []ContractVersion) {
+	if cvb.identities[si.ID] {
+		// Make sure a malicious conode cannot vote multiple times.
+		return
+	}
+	cvb.identities[si.ID] = true
+
+	seen := make(map[contractVersionKey]bool)
+	for _, cv := range cvs {
+		key := contractVersionKey{cv.ContractID, cv.Version}
+		if !seen[key] {
+			seen[key] = true
+			cvb.versions[key]++
+		}
+	}
+}
+
+func (cvb contractVersionBuffer) hasThresholdFor(contractID string, version int) bool {
+	return cvb.versions[contractVersionKey{contractID, version}] >= cvb.threshold
+}
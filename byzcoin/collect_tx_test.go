@@ -115,3 +115,25 @@ func TestCollectTx_VersionBuffer(t *testing.T) {
 	require.False(t, vb.hasThresholdFor(2))
 	require.True(t, vb.hasThresholdFor(1))
 }
+
+// Check the contract version buffer features.
+func TestCollectTx_ContractVersionBuffer(t *testing.T) {
+	cvb := newContractVersionBuffer(4)
+	require.Equal(t, cvb.threshold, 3)
+
+	v1 := ContractVersion{ContractID: "a", Version: 1}
+	v2 := ContractVersion{ContractID: "a", Version: 2}
+
+	cvb.add(newSI(), []ContractVersion{v1, v2})
+	cvb.add(newSI(), []ContractVersion{v1})
+	si1 := newSI()
+	cvb.add(si1, []ContractVersion{v2, v2})
+	cvb.add(si1, []ContractVersion{v1, v2})
+
+	require.False(t, cvb.hasThresholdFor("a", 1))
+	require.False(t, cvb.hasThresholdFor("a", 2))
+
+	cvb.add(newSI(), []ContractVersion{v1})
+	require.True(t, cvb.hasThresholdFor("a", 1))
+	require.False(t, cvb.hasThresholdFor("b", 1))
+}
@@ -0,0 +1,318 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// maxSignedRequestAge is how long a signed request for the global states is
+// accepted, so that it can't be replayed later.
+const maxSignedRequestAge = 5 * time.Minute
+
+// Hash returns the hash of the request, which is signed by the member of the
+// roster sending it.
+func (req *GetTrieState) Hash() []byte {
+	h := sha256.New()
+	h.Write(req.ID)
+	binary.Write(h, binary.LittleEndian, int64(req.Index))
+	for _, key := range req.Keys {
+		h.Write(key.Slice())
+	}
+	binary.Write(h, binary.LittleEndian, req.Timestamp)
+	return h.Sum(nil)
+}
+
+// Hash returns the hash of the request, which is signed by the node receiving
+// it.
+func (req *VerifyRosterConsistency) Hash() []byte {
+	h := sha256.New()
+	h.Write(req.ID)
+	binary.Write(h, binary.LittleEndian, int64(req.Index))
+	binary.Write(h, binary.LittleEndian, req.Timestamp)
+	return h.Sum(nil)
+}
+
+// verifySignedRequest checks that the request is recent and that it is
+// signed by one of the keys. Rebuilding old global states is expensive, so
+// the nodes only answer the requests of their operator and of the other
+// members of the roster.
+func verifySignedRequest(hash []byte, timestamp int64, sig []byte, publics []kyber.Point) error {
+	age := time.Since(time.Unix(0, timestamp))
+	if age > maxSignedRequestAge || age < -maxSignedRequestAge {
+		return xerrors.New("the request is too old")
+	}
+	for _, public := range publics {
+		if schnorr.Verify(cothority.Suite, public, hash, sig) == nil {
+			return nil
+		}
+	}
+	return xerrors.New("the request is not signed by an allowed key")
+}
+
+// GetTrieState returns the root of the global state of this node at a block,
+// the values of the requested instances and the instances changed by the
+// block. Unlike GetStateDiff, the rebuilt state is not checked against the
+// block, so that the states of nodes which disagree can be compared. Only the
+// members of the roster of the latest block can send the request.
+func (s *Service) GetTrieState(req *GetTrieState) (*GetTrieStateResponse, error) {
+	sb := s.db().GetByID(req.ID)
+	if sb == nil {
+		return nil, xerrors.New("cannot find skipblock while getting trie state")
+	}
+	scID := sb.SkipChainID()
+
+	latestSB, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest block: %v", err)
+	}
+	err = verifySignedRequest(req.Hash(), req.Timestamp, req.Signature, latestSB.Roster.Publics())
+	if err != nil {
+		return nil, xerrors.Errorf("refusing request: %v", err)
+	}
+
+	st, err := s.getStateTrie(scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	latest := st.GetIndex()
+	if req.Index < 0 || req.Index > latest {
+		return nil, xerrors.Errorf("invalid block index %d, latest is %d",
+			req.Index, latest)
+	}
+
+	sst, err := s.rebuildStagingTrie(st, scID, req.Index, latest)
+	if err != nil {
+		return nil, xerrors.Errorf("rebuilding state of block %d: %v", req.Index, err)
+	}
+
+	resp := &GetTrieStateResponse{
+		TrieIndex: latest,
+		Root:      sst.GetRoot(),
+		Values:    make([][]byte, len(req.Keys)),
+	}
+	for i, key := range req.Keys {
+		resp.Values[i], err = sst.Get(key.Slice())
+		if err != nil {
+			return nil, xerrors.Errorf("reading trie: %v", err)
+		}
+	}
+
+	sces, err := s.stateChangeStorage.getByBlock(scID, req.Index)
+	if err != nil {
+		return nil, xerrors.Errorf("getting state changes: %v", err)
+	}
+	seen := make(map[InstanceID]bool)
+	for _, sce := range sces {
+		iid := NewInstanceID(sce.StateChange.InstanceID)
+		if !seen[iid] {
+			seen[iid] = true
+			resp.ChangedKeys = append(resp.ChangedKeys, iid)
+		}
+	}
+	return resp, nil
+}
+
+// VerifyRosterConsistency asks every member of the roster of the latest block
+// for its global state at a block, and compares it with the root stored in
+// the block. For each divergent member, the first block where its global
+// state diverges is searched by bisection, and the instances changed by this
+// block are compared with a consistent member. The request must be signed with
+// the private key of this node.
+func (s *Service) VerifyRosterConsistency(req *VerifyRosterConsistency) (*VerifyRosterConsistencyResponse, error) {
+	err := verifySignedRequest(req.Hash(), req.Timestamp, req.Signature,
+		[]kyber.Point{s.ServerIdentity().Public})
+	if err != nil {
+		return nil, xerrors.Errorf("refusing request: %v", err)
+	}
+
+	sb := s.db().GetByID(req.ID)
+	if sb == nil {
+		return nil, xerrors.New("cannot find skipblock while verifying the roster")
+	}
+	scID := sb.SkipChainID()
+
+	latest, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest block: %v", err)
+	}
+	index := req.Index
+	if index < 0 {
+		index = latest.Index
+	}
+	if index > latest.Index {
+		return nil, xerrors.Errorf("invalid block index %d, latest is %d",
+			index, latest.Index)
+	}
+
+	v := &rosterVerifier{s: s, scID: scID, roots: make(map[int][]byte)}
+	root, err := v.blockRoot(index)
+	if err != nil {
+		return nil, err
+	}
+	resp := &VerifyRosterConsistencyResponse{
+		Index:    index,
+		TrieRoot: root,
+		Nodes:    make([]RosterConsistencyNode, len(latest.Roster.List)),
+	}
+
+	var wg sync.WaitGroup
+	for i, si := range latest.Roster.List {
+		resp.Nodes[i].ServerIdentity = si
+		wg.Add(1)
+		go func(node *RosterConsistencyNode) {
+			defer wg.Done()
+			reply, err := v.trieState(node.ServerIdentity, index, nil)
+			if err != nil {
+				node.Error = err.Error()
+				return
+			}
+			node.Root = reply.Root
+			node.Consistent = bytes.Equal(reply.Root, root)
+		}(&resp.Nodes[i])
+	}
+	wg.Wait()
+
+	// The divergent members are compared with a consistent one.
+	var reference *network.ServerIdentity
+	for _, node := range resp.Nodes {
+		if node.Consistent {
+			reference = node.ServerIdentity
+			break
+		}
+	}
+	for i := range resp.Nodes {
+		node := &resp.Nodes[i]
+		if node.Error != "" || node.Consistent {
+			continue
+		}
+		log.Warnf("%s: the global state of %s diverges at block %d",
+			s.ServerIdentity(), node.ServerIdentity, index)
+		err := v.findDivergence(node, index, reference)
+		if err != nil {
+			node.Error = err.Error()
+		}
+	}
+	return resp, nil
+}
+
+// rosterVerifier holds the roots of the blocks read during a verification.
+type rosterVerifier struct {
+	s     *Service
+	scID  skipchain.SkipBlockID
+	roots map[int][]byte
+}
+
+// blockRoot returns the root of the global state stored in the block at the
+// index.
+func (v *rosterVerifier) blockRoot(index int) ([]byte, error) {
+	if root, ok := v.roots[index]; ok {
+		return root, nil
+	}
+	reply, err := v.s.skService().GetSingleBlockByIndex(&skipchain.GetSingleBlockByIndex{
+		Genesis: v.scID,
+		Index:   index,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("getting block: %v", err)
+	}
+	header, err := decodeBlockHeader(reply.SkipBlock)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding header: %v", err)
+	}
+	v.roots[index] = header.TrieRoot
+	return header.TrieRoot, nil
+}
+
+// trieState asks the member for its global state at the block, directly if
+// the member is this node. The request is signed by this node.
+func (v *rosterVerifier) trieState(si *network.ServerIdentity, index int, keys []InstanceID) (*GetTrieStateResponse, error) {
+	req := &GetTrieState{ID: v.scID, Index: index, Keys: keys, Timestamp: time.Now().UnixNano()}
+	sig, err := schnorr.Sign(cothority.Suite, v.s.getPrivateKey(), req.Hash())
+	if err != nil {
+		return nil, xerrors.Errorf("signing request: %v", err)
+	}
+	req.Signature = sig
+	if si.Equal(v.s.ServerIdentity()) {
+		return v.s.GetTrieState(req)
+	}
+	reply := &GetTrieStateResponse{}
+	err = onet.NewClient(cothority.Suite, ServiceName).SendProtobuf(si, req, reply)
+	return reply, cothority.ErrorOrNil(err, "request failed")
+}
+
+// findDivergence bisects the blocks up to the index, whose global state
+// differs on the node, to find the first one where the node diverges. Then
+// the instances changed by this block are compared with the reference.
+func (v *rosterVerifier) findDivergence(node *RosterConsistencyNode, index int, reference *network.ServerIdentity) error {
+	// The global state of the node is the one of the block at good, which
+	// is -1 before the genesis block, and different at bad.
+	good, bad := -1, index
+	for bad-good > 1 {
+		mid := (good + bad) / 2
+		root, err := v.blockRoot(mid)
+		if err != nil {
+			return err
+		}
+		reply, err := v.trieState(node.ServerIdentity, mid, nil)
+		if err != nil {
+			node.FirstDivergence = bad
+			return xerrors.Errorf("getting state of block %d: %v", mid, err)
+		}
+		if bytes.Equal(reply.Root, root) {
+			good = mid
+		} else {
+			bad = mid
+		}
+	}
+	node.FirstDivergence = bad
+	if reference == nil {
+		return xerrors.New("no consistent member to compare with")
+	}
+
+	nodeChanges, err := v.trieState(node.ServerIdentity, bad, nil)
+	if err != nil {
+		return xerrors.Errorf("getting state changes of the node: %v", err)
+	}
+	refChanges, err := v.trieState(reference, bad, nil)
+	if err != nil {
+		return xerrors.Errorf("getting state changes of the reference: %v", err)
+	}
+	var keys []InstanceID
+	seen := make(map[InstanceID]bool)
+	for _, key := range append(refChanges.ChangedKeys, nodeChanges.ChangedKeys...) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	nodeState, err := v.trieState(node.ServerIdentity, bad, keys)
+	if err != nil {
+		return xerrors.Errorf("getting values of the node: %v", err)
+	}
+	refState, err := v.trieState(reference, bad, keys)
+	if err != nil {
+		return xerrors.Errorf("getting values of the reference: %v", err)
+	}
+	if len(nodeState.Values) != len(keys) || len(refState.Values) != len(keys) {
+		return xerrors.New("wrong number of values")
+	}
+	for i, key := range keys {
+		if !bytes.Equal(nodeState.Values[i], refState.Values[i]) {
+			node.DivergentInstances = append(node.DivergentInstances, key)
+		}
+	}
+	return nil
+}
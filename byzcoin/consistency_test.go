@@ -0,0 +1,107 @@
+package byzcoin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/kyber/v3/sign/schnorr"
+)
+
+// signRosterConsistency signs the request with the private key of the service.
+func signRosterConsistency(t *testing.T, s *Service, req *VerifyRosterConsistency) *VerifyRosterConsistency {
+	req.Timestamp = time.Now().UnixNano()
+	sig, err := schnorr.Sign(cothority.Suite, s.getPrivateKey(), req.Hash())
+	require.NoError(t, err)
+	req.Signature = sig
+	return req
+}
+
+func TestService_VerifyRosterConsistency(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	var ids []InstanceID
+	for i, value := range []string{"first", "second"} {
+		in := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte(value))
+		in.SignerIdentities = []darc.Identity{s.signer.Identity()}
+		in.SignerCounter = []uint64{uint64(i + 1)}
+		ids = append(ids, NewInstanceID(in.Hash()))
+		tx, err := combineInstrsAndSign(s.signer, in)
+		require.NoError(t, err)
+		s.sendTxAndWait(t, tx, 10)
+	}
+	s.waitPropagation(t, 2)
+
+	// The request must be signed by the node.
+	req := &VerifyRosterConsistency{ID: s.genesis.Hash, Index: -1}
+	_, err := s.service().VerifyRosterConsistency(req)
+	require.Error(t, err)
+	signRosterConsistency(t, s.services[1], req)
+	_, err = s.service().VerifyRosterConsistency(req)
+	require.Error(t, err)
+
+	signRosterConsistency(t, s.service(), req)
+	resp, err := s.service().VerifyRosterConsistency(req)
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.Index)
+	require.Equal(t, len(s.roster.List), len(resp.Nodes))
+	for _, node := range resp.Nodes {
+		require.Empty(t, node.Error)
+		require.True(t, node.Consistent)
+		require.Equal(t, resp.TrieRoot, node.Root)
+	}
+
+	// The last member stores another value for the second instance.
+	divergent := s.services[len(s.services)-1]
+	sce, ok, err := divergent.stateChangeStorage.getLast(ids[1][:], s.genesis.SkipChainID())
+	require.NoError(t, err)
+	require.True(t, ok)
+	sc := sce.StateChange.Copy()
+	sc.Value = []byte("divergent")
+	sb, err := divergent.skService().GetSingleBlockByIndex(&skipchain.GetSingleBlockByIndex{
+		Genesis: s.genesis.SkipChainID(),
+		Index:   sce.BlockIndex,
+	})
+	require.NoError(t, err)
+	require.NoError(t, divergent.stateChangeStorage.append(StateChanges{sc}, sb.SkipBlock))
+	st, err := divergent.getStateTrie(s.genesis.SkipChainID())
+	require.NoError(t, err)
+	require.NoError(t, st.StoreAll(StateChanges{sc}, st.GetIndex(), st.GetVersion()))
+
+	resp, err = s.service().VerifyRosterConsistency(req)
+	require.NoError(t, err)
+	for i, node := range resp.Nodes {
+		require.Empty(t, node.Error)
+		if i < len(resp.Nodes)-1 {
+			require.True(t, node.Consistent)
+			continue
+		}
+		require.False(t, node.Consistent)
+		require.Equal(t, sce.BlockIndex, node.FirstDivergence)
+		require.Equal(t, []InstanceID{ids[1]}, node.DivergentInstances)
+	}
+
+	// The states of the earlier blocks are still consistent.
+	resp, err = s.service().VerifyRosterConsistency(signRosterConsistency(t, s.service(),
+		&VerifyRosterConsistency{ID: s.genesis.Hash, Index: sce.BlockIndex - 1}))
+	require.NoError(t, err)
+	for _, node := range resp.Nodes {
+		require.True(t, node.Consistent)
+	}
+
+	req.Index = 10
+	_, err = s.service().VerifyRosterConsistency(signRosterConsistency(t, s.service(), req))
+	require.Error(t, err)
+
+	// The global states are only sent to the members of the roster.
+	_, err = s.service().GetTrieState(&GetTrieState{
+		ID:        s.genesis.Hash,
+		Index:     0,
+		Timestamp: time.Now().UnixNano(),
+	})
+	require.Error(t, err)
+}
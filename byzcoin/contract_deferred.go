@@ -161,6 +161,9 @@ func (c *contractDeferred) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins
 	//   - identity darc.Identity
 	//   - signature []byte
 	//   - index uint32 (index of the instruction wrt the transaction)
+	//
+	// Invoke:execProposedTx can have the following input argument:
+	//   - proofs DeferredProofs (optional, signatures collected off-chain)
 	err = c.checkInvoke(rst, inst.Invoke)
 	if err != nil {
 		return nil, nil, xerrors.Errorf("checks of invoke failed: %v", err)
@@ -229,6 +232,25 @@ func (c *contractDeferred) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins
 		// method like the "processOneTx" one because it involved quite a lot
 		// of changes and would bring more complexity compared to the benefits.
 
+		// The signatures collected off-chain are added as if they had been
+		// given with addProof.
+		if proofsBuf := inst.Invoke.Args.Search("proofs"); proofsBuf != nil {
+			var proofs DeferredProofs
+			err = protobuf.Decode(proofsBuf, &proofs)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("couldn't decode proofs: %v", err)
+			}
+			for _, proof := range proofs.Proofs {
+				err = c.DeferredData.verifyProof(proof)
+				if err != nil {
+					return nil, nil, xerrors.Errorf("invalid proof: %v", err)
+				}
+				instr := &c.DeferredData.ProposedTransaction.Instructions[proof.Index]
+				instr.SignerIdentities = append(instr.SignerIdentities, proof.Identity)
+				instr.Signatures = append(instr.Signatures, proof.Signature)
+			}
+		}
+
 		instructionIDs := make([][]byte, len(c.DeferredData.ProposedTransaction.Instructions))
 
 		for i, proposedInstr := range c.DeferredData.ProposedTransaction.Instructions {
@@ -410,6 +432,24 @@ func (c *contractDeferred) VerifyDeferredInstruction(rst ReadOnlyStateTrie, inst
 	return nil
 }
 
+// verifyProof checks that the proof is a valid signature of an instruction
+// of the proposed transaction by an identity that didn't sign it yet.
+func (dd DeferredData) verifyProof(proof DeferredProof) error {
+	numInstruction := len(dd.ProposedTransaction.Instructions)
+	if proof.Index >= uint32(numInstruction) {
+		return xerrors.Errorf("index is out of range (%d >= %d)", proof.Index, numInstruction)
+	}
+	for _, storedIdentity := range dd.ProposedTransaction.Instructions[proof.Index].SignerIdentities {
+		if proof.Identity.Equal(&storedIdentity) {
+			return xerrors.New("identity already stored")
+		}
+	}
+	if err := proof.Identity.Verify(dd.InstructionHashes[proof.Index], proof.Signature); err != nil {
+		return xerrors.New("bad signature")
+	}
+	return nil
+}
+
 // This is a modified version of computing the hash of a transaction. In this
 // version, we do not take into account the signers nor the signers counters. We
 // also add to the hash the instanceID of the deferred contract.
@@ -0,0 +1,184 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin/mmr"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// The log contract is an append-only list of entries. The entries are the
+// leaves of a Merkle Mountain Range whose peaks and root are kept in the
+// instance, so that the inclusion of an entry can be proven with a few hashes
+// and the proof of the instance. Every node of the range is stored in its own
+// instance, at logNodeID, when it is created.
+
+// ContractLogID denotes a contract that appends entries to a log.
+var ContractLogID = "log"
+
+const cmdLogAppend = "append"
+
+// LogData contains the specific data of a log instance.
+type LogData struct {
+	// Size is the number of entries in the log.
+	Size uint64
+	// Peaks are the hashes of the peaks of the range, from the highest to
+	// the lowest.
+	Peaks [][]byte `protobuf:"opt"`
+	// Root is the root of the range, computed from the peaks. It is empty as
+	// long as the log is.
+	Root []byte `protobuf:"opt"`
+}
+
+// String returns a human readable string representation of the log data.
+func (ld LogData) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintf(out, "- Size: %d\n", ld.Size)
+	fmt.Fprintf(out, "- Root: %x\n", ld.Root)
+	return out.String()
+}
+
+// logNode is the content of the instance holding a node of the range. Only
+// the leaves have data.
+type logNode struct {
+	Hash []byte
+	Data []byte `protobuf:"opt"`
+}
+
+type contractLog struct {
+	BasicContract
+	LogData
+}
+
+func contractLogFromBytes(in []byte) (Contract, error) {
+	c := &contractLog{}
+
+	err := protobuf.Decode(in, &c.LogData)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// Spawn creates an empty log.
+func (c *contractLog) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+
+	buf, err := protobuf.Encode(&LogData{})
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding log: %v", err)
+	}
+	return []StateChange{
+		NewStateChange(Create, inst.DeriveID(""), ContractLogID, buf, darcID),
+	}, coins, nil
+}
+
+// Invoke appends the argument "entry" to the log.
+func (c *contractLog) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+
+	if inst.Invoke.Command != cmdLogAppend {
+		return nil, nil, xerrors.Errorf("unknown command: %s", inst.Invoke.Command)
+	}
+	entry := inst.Invoke.Args.Search("entry")
+	if len(entry) == 0 {
+		return nil, nil, xerrors.New("missing entry")
+	}
+
+	peaks, nodes, err := mmr.Append(c.Size, c.Peaks, entry)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("appending entry: %v", err)
+	}
+
+	var scs StateChanges
+	for i, node := range nodes {
+		ln := logNode{Hash: node.Hash}
+		if i == 0 {
+			ln.Data = entry
+		}
+		buf, err := protobuf.Encode(&ln)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("encoding node: %v", err)
+		}
+		scs = append(scs, NewStateChange(Create, logNodeID(inst.InstanceID, node.NodeID), "", buf, darcID))
+	}
+
+	c.LogData = LogData{
+		Size:  c.Size + 1,
+		Peaks: peaks,
+		Root:  mmr.Root(peaks),
+	}
+	buf, err := protobuf.Encode(&c.LogData)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding log: %v", err)
+	}
+	scs = append(scs, NewStateChange(Update, inst.InstanceID, ContractLogID, buf, darcID))
+	return scs, coins, nil
+}
+
+// logNodeID returns the ID of the instance holding the node of the log.
+func logNodeID(logID InstanceID, id mmr.NodeID) InstanceID {
+	h := sha256.New()
+	h.Write([]byte("log_node_"))
+	h.Write(logID.Slice())
+	binary.Write(h, binary.LittleEndian, id.Height)
+	binary.Write(h, binary.LittleEndian, id.Index)
+	return NewInstanceID(h.Sum(nil))
+}
+
+// loadLogNode returns the node of the log stored in the trie.
+func loadLogNode(rst ReadOnlyStateTrie, logID InstanceID, id mmr.NodeID) (*logNode, error) {
+	buf, _, _, _, err := rst.GetValues(logNodeID(logID, id).Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("reading node %v: %v", id, err)
+	}
+	var ln logNode
+	err = protobuf.Decode(buf, &ln)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding node: %v", err)
+	}
+	return &ln, nil
+}
+
+// Verify checks that the entry of the response is at the index of the log,
+// and that the log is part of the skipchain.
+func (r GetLogEntryResponse) Verify(scID skipchain.SkipBlockID, logID InstanceID, index uint64) error {
+	err := r.Proof.Verify(scID)
+	if err != nil {
+		return xerrors.Errorf("verifying proof: %v", err)
+	}
+	key, _, _, _, err := r.Proof.KeyValue()
+	if err != nil {
+		return xerrors.Errorf("reading proof: %v", err)
+	}
+	if !bytes.Equal(key, logID.Slice()) {
+		return xerrors.New("proof is for another instance")
+	}
+
+	var ld LogData
+	err = r.Proof.VerifyAndDecode(cothority.Suite, ContractLogID, &ld)
+	if err != nil {
+		return xerrors.Errorf("decoding log: %v", err)
+	}
+	if !bytes.Equal(mmr.Root(ld.Peaks), ld.Root) {
+		return xerrors.New("peaks don't match the root")
+	}
+	err = mmr.Verify(r.Entry, index, ld.Size, r.Siblings, ld.Peaks)
+	if err != nil {
+		return xerrors.Errorf("verifying entry: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package byzcoin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin/mmr"
+	"go.dedis.ch/protobuf"
+)
+
+func TestLogNodeID(t *testing.T) {
+	logID := NewInstanceID([]byte("log"))
+	require.Equal(t, logNodeID(logID, mmr.NodeID{Index: 1}), logNodeID(logID, mmr.NodeID{Index: 1}))
+	require.NotEqual(t, logNodeID(logID, mmr.NodeID{Index: 1}), logNodeID(logID, mmr.NodeID{Height: 1, Index: 1}))
+	require.NotEqual(t, logNodeID(logID, mmr.NodeID{Index: 1}),
+		logNodeID(NewInstanceID([]byte("other")), mmr.NodeID{Index: 1}))
+}
+
+func TestContractLog(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	spawn := createSpawnInstr(s.darc.GetBaseID(), ContractLogID, "", nil)
+	spawn.SignerCounter = []uint64{2}
+	tx, err := combineInstrsAndSign(s.signer, spawn)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	logID := tx.Instructions[0].DeriveID("")
+
+	// An empty entry is refused.
+	instr := createInvokeInstr(logID, ContractLogID, cmdLogAppend, "entry", nil)
+	instr.SignerCounter = []uint64{3}
+	tx, err = combineInstrsAndSign(s.signer, instr)
+	require.NoError(t, err)
+	resp, err := s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.genesis.SkipChainID(),
+		Transaction:   tx,
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Error)
+
+	n := 5
+	var instrs []Instruction
+	for i := 0; i < n; i++ {
+		instr := createInvokeInstr(logID, ContractLogID, cmdLogAppend, "entry",
+			[]byte(fmt.Sprintf("entry %d", i)))
+		instr.SignerCounter = []uint64{uint64(3 + i)}
+		instrs = append(instrs, instr)
+	}
+	tx, err = combineInstrsAndSign(s.signer, instrs...)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+
+	pr := s.waitProof(t, logID)
+	value, contractID, _, err := pr.Get(logID.Slice())
+	require.NoError(t, err)
+	require.Equal(t, ContractLogID, contractID)
+	var ld LogData
+	require.NoError(t, protobuf.Decode(value, &ld))
+	require.Equal(t, uint64(n), ld.Size)
+	require.Equal(t, mmr.Root(ld.Peaks), ld.Root)
+
+	for i := 0; i < n; i++ {
+		entry, err := s.service().GetLogEntry(&GetLogEntry{
+			SkipChainID: s.genesis.SkipChainID(),
+			LogID:       logID,
+			Index:       uint64(i),
+		})
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("entry %d", i)), entry.Entry)
+		require.NoError(t, entry.Verify(s.genesis.SkipChainID(), logID, uint64(i)))
+		require.Error(t, entry.Verify(s.genesis.SkipChainID(), logID, uint64((i+1)%n)))
+		require.Error(t, entry.Verify(s.genesis.SkipChainID(), NewInstanceID(nil), uint64(i)))
+
+		entry.Entry = []byte("forged")
+		require.Error(t, entry.Verify(s.genesis.SkipChainID(), logID, uint64(i)))
+	}
+
+	_, err = s.service().GetLogEntry(&GetLogEntry{
+		SkipChainID: s.genesis.SkipChainID(),
+		LogID:       logID,
+		Index:       uint64(n),
+	})
+	require.Error(t, err)
+}
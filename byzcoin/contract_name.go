@@ -1,9 +1,11 @@
 package byzcoin
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strings"
 
 	"go.dedis.ch/cothority/v3"
@@ -29,8 +31,18 @@ import (
 // To get back a named instance ID, you should use the byzcoin API -
 // ResolveInstanceID. You need to provide a darc ID and the name. The darc ID
 // is the one that "guards" the the instance.
+//
+// Once the version 1 of the contract is activated with the upgrade_contract
+// command of the config contract, the names are hierarchical: they are made
+// of labels separated by dots, like "team.project.config". The contract then
+// also keeps an index of the names of each darc and of each instance, which
+// are used by the ListNames and ResolveNames APIs.
 const ContractNamingID = "naming"
 
+// ContractNamingIndexedVersion is the version of the naming contract that
+// checks the hierarchical names and keeps the indexes of the names.
+const ContractNamingIndexedVersion = 1
+
 // ContractNamingBody holds a reference of the latest naming entries. These
 // entries form a reversed linked list of. It is possible to traverse the
 // reversed linked list to find all the naming entries.
@@ -44,6 +56,9 @@ var NamingInstanceID = InstanceID([32]byte{1})
 type contractNaming struct {
 	BasicContract
 	ContractNamingBody
+	// indexed is true for the version of the contract that keeps the
+	// indexes of the names.
+	indexed bool
 }
 
 // String returns a human readable string representation of ContractNamingBody
@@ -65,6 +80,15 @@ func contractNamingFromBytes(in []byte) (Contract, error) {
 	return c, nil
 }
 
+func contractNamingIndexedFromBytes(in []byte) (Contract, error) {
+	c, err := contractNamingFromBytes(in)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding: %v", err)
+	}
+	c.(*contractNaming).indexed = true
+	return c, nil
+}
+
 func (c *contractNaming) VerifyInstruction(rst ReadOnlyStateTrie, inst Instruction, msg []byte) error {
 	pr, err := rst.GetProof(NamingInstanceID.Slice())
 	if err != nil {
@@ -201,6 +225,11 @@ func (c *contractNaming) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins [
 		if len(name) == 0 {
 			return nil, nil, xerrors.New("the name cannot be empty")
 		}
+		if c.indexed {
+			if err := checkHierarchicalName(string(name)); err != nil {
+				return nil, nil, xerrors.Errorf("invalid name: %v", err)
+			}
+		}
 		h := sha256.New()
 		h.Write(dID)
 		h.Write([]byte{'/'})
@@ -246,6 +275,15 @@ func (c *contractNaming) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins [
 			NewStateChange(Create, key, "", entryBuf, nil),
 			NewStateChange(Update, NamingInstanceID, ContractNamingID, contractBuf, nil),
 		}
+		if c.indexed {
+			named := NamedInstance{DarcID: dID, Name: string(name), InstanceID: NewInstanceID(iID)}
+			var isc StateChanges
+			isc, err = updateNamingIndexes(rst, named, true)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("updating indexes: %v", err)
+			}
+			sc = append(sc, isc...)
+		}
 		return sc, coins, nil
 	case "remove":
 		iID := inst.Invoke.Args.Search("instanceID")
@@ -292,8 +330,140 @@ func (c *contractNaming) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins [
 		sc := StateChanges{
 			NewStateChange(Update, key, "", entryBuf, nil),
 		}
+		if c.indexed {
+			named := NamedInstance{DarcID: dID, Name: string(name), InstanceID: oldEntry.IID}
+			var isc StateChanges
+			isc, err = updateNamingIndexes(rst, named, false)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("updating indexes: %v", err)
+			}
+			sc = append(sc, isc...)
+		}
 		return sc, coins, nil
 	default:
 		return nil, nil, xerrors.New("invalid invoke command: " + inst.Invoke.Command)
 	}
 }
+
+// checkHierarchicalName verifies that the name is made of labels separated by
+// dots. A label cannot be empty and is made of letters, digits, '-' and '_'.
+func checkHierarchicalName(name string) error {
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return xerrors.Errorf("empty label in '%s'", name)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+				r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return xerrors.Errorf("invalid character '%c' in '%s'", r, name)
+			}
+		}
+	}
+	return nil
+}
+
+// hasNamePrefix returns true if the name is the prefix itself or one of the
+// names below it in the hierarchy. Every name has the empty prefix.
+func hasNamePrefix(name, prefix string) bool {
+	if prefix == "" || name == prefix {
+		return true
+	}
+	return strings.HasPrefix(name, prefix+".")
+}
+
+// namingIndex is the value of the instances holding the names of a darc or of
+// an instance.
+type namingIndex struct {
+	Names []NamedInstance
+}
+
+// namingDarcIndexID returns the ID of the instance holding the names given
+// under the darc.
+func namingDarcIndexID(id darc.ID) InstanceID {
+	h := sha256.New()
+	h.Write([]byte("naming_darc_"))
+	h.Write(id)
+	return NewInstanceID(h.Sum(nil))
+}
+
+// namingInstanceIndexID returns the ID of the instance holding the names
+// given to the instance.
+func namingInstanceIndexID(id InstanceID) InstanceID {
+	h := sha256.New()
+	h.Write([]byte("naming_instance_"))
+	h.Write(id.Slice())
+	return NewInstanceID(h.Sum(nil))
+}
+
+// loadNamingIndex reads the index stored at the key. The index is empty if it
+// has not been created yet.
+func loadNamingIndex(rst ReadOnlyStateTrie, key InstanceID) (*namingIndex, bool, error) {
+	idx := &namingIndex{}
+	buf, _, _, _, err := rst.GetValues(key.Slice())
+	if xerrors.Is(err, errKeyNotSet) {
+		return idx, false, nil
+	}
+	if err != nil {
+		return nil, false, xerrors.Errorf("reading trie: %v", err)
+	}
+	err = protobuf.Decode(buf, idx)
+	if err != nil {
+		return nil, false, xerrors.Errorf("decoding: %v", err)
+	}
+	return idx, true, nil
+}
+
+// updateNamingIndexes returns the state changes that add or remove the name
+// in the index of the darc and in the one of the instance.
+func updateNamingIndexes(rst ReadOnlyStateTrie, named NamedInstance, add bool) (StateChanges, error) {
+	var scs StateChanges
+	for _, key := range []InstanceID{namingDarcIndexID(named.DarcID), namingInstanceIndexID(named.InstanceID)} {
+		idx, exists, err := loadNamingIndex(rst, key)
+		if err != nil {
+			return nil, xerrors.Errorf("loading index: %v", err)
+		}
+
+		pos := sort.Search(len(idx.Names), func(i int) bool {
+			return !idx.Names[i].less(named)
+		})
+		found := pos < len(idx.Names) && idx.Names[pos].equal(named)
+		if add {
+			if found {
+				return nil, xerrors.New("name already in the index")
+			}
+			idx.Names = append(idx.Names, NamedInstance{})
+			copy(idx.Names[pos+1:], idx.Names[pos:])
+			idx.Names[pos] = named
+		} else {
+			// Names added before the activation of the index are
+			// not in it.
+			if !found {
+				continue
+			}
+			idx.Names = append(idx.Names[:pos], idx.Names[pos+1:]...)
+		}
+
+		buf, err := protobuf.Encode(idx)
+		if err != nil {
+			return nil, xerrors.Errorf("encoding: %v", err)
+		}
+		action := Update
+		if !exists {
+			action = Create
+		}
+		scs = append(scs, NewStateChange(action, key, "", buf, nil))
+	}
+	return scs, nil
+}
+
+// less orders the names by darc, then by name.
+func (ni NamedInstance) less(other NamedInstance) bool {
+	if c := bytes.Compare(ni.DarcID, other.DarcID); c != 0 {
+		return c < 0
+	}
+	return ni.Name < other.Name
+}
+
+func (ni NamedInstance) equal(other NamedInstance) bool {
+	return ni.DarcID.Equal(other.DarcID) && ni.Name == other.Name
+}
@@ -385,3 +385,173 @@ func TestService_Naming(t *testing.T) {
 	_, _, _, _, err = pResp.Proof.KeyValue()
 	require.NoError(t, err)
 }
+
+func TestCheckHierarchicalName(t *testing.T) {
+	require.NoError(t, checkHierarchicalName("config"))
+	require.NoError(t, checkHierarchicalName("team.project-1.my_config"))
+	require.Error(t, checkHierarchicalName(""))
+	require.Error(t, checkHierarchicalName(".team"))
+	require.Error(t, checkHierarchicalName("team."))
+	require.Error(t, checkHierarchicalName("team..config"))
+	require.Error(t, checkHierarchicalName("my config"))
+	require.Error(t, checkHierarchicalName("team/config"))
+}
+
+func TestHasNamePrefix(t *testing.T) {
+	require.True(t, hasNamePrefix("team", ""))
+	require.True(t, hasNamePrefix("team", "team"))
+	require.True(t, hasNamePrefix("team.project", "team"))
+	require.True(t, hasNamePrefix("team.project.config", "team.project"))
+	require.False(t, hasNamePrefix("teammate", "team"))
+	require.False(t, hasNamePrefix("team", "team.project"))
+}
+
+func TestUpdateNamingIndexes(t *testing.T) {
+	st, err := newMemStateTrie([]byte("nonce"))
+	require.NoError(t, err)
+
+	iid := NewInstanceID([]byte("instance"))
+	b := NamedInstance{DarcID: darc.ID("darc"), Name: "b", InstanceID: iid}
+	a := NamedInstance{DarcID: darc.ID("darc"), Name: "a", InstanceID: iid}
+
+	// The indexes are created by the first name.
+	scs, err := updateNamingIndexes(st, b, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(scs))
+	require.Equal(t, Create, scs[0].StateAction)
+	require.NoError(t, st.StoreAll(scs, 0, CurrentVersion))
+
+	scs, err = updateNamingIndexes(st, a, true)
+	require.NoError(t, err)
+	require.Equal(t, Update, scs[0].StateAction)
+	require.NoError(t, st.StoreAll(scs, 1, CurrentVersion))
+
+	for _, key := range []InstanceID{namingDarcIndexID(a.DarcID), namingInstanceIndexID(iid)} {
+		idx, exists, err := loadNamingIndex(st, key)
+		require.NoError(t, err)
+		require.True(t, exists)
+		require.Equal(t, []NamedInstance{a, b}, idx.Names)
+	}
+
+	_, err = updateNamingIndexes(st, a, true)
+	require.Error(t, err)
+
+	scs, err = updateNamingIndexes(st, b, false)
+	require.NoError(t, err)
+	require.NoError(t, st.StoreAll(scs, 2, CurrentVersion))
+	idx, _, err := loadNamingIndex(st, namingDarcIndexID(a.DarcID))
+	require.NoError(t, err)
+	require.Equal(t, []NamedInstance{a}, idx.Names)
+
+	// Removing a name that is not indexed doesn't change anything.
+	scs, err = updateNamingIndexes(st, b, false)
+	require.NoError(t, err)
+	require.Empty(t, scs)
+}
+
+func namingInstr(cmd string, iid InstanceID, name string, counter uint64) Instruction {
+	return Instruction{
+		InstanceID: NamingInstanceID,
+		Invoke: &Invoke{
+			ContractID: ContractNamingID,
+			Command:    cmd,
+			Args: Arguments{
+				{Name: "instanceID", Value: iid.Slice()},
+				{Name: "name", Value: []byte(name)},
+			},
+		},
+		SignerCounter: []uint64{counter},
+	}
+}
+
+// TestService_NamingIndexed activates the version of the naming contract that
+// keeps the indexes and checks the listing and the reverse lookup.
+func TestService_NamingIndexed(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	latest, err := s.service().db().GetLatestByID(s.genesis.SkipChainID())
+	require.NoError(t, err)
+
+	// The upgrade and the spawn of the naming instance each create a
+	// block, so that the names are added with the new version.
+	cv := ContractVersion{ContractID: ContractNamingID, Version: ContractNamingIndexedVersion, Index: latest.Index + 3}
+	s.sendTxAndWait(t, createUpgradeContractTx(t, s, cv, 2), 10)
+
+	spawn := Instruction{
+		InstanceID:    NewInstanceID(s.darc.GetBaseID()),
+		Spawn:         &Spawn{ContractID: ContractNamingID},
+		SignerCounter: []uint64{3},
+	}
+	tx, err := combineInstrsAndSign(s.signer, spawn)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+
+	iid := NewInstanceID(s.darc.GetBaseID())
+	tx, err = combineInstrsAndSign(s.signer,
+		namingInstr("add", iid, "team", 4),
+		namingInstr("add", iid, "team.project.config", 5),
+		namingInstr("add", iid, "team.other", 6),
+		namingInstr("add", iid, "teammate", 7))
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+
+	// Names must be hierarchical.
+	tx, err = combineInstrsAndSign(s.signer, namingInstr("add", iid, "team..config", 8))
+	require.NoError(t, err)
+	resp, err := s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.genesis.SkipChainID(),
+		Transaction:   tx,
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	require.Contains(t, resp.Error, "invalid name")
+
+	listNames := func(prefix string) []string {
+		reply, err := s.service().ListNames(&ListNames{
+			SkipChainID: s.genesis.SkipChainID(),
+			DarcID:      s.darc.GetBaseID(),
+			Prefix:      prefix,
+		})
+		require.NoError(t, err)
+		var names []string
+		for _, named := range reply.Names {
+			require.Equal(t, iid, named.InstanceID)
+			names = append(names, named.Name)
+		}
+		return names
+	}
+	require.Equal(t, []string{"team", "team.other", "team.project.config", "teammate"}, listNames(""))
+	require.Equal(t, []string{"team", "team.other", "team.project.config"}, listNames("team"))
+	require.Equal(t, []string{"team.project.config"}, listNames("team.project"))
+	require.Empty(t, listNames("other"))
+
+	reply, err := s.service().ResolveNames(&ResolveNames{
+		SkipChainID: s.genesis.SkipChainID(),
+		InstanceID:  iid,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(reply.Names))
+
+	resolved, err := s.service().ResolveInstanceID(&ResolveInstanceID{
+		SkipChainID: s.genesis.SkipChainID(),
+		DarcID:      s.darc.GetBaseID(),
+		Name:        "team.project.config",
+	})
+	require.NoError(t, err)
+	require.Equal(t, iid, resolved.InstanceID)
+
+	// A removed name disappears from the indexes.
+	tx, err = combineInstrsAndSign(s.signer, namingInstr("remove", iid, "team.other", 8))
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	require.Equal(t, []string{"team", "team.project.config"}, listNames("team"))
+
+	reply, err = s.service().ResolveNames(&ResolveNames{
+		SkipChainID: s.genesis.SkipChainID(),
+		InstanceID:  iid,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, len(reply.Names))
+}
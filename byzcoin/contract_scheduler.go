@@ -0,0 +1,341 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// The scheduler contract holds an instruction signed in advance that is
+// executed once a block index or a time is reached. The leader adds the
+// executions of the due instructions at the beginning of the blocks, with the
+// timestamp of the block so that the followers can verify it.
+
+// ContractSchedulerID denotes a contract that executes a pre-signed
+// instruction at or after a block index or a timestamp.
+var ContractSchedulerID = "scheduler"
+
+const (
+	cmdSchedulerExecute = "execute"
+	cmdSchedulerCancel  = "cancel"
+)
+
+// ScheduledData contains the specific data of a scheduler instance.
+type ScheduledData struct {
+	// Instruction is executed once the conditions are met. Its signatures
+	// are computed on the hash returned by ScheduledHash.
+	Instruction Instruction
+	// BlockIndex is the index of the first block that can execute the
+	// instruction. Zero means there is no condition on the index.
+	BlockIndex uint64
+	// Timestamp, in nanoseconds since the epoch, is the earliest timestamp of
+	// the block that can execute the instruction. Zero means there is no
+	// condition on the time.
+	Timestamp int64
+	// Executed is true once the instruction has been executed, successfully
+	// or not.
+	Executed bool
+	// Cancelled is true if the instance has been cancelled before the
+	// execution.
+	Cancelled bool
+	// Error holds the reason why the execution of the instruction failed.
+	Error string
+}
+
+// String returns a human readable string representation of the scheduled
+// data.
+func (sd ScheduledData) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Instruction:\n")
+	out.WriteString(eachLine.ReplaceAllString(sd.Instruction.String(), "-$1"))
+	fmt.Fprintf(out, "- Block index: %d\n", sd.BlockIndex)
+	fmt.Fprintf(out, "- Timestamp: %d\n", sd.Timestamp)
+	fmt.Fprintf(out, "- Executed: %t\n", sd.Executed)
+	fmt.Fprintf(out, "- Cancelled: %t\n", sd.Cancelled)
+	if sd.Error != "" {
+		fmt.Fprintf(out, "- Error: %s\n", sd.Error)
+	}
+	return out.String()
+}
+
+// pending returns true if the instruction is still waiting to be executed.
+func (sd ScheduledData) pending() bool {
+	return !sd.Executed && !sd.Cancelled
+}
+
+// isDue returns true if the instruction can be executed in the block with the
+// given index and timestamp.
+func (sd ScheduledData) isDue(index uint64, timestamp int64) bool {
+	return index >= sd.BlockIndex && timestamp >= sd.Timestamp
+}
+
+// ScheduledHash returns the hash that the signers of a scheduled instruction
+// must sign. It is also the ID of the scheduler instance, so that the same
+// signatures can't be used twice. The signer counters are not part of it as
+// they are ignored during the execution. The instruction is hashed with the
+// given version, which is the one of the latest block of the chain.
+func ScheduledHash(instr Instruction, version Version, blockIndex uint64, timestamp int64) []byte {
+	h := sha256.New()
+	h.Write([]byte(ContractSchedulerID))
+	instr.version = version
+	instr.hashType(h)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, blockIndex)
+	h.Write(buf)
+	binary.LittleEndian.PutUint64(buf, uint64(timestamp))
+	h.Write(buf)
+	return h.Sum(nil)
+}
+
+type contractScheduler struct {
+	BasicContract
+	ScheduledData
+	contracts ReadOnlyContractRegistry
+}
+
+func contractSchedulerFromBytes(in []byte) (Contract, error) {
+	c := &contractScheduler{}
+
+	err := protobuf.Decode(in, &c.ScheduledData)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+// SetRegistry keeps the reference of the contract registry.
+func (c *contractScheduler) SetRegistry(r ReadOnlyContractRegistry) {
+	c.contracts = r
+}
+
+// VerifyInstruction lets anybody execute a scheduled instruction once it is
+// due, as it has been signed beforehand. The other instructions are verified
+// against the darc of the instance.
+func (c *contractScheduler) VerifyInstruction(rst ReadOnlyStateTrie, inst Instruction, ctxHash []byte) error {
+	if inst.GetType() == InvokeType && inst.Invoke.Command == cmdSchedulerExecute {
+		if inst.Invoke.ContractID != ContractSchedulerID {
+			return xerrors.Errorf("wrong contract ID %s", inst.Invoke.ContractID)
+		}
+		return c.checkDue(rst, inst)
+	}
+	return c.BasicContract.VerifyInstruction(rst, inst, ctxHash)
+}
+
+// checkDue returns an error if the instruction can't be executed in the block
+// following the state. The timestamp of the block is given by the leader and
+// checked by the followers.
+func (c *contractScheduler) checkDue(rst ReadOnlyStateTrie, inst Instruction) error {
+	if !c.ScheduledData.pending() {
+		return xerrors.New("instruction is not pending anymore")
+	}
+	buf := inst.Invoke.Args.Search("timestamp")
+	if len(buf) != 8 {
+		return xerrors.New("timestamp must be 8 bytes")
+	}
+	timestamp := int64(binary.LittleEndian.Uint64(buf))
+	if !c.ScheduledData.isDue(uint64(rst.GetIndex()+1), timestamp) {
+		return xerrors.New("instruction is not due yet")
+	}
+	return nil
+}
+
+func (c *contractScheduler) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	// Spawn should have those input arguments:
+	//   - instruction Instruction
+	//   - blockIndex uint64 (optional)
+	//   - timestamp uint64 (optional, in nanoseconds)
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+
+	var data ScheduledData
+	err = protobuf.Decode(inst.Spawn.Args.Search("instruction"), &data.Instruction)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't decode instruction: %v", err)
+	}
+	if buf := inst.Spawn.Args.Search("blockIndex"); buf != nil {
+		if len(buf) != 8 {
+			return nil, nil, xerrors.New("blockIndex must be 8 bytes")
+		}
+		data.BlockIndex = binary.LittleEndian.Uint64(buf)
+	}
+	if buf := inst.Spawn.Args.Search("timestamp"); buf != nil {
+		if len(buf) != 8 {
+			return nil, nil, xerrors.New("timestamp must be 8 bytes")
+		}
+		data.Timestamp = int64(binary.LittleEndian.Uint64(buf))
+	}
+	if data.BlockIndex == 0 && data.Timestamp <= 0 {
+		return nil, nil, xerrors.New("need a block index or a timestamp")
+	}
+
+	instr := data.Instruction
+	if instr.GetType() == InvalidInstrType {
+		return nil, nil, xerrors.New("invalid instruction")
+	}
+	if len(instr.Signatures) == 0 || len(instr.Signatures) != len(instr.SignerIdentities) {
+		return nil, nil, xerrors.New("the instruction must be signed")
+	}
+	// A change of the configuration could change the roster, which must be
+	// known by the leader before the block is created.
+	if instr.InstanceID.Equal(ConfigInstanceID) {
+		return nil, nil, xerrors.New("the configuration can't be scheduled")
+	}
+
+	dataBuf, err := protobuf.Encode(&data)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode ScheduledData: %v", err)
+	}
+
+	id := NewInstanceID(ScheduledHash(instr, rst.GetVersion(), data.BlockIndex, data.Timestamp))
+	sc := StateChanges{NewStateChange(Create, id, ContractSchedulerID, dataBuf, darcID)}
+	return sc, coins, nil
+}
+
+func (c *contractScheduler) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins []Coin) (sc []StateChange, cout []Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+
+	switch inst.Invoke.Command {
+	case cmdSchedulerExecute:
+		// The execution is verified by VerifyInstruction. A failure of the
+		// scheduled instruction is stored in the instance instead of
+		// refusing the transaction, so that the leader doesn't try again.
+		var scheduledScs StateChanges
+		scheduledScs, cout, err = c.executeScheduled(rst, inst.InstanceID, coins)
+		if err != nil {
+			c.ScheduledData.Error = err.Error()
+			cout = coins
+		} else {
+			sc = append(sc, scheduledScs...)
+		}
+		c.ScheduledData.Executed = true
+	case cmdSchedulerCancel:
+		if !c.ScheduledData.pending() {
+			return nil, nil, xerrors.New("instruction is not pending anymore")
+		}
+		c.ScheduledData.Cancelled = true
+	default:
+		return nil, nil, xerrors.New("scheduler contract can only execute and cancel")
+	}
+
+	dataBuf, err := protobuf.Encode(&c.ScheduledData)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode ScheduledData: %v", err)
+	}
+	sc = append(sc, NewStateChange(Update, inst.InstanceID, ContractSchedulerID, dataBuf, darcID))
+	return sc, cout, nil
+}
+
+// Delete is refused so that the instance prevents the instruction to be
+// scheduled a second time. A pending instruction can be cancelled instead.
+func (c *contractScheduler) Delete(rst ReadOnlyStateTrie, inst Instruction, coins []Coin) ([]StateChange, []Coin, error) {
+	return nil, nil, xerrors.New("scheduler instances can't be deleted")
+}
+
+// executeScheduled verifies the signatures of the scheduled instruction and
+// executes it. The state changes are checked so that the transaction of the
+// scheduler can't be refused because of them.
+func (c *contractScheduler) executeScheduled(rst ReadOnlyStateTrie, id InstanceID, coins []Coin) (sc StateChanges, cout []Coin, err error) {
+	defer func() {
+		if re := recover(); re != nil {
+			err = xerrors.Errorf("executing instruction: %v", re)
+		}
+	}()
+
+	instr := c.ScheduledData.Instruction
+	instr.version = rst.GetVersion()
+
+	contractBuf, _, contractID, _, err := rst.GetValues(instr.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get contract buf: %v", err)
+	}
+	if c.contracts == nil {
+		return nil, nil, xerrors.New("contracts registry is missing due to bad initialization")
+	}
+	fn, exists := c.contracts.Search(contractID)
+	if !exists {
+		return nil, nil, xerrors.Errorf("unknown contract %s", contractID)
+	}
+	contract, err := fn(contractBuf)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get the contract: %v", err)
+	}
+	if cwr, ok := contract.(ContractWithRegistry); ok {
+		cwr.SetRegistry(c.contracts)
+	}
+
+	err = contract.VerifyDeferredInstruction(rst, instr, id.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("verifying the instruction failed: %v", err)
+	}
+
+	switch instr.GetType() {
+	case SpawnType:
+		sc, cout, err = contract.Spawn(rst, instr, coins)
+	case InvokeType:
+		sc, cout, err = contract.Invoke(rst, instr, coins)
+	case DeleteType:
+		sc, cout, err = contract.Delete(rst, instr, coins)
+	default:
+		return nil, nil, xerrors.New("invalid instruction")
+	}
+	if err != nil {
+		return nil, nil, xerrors.Errorf("executing instruction: %v", err)
+	}
+
+	err = checkStateChanges(rst, sc, c.contracts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sc, cout, nil
+}
+
+// checkStateChanges applies the same checks to the state changes as the
+// service does when it processes a transaction.
+func checkStateChanges(rst ReadOnlyStateTrie, scs StateChanges, contracts ReadOnlyContractRegistry) error {
+	for _, sc := range scs {
+		if sc.ContractID != "" {
+			if _, ok := contracts.Search(sc.ContractID); !ok {
+				return xerrors.Errorf("unknown contract ID %s", sc.ContractID)
+			}
+		}
+		if bytes.Equal(sc.InstanceID, ConfigInstanceID.Slice()) {
+			return xerrors.New("the configuration can't be changed")
+		}
+
+		_, _, _, _, err := rst.GetValues(sc.InstanceID)
+		exists := err == nil
+		if err != nil && !xerrors.Is(err, errKeyNotSet) {
+			return xerrors.Errorf("reading trie: %v", err)
+		}
+		switch sc.StateAction {
+		case Create:
+			if exists {
+				return xerrors.Errorf("tried to create existing instanceID %x", sc.InstanceID)
+			}
+		case Update, Remove:
+			if !exists {
+				return xerrors.Errorf("tried to %s non-existing instanceID %x", sc.StateAction, sc.InstanceID)
+			}
+		}
+
+		rst, err = rst.StoreAllToReplica(StateChanges{sc})
+		if err != nil {
+			return xerrors.Errorf("storing state change: %v", err)
+		}
+	}
+	return nil
+}
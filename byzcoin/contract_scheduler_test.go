@@ -0,0 +1,184 @@
+package byzcoin
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func TestScheduledHash(t *testing.T) {
+	instr := createSpawnInstr(darc.ID("darc"), dummyContract, "data", []byte("a"))
+	h := ScheduledHash(instr, CurrentVersion, 10, 0)
+
+	// Neither the signers nor the version of the instruction change the
+	// hash, which uses the version of the chain.
+	other := instr
+	other.SignerCounter = []uint64{42}
+	other.version = 0
+	require.Equal(t, h, ScheduledHash(other, CurrentVersion, 10, 0))
+	invoke := createInvokeInstr(NewInstanceID(nil), dummyContract, "update", "data", nil)
+	require.NotEqual(t, ScheduledHash(invoke, 0, 10, 0), ScheduledHash(invoke, CurrentVersion, 10, 0))
+
+	require.NotEqual(t, h, ScheduledHash(instr, CurrentVersion, 11, 0))
+	require.NotEqual(t, h, ScheduledHash(instr, CurrentVersion, 10, 1))
+	other = createSpawnInstr(darc.ID("darc"), dummyContract, "data", []byte("b"))
+	require.NotEqual(t, h, ScheduledHash(other, CurrentVersion, 10, 0))
+}
+
+func TestScheduledData_IsDue(t *testing.T) {
+	sd := ScheduledData{BlockIndex: 5}
+	require.True(t, sd.pending())
+	require.False(t, sd.isDue(4, 0))
+	require.True(t, sd.isDue(5, 0))
+
+	sd = ScheduledData{Timestamp: 100}
+	require.False(t, sd.isDue(1000, 99))
+	require.True(t, sd.isDue(1, 100))
+
+	sd = ScheduledData{BlockIndex: 5, Timestamp: 100}
+	require.False(t, sd.isDue(5, 99))
+	require.False(t, sd.isDue(4, 100))
+	require.True(t, sd.isDue(5, 100))
+
+	sd.Cancelled = true
+	require.False(t, sd.pending())
+}
+
+// scheduleSpawnDarc returns a transaction that schedules the spawn of a new
+// darc, and the IDs of the scheduler instance and of the darc.
+func scheduleSpawnDarc(t *testing.T, s *ser, desc string, blockIndex uint64, timestamp int64, counter uint64) (ClientTransaction, InstanceID, InstanceID) {
+	id := []darc.Identity{s.signer.Identity()}
+	d := darc.NewDarc(darc.InitRules(id, id), []byte(desc))
+	dBuf, err := d.ToProto()
+	require.NoError(t, err)
+
+	instr := Instruction{
+		InstanceID: NewInstanceID(s.darc.GetBaseID()),
+		Spawn: &Spawn{
+			ContractID: ContractDarcID,
+			Args:       Arguments{{Name: "darc", Value: dBuf}},
+		},
+		SignerIdentities: id,
+	}
+	hash := ScheduledHash(instr, CurrentVersion, blockIndex, timestamp)
+	sig, err := s.signer.Sign(hash)
+	require.NoError(t, err)
+	instr.Signatures = [][]byte{sig}
+	instrBuf, err := protobuf.Encode(&instr)
+	require.NoError(t, err)
+
+	args := Arguments{{Name: "instruction", Value: instrBuf}}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, blockIndex)
+	args = append(args, Argument{Name: "blockIndex", Value: buf})
+	buf = make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(timestamp))
+	args = append(args, Argument{Name: "timestamp", Value: buf})
+
+	spawn := Instruction{
+		InstanceID: NewInstanceID(s.darc.GetBaseID()),
+		Spawn: &Spawn{
+			ContractID: ContractSchedulerID,
+			Args:       args,
+		},
+		SignerCounter: []uint64{counter},
+	}
+	tx, err := combineInstrsAndSign(s.signer, spawn)
+	require.NoError(t, err)
+	return tx, NewInstanceID(hash), NewInstanceID(d.GetBaseID())
+}
+
+func getScheduledData(t *testing.T, s *ser, id InstanceID) ScheduledData {
+	pr := s.waitProof(t, id)
+	value, contractID, _, err := pr.Get(id.Slice())
+	require.NoError(t, err)
+	require.Equal(t, ContractSchedulerID, contractID)
+	var sd ScheduledData
+	require.NoError(t, protobuf.Decode(value, &sd))
+	return sd
+}
+
+func TestContractScheduler(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	latest, err := s.service().db().GetLatestByID(s.genesis.SkipChainID())
+	require.NoError(t, err)
+
+	// The instruction is executed without any other transaction.
+	tx, schedID, darcID := scheduleSpawnDarc(t, s, "by index", uint64(latest.Index+3), 0, 2)
+	s.sendTxAndWait(t, tx, 10)
+	sd := getScheduledData(t, s, schedID)
+	require.True(t, sd.pending())
+
+	s.waitProof(t, darcID)
+	sd = getScheduledData(t, s, schedID)
+	require.True(t, sd.Executed)
+	require.Empty(t, sd.Error)
+
+	// The same instruction can't be scheduled twice.
+	tx, _, _ = scheduleSpawnDarc(t, s, "by index", uint64(latest.Index+3), 0, 3)
+	resp, err := s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.genesis.SkipChainID(),
+		Transaction:   tx,
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp.Error)
+
+	// A client can't ask for the execution.
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.genesis.SkipChainID(),
+		Transaction: newScheduledTx(schedID, time.Now().UnixNano()),
+	})
+	require.Error(t, err)
+
+	// Not even together with another instruction, which would execute it
+	// before it is due.
+	tx, pendingID, _ := scheduleSpawnDarc(t, s, "bypass", uint64(latest.Index+1000), 0, 3)
+	s.sendTxAndWait(t, tx, 10)
+	bypass := newScheduledTx(pendingID, time.Now().Add(time.Hour).UnixNano())
+	other := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte("bypass"))
+	other.SignerCounter = []uint64{4}
+	bypass.Instructions = append(bypass.Instructions, other)
+	require.NoError(t, bypass.FillSignersAndSignWith(s.signer))
+	_, err = s.service().AddTransaction(&AddTxRequest{
+		Version:     CurrentVersion,
+		SkipchainID: s.genesis.SkipChainID(),
+		Transaction: bypass,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "executed by the leader")
+	require.True(t, getScheduledData(t, s, pendingID).pending())
+
+	// A faulty node returning the execution to the leader doesn't get the
+	// blocks refused, as the leader drops it.
+	s.services[1].txBuffer.add(string(s.genesis.SkipChainID()), bypass)
+
+	// Execution at a given time.
+	ts := time.Now().Add(4 * s.interval).UnixNano()
+	tx, schedID, darcID = scheduleSpawnDarc(t, s, "by time", 0, ts, 4)
+	s.sendTxAndWait(t, tx, 10)
+	s.waitProof(t, darcID)
+	require.True(t, time.Now().UnixNano() >= ts)
+	sd = getScheduledData(t, s, schedID)
+	require.True(t, sd.Executed)
+
+	// A cancelled instruction is not executed.
+	tx, schedID, _ = scheduleSpawnDarc(t, s, "cancelled", uint64(latest.Index+1000), 0, 5)
+	s.sendTxAndWait(t, tx, 10)
+	cancel := createInvokeInstr(schedID, ContractSchedulerID, cmdSchedulerCancel, "", nil)
+	cancel.SignerCounter = []uint64{6}
+	tx, err = combineInstrsAndSign(s.signer, cancel)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	sd = getScheduledData(t, s, schedID)
+	require.True(t, sd.Cancelled)
+	require.False(t, sd.Executed)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -94,8 +95,11 @@ type ContractFn func(in []byte) (Contract, error)
 // contractRegistry maps a contract ID with its constructor function. As soon
 // as the first cloning happens, the registry will be locked and no new contract
 // can be added for the global call.
+// Upgraded versions of a contract are stored separately, the version 0 being
+// the one of the registry map.
 type contractRegistry struct {
 	registry map[string]ContractFn
+	versions map[string]map[int]ContractFn
 	locked   bool
 	sync.Mutex
 }
@@ -132,6 +136,69 @@ func (cr *contractRegistry) Search(contractID string) (ContractFn, bool) {
 	return fn, exists
 }
 
+// registerVersion stores an upgraded version of a contract inside the
+// registry. The version 0 of the contract must already be registered and the
+// same rules as register apply for the lock.
+func (cr *contractRegistry) registerVersion(contractID string, version int, f ContractFn, ignoreLock bool) error {
+	if version <= 0 {
+		return xerrors.New("version must be strictly positive")
+	}
+
+	cr.Lock()
+	defer cr.Unlock()
+
+	if cr.locked && !ignoreLock {
+		return xerrors.New("contract registry is locked")
+	}
+	if _, exists := cr.registry[contractID]; !exists {
+		return xerrors.New("unknown contract")
+	}
+	if _, exists := cr.versions[contractID][version]; exists {
+		return xerrors.New("contract version already registered")
+	}
+
+	if cr.versions[contractID] == nil {
+		cr.versions[contractID] = make(map[int]ContractFn)
+	}
+	cr.versions[contractID][version] = f
+	return nil
+}
+
+// SearchVersion looks up the given version of the contract and returns the
+// constructor function if it exists and nil otherwise. The version 0 is the
+// one returned by Search.
+func (cr *contractRegistry) SearchVersion(contractID string, version int) (ContractFn, bool) {
+	if version == 0 {
+		return cr.Search(contractID)
+	}
+
+	cr.Lock()
+	fn, exists := cr.versions[contractID][version]
+	cr.Unlock()
+	return fn, exists
+}
+
+// supportedVersions returns the upgraded versions of the contracts that are
+// registered, sorted by contract ID and version.
+func (cr *contractRegistry) supportedVersions() []ContractVersion {
+	cr.Lock()
+	var cvs []ContractVersion
+	for id, versions := range cr.versions {
+		for v := range versions {
+			cvs = append(cvs, ContractVersion{ContractID: id, Version: v})
+		}
+	}
+	cr.Unlock()
+
+	sort.Slice(cvs, func(i, j int) bool {
+		if cvs[i].ContractID != cvs[j].ContractID {
+			return cvs[i].ContractID < cvs[j].ContractID
+		}
+		return cvs[i].Version < cvs[j].Version
+	})
+	return cvs
+}
+
 // Clone returns a copy of the registry and locks the source so that
 // static registration is not allowed anymore. This is to prevent
 // registration of a contract at runtime and limit it only to the
@@ -147,6 +214,12 @@ func (cr *contractRegistry) clone() *contractRegistry {
 	for key, value := range cr.registry {
 		clone.registry[key] = value
 	}
+	for key, versions := range cr.versions {
+		clone.versions[key] = make(map[int]ContractFn)
+		for v, value := range versions {
+			clone.versions[key][v] = value
+		}
+	}
 	cr.Unlock()
 
 	return clone
@@ -155,10 +228,25 @@ func (cr *contractRegistry) clone() *contractRegistry {
 func newContractRegistry() *contractRegistry {
 	return &contractRegistry{
 		registry: make(map[string]ContractFn),
+		versions: make(map[string]map[int]ContractFn),
 		locked:   false,
 	}
 }
 
+// chainContractRegistry is the view of the registry for a given block of a
+// chain: the constructors returned are the ones of the versions active at
+// that block.
+type chainContractRegistry struct {
+	*contractRegistry
+	active map[string]int
+}
+
+// Search looks up the contract ID and returns the constructor function of the
+// active version of the contract if it exists and nil otherwise.
+func (cr chainContractRegistry) Search(contractID string) (ContractFn, bool) {
+	return cr.SearchVersion(contractID, cr.active[contractID])
+}
+
 var globalContractRegistry = newContractRegistry()
 
 // RegisterGlobalContract stores the contract in the global registry. This should
@@ -169,6 +257,18 @@ func RegisterGlobalContract(contractID string, f ContractFn) error {
 	return cothority.ErrorOrNil(err, "registration failed")
 }
 
+// RegisterGlobalContractVersion stores an upgraded version of a contract in the
+// global registry. The contract must already be registered with
+// RegisterGlobalContract, which is the version 0. A version is only used by a
+// chain once it has been activated with the upgrade_contract command of the
+// config contract, so that all the nodes switch to the new code at the same
+// block. As for RegisterGlobalContract, this should be called during module
+// initialization.
+func RegisterGlobalContractVersion(contractID string, version int, f ContractFn) error {
+	err := globalContractRegistry.registerVersion(contractID, version, f, false)
+	return cothority.ErrorOrNil(err, "registration failed")
+}
+
 // RegisterContract stores the contract in the service registry which
 // makes it only available to byzcoin.
 //
@@ -288,6 +388,10 @@ const ContractConfigID = "config"
 // ConfigInstanceID represents the 0-id of the configuration instance.
 var ConfigInstanceID = InstanceID{}
 
+// cmdConfigUpgradeContract is the command of the config contract that
+// activates a new version of a contract.
+const cmdConfigUpgradeContract = "upgrade_contract"
+
 type contractConfig struct {
 	BasicContract
 	ChainConfig
@@ -371,6 +475,22 @@ func (c *contractConfig) FormatMethod(instr Instruction) string {
 
 		return out.String()
 	}
+	if instr.GetType() == InvokeType && instr.Invoke.Command == cmdConfigUpgradeContract {
+		out.WriteString("- Invoke:\n")
+		fmt.Fprintf(out, "-- ContractID: %s\n", instr.Invoke.ContractID)
+		fmt.Fprintf(out, "-- Command: %s\n", instr.Invoke.Command)
+
+		var cv ContractVersion
+		err := protobuf.Decode(instr.Invoke.Args.Search("version"), &cv)
+		if err != nil {
+			return "[!!!] failed to decode contract version: " + err.Error()
+		}
+
+		out.WriteString("-- Args:\n")
+		fmt.Fprintf(out, "--- %s\n", cv)
+
+		return out.String()
+	}
 	return c.BasicContract.FormatMethod(instr)
 }
 
@@ -437,11 +557,18 @@ func (c *contractConfig) Spawn(rst ReadOnlyStateTrie, inst Instruction, coins []
 
 // Invoke offers the following functions:
 //   - Invoke:update_config
+//   - Invoke:upgrade_contract
 //   - Invoke:view_change
 //
 // Invoke:update_config should have the following input argument:
 //   - config ChainConfig
 //
+// The contract versions of the new config are ignored as they can only be
+// changed with upgrade_contract.
+//
+// Invoke:upgrade_contract should have the following input argument:
+//   - version ContractVersion
+//
 // Invoke:view_change sould have the following input arguments:
 //   - newview viewchange.NewViewReq
 //   - multisig []byte
@@ -477,6 +604,13 @@ func (c *contractConfig) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins [
 		if err = newConfig.sanityCheck(oldConfig); err != nil {
 			return nil, nil, xerrors.Errorf("sanity check: %v", err)
 		}
+		if !contractVersionsEqual(newConfig.ContractVersions, oldConfig.ContractVersions) {
+			newConfig.ContractVersions = oldConfig.ContractVersions
+			configBuf, err = protobuf.Encode(&newConfig)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("encoding config: %v", err)
+			}
+		}
 		var val []byte
 		val, _, _, _, err = rst.GetValues(darcID)
 		if err != nil {
@@ -502,6 +636,34 @@ func (c *contractConfig) Invoke(rst ReadOnlyStateTrie, inst Instruction, coins [
 			NewStateChange(Update, NewInstanceID(darcID), ContractDarcID, genesisBuf, darcID),
 		}
 		return sc, coins, nil
+	case cmdConfigUpgradeContract:
+		var cv ContractVersion
+		err = protobuf.Decode(inst.Invoke.Args.Search("version"), &cv)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("decoding version: %v", err)
+		}
+
+		var config *ChainConfig
+		config, err = LoadConfigFromTrie(rst)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("reading trie: %v", err)
+		}
+		// The instruction is part of the block following the one of the
+		// trie.
+		if err = config.checkContractUpgrade(cv, rst.GetIndex()+1); err != nil {
+			return nil, nil, xerrors.Errorf("invalid upgrade: %v", err)
+		}
+		config.ContractVersions = append(config.ContractVersions, cv)
+
+		var configBuf []byte
+		configBuf, err = protobuf.Encode(config)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("encoding config: %v", err)
+		}
+		sc := StateChanges{
+			NewStateChange(Update, NewInstanceID(nil), ContractConfigID, configBuf, darcID),
+		}
+		return sc, coins, nil
 	case "view_change":
 		var req viewchange.NewViewReq
 		err = protobuf.DecodeWithConstructors(inst.Invoke.Args.Search("newview"), &req, network.DefaultConstructors(cothority.Suite))
@@ -32,6 +32,8 @@ var CoinName = iid("byzCoin")
 //    parameter for the next instruction to interpret.
 //  - store puts the coins given to the instance back into the account.
 // You can only delete a contractCoin instance if the account is empty.
+// The type of a coin instance cannot be a token of ContractTokenID, whose
+// coins are only held by token accounts.
 
 func contractCoinFromBytes(in []byte) (byzcoin.Contract, error) {
 	c := &contractCoin{}
@@ -80,6 +82,9 @@ func (c *contractCoin) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 			return nil, nil, xerrors.New("type needs to be an InstanceID")
 		}
 		c.Name = byzcoin.NewInstanceID(t)
+		if isTokenCoin(rst, c.Name) {
+			return nil, nil, xerrors.New("the coins of a token can only be held by token accounts")
+		}
 	} else {
 		c.Name = CoinName
 	}
@@ -103,6 +108,13 @@ func (c *contractCoin) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instru
 		return
 	}
 
+	// The coins of a token must not be minted or stored outside of the token
+	// accounts, else the supply of the token wouldn't hold.
+	if isTokenCoin(rst, c.Name) {
+		err = xerrors.New("the coins of a token can only be held by token accounts")
+		return
+	}
+
 	// Invoke is one of "mint", "transfer", "fetch", or "store".
 	var coinsArg uint64
 	if inst.Invoke.Command != "store" {
@@ -330,3 +330,32 @@ func (ct cvTest) getContract(i byzcoin.InstanceID) byzcoin.Contract {
 	}
 	return c
 }
+
+// apply stores the state changes in the test trie, and removes the instances
+// deleted by them.
+func (ct *cvTest) apply(scs []byzcoin.StateChange) {
+	for _, sc := range scs {
+		if sc.StateAction == byzcoin.Remove {
+			k := string(sc.InstanceID)
+			delete(ct.values, k)
+			delete(ct.contractIDs, k)
+			delete(ct.darcIDs, k)
+			continue
+		}
+		ct.Store(byzcoin.NewInstanceID(sc.InstanceID), sc.Value, sc.ContractID, sc.DarcID)
+	}
+}
+
+// invokeInstr returns an instruction invoking the command on the instance,
+// signed by gsigner.
+func invokeInstr(id byzcoin.InstanceID, cmd string, args ...byzcoin.Argument) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			Command: cmd,
+			Args:    args,
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+}
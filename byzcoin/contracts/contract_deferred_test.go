@@ -2448,3 +2448,161 @@ func TestDeferred_PublicDelete(t *testing.T) {
 	require.Nil(t, err)
 	require.False(t, exist)
 }
+
+func TestDeferred_OffChainSignatures(t *testing.T) {
+	// The two signatures needed to update a value contract are collected
+	// off-chain, and a single execProposedTx carries them.
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	signer2 := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:value", "spawn:deferred", "invoke:deferred.execProposedTx"},
+		signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+	require.NoError(t, gDarc.Rules.AddRule(darc.Action("invoke:value.update"),
+		expression.InitAndExpr(signer.Identity().String(), signer2.Identity().String())))
+	genesisMsg.BlockInterval = time.Second
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractValueID,
+			Args:       byzcoin.Arguments{{Name: "value", Value: []byte("1234")}},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	valueID := ctx.Instructions[0].DeriveID("")
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	updatedValue := []byte("aef123456789fab")
+	proposedTransaction, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: valueID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractValueID,
+			Command:    "update",
+			Args:       byzcoin.Arguments{{Name: "value", Value: updatedValue}},
+		},
+	})
+	require.NoError(t, err)
+	proposedTransactionBuf, err := protobuf.Encode(&proposedTransaction)
+	require.NoError(t, err)
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDeferredID,
+			Args:       byzcoin.Arguments{{Name: "proposedTransaction", Value: proposedTransactionBuf}},
+		},
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	deferredID := ctx.Instructions[0].DeriveID("")
+	atr, err := cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+	require.NoError(t, cl.WaitPropagation(atr.Proof.Latest.Index))
+
+	// The signers can learn that the proposal needs their signature.
+	pending, err := cl.GetPendingDeferred(signer2.Identity())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(pending.Pending))
+	require.True(t, deferredID.Equal(pending.Pending[0].InstanceID))
+	require.Equal(t, []uint32{0}, pending.Pending[0].Indexes)
+	pending, err = cl.GetPendingDeferred(darc.NewSignerEd25519(nil, nil).Identity())
+	require.NoError(t, err)
+	require.Empty(t, pending.Pending)
+
+	streamed := make(chan byzcoin.GetPendingDeferredResponse, 10)
+	go byzcoin.NewClient(cl.ID, cl.Roster).StreamPendingDeferred(signer2.Identity(),
+		func(resp byzcoin.GetPendingDeferredResponse, err error) {
+			if err == nil {
+				streamed <- resp
+			}
+		})
+	select {
+	case resp := <-streamed:
+		require.Equal(t, 1, len(resp.Pending))
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "didn't get the pending instances")
+	}
+
+	// The proposer registers the proposal.
+	_, err = cl.GetDeferredProposal(deferredID)
+	require.Error(t, err)
+	resp, err := cl.ProposeDeferred(deferredID)
+	require.NoError(t, err)
+	require.Empty(t, resp.Proofs)
+	require.False(t, resp.Ready)
+	hash := resp.InstructionHashes[0]
+
+	// The co-signers submit their signatures to any of the nodes.
+	_, err = cl.AddDeferredSignature(deferredID, hash, 1, signer)
+	require.Error(t, err)
+	_, err = cl.AddDeferredSignature(deferredID, []byte("wrong hash"), 0, signer)
+	require.Error(t, err)
+	resp, err = cl.AddDeferredSignature(deferredID, hash, 0, signer)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Proofs))
+	require.False(t, resp.Ready)
+	pending, err = cl.GetPendingDeferred(signer.Identity())
+	require.NoError(t, err)
+	require.Empty(t, pending.Pending)
+	_, err = cl.AddDeferredSignature(deferredID, hash, 0, signer)
+	require.Error(t, err)
+
+	require.NoError(t, cl.UseNode(2))
+	resp, err = cl.AddDeferredSignature(deferredID, hash, 0, signer2)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resp.Proofs))
+	require.True(t, resp.Ready)
+
+	require.NoError(t, cl.UseNode(1))
+	resp, err = cl.GetDeferredProposal(deferredID)
+	require.NoError(t, err)
+	require.True(t, resp.Ready)
+
+	// A single transaction executes the proposed transaction.
+	args, err := resp.ExecArgs()
+	require.NoError(t, err)
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: deferredID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: byzcoin.ContractDeferredID,
+			Command:    "execProposedTx",
+			Args:       args,
+		},
+		SignerCounter: []uint64{3},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	_, err = cl.WaitProof(valueID, genesisMsg.BlockInterval, updatedValue)
+	require.NoError(t, err)
+
+	// The executed proposal is not pending anymore.
+	select {
+	case resp := <-streamed:
+		require.Empty(t, resp.Pending)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "didn't get the update of the pending instances")
+	}
+
+	// The proposal can't be executed anymore.
+	_, err = cl.GetDeferredProposal(deferredID)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
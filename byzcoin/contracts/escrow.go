@@ -0,0 +1,378 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractEscrowID denotes a contract holding coins between a buyer and a
+// seller until one of them, or an arbiter, decides where they go.
+//
+// Spawn takes the coins given to the instruction, usually fetched from the
+// account of the buyer in the previous instruction, and the arguments:
+//   - "buyer", "seller" and "arbiter" are the darcs of the parties
+//   - "buyerAccount" and "sellerAccount" are the coin instances receiving
+//     the coins
+//   - "type" is the type of coins held, CoinName by default
+//   - "timeout" is the optional index of the first block where the coins can
+//     be released without the buyer
+//
+// Spawn creates a darc guarding the new instance, which gives the following
+// commands to the parties:
+//   - release pays the seller, signed by the buyer or the arbiter
+//   - refund pays the buyer back, signed by the seller or the arbiter
+//   - dispute prevents release and refund, signed by the buyer or the seller
+//   - resolve pays the party given in the argument "to", either "buyer" or
+//     "seller", signed by the arbiter
+//   - autoRelease pays the seller once the timeout is reached, signed by any
+//     party. A disputed escrow is not released.
+//
+// The instance stays once closed, to keep track of where the coins went.
+const ContractEscrowID = "escrow"
+
+// EscrowState is the state of an escrow instance.
+type EscrowState int
+
+const (
+	// EscrowPending is the state of an escrow holding coins.
+	EscrowPending EscrowState = iota
+	// EscrowDisputed is the state of an escrow whose coins can only be moved
+	// by the arbiter.
+	EscrowDisputed
+	// EscrowReleased is the state of an escrow that paid the seller.
+	EscrowReleased
+	// EscrowRefunded is the state of an escrow that paid the buyer back.
+	EscrowRefunded
+)
+
+func (s EscrowState) String() string {
+	switch s {
+	case EscrowPending:
+		return "pending"
+	case EscrowDisputed:
+		return "disputed"
+	case EscrowReleased:
+		return "released"
+	case EscrowRefunded:
+		return "refunded"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(s))
+	}
+}
+
+// Escrow is the data of an escrow instance.
+type Escrow struct {
+	Buyer         darc.ID
+	Seller        darc.ID
+	Arbiter       darc.ID
+	BuyerAccount  byzcoin.InstanceID
+	SellerAccount byzcoin.InstanceID
+	// Timeout is the index of the first block where the coins can be
+	// released without the buyer. Zero means there is no timeout.
+	Timeout uint64
+	// Coin holds the coins of the escrow until it is closed.
+	Coin  byzcoin.Coin
+	State EscrowState
+}
+
+// String returns a human readable string representation of the escrow.
+func (e Escrow) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Escrow:\n")
+	fmt.Fprintf(out, "-- Buyer: %x (account %s)\n", []byte(e.Buyer), e.BuyerAccount)
+	fmt.Fprintf(out, "-- Seller: %x (account %s)\n", []byte(e.Seller), e.SellerAccount)
+	fmt.Fprintf(out, "-- Arbiter: %x\n", []byte(e.Arbiter))
+	fmt.Fprintf(out, "-- Coins: %d %s\n", e.Coin.Value, e.Coin.Name)
+	if e.Timeout > 0 {
+		fmt.Fprintf(out, "-- Timeout: block %d\n", e.Timeout)
+	}
+	fmt.Fprintf(out, "-- State: %s\n", e.State)
+	return out.String()
+}
+
+// EscrowSpawn returns the instructions fetching the coins of the escrow from
+// the account of the buyer and spawning the escrow with them. The signer
+// counters must still be set.
+func EscrowSpawn(spawnDarc darc.ID, e Escrow) []byzcoin.Instruction {
+	coins := make([]byte, 8)
+	binary.LittleEndian.PutUint64(coins, e.Coin.Value)
+	timeout := make([]byte, 8)
+	binary.LittleEndian.PutUint64(timeout, e.Timeout)
+
+	return []byzcoin.Instruction{
+		{
+			InstanceID: e.BuyerAccount,
+			Invoke: &byzcoin.Invoke{
+				ContractID: ContractCoinID,
+				Command:    "fetch",
+				Args:       byzcoin.Arguments{{Name: "coins", Value: coins}},
+			},
+		},
+		{
+			InstanceID: byzcoin.NewInstanceID(spawnDarc),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractEscrowID,
+				Args: byzcoin.Arguments{
+					{Name: "buyer", Value: e.Buyer},
+					{Name: "seller", Value: e.Seller},
+					{Name: "arbiter", Value: e.Arbiter},
+					{Name: "buyerAccount", Value: e.BuyerAccount.Slice()},
+					{Name: "sellerAccount", Value: e.SellerAccount.Slice()},
+					{Name: "type", Value: e.Coin.Name.Slice()},
+					{Name: "timeout", Value: timeout},
+				},
+			},
+		},
+	}
+}
+
+// EscrowInvoke returns the instruction sending the command to the escrow. The
+// argument "to" of resolve is given by EscrowResolve. The signer counters
+// must still be set.
+func EscrowInvoke(escrowID byzcoin.InstanceID, command string) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: escrowID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractEscrowID,
+			Command:    command,
+		},
+	}
+}
+
+// EscrowResolve returns the instruction of the arbiter paying the seller, or
+// the buyer if toSeller is false. The signer counters must still be set.
+func EscrowResolve(escrowID byzcoin.InstanceID, toSeller bool) byzcoin.Instruction {
+	inst := EscrowInvoke(escrowID, "resolve")
+	to := "buyer"
+	if toSeller {
+		to = "seller"
+	}
+	inst.Invoke.Args = byzcoin.Arguments{{Name: "to", Value: []byte(to)}}
+	return inst
+}
+
+func contractEscrowFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractEscrow{}
+	err := protobuf.Decode(in, &c.Escrow)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractEscrow struct {
+	byzcoin.BasicContract
+	Escrow
+}
+
+func (c *contractEscrow) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	args := inst.Spawn.Args
+	c.Escrow = Escrow{
+		Buyer:         darc.ID(args.Search("buyer")),
+		Seller:        darc.ID(args.Search("seller")),
+		Arbiter:       darc.ID(args.Search("arbiter")),
+		BuyerAccount:  byzcoin.NewInstanceID(args.Search("buyerAccount")),
+		SellerAccount: byzcoin.NewInstanceID(args.Search("sellerAccount")),
+		Coin:          byzcoin.Coin{Name: CoinName},
+	}
+	for _, party := range []darc.ID{c.Buyer, c.Seller, c.Arbiter} {
+		err = checkDarcInstance(rst, party)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("checking parties: %v", err)
+		}
+	}
+	if t := args.Search("type"); t != nil {
+		if len(t) != len(byzcoin.InstanceID{}) {
+			return nil, nil, xerrors.New("type needs to be an InstanceID")
+		}
+		c.Coin.Name = byzcoin.NewInstanceID(t)
+	}
+	if args.Search("timeout") != nil {
+		c.Timeout, err = uint64Arg(args, "timeout")
+		if err != nil {
+			return
+		}
+	}
+	for _, account := range []byzcoin.InstanceID{c.BuyerAccount, c.SellerAccount} {
+		_, _, err = loadEscrowAccount(rst, account, c.Coin.Name)
+		if err != nil {
+			return
+		}
+	}
+
+	cout = []byzcoin.Coin{}
+	for _, co := range coins {
+		if co.Name.Equal(c.Coin.Name) {
+			err = c.Coin.SafeAdd(co.Value)
+			if err != nil {
+				return
+			}
+		} else {
+			cout = append(cout, co)
+		}
+	}
+	if c.Coin.Value == 0 {
+		return nil, nil, xerrors.New("no coins given to the escrow")
+	}
+
+	// The darc of the escrow lets each party send its commands, and can't be
+	// changed.
+	id := inst.DeriveID("")
+	or := func(ids ...darc.ID) expression.Expr {
+		var strs []string
+		for _, id := range ids {
+			strs = append(strs, darc.NewIdentityDarc(id).String())
+		}
+		return expression.InitOrExpr(strs...)
+	}
+	rules := darc.NewRules()
+	for _, rule := range []struct {
+		command string
+		expr    expression.Expr
+	}{
+		{"release", or(c.Buyer, c.Arbiter)},
+		{"refund", or(c.Seller, c.Arbiter)},
+		{"dispute", or(c.Buyer, c.Seller)},
+		{"resolve", or(c.Arbiter)},
+		{"autoRelease", or(c.Buyer, c.Seller, c.Arbiter)},
+	} {
+		err = rules.AddRule(darc.Action("invoke:"+ContractEscrowID+"."+rule.command), rule.expr)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("adding rule: %v", err)
+		}
+	}
+	d := darc.NewDarc(rules, append([]byte("escrow "), id.Slice()...))
+	var darcBuf []byte
+	darcBuf, err = d.ToProto()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("encoding darc: %v", err)
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Escrow)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode escrow: %v", err)
+	}
+	log.Lvlf2("escrow %x holds %d coins", id.Slice(), c.Coin.Value)
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, byzcoin.NewInstanceID(d.GetBaseID()),
+			byzcoin.ContractDarcID, darcBuf, d.GetBaseID()),
+		byzcoin.NewStateChange(byzcoin.Create, id, ContractEscrowID, buf, d.GetBaseID()),
+	}
+	return
+}
+
+func (c *contractEscrow) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.State != EscrowPending && c.State != EscrowDisputed {
+		return nil, nil, xerrors.Errorf("escrow is already %s", c.State)
+	}
+	toSeller := false
+	switch inst.Invoke.Command {
+	case "release":
+		toSeller = true
+	case "refund":
+	case "autoRelease":
+		if c.Timeout == 0 || uint64(rst.GetIndex()+1) < c.Timeout {
+			return nil, nil, xerrors.New("timeout is not reached")
+		}
+		toSeller = true
+	case "dispute":
+		if c.State == EscrowDisputed {
+			return nil, nil, xerrors.New("escrow is already disputed")
+		}
+	case "resolve":
+		switch string(inst.Invoke.Args.Search("to")) {
+		case "seller":
+			toSeller = true
+		case "buyer":
+		default:
+			return nil, nil, xerrors.New("argument \"to\" must be buyer or seller")
+		}
+	default:
+		return nil, nil, xerrors.New("escrow contract can only release, refund, dispute, resolve and autoRelease")
+	}
+
+	if inst.Invoke.Command == "dispute" {
+		c.State = EscrowDisputed
+	} else {
+		if c.State == EscrowDisputed && inst.Invoke.Command != "resolve" {
+			return nil, nil, xerrors.New("a disputed escrow can only be resolved")
+		}
+		dest := c.BuyerAccount
+		c.State = EscrowRefunded
+		if toSeller {
+			dest = c.SellerAccount
+			c.State = EscrowReleased
+		}
+		var paySC byzcoin.StateChange
+		paySC, err = payEscrow(rst, dest, c.Coin)
+		if err != nil {
+			return
+		}
+		sc = append(sc, paySC)
+		log.Lvlf2("escrow %x is %s", inst.InstanceID.Slice(), c.State)
+		c.Coin.Value = 0
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Escrow)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode escrow: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractEscrowID, buf, darcID))
+	return
+}
+
+// loadEscrowAccount returns the coin instance and its darc, if it holds the
+// given type of coins.
+func loadEscrowAccount(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID, name byzcoin.InstanceID) (*byzcoin.Coin, darc.ID, error) {
+	v, _, cid, did, err := rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get account: %v", err)
+	}
+	if cid != ContractCoinID {
+		return nil, nil, xerrors.Errorf("%x is not a coin account", id.Slice())
+	}
+	var coin byzcoin.Coin
+	err = protobuf.Decode(v, &coin)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't unmarshal account: %v", err)
+	}
+	if !coin.Name.Equal(name) {
+		return nil, nil, xerrors.Errorf("%x holds another type of coins", id.Slice())
+	}
+	return &coin, did, nil
+}
+
+// payEscrow returns the state change adding the coins to the account.
+func payEscrow(rst byzcoin.ReadOnlyStateTrie, dest byzcoin.InstanceID, coin byzcoin.Coin) (byzcoin.StateChange, error) {
+	account, did, err := loadEscrowAccount(rst, dest, coin.Name)
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("loading destination: %v", err)
+	}
+	err = account.SafeAdd(coin.Value)
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("paying: %v", err)
+	}
+	buf, err := protobuf.Encode(account)
+	if err != nil {
+		return byzcoin.StateChange{}, xerrors.Errorf("couldn't encode account: %v", err)
+	}
+	return byzcoin.NewStateChange(byzcoin.Update, dest, ContractCoinID, buf, did), nil
+}
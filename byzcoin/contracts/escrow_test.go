@@ -0,0 +1,268 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+)
+
+// storeCoinAccount stores a coin instance in the test trie.
+func storeCoinAccount(t *testing.T, ct *cvTest, id byzcoin.InstanceID, coin byzcoin.Coin) {
+	buf, err := protobuf.Encode(&coin)
+	require.NoError(t, err)
+	ct.Store(id, buf, ContractCoinID, gdarc.GetBaseID())
+}
+
+func getCoinAccount(t *testing.T, ct *cvTest, id byzcoin.InstanceID) byzcoin.Coin {
+	var coin byzcoin.Coin
+	require.NoError(t, protobuf.Decode(ct.values[string(id.Slice())], &coin))
+	return coin
+}
+
+func getEscrow(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractEscrow {
+	c, err := contractEscrowFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractEscrow)
+}
+
+// newTestEscrow stores the parties and their accounts in the test trie, and
+// spawns an escrow holding 10 coins.
+func newTestEscrow(t *testing.T, ct *cvTest, timeout uint64) byzcoin.InstanceID {
+	storeCoinAccount(t, ct, iid("buyerAccount"), byzcoin.Coin{Name: CoinName})
+	storeCoinAccount(t, ct, iid("sellerAccount"), byzcoin.Coin{Name: CoinName})
+	e := Escrow{
+		Buyer:         storeDarc(t, ct, "buyer"),
+		Seller:        storeDarc(t, ct, "seller"),
+		Arbiter:       storeDarc(t, ct, "arbiter"),
+		BuyerAccount:  iid("buyerAccount"),
+		SellerAccount: iid("sellerAccount"),
+		Timeout:       timeout,
+		Coin:          byzcoin.Coin{Name: CoinName, Value: 10},
+	}
+	inst := EscrowSpawn(gdarc.GetBaseID(), e)[1]
+
+	c, _ := contractEscrowFromBytes(nil)
+	other := byzcoin.Coin{Name: iid("other"), Value: 1}
+	sc, cout, err := c.Spawn(ct, inst, []byzcoin.Coin{other, {Name: CoinName, Value: 10}})
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other}, cout)
+	require.Equal(t, 2, len(sc))
+	require.Equal(t, byzcoin.ContractDarcID, sc[0].ContractID)
+	ct.apply(sc)
+	return byzcoin.NewInstanceID(sc[1].InstanceID)
+}
+
+func TestEscrow_Spawn(t *testing.T) {
+	ct := newCT("spawn:escrow")
+	id := newTestEscrow(t, ct, 0)
+
+	e := getEscrow(t, ct, id)
+	require.Equal(t, uint64(10), e.Coin.Value)
+	require.Equal(t, EscrowPending, e.State)
+
+	// The escrow is guarded by its own darc, with a rule for each command.
+	d, err := darc.NewFromProtobuf(ct.values[string(ct.darcIDs[string(id.Slice())])])
+	require.NoError(t, err)
+	arbiter := darc.NewIdentityDarc(e.Arbiter).String()
+	require.Equal(t, arbiter, string(d.Rules.Get("invoke:escrow.resolve")))
+	require.Equal(t, darc.NewIdentityDarc(e.Buyer).String()+" | "+arbiter,
+		string(d.Rules.Get("invoke:escrow.release")))
+
+	// The spawn needs coins, and accounts of the right type.
+	inst := EscrowSpawn(gdarc.GetBaseID(), e.Escrow)[1]
+	c, _ := contractEscrowFromBytes(nil)
+	_, _, err = c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+	storeCoinAccount(t, ct, iid("sellerAccount"), byzcoin.Coin{Name: iid("other")})
+	_, _, err = c.Spawn(ct, inst, []byzcoin.Coin{{Name: CoinName, Value: 10}})
+	require.Error(t, err)
+}
+
+func TestEscrow_ReleaseRefund(t *testing.T) {
+	for _, cmd := range []string{"release", "refund"} {
+		ct := newCT("spawn:escrow")
+		id := newTestEscrow(t, ct, 0)
+
+		sc, _, err := getEscrow(t, ct, id).Invoke(ct, EscrowInvoke(id, cmd), nil)
+		require.NoError(t, err)
+		ct.apply(sc)
+
+		e := getEscrow(t, ct, id)
+		require.Equal(t, uint64(0), e.Coin.Value)
+		if cmd == "release" {
+			require.Equal(t, EscrowReleased, e.State)
+			require.Equal(t, uint64(10), getCoinAccount(t, ct, iid("sellerAccount")).Value)
+		} else {
+			require.Equal(t, EscrowRefunded, e.State)
+			require.Equal(t, uint64(10), getCoinAccount(t, ct, iid("buyerAccount")).Value)
+		}
+
+		// A closed escrow can't pay twice.
+		_, _, err = e.Invoke(ct, EscrowInvoke(id, "refund"), nil)
+		require.Error(t, err)
+	}
+}
+
+func TestEscrow_Dispute(t *testing.T) {
+	ct := newCT("spawn:escrow")
+	id := newTestEscrow(t, ct, 1)
+
+	sc, _, err := getEscrow(t, ct, id).Invoke(ct, EscrowInvoke(id, "dispute"), nil)
+	require.NoError(t, err)
+	ct.apply(sc)
+	require.Equal(t, EscrowDisputed, getEscrow(t, ct, id).State)
+
+	for _, cmd := range []string{"dispute", "release", "refund", "autoRelease"} {
+		_, _, err = getEscrow(t, ct, id).Invoke(ct, EscrowInvoke(id, cmd), nil)
+		require.Error(t, err)
+	}
+	inst := EscrowInvoke(id, "resolve")
+	inst.Invoke.Args = byzcoin.Arguments{{Name: "to", Value: []byte("arbiter")}}
+	_, _, err = getEscrow(t, ct, id).Invoke(ct, inst, nil)
+	require.Error(t, err)
+
+	sc, _, err = getEscrow(t, ct, id).Invoke(ct, EscrowResolve(id, false), nil)
+	require.NoError(t, err)
+	ct.apply(sc)
+	require.Equal(t, EscrowRefunded, getEscrow(t, ct, id).State)
+	require.Equal(t, uint64(10), getCoinAccount(t, ct, iid("buyerAccount")).Value)
+	require.Equal(t, uint64(0), getCoinAccount(t, ct, iid("sellerAccount")).Value)
+}
+
+func TestEscrow_AutoRelease(t *testing.T) {
+	ct := newCT("spawn:escrow")
+	_, _, err := getEscrow(t, ct, newTestEscrow(t, ct, 0)).Invoke(ct,
+		EscrowInvoke(iid("escrow"), "autoRelease"), nil)
+	require.Error(t, err)
+
+	ct = newCT("spawn:escrow")
+	id := newTestEscrow(t, ct, 100)
+	ct.index = 98
+	_, _, err = getEscrow(t, ct, id).Invoke(ct, EscrowInvoke(id, "autoRelease"), nil)
+	require.Error(t, err)
+
+	ct.index = 99
+	sc, _, err := getEscrow(t, ct, id).Invoke(ct, EscrowInvoke(id, "autoRelease"), nil)
+	require.NoError(t, err)
+	ct.apply(sc)
+	require.Equal(t, EscrowReleased, getEscrow(t, ct, id).State)
+	require.Equal(t, uint64(10), getCoinAccount(t, ct, iid("sellerAccount")).Value)
+}
+
+// TestEscrow_Ledger checks that the darc of the escrow only lets the parties
+// send their own commands.
+func TestEscrow_Ledger(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	buyer := darc.NewSignerEd25519(nil, nil)
+	seller := darc.NewSignerEd25519(nil, nil)
+	arbiter := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:darc", "spawn:coin", "invoke:coin.mint", "invoke:coin.fetch",
+			"spawn:escrow"}, buyer.Identity())
+	require.NoError(t, err)
+	genesisMsg.BlockInterval = time.Second
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+	gDarc := genesisMsg.GenesisDarc.GetBaseID()
+
+	counters := map[string]uint64{}
+	send := func(signer darc.Signer, instrs ...byzcoin.Instruction) (byzcoin.ClientTransaction, error) {
+		id := signer.Identity().String()
+		for i := range instrs {
+			instrs[i].SignerCounter = []uint64{counters[id] + uint64(i) + 1}
+		}
+		ctx, err := cl.CreateTransaction(instrs...)
+		require.NoError(t, err)
+		require.NoError(t, ctx.FillSignersAndSignWith(signer))
+		_, err = cl.AddTransactionAndWait(ctx, 10)
+		if err == nil {
+			counters[id] += uint64(len(instrs))
+		}
+		return ctx, err
+	}
+	spawnDarc := func(signer darc.Signer) (byzcoin.Instruction, darc.ID) {
+		id := []darc.Identity{signer.Identity()}
+		d := darc.NewDarc(darc.InitRules(id, id), []byte(signer.Identity().String()))
+		buf, err := d.ToProto()
+		require.NoError(t, err)
+		return byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gDarc),
+			Spawn: &byzcoin.Spawn{
+				ContractID: byzcoin.ContractDarcID,
+				Args:       byzcoin.Arguments{{Name: "darc", Value: buf}},
+			},
+		}, d.GetBaseID()
+	}
+	spawnCoin := func(name string) (byzcoin.Instruction, byzcoin.InstanceID) {
+		h := sha256.New()
+		h.Write([]byte(ContractCoinID))
+		h.Write([]byte(name))
+		return byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(gDarc),
+			Spawn: &byzcoin.Spawn{
+				ContractID: ContractCoinID,
+				Args:       byzcoin.Arguments{{Name: "coinID", Value: []byte(name)}},
+			},
+		}, byzcoin.NewInstanceID(h.Sum(nil))
+	}
+
+	sellerInst, sellerDarc := spawnDarc(seller)
+	arbiterInst, arbiterDarc := spawnDarc(arbiter)
+	buyerCoinInst, buyerAccount := spawnCoin("buyer")
+	sellerCoinInst, sellerAccount := spawnCoin("seller")
+	mint := byzcoin.Instruction{
+		InstanceID: buyerAccount,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractCoinID,
+			Command:    "mint",
+			Args:       byzcoin.Arguments{{Name: "coins", Value: tokenCoins(100)}},
+		},
+	}
+	_, err = send(buyer, sellerInst, arbiterInst, buyerCoinInst, sellerCoinInst, mint)
+	require.NoError(t, err)
+
+	ctx, err := send(buyer, EscrowSpawn(gDarc, Escrow{
+		Buyer:         gDarc,
+		Seller:        sellerDarc,
+		Arbiter:       arbiterDarc,
+		BuyerAccount:  buyerAccount,
+		SellerAccount: sellerAccount,
+		Coin:          byzcoin.Coin{Name: CoinName, Value: 40},
+	})...)
+	require.NoError(t, err)
+	id := ctx.Instructions[1].DeriveID("")
+
+	// Only the buyer and the arbiter can release, only the arbiter can
+	// resolve.
+	_, err = send(seller, EscrowInvoke(id, "release"))
+	require.Error(t, err)
+	_, err = send(buyer, EscrowResolve(id, false))
+	require.Error(t, err)
+	_, err = send(seller, EscrowInvoke(id, "dispute"))
+	require.NoError(t, err)
+	_, err = send(buyer, EscrowInvoke(id, "release"))
+	require.Error(t, err)
+	_, err = send(arbiter, EscrowResolve(id, true))
+	require.NoError(t, err)
+
+	pr, err := cl.GetProofFromLatest(sellerAccount.Slice())
+	require.NoError(t, err)
+	var coin byzcoin.Coin
+	require.NoError(t, pr.Proof.VerifyAndDecode(cothority.Suite, ContractCoinID, &coin))
+	require.Equal(t, uint64(40), coin.Value)
+	pr, err = cl.GetProofFromLatest(buyerAccount.Slice())
+	require.NoError(t, err)
+	require.NoError(t, pr.Proof.VerifyAndDecode(cothority.Suite, ContractCoinID, &coin))
+	require.Equal(t, uint64(60), coin.Value)
+}
@@ -0,0 +1,224 @@
+package contracts
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractKVMapID denotes a contract holding a map of keys to values. Every
+// key is stored in its own instance, at KVMapEntryID, so that updating a key
+// doesn't rewrite the others and that a proof can be requested for a single
+// key.
+//
+// The following methods are available, all of them taking the key in the
+// argument "key":
+//   - set stores the argument "value" in the key
+//   - delete removes the key, which must exist
+//   - compareAndSet stores the argument "value" in the key only if its
+//     current value is equal to the argument "expected". If "expected" is
+//     missing, the key must not exist yet
+//
+// You can only delete an empty map.
+const ContractKVMapID = "kvmap"
+
+// ContractKVMapEntryID is the contract ID of the instances holding the keys
+// of a map. No contract is registered for it, so the entries can only be
+// changed through their map.
+const ContractKVMapEntryID = "kvmap_entry"
+
+// KVMap is the data of a map instance.
+type KVMap struct {
+	// Entries is the number of keys in the map.
+	Entries uint64
+}
+
+// KVMapEntry is the data of the instance holding a key of a map.
+type KVMapEntry struct {
+	Map   byzcoin.InstanceID
+	Key   string
+	Value []byte
+}
+
+// KVMapEntryID returns the instance ID where the key of the map is stored.
+func KVMapEntryID(mapID byzcoin.InstanceID, key string) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write(mapID.Slice())
+	h.Write([]byte(key))
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// KVMapEntryFromProof returns the entry of the key in the proof, or nil if
+// the proof shows that the key is not in the map. The proof must be verified
+// by the caller.
+func KVMapEntryFromProof(p byzcoin.Proof, mapID byzcoin.InstanceID, key string) (*KVMapEntry, error) {
+	id := KVMapEntryID(mapID, key)
+	if !p.InclusionProof.Match(id.Slice()) {
+		return nil, nil
+	}
+	value, contractID, _, err := p.Get(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get entry: %v", err)
+	}
+	if contractID != ContractKVMapEntryID {
+		return nil, xerrors.Errorf("instance is a %s contract", contractID)
+	}
+	var entry KVMapEntry
+	err = protobuf.Decode(value, &entry)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal entry: %v", err)
+	}
+	if !entry.Map.Equal(mapID) || entry.Key != key {
+		return nil, xerrors.New("entry belongs to another key")
+	}
+	return &entry, nil
+}
+
+func contractKVMapFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractKVMap{}
+	err := protobuf.Decode(in, &c.KVMap)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractKVMap struct {
+	byzcoin.BasicContract
+	KVMap
+}
+
+func (c *contractKVMap) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	c.KVMap = KVMap{}
+	var buf []byte
+	buf, err = protobuf.Encode(&c.KVMap)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode map: %v", err)
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractKVMapID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractKVMap) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	key := string(inst.Invoke.Args.Search("key"))
+	if key == "" {
+		return nil, nil, xerrors.New("argument \"key\" is missing")
+	}
+	entryID := KVMapEntryID(inst.InstanceID, key)
+	var entry *KVMapEntry
+	entry, err = loadKVMapEntry(rst, entryID)
+	if err != nil {
+		return
+	}
+
+	var entrySC byzcoin.StateChange
+	switch inst.Invoke.Command {
+	case "compareAndSet":
+		expected := inst.Invoke.Args.Search("expected")
+		if expected == nil && entry != nil {
+			return nil, nil, xerrors.Errorf("key \"%s\" already exists", key)
+		}
+		if expected != nil && (entry == nil || !bytes.Equal(expected, entry.Value)) {
+			return nil, nil, xerrors.Errorf("value of key \"%s\" is not the expected one", key)
+		}
+		fallthrough
+	case "set":
+		action := byzcoin.Update
+		if entry == nil {
+			action = byzcoin.Create
+			c.Entries++
+		}
+		var buf []byte
+		buf, err = protobuf.Encode(&KVMapEntry{
+			Map:   inst.InstanceID,
+			Key:   key,
+			Value: inst.Invoke.Args.Search("value"),
+		})
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode entry: %v", err)
+		}
+		entrySC = byzcoin.NewStateChange(action, entryID, ContractKVMapEntryID, buf, darcID)
+	case "delete":
+		if entry == nil {
+			return nil, nil, xerrors.Errorf("key \"%s\" doesn't exist", key)
+		}
+		c.Entries--
+		entrySC = byzcoin.NewStateChange(byzcoin.Remove, entryID, ContractKVMapEntryID, nil, darcID)
+	default:
+		return nil, nil, xerrors.New("kvmap contract can only set, delete and compareAndSet")
+	}
+	sc = append(sc, entrySC)
+
+	// The map only changes when a key is added or removed.
+	if entrySC.StateAction != byzcoin.Update {
+		var buf []byte
+		buf, err = protobuf.Encode(&c.KVMap)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode map: %v", err)
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractKVMapID, buf, darcID))
+	}
+	return
+}
+
+func (c *contractKVMap) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Entries > 0 {
+		err = xerrors.New("cannot delete a map that still has keys")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractKVMapID, nil, darcID),
+	}
+	return
+}
+
+// loadKVMapEntry returns the entry stored in the instance, or nil if it
+// doesn't exist.
+func loadKVMapEntry(rst byzcoin.ReadOnlyStateTrie, id byzcoin.InstanceID) (*KVMapEntry, error) {
+	v, _, cid, _, err := rst.GetValues(id.Slice())
+	if byzcoin.IsKeyNotSet(err) || (err == nil && v == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't get entry: %v", err)
+	}
+	if cid != ContractKVMapEntryID {
+		return nil, xerrors.Errorf("%x is not a kvmap entry", id.Slice())
+	}
+	var entry KVMapEntry
+	err = protobuf.Decode(v, &entry)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal entry: %v", err)
+	}
+	return &entry, nil
+}
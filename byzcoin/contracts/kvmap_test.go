@@ -0,0 +1,205 @@
+package contracts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func kvmapArgs(key string, value []byte) []byzcoin.Argument {
+	return []byzcoin.Argument{
+		{Name: "key", Value: []byte(key)},
+		{Name: "value", Value: value},
+	}
+}
+
+func getKVMap(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractKVMap {
+	c, err := contractKVMapFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractKVMap)
+}
+
+func getKVMapEntry(t *testing.T, ct *cvTest, mapID byzcoin.InstanceID, key string) *KVMapEntry {
+	entry, err := loadKVMapEntry(ct, KVMapEntryID(mapID, key))
+	require.NoError(t, err)
+	return entry
+}
+
+// invokeKVMap applies the command to the map in the test trie.
+func invokeKVMap(ct *cvTest, mapID byzcoin.InstanceID, cmd string, args ...byzcoin.Argument) ([]byzcoin.StateChange, error) {
+	c, err := contractKVMapFromBytes(ct.values[string(mapID.Slice())])
+	if err != nil {
+		return nil, err
+	}
+	sc, _, err := c.Invoke(ct, invokeInstr(mapID, cmd, args...), nil)
+	if err != nil {
+		return nil, err
+	}
+	ct.apply(sc)
+	return sc, nil
+}
+
+func spawnKVMap(t *testing.T, ct *cvTest) byzcoin.InstanceID {
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractKVMapID,
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	c, _ := contractKVMapFromBytes(nil)
+	sc, _, err := c.Spawn(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	ct.apply(sc)
+	return byzcoin.NewInstanceID(sc[0].InstanceID)
+}
+
+func TestKVMapEntryID(t *testing.T) {
+	require.Equal(t, KVMapEntryID(iid("map"), "a"), KVMapEntryID(iid("map"), "a"))
+	require.NotEqual(t, KVMapEntryID(iid("map"), "a"), KVMapEntryID(iid("map"), "b"))
+	require.NotEqual(t, KVMapEntryID(iid("map"), "a"), KVMapEntryID(iid("other"), "a"))
+}
+
+func TestKVMap_SetDelete(t *testing.T) {
+	ct := newCT("spawn:kvmap", "invoke:kvmap.set", "invoke:kvmap.delete")
+	mapID := spawnKVMap(t, ct)
+	require.Equal(t, uint64(0), getKVMap(t, ct, mapID).Entries)
+
+	_, err := invokeKVMap(ct, mapID, "set", byzcoin.Argument{Name: "value", Value: []byte("v")})
+	require.Error(t, err)
+	_, err = invokeKVMap(ct, mapID, "update", kvmapArgs("a", []byte("v"))...)
+	require.Error(t, err)
+
+	// A new key updates the map, an existing one doesn't.
+	sc, err := invokeKVMap(ct, mapID, "set", kvmapArgs("a", []byte("1"))...)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sc))
+	require.Equal(t, byzcoin.Create, sc[0].StateAction)
+	sc, err = invokeKVMap(ct, mapID, "set", kvmapArgs("a", []byte("2"))...)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	require.Equal(t, byzcoin.Update, sc[0].StateAction)
+	require.Equal(t, gdarc.GetBaseID(), sc[0].DarcID)
+	_, err = invokeKVMap(ct, mapID, "set", kvmapArgs("b", []byte("3"))...)
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(2), getKVMap(t, ct, mapID).Entries)
+	entry := getKVMapEntry(t, ct, mapID, "a")
+	require.Equal(t, mapID, entry.Map)
+	require.Equal(t, "a", entry.Key)
+	require.Equal(t, []byte("2"), entry.Value)
+
+	// The map can't be deleted while it has keys.
+	del := byzcoin.Instruction{
+		InstanceID:       mapID,
+		Delete:           &byzcoin.Delete{},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	_, _, err = getKVMap(t, ct, mapID).Delete(ct, del, nil)
+	require.Error(t, err)
+
+	_, err = invokeKVMap(ct, mapID, "delete", byzcoin.Argument{Name: "key", Value: []byte("c")})
+	require.Error(t, err)
+	for _, key := range []string{"a", "b"} {
+		sc, err = invokeKVMap(ct, mapID, "delete", byzcoin.Argument{Name: "key", Value: []byte(key)})
+		require.NoError(t, err)
+		require.Equal(t, byzcoin.Remove, sc[0].StateAction)
+		// The mock trie doesn't remove instances.
+		delete(ct.values, string(sc[0].InstanceID))
+	}
+	require.Equal(t, uint64(0), getKVMap(t, ct, mapID).Entries)
+	require.Nil(t, getKVMapEntry(t, ct, mapID, "a"))
+
+	_, _, err = getKVMap(t, ct, mapID).Delete(ct, del, nil)
+	require.NoError(t, err)
+}
+
+func TestKVMap_CompareAndSet(t *testing.T) {
+	ct := newCT("spawn:kvmap", "invoke:kvmap.compareAndSet")
+	mapID := spawnKVMap(t, ct)
+
+	// Without an expected value, the key must not exist.
+	_, err := invokeKVMap(ct, mapID, "compareAndSet", kvmapArgs("a", []byte("1"))...)
+	require.NoError(t, err)
+	_, err = invokeKVMap(ct, mapID, "compareAndSet", kvmapArgs("a", []byte("2"))...)
+	require.Error(t, err)
+
+	// A missing key doesn't match an expected value.
+	_, err = invokeKVMap(ct, mapID, "compareAndSet", append(kvmapArgs("b", []byte("2")),
+		byzcoin.Argument{Name: "expected", Value: []byte("1")})...)
+	require.Error(t, err)
+
+	_, err = invokeKVMap(ct, mapID, "compareAndSet", append(kvmapArgs("a", []byte("2")),
+		byzcoin.Argument{Name: "expected", Value: []byte("0")})...)
+	require.Error(t, err)
+	require.Equal(t, []byte("1"), getKVMapEntry(t, ct, mapID, "a").Value)
+
+	_, err = invokeKVMap(ct, mapID, "compareAndSet", append(kvmapArgs("a", []byte("2")),
+		byzcoin.Argument{Name: "expected", Value: []byte("1")})...)
+	require.NoError(t, err)
+	require.Equal(t, []byte("2"), getKVMapEntry(t, ct, mapID, "a").Value)
+	require.Equal(t, uint64(1), getKVMap(t, ct, mapID).Entries)
+}
+
+func TestKVMap_Proof(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:kvmap", "invoke:kvmap.set"}, signer.Identity())
+	require.NoError(t, err)
+	genesisMsg.BlockInterval = time.Second
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(genesisMsg.GenesisDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractKVMapID,
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+	mapID := ctx.Instructions[0].DeriveID("")
+
+	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: mapID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: ContractKVMapID,
+			Command:    "set",
+			Args:       kvmapArgs("a", []byte("1")),
+		},
+		SignerCounter: []uint64{2},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	pr, err := cl.GetProofFromLatest(KVMapEntryID(mapID, "a").Slice())
+	require.NoError(t, err)
+	entry, err := KVMapEntryFromProof(pr.Proof, mapID, "a")
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.Equal(t, []byte("1"), entry.Value)
+
+	pr, err = cl.GetProofFromLatest(KVMapEntryID(mapID, "b").Slice())
+	require.NoError(t, err)
+	entry, err = KVMapEntryFromProof(pr.Proof, mapID, "b")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
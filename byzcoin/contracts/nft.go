@@ -0,0 +1,374 @@
+package contracts
+
+import (
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractNFTCollectionID denotes a contract that mints non-fungible tokens
+// and enumerates them.
+//
+// Spawn takes the name and the symbol of the collection, which must not be
+// empty.
+//
+// The following methods are available:
+//   - mint creates a new token owned by the darc given in the argument
+//     "owner", with the hash of its metadata in the argument "metadataHash".
+//     The optional arguments "royaltyCoins", "royaltyType" and
+//     "royaltyDestination" define the royalty paid at each transfer of the
+//     token: "royaltyCoins" coins of type "royaltyType", CoinName by default,
+//     are stored in the coin instance "royaltyDestination".
+//
+// You can only delete an empty collection.
+const ContractNFTCollectionID = "nft_collection"
+
+// ContractNFTID denotes a contract holding a non-fungible token. The instance
+// is guarded by the darc of its owner, so that the owner signs its transfer
+// and its burn. The metadata hash can't be changed.
+//
+// The following methods are available:
+//   - transfer gives the token to the darc in the argument "owner". If the
+//     token has a royalty, the coins are taken from the ones given to the
+//     instruction and the others are passed to the next instruction
+//   - burn removes the token and its entry in the collection
+const ContractNFTID = "nft"
+
+// NFTCollection is the data of a collection instance.
+type NFTCollection struct {
+	Name   string
+	Symbol string
+	// Tokens holds the instance IDs of the tokens of the collection, in the
+	// order they have been minted.
+	Tokens []byzcoin.InstanceID `protobuf:"opt"`
+}
+
+// String returns a human readable string representation of the collection.
+func (c NFTCollection) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- NFTCollection:\n")
+	fmt.Fprintf(out, "-- Name: %s\n", c.Name)
+	fmt.Fprintf(out, "-- Symbol: %s\n", c.Symbol)
+	for _, id := range c.Tokens {
+		fmt.Fprintf(out, "-- Token: %s\n", id)
+	}
+	return out.String()
+}
+
+// NFTRoyalty describes the coins paid to the destination at each transfer of
+// a token.
+type NFTRoyalty struct {
+	Coin        byzcoin.Coin
+	Destination byzcoin.InstanceID
+}
+
+// NFT is the data of a token instance.
+type NFT struct {
+	Collection   byzcoin.InstanceID
+	Owner        darc.ID
+	MetadataHash []byte
+	Royalty      *NFTRoyalty `protobuf:"opt"`
+}
+
+// String returns a human readable string representation of the token.
+func (n NFT) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- NFT:\n")
+	fmt.Fprintf(out, "-- Collection: %s\n", n.Collection)
+	fmt.Fprintf(out, "-- Owner: %x\n", []byte(n.Owner))
+	fmt.Fprintf(out, "-- MetadataHash: %x\n", n.MetadataHash)
+	if n.Royalty != nil {
+		fmt.Fprintf(out, "-- Royalty: %d %s to %s\n", n.Royalty.Coin.Value,
+			n.Royalty.Coin.Name, n.Royalty.Destination)
+	}
+	return out.String()
+}
+
+func contractNFTCollectionFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractNFTCollection{}
+	err := protobuf.Decode(in, &c.NFTCollection)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractNFTCollection struct {
+	byzcoin.BasicContract
+	NFTCollection
+}
+
+func (c *contractNFTCollection) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	c.NFTCollection = NFTCollection{
+		Name:   string(inst.Spawn.Args.Search("name")),
+		Symbol: string(inst.Spawn.Args.Search("symbol")),
+	}
+	if c.Name == "" || c.Symbol == "" {
+		return nil, nil, xerrors.New("the name and the symbol are required")
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.NFTCollection)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode collection: %v", err)
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractNFTCollectionID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractNFTCollection) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if inst.Invoke.Command != "mint" {
+		err = xerrors.New("nft collection can only mint")
+		return
+	}
+
+	nft := NFT{
+		Collection:   inst.InstanceID,
+		Owner:        darc.ID(inst.Invoke.Args.Search("owner")),
+		MetadataHash: inst.Invoke.Args.Search("metadataHash"),
+	}
+	if len(nft.MetadataHash) == 0 {
+		return nil, nil, xerrors.New("the metadata hash is required")
+	}
+	err = checkDarcInstance(rst, nft.Owner)
+	if err != nil {
+		return
+	}
+
+	if inst.Invoke.Args.Search("royaltyCoins") != nil {
+		royalty := &NFTRoyalty{
+			Coin:        byzcoin.Coin{Name: CoinName},
+			Destination: byzcoin.NewInstanceID(inst.Invoke.Args.Search("royaltyDestination")),
+		}
+		royalty.Coin.Value, err = uint64Arg(inst.Invoke.Args, "royaltyCoins")
+		if err != nil {
+			return
+		}
+		if t := inst.Invoke.Args.Search("royaltyType"); t != nil {
+			if len(t) != len(byzcoin.InstanceID{}) {
+				return nil, nil, xerrors.New("royaltyType needs to be an InstanceID")
+			}
+			royalty.Coin.Name = byzcoin.NewInstanceID(t)
+		}
+		_, _, err = loadRoyaltyDestination(rst, royalty)
+		if err != nil {
+			return
+		}
+		nft.Royalty = royalty
+	}
+
+	var nftBuf []byte
+	nftBuf, err = protobuf.Encode(&nft)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode token: %v", err)
+	}
+	id := inst.DeriveID("")
+	c.Tokens = append(c.Tokens, id)
+	var buf []byte
+	buf, err = protobuf.Encode(&c.NFTCollection)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode collection: %v", err)
+	}
+
+	log.Lvlf2("minting token %x for %x", id.Slice(), []byte(nft.Owner))
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, id, ContractNFTID, nftBuf, nft.Owner),
+		byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractNFTCollectionID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractNFTCollection) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if len(c.Tokens) > 0 {
+		err = xerrors.New("cannot delete a collection that still has tokens")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractNFTCollectionID, nil, darcID),
+	}
+	return
+}
+
+func contractNFTFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractNFT{}
+	err := protobuf.Decode(in, &c.NFT)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractNFT struct {
+	byzcoin.BasicContract
+	NFT
+}
+
+func (c *contractNFT) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	switch inst.Invoke.Command {
+	case "transfer":
+		owner := darc.ID(inst.Invoke.Args.Search("owner"))
+		if owner.Equal(c.Owner) {
+			err = xerrors.New("the token already belongs to this owner")
+			return
+		}
+		err = checkDarcInstance(rst, owner)
+		if err != nil {
+			return
+		}
+
+		if c.Royalty != nil {
+			var royaltySC byzcoin.StateChange
+			royaltySC, cout, err = payRoyalty(rst, c.Royalty, coins)
+			if err != nil {
+				return
+			}
+			sc = append(sc, royaltySC)
+		}
+
+		c.Owner = owner
+		var buf []byte
+		buf, err = protobuf.Encode(&c.NFT)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode token: %v", err)
+		}
+		log.Lvlf2("transferring token %x to %x", inst.InstanceID.Slice(), []byte(owner))
+		// The new owner's darc guards the instance from now on.
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractNFTID, buf, owner))
+	case "burn":
+		var collBuf []byte
+		var collDarc darc.ID
+		collBuf, _, _, collDarc, err = rst.GetValues(c.Collection.Slice())
+		if err != nil {
+			return
+		}
+		var coll NFTCollection
+		err = protobuf.Decode(collBuf, &coll)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't unmarshal collection: %v", err)
+		}
+		for i, id := range coll.Tokens {
+			if id.Equal(inst.InstanceID) {
+				coll.Tokens = append(coll.Tokens[:i], coll.Tokens[i+1:]...)
+				break
+			}
+		}
+		collBuf, err = protobuf.Encode(&coll)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode collection: %v", err)
+		}
+		sc = byzcoin.StateChanges{
+			byzcoin.NewStateChange(byzcoin.Update, c.Collection, ContractNFTCollectionID, collBuf, collDarc),
+			byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractNFTID, nil, c.Owner),
+		}
+	default:
+		err = xerrors.New("nft contract can only transfer and burn")
+	}
+	return
+}
+
+// checkDarcInstance verifies that the ID is the one of an existing darc.
+func checkDarcInstance(rst byzcoin.ReadOnlyStateTrie, id darc.ID) error {
+	if len(id) == 0 {
+		return xerrors.New("the darc is required")
+	}
+	_, _, cid, _, err := rst.GetValues(id)
+	if err != nil {
+		return xerrors.Errorf("couldn't get darc: %v", err)
+	}
+	if cid != byzcoin.ContractDarcID {
+		return xerrors.Errorf("%x is not a darc", []byte(id))
+	}
+	return nil
+}
+
+// loadRoyaltyDestination returns the coin instance receiving the royalty and
+// its darc.
+func loadRoyaltyDestination(rst byzcoin.ReadOnlyStateTrie, royalty *NFTRoyalty) (*byzcoin.Coin, darc.ID, error) {
+	v, _, cid, did, err := rst.GetValues(royalty.Destination.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get royalty destination: %v", err)
+	}
+	if cid != ContractCoinID {
+		return nil, nil, xerrors.New("royalty destination is not a coin contract")
+	}
+	var coin byzcoin.Coin
+	err = protobuf.Decode(v, &coin)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't unmarshal royalty destination: %v", err)
+	}
+	if !coin.Name.Equal(royalty.Coin.Name) {
+		return nil, nil, xerrors.New("royalty destination holds another type of coins")
+	}
+	return &coin, did, nil
+}
+
+// payRoyalty takes the royalty out of the coins and returns the state change
+// storing it in the destination, along with the remaining coins.
+func payRoyalty(rst byzcoin.ReadOnlyStateTrie, royalty *NFTRoyalty, coins []byzcoin.Coin) (byzcoin.StateChange, []byzcoin.Coin, error) {
+	missing := royalty.Coin.Value
+	cout := []byzcoin.Coin{}
+	for _, co := range coins {
+		if missing > 0 && co.Name.Equal(royalty.Coin.Name) {
+			taken := co.Value
+			if taken > missing {
+				taken = missing
+			}
+			co.Value -= taken
+			missing -= taken
+			if co.Value == 0 {
+				continue
+			}
+		}
+		cout = append(cout, co)
+	}
+	if missing > 0 {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("%d coins are missing for the royalty", missing)
+	}
+
+	dest, did, err := loadRoyaltyDestination(rst, royalty)
+	if err != nil {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("loading destination: %v", err)
+	}
+	err = dest.SafeAdd(royalty.Coin.Value)
+	if err != nil {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("paying royalty: %v", err)
+	}
+	buf, err := protobuf.Encode(dest)
+	if err != nil {
+		return byzcoin.StateChange{}, nil, xerrors.Errorf("couldn't encode coin: %v", err)
+	}
+	return byzcoin.NewStateChange(byzcoin.Update, royalty.Destination, ContractCoinID, buf, did), cout, nil
+}
@@ -0,0 +1,221 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+// storeDarc stores a new darc in the test trie and returns its ID.
+func storeDarc(t *testing.T, ct *cvTest, desc string) darc.ID {
+	id := []darc.Identity{gsigner.Identity()}
+	d := darc.NewDarc(darc.InitRules(id, id), []byte(desc))
+	buf, err := d.ToProto()
+	require.NoError(t, err)
+	ct.Store(byzcoin.NewInstanceID(d.GetBaseID()), buf, byzcoin.ContractDarcID, d.GetBaseID())
+	return d.GetBaseID()
+}
+
+func getNFTCollection(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractNFTCollection {
+	c, err := contractNFTCollectionFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractNFTCollection)
+}
+
+func getNFT(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractNFT {
+	c, err := contractNFTFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractNFT)
+}
+
+// spawnNFTCollection spawns a collection in the test trie and returns its ID.
+func spawnNFTCollection(t *testing.T, ct *cvTest) byzcoin.InstanceID {
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractNFTCollectionID,
+			Args: byzcoin.Arguments{
+				{Name: "name", Value: []byte("Assets")},
+				{Name: "symbol", Value: []byte("AST")},
+			},
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	c, _ := contractNFTCollectionFromBytes(nil)
+	sc, _, err := c.Spawn(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	ct.apply(sc)
+	return byzcoin.NewInstanceID(sc[0].InstanceID)
+}
+
+// mintNFT mints a token in the collection and returns its ID.
+func mintNFT(t *testing.T, ct *cvTest, collID byzcoin.InstanceID, args ...byzcoin.Argument) byzcoin.InstanceID {
+	inst := invokeInstr(collID, "mint", args...)
+	sc, _, err := getNFTCollection(t, ct, collID).Invoke(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sc))
+	ct.apply(sc)
+	return byzcoin.NewInstanceID(sc[0].InstanceID)
+}
+
+func TestNFTCollection_Spawn(t *testing.T) {
+	ct := newCT("spawn:nft_collection")
+
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractNFTCollectionID,
+			Args:       byzcoin.Arguments{{Name: "name", Value: []byte("Assets")}},
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	c, _ := contractNFTCollectionFromBytes(nil)
+	_, _, err := c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+
+	collID := spawnNFTCollection(t, ct)
+	coll := getNFTCollection(t, ct, collID)
+	require.Equal(t, "Assets", coll.Name)
+	require.Equal(t, "AST", coll.Symbol)
+	require.Empty(t, coll.Tokens)
+}
+
+func TestNFTCollection_Mint(t *testing.T) {
+	ct := newCT("spawn:nft_collection", "invoke:nft_collection.mint")
+	collID := spawnNFTCollection(t, ct)
+	owner := storeDarc(t, ct, "owner")
+	ct.Store(iid("coins"), []byte{}, ContractCoinID, gdarc.GetBaseID())
+
+	// Missing metadata hash or unknown owner.
+	coll := getNFTCollection(t, ct, collID)
+	_, _, err := coll.Invoke(ct, invokeInstr(collID, "mint",
+		byzcoin.Argument{Name: "owner", Value: owner}), nil)
+	require.Error(t, err)
+	_, _, err = coll.Invoke(ct, invokeInstr(collID, "mint",
+		byzcoin.Argument{Name: "owner", Value: []byte("unknown")},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash")}), nil)
+	require.Error(t, err)
+	_, _, err = coll.Invoke(ct, invokeInstr(collID, "mint",
+		byzcoin.Argument{Name: "owner", Value: collID.Slice()},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash")}), nil)
+	require.Error(t, err)
+
+	// The royalty destination must hold the right type of coins.
+	_, _, err = coll.Invoke(ct, invokeInstr(collID, "mint",
+		byzcoin.Argument{Name: "owner", Value: owner},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash")},
+		byzcoin.Argument{Name: "royaltyCoins", Value: tokenCoins(10)},
+		byzcoin.Argument{Name: "royaltyType", Value: iid("other").Slice()},
+		byzcoin.Argument{Name: "royaltyDestination", Value: iid("coins").Slice()}), nil)
+	require.Error(t, err)
+
+	id1 := mintNFT(t, ct, collID,
+		byzcoin.Argument{Name: "owner", Value: owner},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash1")})
+	id2 := mintNFT(t, ct, collID,
+		byzcoin.Argument{Name: "owner", Value: owner},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash2")},
+		byzcoin.Argument{Name: "royaltyCoins", Value: tokenCoins(10)},
+		byzcoin.Argument{Name: "royaltyDestination", Value: iid("coins").Slice()})
+
+	require.Equal(t, []byzcoin.InstanceID{id1, id2}, getNFTCollection(t, ct, collID).Tokens)
+	require.Equal(t, owner, ct.darcIDs[string(id1.Slice())])
+	nft := getNFT(t, ct, id1)
+	require.Equal(t, collID, nft.Collection)
+	require.Equal(t, owner, nft.Owner)
+	require.Equal(t, []byte("hash1"), nft.MetadataHash)
+	require.Nil(t, nft.Royalty)
+	nft = getNFT(t, ct, id2)
+	require.NotNil(t, nft.Royalty)
+	require.Equal(t, CoinName, nft.Royalty.Coin.Name)
+	require.Equal(t, uint64(10), nft.Royalty.Coin.Value)
+}
+
+func TestNFT_Transfer(t *testing.T) {
+	ct := newCT("spawn:nft_collection", "invoke:nft_collection.mint")
+	collID := spawnNFTCollection(t, ct)
+	owner := storeDarc(t, ct, "owner")
+	buyer := storeDarc(t, ct, "buyer")
+	dest := byzcoin.Coin{Name: CoinName, Value: 5}
+	buf, err := protobuf.Encode(&dest)
+	require.NoError(t, err)
+	ct.Store(iid("royalty"), buf, ContractCoinID, gdarc.GetBaseID())
+
+	id := mintNFT(t, ct, collID,
+		byzcoin.Argument{Name: "owner", Value: owner},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash")},
+		byzcoin.Argument{Name: "royaltyCoins", Value: tokenCoins(10)},
+		byzcoin.Argument{Name: "royaltyDestination", Value: iid("royalty").Slice()})
+	transfer := invokeInstr(id, "transfer", byzcoin.Argument{Name: "owner", Value: buyer})
+
+	// Not enough coins for the royalty.
+	_, _, err = getNFT(t, ct, id).Invoke(ct, transfer,
+		[]byzcoin.Coin{{Name: CoinName, Value: 9}})
+	require.Error(t, err)
+
+	// Transferring to the owner is refused.
+	_, _, err = getNFT(t, ct, id).Invoke(ct,
+		invokeInstr(id, "transfer", byzcoin.Argument{Name: "owner", Value: owner}),
+		[]byzcoin.Coin{{Name: CoinName, Value: 10}})
+	require.Error(t, err)
+
+	other := byzcoin.Coin{Name: iid("other"), Value: 3}
+	sc, cout, err := getNFT(t, ct, id).Invoke(ct, transfer,
+		[]byzcoin.Coin{other, {Name: CoinName, Value: 4}, {Name: CoinName, Value: 8}})
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other, {Name: CoinName, Value: 2}}, cout)
+	require.Equal(t, 2, len(sc))
+	ct.apply(sc)
+
+	nft := getNFT(t, ct, id)
+	require.Equal(t, buyer, nft.Owner)
+	require.Equal(t, []byte("hash"), nft.MetadataHash)
+	require.Equal(t, buyer, ct.darcIDs[string(id.Slice())])
+	require.NoError(t, protobuf.Decode(ct.values[string(iid("royalty").Slice())], &dest))
+	require.Equal(t, uint64(15), dest.Value)
+}
+
+func TestNFT_Burn(t *testing.T) {
+	ct := newCT("spawn:nft_collection", "invoke:nft_collection.mint")
+	collID := spawnNFTCollection(t, ct)
+	owner := storeDarc(t, ct, "owner")
+	id1 := mintNFT(t, ct, collID,
+		byzcoin.Argument{Name: "owner", Value: owner},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash1")})
+	id2 := mintNFT(t, ct, collID,
+		byzcoin.Argument{Name: "owner", Value: owner},
+		byzcoin.Argument{Name: "metadataHash", Value: []byte("hash2")})
+
+	// The collection can't be deleted while it has tokens.
+	del := byzcoin.Instruction{
+		InstanceID:       collID,
+		Delete:           &byzcoin.Delete{},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	_, _, err := getNFTCollection(t, ct, collID).Delete(ct, del, nil)
+	require.Error(t, err)
+
+	sc, _, err := getNFT(t, ct, id1).Invoke(ct, invokeInstr(id1, "burn"), nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sc))
+	require.Equal(t, byzcoin.Remove, sc[1].StateAction)
+	require.Equal(t, id1.Slice(), sc[1].InstanceID)
+	ct.apply(sc[:1])
+	require.Equal(t, []byzcoin.InstanceID{id2}, getNFTCollection(t, ct, collID).Tokens)
+
+	sc, _, err = getNFT(t, ct, id2).Invoke(ct, invokeInstr(id2, "burn"), nil)
+	require.NoError(t, err)
+	ct.apply(sc[:1])
+	require.Empty(t, getNFTCollection(t, ct, collID).Tokens)
+
+	sc, _, err = getNFTCollection(t, ct, collID).Delete(ct, del, nil)
+	require.NoError(t, err)
+	require.Equal(t, byzcoin.Remove, sc[0].StateAction)
+}
@@ -0,0 +1,606 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractTokenID denotes a contract that defines a fungible token: its
+// metadata and its supply. The tokens are held by token accounts, and are
+// passed between instructions as byzcoin.Coin whose name is the instance ID of
+// the token. They cannot be held by a coin instance, which could mint them
+// without changing the supply.
+//
+// Spawn takes the following arguments:
+//   - name and symbol of the token, which must not be empty
+//   - decimals, the number of decimals used to display the amounts, at most
+//     18. It is 0 if it is missing
+//   - cap, the maximum supply. There is no maximum if it is missing
+//   - darcID, the darc of the new instance if it is not the one of the spawn
+//
+// The following methods are available:
+//   - mint creates the number of tokens given in the argument "coins". If the
+//     argument "destination" is given, they are added to this token account,
+//     else they are returned to the next instruction
+//   - burn destroys all the tokens given to the instruction
+//
+// You can only delete a token instance once all the tokens are burnt.
+const ContractTokenID = "token"
+
+// ContractTokenAccountID denotes a contract that holds the tokens of an
+// account.
+//
+// Spawn takes the argument "token" which is the instance ID of the token, and
+// an optional "darcID" as for the token.
+//
+// The following methods are available:
+//   - transfer sends "coins" tokens to the account "destination"
+//   - approve allows the account "spender" to transfer up to "coins" tokens
+//     from this account. A new approval replaces the previous one
+//   - transferFrom is invoked by the spender to send "coins" tokens from the
+//     account "from" to the account "destination"
+//   - fetch takes "coins" tokens out of the account and returns them to the
+//     next instruction
+//   - store puts the tokens given to the instruction back into the account
+//   - burn destroys "coins" tokens of the account
+//
+// All the amounts are 64-bit uints in LittleEndian, and the accounts must hold
+// the same token. You can only delete an empty account.
+const ContractTokenAccountID = "token_account"
+
+// isTokenCoin returns true if the coins with the name are the tokens of a
+// token instance.
+func isTokenCoin(rst byzcoin.ReadOnlyStateTrie, name byzcoin.InstanceID) bool {
+	_, _, cid, _, err := rst.GetValues(name.Slice())
+	return err == nil && cid == ContractTokenID
+}
+
+// maxTokenDecimals is the maximum number of decimals of a token, as an uint64
+// can't hold more than 19 digits.
+const maxTokenDecimals = 18
+
+// Token is the data of a token instance.
+type Token struct {
+	Name     string
+	Symbol   string
+	Decimals uint32
+	// Cap is the maximum supply, or 0 if there is no maximum.
+	Cap    uint64
+	Supply uint64
+}
+
+// String returns a human readable string representation of the token.
+func (t Token) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Token:\n")
+	fmt.Fprintf(out, "-- Name: %s\n", t.Name)
+	fmt.Fprintf(out, "-- Symbol: %s\n", t.Symbol)
+	fmt.Fprintf(out, "-- Decimals: %d\n", t.Decimals)
+	fmt.Fprintf(out, "-- Cap: %d\n", t.Cap)
+	fmt.Fprintf(out, "-- Supply: %d\n", t.Supply)
+	return out.String()
+}
+
+// FormatAmount returns the amount of tokens with the decimals of the token,
+// followed by its symbol.
+func (t Token) FormatAmount(value uint64) string {
+	str := strconv.FormatUint(value, 10)
+	if t.Decimals > 0 {
+		d := int(t.Decimals)
+		if len(str) <= d {
+			str = strings.Repeat("0", d-len(str)+1) + str
+		}
+		str = str[:len(str)-d] + "." + str[len(str)-d:]
+	}
+	return str + " " + t.Symbol
+}
+
+func (t *Token) mint(value uint64) error {
+	supply := t.Supply + value
+	if supply < t.Supply {
+		return xerrors.New("uint64 overflow")
+	}
+	if t.Cap > 0 && supply > t.Cap {
+		return xerrors.Errorf("supply would exceed the cap of %d", t.Cap)
+	}
+	t.Supply = supply
+	return nil
+}
+
+func (t *Token) burn(value uint64) error {
+	if value > t.Supply {
+		return xerrors.New("burning more than the supply")
+	}
+	t.Supply -= value
+	return nil
+}
+
+// TokenAllowance is the number of tokens an account can transfer on behalf of
+// another one.
+type TokenAllowance struct {
+	Spender byzcoin.InstanceID
+	Value   uint64
+}
+
+// TokenAccount is the data of a token account instance.
+type TokenAccount struct {
+	// Coin holds the balance of the account. Its name is the instance ID of
+	// the token.
+	Coin       byzcoin.Coin
+	Allowances []TokenAllowance `protobuf:"opt"`
+}
+
+// String returns a human readable string representation of the account.
+func (a TokenAccount) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- TokenAccount:\n")
+	fmt.Fprintf(out, "-- Token: %s\n", a.Coin.Name)
+	fmt.Fprintf(out, "-- Balance: %d\n", a.Coin.Value)
+	for _, al := range a.Allowances {
+		fmt.Fprintf(out, "-- Allowance: %d for %s\n", al.Value, al.Spender)
+	}
+	return out.String()
+}
+
+func (a TokenAccount) allowance(spender byzcoin.InstanceID) uint64 {
+	for _, al := range a.Allowances {
+		if al.Spender.Equal(spender) {
+			return al.Value
+		}
+	}
+	return 0
+}
+
+// setAllowance replaces the allowance of the spender, or removes it if the
+// value is 0.
+func (a *TokenAccount) setAllowance(spender byzcoin.InstanceID, value uint64) {
+	for i, al := range a.Allowances {
+		if al.Spender.Equal(spender) {
+			if value == 0 {
+				a.Allowances = append(a.Allowances[:i], a.Allowances[i+1:]...)
+			} else {
+				a.Allowances[i].Value = value
+			}
+			return
+		}
+	}
+	if value > 0 {
+		a.Allowances = append(a.Allowances, TokenAllowance{Spender: spender, Value: value})
+	}
+}
+
+func contractTokenFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractToken{}
+	err := protobuf.Decode(in, &c.Token)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractToken struct {
+	byzcoin.BasicContract
+	Token
+}
+
+func (c *contractToken) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	if did := inst.Spawn.Args.Search("darcID"); did != nil {
+		darcID = darc.ID(did)
+	}
+
+	c.Token = Token{
+		Name:   string(inst.Spawn.Args.Search("name")),
+		Symbol: string(inst.Spawn.Args.Search("symbol")),
+	}
+	if c.Name == "" || c.Symbol == "" {
+		return nil, nil, xerrors.New("the name and the symbol are required")
+	}
+	if inst.Spawn.Args.Search("decimals") != nil {
+		var decimals uint64
+		decimals, err = uint64Arg(inst.Spawn.Args, "decimals")
+		if err != nil {
+			return
+		}
+		if decimals > maxTokenDecimals {
+			return nil, nil, xerrors.Errorf("at most %d decimals are allowed", maxTokenDecimals)
+		}
+		c.Decimals = uint32(decimals)
+	}
+	if inst.Spawn.Args.Search("cap") != nil {
+		c.Cap, err = uint64Arg(inst.Spawn.Args, "cap")
+		if err != nil {
+			return
+		}
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Token)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode token: %v", err)
+	}
+	ca := inst.DeriveID("")
+	log.Lvlf2("Spawning token %s to %x", c.Symbol, ca.Slice())
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, ca, ContractTokenID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractToken) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	switch inst.Invoke.Command {
+	case "mint":
+		var value uint64
+		value, err = uint64Arg(inst.Invoke.Args, "coins")
+		if err != nil {
+			return
+		}
+		err = c.mint(value)
+		if err != nil {
+			return
+		}
+
+		target := inst.Invoke.Args.Search("destination")
+		if target == nil {
+			cout = append(cout, byzcoin.Coin{Name: inst.InstanceID, Value: value})
+			break
+		}
+		var dest *TokenAccount
+		var did darc.ID
+		dest, did, err = loadTokenAccount(rst, target, inst.InstanceID)
+		if err != nil {
+			return
+		}
+		err = dest.Coin.SafeAdd(value)
+		if err != nil {
+			return
+		}
+		var destBuf []byte
+		destBuf, err = protobuf.Encode(dest)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode account: %v", err)
+		}
+		log.Lvlf2("minting %d to %x", value, target)
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, byzcoin.NewInstanceID(target),
+			ContractTokenAccountID, destBuf, did))
+	case "burn":
+		cout = []byzcoin.Coin{}
+		for _, co := range coins {
+			if inst.InstanceID.Equal(co.Name) {
+				err = c.burn(co.Value)
+				if err != nil {
+					return
+				}
+			} else {
+				cout = append(cout, co)
+			}
+		}
+	default:
+		err = xerrors.New("token contract can only mint and burn")
+		return
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Token)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode token: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractTokenID, buf, darcID))
+	return
+}
+
+func (c *contractToken) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Supply > 0 {
+		err = xerrors.New("cannot delete a token that still has a supply")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractTokenID, nil, darcID),
+	}
+	return
+}
+
+func contractTokenAccountFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractTokenAccount{}
+	err := protobuf.Decode(in, &c.TokenAccount)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractTokenAccount struct {
+	byzcoin.BasicContract
+	TokenAccount
+}
+
+func (c *contractTokenAccount) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+	if did := inst.Spawn.Args.Search("darcID"); did != nil {
+		darcID = darc.ID(did)
+	}
+
+	token := inst.Spawn.Args.Search("token")
+	var cid string
+	_, _, cid, _, err = rst.GetValues(token)
+	if err == nil && cid != ContractTokenID {
+		err = xerrors.New("token is not a token contract")
+	}
+	if err != nil {
+		return
+	}
+
+	c.TokenAccount = TokenAccount{Coin: byzcoin.Coin{Name: byzcoin.NewInstanceID(token)}}
+	var buf []byte
+	buf, err = protobuf.Encode(&c.TokenAccount)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode account: %v", err)
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractTokenAccountID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractTokenAccount) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	var value uint64
+	if inst.Invoke.Command != "store" {
+		value, err = uint64Arg(inst.Invoke.Args, "coins")
+		if err != nil {
+			return
+		}
+	}
+
+	switch inst.Invoke.Command {
+	case "transfer":
+		target := inst.Invoke.Args.Search("destination")
+		if inst.InstanceID.Equal(byzcoin.NewInstanceID(target)) {
+			err = xerrors.New("cannot send tokens to ourselves")
+			return
+		}
+		var dest *TokenAccount
+		var did darc.ID
+		dest, did, err = loadTokenAccount(rst, target, c.Coin.Name)
+		if err != nil {
+			return
+		}
+		err = c.Coin.SafeSub(value)
+		if err != nil {
+			return
+		}
+		err = dest.Coin.SafeAdd(value)
+		if err != nil {
+			return
+		}
+		var destBuf []byte
+		destBuf, err = protobuf.Encode(dest)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode account: %v", err)
+		}
+		log.Lvlf2("transferring %d tokens to %x", value, target)
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, byzcoin.NewInstanceID(target),
+			ContractTokenAccountID, destBuf, did))
+	case "approve":
+		spender := inst.Invoke.Args.Search("spender")
+		if inst.InstanceID.Equal(byzcoin.NewInstanceID(spender)) {
+			err = xerrors.New("cannot approve ourselves")
+			return
+		}
+		_, _, err = loadTokenAccount(rst, spender, c.Coin.Name)
+		if err != nil {
+			return
+		}
+		c.setAllowance(byzcoin.NewInstanceID(spender), value)
+	case "transferFrom":
+		from := byzcoin.NewInstanceID(inst.Invoke.Args.Search("from"))
+		target := byzcoin.NewInstanceID(inst.Invoke.Args.Search("destination"))
+		if from.Equal(inst.InstanceID) || from.Equal(target) {
+			err = xerrors.New("the source must be another account than the spender and the destination")
+			return
+		}
+		var owner *TokenAccount
+		var ownerDarc darc.ID
+		owner, ownerDarc, err = loadTokenAccount(rst, from.Slice(), c.Coin.Name)
+		if err != nil {
+			return
+		}
+		allowed := owner.allowance(inst.InstanceID)
+		if value > allowed {
+			err = xerrors.Errorf("only %d tokens are allowed", allowed)
+			return
+		}
+		owner.setAllowance(inst.InstanceID, allowed-value)
+		err = owner.Coin.SafeSub(value)
+		if err != nil {
+			return
+		}
+
+		if target.Equal(inst.InstanceID) {
+			err = c.Coin.SafeAdd(value)
+			if err != nil {
+				return
+			}
+		} else {
+			var dest *TokenAccount
+			var did darc.ID
+			dest, did, err = loadTokenAccount(rst, target.Slice(), c.Coin.Name)
+			if err != nil {
+				return
+			}
+			err = dest.Coin.SafeAdd(value)
+			if err != nil {
+				return
+			}
+			var destBuf []byte
+			destBuf, err = protobuf.Encode(dest)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("couldn't encode account: %v", err)
+			}
+			sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, target,
+				ContractTokenAccountID, destBuf, did))
+		}
+
+		var ownerBuf []byte
+		ownerBuf, err = protobuf.Encode(owner)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode account: %v", err)
+		}
+		log.Lvlf2("transferring %d tokens from %x to %x", value, from.Slice(), target.Slice())
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, from,
+			ContractTokenAccountID, ownerBuf, ownerDarc))
+	case "fetch":
+		err = c.Coin.SafeSub(value)
+		if err != nil {
+			return
+		}
+		cout = append(cout, byzcoin.Coin{Name: c.Coin.Name, Value: value})
+	case "store":
+		cout = []byzcoin.Coin{}
+		for _, co := range coins {
+			if c.Coin.Name.Equal(co.Name) {
+				err = c.Coin.SafeAdd(co.Value)
+				if err != nil {
+					return
+				}
+			} else {
+				cout = append(cout, co)
+			}
+		}
+	case "burn":
+		err = c.Coin.SafeSub(value)
+		if err != nil {
+			return
+		}
+		var tokenBuf []byte
+		var tokenDarc darc.ID
+		tokenBuf, _, _, tokenDarc, err = rst.GetValues(c.Coin.Name.Slice())
+		if err != nil {
+			return
+		}
+		var token Token
+		err = protobuf.Decode(tokenBuf, &token)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't unmarshal token: %v", err)
+		}
+		err = token.burn(value)
+		if err != nil {
+			return
+		}
+		tokenBuf, err = protobuf.Encode(&token)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("couldn't encode token: %v", err)
+		}
+		sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, c.Coin.Name,
+			ContractTokenID, tokenBuf, tokenDarc))
+	default:
+		err = xerrors.New("invalid command: " + inst.Invoke.Command)
+		return
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.TokenAccount)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode account: %v", err)
+	}
+	sc = append(sc, byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ContractTokenAccountID, buf, darcID))
+	return
+}
+
+func (c *contractTokenAccount) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Coin.Value > 0 {
+		err = xerrors.New("cannot delete an account that still has tokens in it")
+		return
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractTokenAccountID, nil, darcID),
+	}
+	return
+}
+
+// loadTokenAccount returns the token account of the instance and its darc. The
+// account must hold the given token.
+func loadTokenAccount(rst byzcoin.ReadOnlyStateTrie, id []byte, token byzcoin.InstanceID) (*TokenAccount, darc.ID, error) {
+	v, _, cid, did, err := rst.GetValues(id)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't get account: %v", err)
+	}
+	if cid != ContractTokenAccountID {
+		return nil, nil, xerrors.Errorf("%x is not a token account", id)
+	}
+	var account TokenAccount
+	err = protobuf.Decode(v, &account)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't unmarshal account: %v", err)
+	}
+	if !account.Coin.Name.Equal(token) {
+		return nil, nil, xerrors.Errorf("%x holds another token", id)
+	}
+	return &account, did, nil
+}
+
+// uint64Arg returns the argument of the instruction, which must be a 64-bit
+// uint in LittleEndian.
+func uint64Arg(args byzcoin.Arguments, name string) (uint64, error) {
+	buf := args.Search(name)
+	if buf == nil {
+		return 0, xerrors.Errorf("argument \"%s\" is missing", name)
+	}
+	if len(buf) != 8 {
+		return 0, xerrors.Errorf("argument \"%s\" is wrong length", name)
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
@@ -0,0 +1,314 @@
+package contracts
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/protobuf"
+)
+
+func tokenCoins(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	return buf
+}
+
+// storeToken stores the token and the accounts in the test trie.
+func storeToken(t *testing.T, ct *cvTest, tokenID byzcoin.InstanceID, token Token, accounts map[byzcoin.InstanceID]TokenAccount) {
+	buf, err := protobuf.Encode(&token)
+	require.NoError(t, err)
+	ct.Store(tokenID, buf, ContractTokenID, gdarc.GetBaseID())
+	for id, account := range accounts {
+		account.Coin.Name = tokenID
+		buf, err = protobuf.Encode(&account)
+		require.NoError(t, err)
+		ct.Store(id, buf, ContractTokenAccountID, gdarc.GetBaseID())
+	}
+}
+
+func getToken(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractToken {
+	c, err := contractTokenFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractToken)
+}
+
+func getTokenAccount(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractTokenAccount {
+	c, err := contractTokenAccountFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractTokenAccount)
+}
+
+func TestToken_Spawn(t *testing.T) {
+	ct := newCT("spawn:token")
+
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractTokenID,
+			Args: byzcoin.Arguments{
+				{Name: "name", Value: []byte("Test token")},
+				{Name: "symbol", Value: []byte("TST")},
+				{Name: "decimals", Value: tokenCoins(19)},
+			},
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+
+	c, _ := contractTokenFromBytes(nil)
+	_, _, err := c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+
+	inst.Spawn.Args[2].Value = tokenCoins(2)
+	inst.Spawn.Args = append(inst.Spawn.Args, byzcoin.Argument{Name: "cap", Value: tokenCoins(100)})
+	c, _ = contractTokenFromBytes(nil)
+	sc, _, err := c.Spawn(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(sc))
+	require.Equal(t, inst.DeriveID("").Slice(), sc[0].InstanceID)
+
+	var token Token
+	require.NoError(t, protobuf.Decode(sc[0].Value, &token))
+	require.Equal(t, Token{Name: "Test token", Symbol: "TST", Decimals: 2, Cap: 100}, token)
+
+	// The symbol is required.
+	inst.Spawn.Args = inst.Spawn.Args[:1]
+	c, _ = contractTokenFromBytes(nil)
+	_, _, err = c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+}
+
+func TestToken_FormatAmount(t *testing.T) {
+	token := Token{Symbol: "TST"}
+	require.Equal(t, "1234 TST", token.FormatAmount(1234))
+	token.Decimals = 2
+	require.Equal(t, "12.34 TST", token.FormatAmount(1234))
+	require.Equal(t, "0.05 TST", token.FormatAmount(5))
+	require.Equal(t, "0.00 TST", token.FormatAmount(0))
+}
+
+func TestToken_MintBurn(t *testing.T) {
+	ct := newCT()
+	tokenID := iid("token")
+	otherID := iid("other")
+	accountID := iid("account")
+	storeToken(t, ct, tokenID, Token{Name: "Test", Symbol: "TST", Cap: 10},
+		map[byzcoin.InstanceID]TokenAccount{accountID: {}})
+	storeToken(t, ct, otherID, Token{Name: "Other", Symbol: "OTH"},
+		map[byzcoin.InstanceID]TokenAccount{iid("otherAccount"): {}})
+
+	// Mint to an account.
+	inst := invokeInstr(tokenID, "mint",
+		byzcoin.Argument{Name: "coins", Value: tokenCoins(6)},
+		byzcoin.Argument{Name: "destination", Value: accountID.Slice()})
+	sc, co, err := getToken(t, ct, tokenID).Invoke(ct, inst, nil)
+	require.NoError(t, err)
+	require.Empty(t, co)
+	require.Equal(t, 2, len(sc))
+	ct.apply(sc)
+	require.Equal(t, uint64(6), getToken(t, ct, tokenID).Supply)
+	require.Equal(t, uint64(6), getTokenAccount(t, ct, accountID).Coin.Value)
+
+	// The cap can't be exceeded.
+	_, _, err = getToken(t, ct, tokenID).Invoke(ct, inst, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cap")
+
+	// The account must hold the token.
+	inst = invokeInstr(otherID, "mint",
+		byzcoin.Argument{Name: "coins", Value: tokenCoins(1)},
+		byzcoin.Argument{Name: "destination", Value: accountID.Slice()})
+	_, _, err = getToken(t, ct, otherID).Invoke(ct, inst, nil)
+	require.Error(t, err)
+
+	// Without destination, the tokens are given to the next instruction.
+	inst = invokeInstr(tokenID, "mint", byzcoin.Argument{Name: "coins", Value: tokenCoins(2)})
+	sc, co, err = getToken(t, ct, tokenID).Invoke(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: tokenID, Value: 2}}, co)
+	ct.apply(sc)
+	require.Equal(t, uint64(8), getToken(t, ct, tokenID).Supply)
+
+	// Only the tokens of the instance are burnt.
+	other := byzcoin.Coin{Name: CoinName, Value: 3}
+	inst = invokeInstr(tokenID, "burn")
+	sc, co, err = getToken(t, ct, tokenID).Invoke(ct, inst, append(co, other))
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other}, co)
+	ct.apply(sc)
+	require.Equal(t, uint64(6), getToken(t, ct, tokenID).Supply)
+
+	// A token with a supply can't be deleted.
+	_, _, err = getToken(t, ct, tokenID).Delete(ct, invokeInstr(tokenID, ""), nil)
+	require.Error(t, err)
+}
+
+func TestTokenAccount_Transfer(t *testing.T) {
+	ct := newCT()
+	tokenID := iid("token")
+	a1, a2 := iid("account1"), iid("account2")
+	storeToken(t, ct, tokenID, Token{Name: "Test", Symbol: "TST", Supply: 10},
+		map[byzcoin.InstanceID]TokenAccount{
+			a1: {Coin: byzcoin.Coin{Value: 10}},
+			a2: {},
+		})
+	otherToken := iid("other")
+	a3 := iid("account3")
+	storeToken(t, ct, otherToken, Token{Name: "Other", Symbol: "OTH"},
+		map[byzcoin.InstanceID]TokenAccount{a3: {}})
+
+	transfer := func(from, to byzcoin.InstanceID, v uint64) error {
+		inst := invokeInstr(from, "transfer",
+			byzcoin.Argument{Name: "coins", Value: tokenCoins(v)},
+			byzcoin.Argument{Name: "destination", Value: to.Slice()})
+		sc, _, err := getTokenAccount(t, ct, from).Invoke(ct, inst, nil)
+		if err == nil {
+			ct.apply(sc)
+		}
+		return err
+	}
+
+	require.NoError(t, transfer(a1, a2, 4))
+	require.Equal(t, uint64(6), getTokenAccount(t, ct, a1).Coin.Value)
+	require.Equal(t, uint64(4), getTokenAccount(t, ct, a2).Coin.Value)
+
+	require.Error(t, transfer(a2, a1, 5))
+	require.Error(t, transfer(a1, a1, 1))
+	require.Error(t, transfer(a1, a3, 1))
+	require.Error(t, transfer(a1, tokenID, 1))
+}
+
+func TestTokenAccount_Allowance(t *testing.T) {
+	ct := newCT()
+	tokenID := iid("token")
+	owner, spender, dest := iid("owner"), iid("spender"), iid("dest")
+	storeToken(t, ct, tokenID, Token{Name: "Test", Symbol: "TST", Supply: 10},
+		map[byzcoin.InstanceID]TokenAccount{
+			owner:   {Coin: byzcoin.Coin{Value: 10}},
+			spender: {},
+			dest:    {},
+		})
+
+	approve := func(v uint64) {
+		inst := invokeInstr(owner, "approve",
+			byzcoin.Argument{Name: "coins", Value: tokenCoins(v)},
+			byzcoin.Argument{Name: "spender", Value: spender.Slice()})
+		sc, _, err := getTokenAccount(t, ct, owner).Invoke(ct, inst, nil)
+		require.NoError(t, err)
+		ct.apply(sc)
+	}
+	transferFrom := func(to byzcoin.InstanceID, v uint64) error {
+		inst := invokeInstr(spender, "transferFrom",
+			byzcoin.Argument{Name: "coins", Value: tokenCoins(v)},
+			byzcoin.Argument{Name: "from", Value: owner.Slice()},
+			byzcoin.Argument{Name: "destination", Value: to.Slice()})
+		sc, _, err := getTokenAccount(t, ct, spender).Invoke(ct, inst, nil)
+		if err == nil {
+			ct.apply(sc)
+		}
+		return err
+	}
+
+	// Nothing is allowed yet.
+	require.Error(t, transferFrom(dest, 1))
+
+	approve(5)
+	require.Equal(t, uint64(5), getTokenAccount(t, ct, owner).allowance(spender))
+	require.NoError(t, transferFrom(dest, 3))
+	require.NoError(t, transferFrom(spender, 1))
+	require.Error(t, transferFrom(dest, 2))
+	require.Error(t, transferFrom(owner, 1))
+
+	require.Equal(t, uint64(6), getTokenAccount(t, ct, owner).Coin.Value)
+	require.Equal(t, uint64(1), getTokenAccount(t, ct, owner).allowance(spender))
+	require.Equal(t, uint64(1), getTokenAccount(t, ct, spender).Coin.Value)
+	require.Equal(t, uint64(3), getTokenAccount(t, ct, dest).Coin.Value)
+
+	// An approval of 0 removes the allowance.
+	approve(0)
+	require.Empty(t, getTokenAccount(t, ct, owner).Allowances)
+	require.Error(t, transferFrom(dest, 1))
+}
+
+func TestTokenAccount_FetchStoreBurn(t *testing.T) {
+	ct := newCT()
+	tokenID := iid("token")
+	a1, a2 := iid("account1"), iid("account2")
+	storeToken(t, ct, tokenID, Token{Name: "Test", Symbol: "TST", Supply: 10},
+		map[byzcoin.InstanceID]TokenAccount{
+			a1: {Coin: byzcoin.Coin{Value: 10}},
+			a2: {},
+		})
+
+	inst := invokeInstr(a1, "fetch", byzcoin.Argument{Name: "coins", Value: tokenCoins(11)})
+	_, _, err := getTokenAccount(t, ct, a1).Invoke(ct, inst, nil)
+	require.Error(t, err)
+
+	inst = invokeInstr(a1, "fetch", byzcoin.Argument{Name: "coins", Value: tokenCoins(4)})
+	sc, co, err := getTokenAccount(t, ct, a1).Invoke(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: tokenID, Value: 4}}, co)
+	ct.apply(sc)
+
+	other := byzcoin.Coin{Name: CoinName, Value: 1}
+	sc, co, err = getTokenAccount(t, ct, a2).Invoke(ct, invokeInstr(a2, "store"), append(co, other))
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other}, co)
+	ct.apply(sc)
+	require.Equal(t, uint64(4), getTokenAccount(t, ct, a2).Coin.Value)
+
+	// Burning reduces the supply of the token.
+	inst = invokeInstr(a2, "burn", byzcoin.Argument{Name: "coins", Value: tokenCoins(4)})
+	sc, _, err = getTokenAccount(t, ct, a2).Invoke(ct, inst, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(sc))
+	ct.apply(sc)
+	require.Equal(t, uint64(0), getTokenAccount(t, ct, a2).Coin.Value)
+	require.Equal(t, uint64(6), getToken(t, ct, tokenID).Supply)
+
+	// Only an empty account can be deleted.
+	_, _, err = getTokenAccount(t, ct, a1).Delete(ct, invokeInstr(a1, ""), nil)
+	require.Error(t, err)
+	sc, _, err = getTokenAccount(t, ct, a2).Delete(ct, invokeInstr(a2, ""), nil)
+	require.NoError(t, err)
+	require.Equal(t, byzcoin.Remove, sc[0].StateAction)
+}
+
+func TestToken_CoinInstance(t *testing.T) {
+	ct := newCT()
+	tokenID := iid("token")
+	storeToken(t, ct, tokenID, Token{Name: "Test", Symbol: "TST", Cap: 10}, nil)
+
+	// A coin instance of the type of the token can't be spawned.
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractCoinID,
+			Args:       byzcoin.Arguments{{Name: "type", Value: tokenID.Slice()}},
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	c, _ := contractCoinFromBytes(nil)
+	_, _, err := c.Spawn(ct, inst, nil)
+	require.Error(t, err)
+
+	// A coin instance created before the token can't mint or pass on its
+	// tokens, so they can't be stored in a token account above the cap.
+	coinID := iid("coin")
+	buf, err := protobuf.Encode(&byzcoin.Coin{Name: tokenID, Value: 100})
+	require.NoError(t, err)
+	ct.Store(coinID, buf, ContractCoinID, gdarc.GetBaseID())
+	for _, cmd := range []string{"mint", "fetch"} {
+		inst = invokeInstr(coinID, cmd, byzcoin.Argument{Name: "coins", Value: tokenCoins(100)})
+		_, _, err = ct.getContract(coinID).Invoke(ct, inst, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "token accounts")
+	}
+	_, _, err = ct.getContract(coinID).Invoke(ct, invokeInstr(coinID, "store"),
+		[]byzcoin.Coin{{Name: tokenID, Value: 1}})
+	require.Error(t, err)
+}
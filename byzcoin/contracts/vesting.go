@@ -0,0 +1,244 @@
+package contracts
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ContractVestingID denotes a contract locking coins for a beneficiary, who
+// can claim them gradually.
+//
+// Spawn takes the coins given to the instruction, usually fetched from a coin
+// account in the previous instruction, and the arguments:
+//   - "beneficiary" is the darc guarding the new instance
+//   - "start" is the optional timestamp in nanoseconds where the vesting
+//     starts, the one of the latest block by default
+//   - "cliff" is the optional duration in nanoseconds after the start
+//     during which nothing can be claimed
+//   - "duration" is the duration in nanoseconds after which all the coins
+//     are vested. Between the start and the end, the coins are vested
+//     linearly
+//   - "type" is the type of coins locked, CoinName by default
+//
+// The time is given by the timestamp of the latest block. The following
+// methods are available:
+//   - claim outputs the coins vested and not yet claimed, to be stored by the
+//     next instruction, usually the store of a coin account
+//
+// You can only delete an instance whose coins have all been claimed.
+const ContractVestingID = "vesting"
+
+// Vesting is the data of a vesting instance.
+type Vesting struct {
+	Beneficiary darc.ID
+	// Coin holds the total of the coins locked.
+	Coin byzcoin.Coin
+	// Claimed is the amount of coins already claimed.
+	Claimed uint64
+	// Start is the timestamp in nanoseconds where the vesting starts.
+	Start int64
+	// Cliff is the duration in nanoseconds before the first coins are
+	// vested.
+	Cliff int64
+	// Duration is the duration in nanoseconds after which all the coins are
+	// vested.
+	Duration int64
+}
+
+// String returns a human readable string representation of the vesting.
+func (v Vesting) String() string {
+	out := new(strings.Builder)
+	out.WriteString("- Vesting:\n")
+	fmt.Fprintf(out, "-- Beneficiary: %x\n", []byte(v.Beneficiary))
+	fmt.Fprintf(out, "-- Coins: %d %s\n", v.Coin.Value, v.Coin.Name)
+	fmt.Fprintf(out, "-- Claimed: %d\n", v.Claimed)
+	fmt.Fprintf(out, "-- Start: %s\n", time.Unix(0, v.Start).UTC())
+	fmt.Fprintf(out, "-- Cliff: %s\n", time.Duration(v.Cliff))
+	fmt.Fprintf(out, "-- Duration: %s\n", time.Duration(v.Duration))
+	return out.String()
+}
+
+// Vested returns the amount of coins vested at the timestamp, claimed or not.
+func (v Vesting) Vested(timestamp int64) uint64 {
+	elapsed := timestamp - v.Start
+	switch {
+	case elapsed < v.Cliff || elapsed < 0:
+		return 0
+	case elapsed >= v.Duration:
+		return v.Coin.Value
+	}
+	// As elapsed < Duration, the quotient fits in 64 bits.
+	hi, lo := bits.Mul64(v.Coin.Value, uint64(elapsed))
+	vested, _ := bits.Div64(hi, lo, uint64(v.Duration))
+	return vested
+}
+
+func contractVestingFromBytes(in []byte) (byzcoin.Contract, error) {
+	c := &contractVesting{}
+	err := protobuf.Decode(in, &c.Vesting)
+	if err != nil {
+		return nil, xerrors.Errorf("couldn't unmarshal instance data: %v", err)
+	}
+	return c, nil
+}
+
+type contractVesting struct {
+	byzcoin.BasicContract
+	Vesting
+}
+
+func (c *contractVesting) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	args := inst.Spawn.Args
+	c.Vesting = Vesting{
+		Beneficiary: darc.ID(args.Search("beneficiary")),
+		Coin:        byzcoin.Coin{Name: CoinName},
+	}
+	err = checkDarcInstance(rst, c.Beneficiary)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("checking beneficiary: %v", err)
+	}
+	if t := args.Search("type"); t != nil {
+		if len(t) != len(byzcoin.InstanceID{}) {
+			return nil, nil, xerrors.New("type needs to be an InstanceID")
+		}
+		c.Coin.Name = byzcoin.NewInstanceID(t)
+	}
+
+	if args.Search("start") != nil {
+		var start uint64
+		start, err = uint64Arg(args, "start")
+		if err != nil {
+			return
+		}
+		c.Start = int64(start)
+	} else {
+		c.Start, err = latestTimestamp(rst)
+		if err != nil {
+			return
+		}
+	}
+	if args.Search("cliff") != nil {
+		var cliff uint64
+		cliff, err = uint64Arg(args, "cliff")
+		if err != nil {
+			return
+		}
+		c.Cliff = int64(cliff)
+	}
+	var duration uint64
+	duration, err = uint64Arg(args, "duration")
+	if err != nil {
+		return
+	}
+	c.Duration = int64(duration)
+	if c.Start < 0 || c.Cliff < 0 || c.Duration <= 0 || c.Cliff > c.Duration {
+		return nil, nil, xerrors.New("the duration must be positive and not shorter than the cliff")
+	}
+
+	cout = []byzcoin.Coin{}
+	for _, co := range coins {
+		if co.Name.Equal(c.Coin.Name) {
+			err = c.Coin.SafeAdd(co.Value)
+			if err != nil {
+				return
+			}
+		} else {
+			cout = append(cout, co)
+		}
+	}
+	if c.Coin.Value == 0 {
+		return nil, nil, xerrors.New("no coins given to the vesting")
+	}
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Vesting)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode vesting: %v", err)
+	}
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ContractVestingID, buf, c.Beneficiary),
+	}
+	return
+}
+
+func (c *contractVesting) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if inst.Invoke.Command != "claim" {
+		return nil, nil, xerrors.New("vesting contract can only claim")
+	}
+
+	var now int64
+	now, err = latestTimestamp(rst)
+	if err != nil {
+		return
+	}
+	claimable := c.Vested(now) - c.Claimed
+	if claimable == 0 {
+		return nil, nil, xerrors.New("no coins to claim")
+	}
+	c.Claimed += claimable
+	cout = append(cout, byzcoin.Coin{Name: c.Coin.Name, Value: claimable})
+
+	var buf []byte
+	buf, err = protobuf.Encode(&c.Vesting)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("couldn't encode vesting: %v", err)
+	}
+	log.Lvlf2("claiming %d coins of vesting %x", claimable, inst.InstanceID.Slice())
+	sc = []byzcoin.StateChange{
+		byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID, ContractVestingID, buf, darcID),
+	}
+	return
+}
+
+func (c *contractVesting) Delete(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction, coins []byzcoin.Coin) (sc []byzcoin.StateChange, cout []byzcoin.Coin, err error) {
+	cout = coins
+
+	var darcID darc.ID
+	_, _, _, darcID, err = rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return
+	}
+
+	if c.Claimed < c.Coin.Value {
+		return nil, nil, xerrors.New("cannot delete a vesting with unclaimed coins")
+	}
+	sc = byzcoin.StateChanges{
+		byzcoin.NewStateChange(byzcoin.Remove, inst.InstanceID, ContractVestingID, nil, darcID),
+	}
+	return
+}
+
+// latestTimestamp returns the timestamp of the block that produced the state,
+// so that all the nodes use the same one, even when replaying the chain.
+func latestTimestamp(rst byzcoin.ReadOnlyStateTrie) (int64, error) {
+	gs, ok := rst.(byzcoin.GlobalState)
+	if !ok {
+		return 0, xerrors.New("the blocks are not available")
+	}
+	sb, err := gs.GetBlockByIndex(rst.GetIndex())
+	if err != nil {
+		return 0, xerrors.Errorf("getting block: %v", err)
+	}
+	var header byzcoin.DataHeader
+	err = protobuf.Decode(sb.Data, &header)
+	if err != nil {
+		return 0, xerrors.Errorf("couldn't decode header: %v", err)
+	}
+	return header.Timestamp, nil
+}
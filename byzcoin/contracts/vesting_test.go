@@ -0,0 +1,190 @@
+package contracts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// gsTest adds to the test trie a latest block with the given timestamp.
+type gsTest struct {
+	*cvTest
+	timestamp int64
+}
+
+func (gs gsTest) GetBlockByIndex(idx int) (*skipchain.SkipBlock, error) {
+	if idx != gs.GetIndex() {
+		return nil, xerrors.New("not the block of the trie")
+	}
+	sb := skipchain.NewSkipBlock()
+	sb.Index = idx
+	data, err := protobuf.Encode(&byzcoin.DataHeader{Timestamp: gs.timestamp})
+	if err != nil {
+		return nil, err
+	}
+	sb.Data = data
+	return sb, nil
+}
+
+func (gs gsTest) GetLatest() (*skipchain.SkipBlock, error) {
+	return gs.GetBlockByIndex(gs.GetIndex())
+}
+
+func (gs gsTest) GetGenesisBlock() (*skipchain.SkipBlock, error) {
+	return nil, xerrors.New("not implemented")
+}
+
+func (gs gsTest) GetBlock(skipchain.SkipBlockID) (*skipchain.SkipBlock, error) {
+	return nil, xerrors.New("not implemented")
+}
+
+func getVesting(t *testing.T, ct *cvTest, id byzcoin.InstanceID) *contractVesting {
+	c, err := contractVestingFromBytes(ct.values[string(id.Slice())])
+	require.NoError(t, err)
+	return c.(*contractVesting)
+}
+
+func spawnVestingInst(args ...byzcoin.Argument) byzcoin.Instruction {
+	return byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gdarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: ContractVestingID,
+			Args:       args,
+		},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+}
+
+func TestVesting_Vested(t *testing.T) {
+	v := Vesting{
+		Coin:     byzcoin.Coin{Value: 1000},
+		Start:    100,
+		Cliff:    10,
+		Duration: 100,
+	}
+	require.Equal(t, uint64(0), v.Vested(0))
+	require.Equal(t, uint64(0), v.Vested(109))
+	require.Equal(t, uint64(100), v.Vested(110))
+	require.Equal(t, uint64(555), v.Vested(155))
+	require.Equal(t, uint64(1000), v.Vested(200))
+	require.Equal(t, uint64(1000), v.Vested(math.MaxInt64))
+
+	// The intermediate product doesn't overflow.
+	v.Coin.Value = math.MaxUint64
+	v.Duration = math.MaxInt64
+	require.Equal(t, uint64(math.MaxUint64/2), v.Vested(100+math.MaxInt64/2))
+}
+
+func TestVesting_Spawn(t *testing.T) {
+	ct := newCT("spawn:vesting")
+	gs := gsTest{cvTest: ct, timestamp: 1000}
+	beneficiary := storeDarc(t, ct, "beneficiary")
+	c, _ := contractVestingFromBytes(nil)
+
+	for _, args := range [][]byzcoin.Argument{
+		{{Name: "duration", Value: tokenCoins(10)}},
+		{{Name: "beneficiary", Value: beneficiary}},
+		{{Name: "beneficiary", Value: beneficiary}, {Name: "duration", Value: tokenCoins(0)}},
+		{{Name: "beneficiary", Value: beneficiary}, {Name: "duration", Value: tokenCoins(10)},
+			{Name: "cliff", Value: tokenCoins(11)}},
+	} {
+		_, _, err := c.Spawn(gs, spawnVestingInst(args...), []byzcoin.Coin{{Name: CoinName, Value: 1}})
+		require.Error(t, err)
+	}
+
+	inst := spawnVestingInst(
+		byzcoin.Argument{Name: "beneficiary", Value: beneficiary},
+		byzcoin.Argument{Name: "duration", Value: tokenCoins(100)},
+		byzcoin.Argument{Name: "cliff", Value: tokenCoins(10)})
+	_, _, err := c.Spawn(gs, inst, nil)
+	require.Error(t, err)
+
+	// The vesting starts at the latest block by default.
+	other := byzcoin.Coin{Name: iid("other"), Value: 1}
+	sc, cout, err := c.Spawn(gs, inst, []byzcoin.Coin{other, {Name: CoinName, Value: 50}})
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{other}, cout)
+	require.Equal(t, 1, len(sc))
+	require.Equal(t, beneficiary, sc[0].DarcID)
+	ct.apply(sc)
+	v := getVesting(t, ct, byzcoin.NewInstanceID(sc[0].InstanceID))
+	require.Equal(t, int64(1000), v.Start)
+	require.Equal(t, uint64(50), v.Coin.Value)
+
+	inst.Spawn.Args = append(inst.Spawn.Args, byzcoin.Argument{Name: "start", Value: tokenCoins(5)})
+	sc, _, err = c.Spawn(gs, inst, []byzcoin.Coin{{Name: CoinName, Value: 50}})
+	require.NoError(t, err)
+	ct.apply(sc)
+	require.Equal(t, int64(5), getVesting(t, ct, byzcoin.NewInstanceID(sc[0].InstanceID)).Start)
+
+	// The timestamp is needed.
+	inst.Spawn.Args = inst.Spawn.Args[:3]
+	_, _, err = c.Spawn(ct, inst, []byzcoin.Coin{{Name: CoinName, Value: 50}})
+	require.Error(t, err)
+}
+
+func TestVesting_Claim(t *testing.T) {
+	ct := newCT("spawn:vesting")
+	gs := gsTest{cvTest: ct, timestamp: 0}
+	beneficiary := storeDarc(t, ct, "beneficiary")
+	c, _ := contractVestingFromBytes(nil)
+	sc, _, err := c.Spawn(gs, spawnVestingInst(
+		byzcoin.Argument{Name: "beneficiary", Value: beneficiary},
+		byzcoin.Argument{Name: "start", Value: tokenCoins(100)},
+		byzcoin.Argument{Name: "cliff", Value: tokenCoins(10)},
+		byzcoin.Argument{Name: "duration", Value: tokenCoins(100)}),
+		[]byzcoin.Coin{{Name: CoinName, Value: 1000}})
+	require.NoError(t, err)
+	ct.apply(sc)
+	id := byzcoin.NewInstanceID(sc[0].InstanceID)
+
+	claim := func(timestamp int64) ([]byzcoin.Coin, error) {
+		gs.timestamp = timestamp
+		in := []byzcoin.Coin{{Name: iid("other"), Value: 1}}
+		sc, cout, err := getVesting(t, ct, id).Invoke(gs, invokeInstr(id, "claim"), in)
+		if err != nil {
+			return nil, err
+		}
+		ct.apply(sc)
+		return cout[1:], nil
+	}
+
+	// Nothing before the cliff.
+	_, err = claim(109)
+	require.Error(t, err)
+
+	cout, err := claim(150)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: CoinName, Value: 500}}, cout)
+	_, err = claim(150)
+	require.Error(t, err)
+
+	// Only the coins vested since the last claim are given.
+	cout, err = claim(175)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: CoinName, Value: 250}}, cout)
+
+	del := byzcoin.Instruction{
+		InstanceID:       id,
+		Delete:           &byzcoin.Delete{},
+		SignerIdentities: []darc.Identity{gsigner.Identity()},
+		SignerCounter:    []uint64{1},
+	}
+	_, _, err = getVesting(t, ct, id).Delete(gs, del, nil)
+	require.Error(t, err)
+
+	cout, err = claim(1000)
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.Coin{{Name: CoinName, Value: 250}}, cout)
+	require.Equal(t, uint64(1000), getVesting(t, ct, id).Claimed)
+
+	_, _, err = getVesting(t, ct, id).Delete(gs, del, nil)
+	require.NoError(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/protobuf"
 )
 
 func testContractFn(in []byte) (Contract, error) {
@@ -36,3 +37,104 @@ func TestContracts_Registry(t *testing.T) {
 	require.Error(t, r.register("c", testContractFn, false))
 	require.NoError(t, r.register("c", testContractFn, true))
 }
+
+// Test the registration of the versions of a contract.
+func TestContracts_RegistryVersions(t *testing.T) {
+	r := newContractRegistry()
+	require.Error(t, r.registerVersion("a", 1, testContractFn, false))
+	require.NoError(t, r.register("a", testContractFn, false))
+	require.Error(t, r.registerVersion("a", 0, testContractFn, false))
+	require.NoError(t, r.registerVersion("a", 2, testContractFn, false))
+	require.NoError(t, r.registerVersion("a", 1, testContractFn, false))
+	require.Error(t, r.registerVersion("a", 1, testContractFn, false))
+
+	f, exists := r.SearchVersion("a", 0)
+	require.NotNil(t, f)
+	require.True(t, exists)
+	f, exists = r.SearchVersion("a", 2)
+	require.NotNil(t, f)
+	require.True(t, exists)
+	f, exists = r.SearchVersion("a", 3)
+	require.Nil(t, f)
+	require.False(t, exists)
+
+	require.Equal(t, []ContractVersion{
+		{ContractID: "a", Version: 1},
+		{ContractID: "a", Version: 2},
+	}, r.supportedVersions())
+
+	r2 := r.clone()
+	require.Error(t, r.registerVersion("a", 3, testContractFn, false))
+	require.NoError(t, r2.registerVersion("a", 3, testContractFn, true))
+	_, exists = r.SearchVersion("a", 3)
+	require.False(t, exists)
+
+	cr := chainContractRegistry{contractRegistry: r2, active: map[string]int{"a": 3}}
+	_, exists = cr.Search("a")
+	require.True(t, exists)
+	cr.active["a"] = 4
+	_, exists = cr.Search("a")
+	require.False(t, exists)
+}
+
+// Test the activation of the contract versions in the chain config.
+func TestContracts_ChainConfigVersions(t *testing.T) {
+	c := ChainConfig{}
+	require.Error(t, c.checkContractUpgrade(ContractVersion{Version: 1, Index: 5}, 2))
+	require.Error(t, c.checkContractUpgrade(ContractVersion{ContractID: "a", Index: 5}, 2))
+	require.Error(t, c.checkContractUpgrade(ContractVersion{ContractID: "a", Version: 1, Index: 2}, 2))
+
+	v1 := ContractVersion{ContractID: "a", Version: 1, Index: 5}
+	require.NoError(t, c.checkContractUpgrade(v1, 2))
+	c.ContractVersions = append(c.ContractVersions, v1)
+	require.Error(t, c.checkContractUpgrade(v1, 2))
+
+	v2 := ContractVersion{ContractID: "a", Version: 2, Index: 10}
+	require.NoError(t, c.checkContractUpgrade(v2, 3))
+	c.ContractVersions = append(c.ContractVersions, v2)
+
+	require.Equal(t, 0, c.activeContractVersions(4)["a"])
+	require.Equal(t, 1, c.activeContractVersions(5)["a"])
+	require.Equal(t, 1, c.activeContractVersions(9)["a"])
+	require.Equal(t, 2, c.activeContractVersions(10)["a"])
+	require.Equal(t, 0, c.activeContractVersions(10)["b"])
+
+	require.Contains(t, c.String(), "a version 2 from block 10")
+}
+
+// Test that the contract versions are loaded once for the staging trie of a
+// block.
+func TestContracts_ChainContractsCache(t *testing.T) {
+	s := &Service{contracts: newContractRegistry()}
+	sst, err := newMemStagingStateTrie([]byte("nonce"))
+	require.NoError(t, err)
+
+	// Without a config, nothing is cached.
+	require.Nil(t, s.getChainContracts(sst).active)
+	require.Nil(t, sst.active)
+
+	storeConfig := func(version int, action StateAction) {
+		config := ChainConfig{ContractVersions: []ContractVersion{
+			{ContractID: "a", Version: version, Index: 0},
+		}}
+		buf, err := protobuf.Encode(&config)
+		require.NoError(t, err)
+		require.NoError(t, sst.StoreAll(StateChanges{{
+			StateAction: action,
+			InstanceID:  NewInstanceID(nil).Slice(),
+			ContractID:  ContractConfigID,
+			Value:       buf,
+		}}))
+	}
+	storeConfig(1, Create)
+	require.Equal(t, 1, s.getChainContracts(sst).active["a"])
+
+	// The versions are kept for the rest of the block.
+	storeConfig(2, Update)
+	require.Equal(t, 1, s.getChainContracts(sst).active["a"])
+	require.Equal(t, 1, s.getChainContracts(sst.Clone()).active["a"])
+
+	// They are loaded again for another block.
+	sst.activeIndex--
+	require.Equal(t, 2, s.getChainContracts(sst).active["a"])
+}
@@ -0,0 +1,285 @@
+package byzcoin
+
+import (
+	"sync"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// maxDeferredProposals is the number of proposals a node collects signatures
+// for at the same time.
+const maxDeferredProposals = 1024
+
+// maxDeferredProofs is the number of signatures collected for one proposal.
+const maxDeferredProofs = 1024
+
+type deferredProposal struct {
+	byzcoinID skipchain.SkipBlockID
+	proofs    []DeferredProof
+}
+
+// deferredProposals holds the signatures collected off-chain for the
+// deferred instances. The data of the proposals is always read from the
+// global state, so that only the signatures are kept in memory, until the
+// proposal expires or is executed.
+type deferredProposals struct {
+	sync.Mutex
+	proposals map[string]*deferredProposal
+}
+
+func newDeferredProposals() *deferredProposals {
+	return &deferredProposals{proposals: make(map[string]*deferredProposal)}
+}
+
+// register adds the proposal if it is not known yet.
+func (dp *deferredProposals) register(scID skipchain.SkipBlockID, id InstanceID) error {
+	dp.Lock()
+	defer dp.Unlock()
+
+	if _, ok := dp.proposals[string(id.Slice())]; ok {
+		return nil
+	}
+	if len(dp.proposals) >= maxDeferredProposals {
+		return xerrors.New("too many proposals")
+	}
+	dp.proposals[string(id.Slice())] = &deferredProposal{byzcoinID: scID}
+	return nil
+}
+
+// get returns a copy of the proofs of the proposal, or false if the proposal
+// is not registered for this chain.
+func (dp *deferredProposals) get(scID skipchain.SkipBlockID, id InstanceID) ([]DeferredProof, bool) {
+	dp.Lock()
+	defer dp.Unlock()
+
+	p, ok := dp.proposals[string(id.Slice())]
+	if !ok || !p.byzcoinID.Equal(scID) {
+		return nil, false
+	}
+	return append([]DeferredProof{}, p.proofs...), true
+}
+
+// add stores the proof unless the identity already signed the instruction.
+func (dp *deferredProposals) add(scID skipchain.SkipBlockID, id InstanceID, proof DeferredProof) error {
+	dp.Lock()
+	defer dp.Unlock()
+
+	p, ok := dp.proposals[string(id.Slice())]
+	if !ok || !p.byzcoinID.Equal(scID) {
+		return xerrors.New("unknown proposal")
+	}
+	for _, stored := range p.proofs {
+		if stored.Index == proof.Index && stored.Identity.Equal(&proof.Identity) {
+			return xerrors.New("identity already stored")
+		}
+	}
+	if len(p.proofs) >= maxDeferredProofs {
+		return xerrors.New("too many proofs")
+	}
+	p.proofs = append(p.proofs, proof)
+	return nil
+}
+
+func (dp *deferredProposals) remove(id InstanceID) {
+	dp.Lock()
+	defer dp.Unlock()
+
+	delete(dp.proposals, string(id.Slice()))
+}
+
+// list returns the chains of the registered proposals.
+func (dp *deferredProposals) list() map[string]skipchain.SkipBlockID {
+	dp.Lock()
+	defer dp.Unlock()
+
+	ids := make(map[string]skipchain.SkipBlockID)
+	for id, p := range dp.proposals {
+		ids[id] = p.byzcoinID
+	}
+	return ids
+}
+
+// loadDeferredData returns the data of a deferred instance that can still be
+// executed.
+func (s *Service) loadDeferredData(scID skipchain.SkipBlockID, id InstanceID) (ReadOnlyStateTrie, *DeferredData, error) {
+	if !s.hasByzCoinVerification(scID) {
+		return nil, nil, xerrors.New("unknown byzcoin ID")
+	}
+	st, err := s.GetReadOnlyStateTrie(scID)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	value, _, contractID, _, err := st.GetValues(id.Slice())
+	if err != nil {
+		if xerrors.Is(err, errKeyNotSet) {
+			return nil, nil, xerrors.New("unknown instance")
+		}
+		return nil, nil, xerrors.Errorf("reading trie: %v", err)
+	}
+	if contractID != ContractDeferredID {
+		return nil, nil, xerrors.Errorf("instance is a %s and not a deferred instance", contractID)
+	}
+
+	var dd DeferredData
+	err = protobuf.Decode(value, &dd)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("decoding deferred data: %v", err)
+	}
+	if dd.MaxNumExecution < 1 {
+		return nil, nil, xerrors.New("maximum number of executions reached")
+	}
+	if uint64(st.GetIndex()) > dd.ExpireBlockIndex {
+		return nil, nil, xerrors.New("proposal expired")
+	}
+	return st, &dd, nil
+}
+
+// deferredProposalResponse returns the state of the proposal. The proofs that
+// have been added on-chain in the meantime are dropped.
+func (s *Service) deferredProposalResponse(st ReadOnlyStateTrie, dd *DeferredData, proofs []DeferredProof) *DeferredProposalResponse {
+	resp := &DeferredProposalResponse{
+		ProposedTransaction: dd.ProposedTransaction,
+		InstructionHashes:   dd.InstructionHashes,
+		ExpireBlockIndex:    dd.ExpireBlockIndex,
+	}
+
+	instrs := make(Instructions, len(dd.ProposedTransaction.Instructions))
+	copy(instrs, dd.ProposedTransaction.Instructions)
+	for _, proof := range proofs {
+		if dd.verifyProof(proof) != nil {
+			continue
+		}
+		resp.Proofs = append(resp.Proofs, proof)
+		instr := &instrs[proof.Index]
+		instr.SignerIdentities = append(instr.SignerIdentities[:len(instr.SignerIdentities):len(instr.SignerIdentities)],
+			proof.Identity)
+		instr.Signatures = append(instr.Signatures[:len(instr.Signatures):len(instr.Signatures)],
+			proof.Signature)
+	}
+
+	// The instructions are verified against the current state, so an
+	// instruction depending on the result of a previous one might still
+	// fail during the execution.
+	resp.Ready = true
+	for i, instr := range instrs {
+		err := instr.VerifyWithOption(st, dd.InstructionHashes[i], &VerificationOptions{IgnoreCounters: true})
+		if err != nil {
+			resp.Ready = false
+			break
+		}
+	}
+	return resp
+}
+
+// ProposeDeferred registers a deferred instance so that the signatures of its
+// proposed transaction can be collected off-chain. Unless the request is
+// local, it is forwarded to all the members of the roster.
+func (s *Service) ProposeDeferred(req *ProposeDeferred) (*DeferredProposalResponse, error) {
+	st, dd, err := s.loadDeferredData(req.ByzCoinID, req.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.deferredProposals.register(req.ByzCoinID, req.InstanceID)
+	if err != nil {
+		// Drop the proposals that expired or have been executed and try
+		// again.
+		for id, scID := range s.deferredProposals.list() {
+			iid := NewInstanceID([]byte(id))
+			if _, _, err := s.loadDeferredData(scID, iid); err != nil {
+				s.deferredProposals.remove(iid)
+			}
+		}
+		err = s.deferredProposals.register(req.ByzCoinID, req.InstanceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !req.Local {
+		localReq := *req
+		localReq.Local = true
+		s.forwardDeferred(req.ByzCoinID, &localReq)
+	}
+
+	proofs, _ := s.deferredProposals.get(req.ByzCoinID, req.InstanceID)
+	return s.deferredProposalResponse(st, dd, proofs), nil
+}
+
+// GetDeferredProposal returns the signatures collected for a deferred
+// instance and whether they are enough to execute the proposed transaction.
+func (s *Service) GetDeferredProposal(req *GetDeferredProposal) (*DeferredProposalResponse, error) {
+	st, dd, err := s.loadDeferredData(req.ByzCoinID, req.InstanceID)
+	if err != nil {
+		s.deferredProposals.remove(req.InstanceID)
+		return nil, err
+	}
+	proofs, ok := s.deferredProposals.get(req.ByzCoinID, req.InstanceID)
+	if !ok {
+		return nil, xerrors.New("unknown proposal")
+	}
+	return s.deferredProposalResponse(st, dd, proofs), nil
+}
+
+// AddDeferredSignature verifies the signature of an instruction of a
+// proposed transaction and stores it. Unless the request is local, it is
+// forwarded to all the members of the roster.
+func (s *Service) AddDeferredSignature(req *AddDeferredSignature) (*DeferredProposalResponse, error) {
+	st, dd, err := s.loadDeferredData(req.ByzCoinID, req.InstanceID)
+	if err != nil {
+		s.deferredProposals.remove(req.InstanceID)
+		return nil, err
+	}
+	err = dd.verifyProof(req.Proof)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid proof: %v", err)
+	}
+	err = s.deferredProposals.add(req.ByzCoinID, req.InstanceID, req.Proof)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.Local {
+		localReq := *req
+		localReq.Local = true
+		s.forwardDeferred(req.ByzCoinID, &localReq)
+	}
+
+	proofs, _ := s.deferredProposals.get(req.ByzCoinID, req.InstanceID)
+	return s.deferredProposalResponse(st, dd, proofs), nil
+}
+
+// forwardDeferred sends the request to the other members of the roster, so
+// that the co-signers can contact any of them. The errors are only logged as
+// each member verifies the request on its own.
+func (s *Service) forwardDeferred(scID skipchain.SkipBlockID, req interface{}) {
+	latest, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		log.Errorf("%v couldn't get latest block: %v", s.ServerIdentity(), err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, si := range latest.Roster.List {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(si *network.ServerIdentity) {
+			defer wg.Done()
+
+			cl := onet.NewClient(cothority.Suite, ServiceName)
+			err := cl.SendProtobuf(si, req, &DeferredProposalResponse{})
+			if err != nil {
+				log.Lvlf2("%v couldn't forward proposal to %v: %v", s.ServerIdentity(), si, err)
+			}
+		}(si)
+	}
+	wg.Wait()
+}
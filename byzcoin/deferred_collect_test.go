@@ -0,0 +1,72 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+)
+
+func TestDeferredProposals(t *testing.T) {
+	dp := newDeferredProposals()
+	scID := skipchain.SkipBlockID("chain")
+	id := NewInstanceID([]byte("deferred"))
+	signer := darc.NewSignerEd25519(nil, nil)
+	proof := DeferredProof{Index: 0, Identity: signer.Identity(), Signature: []byte("sig")}
+
+	_, ok := dp.get(scID, id)
+	require.False(t, ok)
+	require.Error(t, dp.add(scID, id, proof))
+
+	require.NoError(t, dp.register(scID, id))
+	require.NoError(t, dp.add(scID, id, proof))
+	require.Error(t, dp.add(scID, id, proof))
+	// The same identity can sign another instruction.
+	proof.Index = 1
+	require.NoError(t, dp.add(scID, id, proof))
+
+	// Registering again keeps the proofs.
+	require.NoError(t, dp.register(scID, id))
+	proofs, ok := dp.get(scID, id)
+	require.True(t, ok)
+	require.Equal(t, 2, len(proofs))
+
+	_, ok = dp.get(skipchain.SkipBlockID("other"), id)
+	require.False(t, ok)
+
+	dp.remove(id)
+	_, ok = dp.get(scID, id)
+	require.False(t, ok)
+
+	for i := 0; i < maxDeferredProposals; i++ {
+		require.NoError(t, dp.register(scID, NewInstanceID([]byte{byte(i), byte(i >> 8)})))
+	}
+	require.Error(t, dp.register(scID, id))
+	require.Equal(t, maxDeferredProposals, len(dp.list()))
+}
+
+func TestDeferredData_VerifyProof(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	hash := []byte("hash of the instruction")
+	dd := DeferredData{
+		ProposedTransaction: ClientTransaction{Instructions: Instructions{{}}},
+		InstructionHashes:   [][]byte{hash},
+	}
+
+	sig, err := signer.Sign(hash)
+	require.NoError(t, err)
+	proof := DeferredProof{Index: 0, Identity: signer.Identity(), Signature: sig}
+	require.NoError(t, dd.verifyProof(proof))
+
+	proof.Index = 1
+	require.Error(t, dd.verifyProof(proof))
+	proof.Index = 0
+
+	proof.Signature = []byte("bad")
+	require.Error(t, dd.verifyProof(proof))
+	proof.Signature = sig
+
+	dd.ProposedTransaction.Instructions[0].SignerIdentities = []darc.Identity{signer.Identity()}
+	require.Error(t, dd.verifyProof(proof))
+}
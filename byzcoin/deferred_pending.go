@@ -0,0 +1,454 @@
+package byzcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+func init() {
+	network.RegisterMessages(&StreamPendingDeferred{}, &GetPendingDeferredResponse{})
+}
+
+type liveDeferred struct {
+	id   InstanceID
+	data DeferredData
+}
+
+type deferredChain struct {
+	// index is the index of the block of the global state the entries
+	// correspond to.
+	index   int
+	entries map[string]DeferredData
+}
+
+// deferredIndex keeps the deferred instances of each chain that can still be
+// executed, so that the pending instances are found without going through
+// the global state.
+type deferredIndex struct {
+	sync.Mutex
+	chains map[string]*deferredChain
+}
+
+func newDeferredIndex() *deferredIndex {
+	return &deferredIndex{chains: make(map[string]*deferredChain)}
+}
+
+// load returns the entries of the chain, reading them from the global state if
+// they are missing or don't match the state.
+func (di *deferredIndex) load(scID skipchain.SkipBlockID, st ReadOnlyStateTrie) (*deferredChain, error) {
+	dc, ok := di.chains[string(scID)]
+	if ok && dc.index == st.GetIndex() {
+		return dc, nil
+	}
+
+	dc = &deferredChain{index: st.GetIndex(), entries: make(map[string]DeferredData)}
+	err := st.ForEach(func(k, v []byte) error {
+		body, err := decodeStateChangeBody(v)
+		if err != nil || body.ContractID != ContractDeferredID {
+			return nil
+		}
+		dc.add(k, body.Value)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("iterating trie: %v", err)
+	}
+	di.chains[string(scID)] = dc
+	return dc, nil
+}
+
+func (dc *deferredChain) add(key []byte, value []byte) {
+	var dd DeferredData
+	if err := protobuf.Decode(value, &dd); err != nil {
+		log.Warnf("invalid deferred instance %x: %v", key, err)
+		return
+	}
+	if dd.MaxNumExecution < 1 {
+		delete(dc.entries, string(key))
+		return
+	}
+	dc.entries[string(key)] = dd
+}
+
+// update applies the state changes of the block to the entries of the chain.
+// If a block is missing, the entries will be read again from the global state.
+func (di *deferredIndex) update(scID skipchain.SkipBlockID, index int, scs StateChanges) {
+	di.Lock()
+	defer di.Unlock()
+
+	dc, ok := di.chains[string(scID)]
+	if !ok {
+		return
+	}
+	if dc.index+1 != index {
+		delete(di.chains, string(scID))
+		return
+	}
+	for _, change := range scs {
+		if change.ContractID != ContractDeferredID {
+			continue
+		}
+		if change.StateAction == Remove {
+			delete(dc.entries, string(change.InstanceID))
+		} else {
+			dc.add(change.InstanceID, change.Value)
+		}
+	}
+	for key, dd := range dc.entries {
+		if uint64(index) > dd.ExpireBlockIndex {
+			delete(dc.entries, key)
+		}
+	}
+	dc.index = index
+}
+
+// live returns the deferred instances of the global state that can still be
+// executed, sorted by instance ID.
+func (di *deferredIndex) live(scID skipchain.SkipBlockID, st ReadOnlyStateTrie) ([]liveDeferred, error) {
+	di.Lock()
+	defer di.Unlock()
+
+	dc, err := di.load(scID, st)
+	if err != nil {
+		return nil, err
+	}
+	var live []liveDeferred
+	for key, dd := range dc.entries {
+		if uint64(st.GetIndex()) > dd.ExpireBlockIndex {
+			continue
+		}
+		live = append(live, liveDeferred{id: NewInstanceID([]byte(key)), data: dd})
+	}
+	sort.Slice(live, func(i, j int) bool {
+		return bytes.Compare(live[i].id.Slice(), live[j].id.Slice()) < 0
+	})
+	return live, nil
+}
+
+// exprIncludes returns true if the identity appears in the expression or in
+// the sign rule of one of the darcs it refers to.
+func exprIncludes(visited map[string]bool, expr expression.Expr, getDarc darc.GetDarc, identity string) bool {
+	found := false
+	parser := expression.InitParser(func(s string) bool {
+		if found {
+			return false
+		}
+		if s == identity {
+			found = true
+			return false
+		}
+		if strings.HasPrefix(s, "darc:") && !visited[s] {
+			visited[s] = true
+			d := getDarc(s, true)
+			if d != nil && exprIncludes(visited, d.Rules.GetSignExpr(), getDarc, identity) {
+				found = true
+			}
+		}
+		return false
+	})
+	// The result of the evaluation doesn't matter, only the identities
+	// visited by the parser.
+	expression.Evaluate(parser, expr)
+	return found
+}
+
+// pendingDeferred returns the deferred instances for which the rules of the
+// darcs of the proposed instructions include the identity and which haven't
+// been signed by it, on-chain or off-chain.
+func (s *Service) pendingDeferred(scID skipchain.SkipBlockID, st ReadOnlyStateTrie, live []liveDeferred,
+	identity darc.Identity) ([]PendingDeferred, error) {
+	config, err := LoadConfigFromTrie(st)
+	if err != nil {
+		return nil, xerrors.Errorf("reading config: %v", err)
+	}
+	getDarc := func(str string, latest bool) *darc.Darc {
+		if len(str) < 5 || str[0:5] != "darc:" {
+			return nil
+		}
+		darcID, err := hex.DecodeString(str[5:])
+		if err != nil {
+			return nil
+		}
+		d, err := LoadDarcFromTrie(st, darcID)
+		if err != nil {
+			return nil
+		}
+		return d
+	}
+
+	var pending []PendingDeferred
+	for _, ld := range live {
+		proofs, _ := s.deferredProposals.get(scID, ld.id)
+
+		var indexes []uint32
+		for i, instr := range ld.data.ProposedTransaction.Instructions {
+			if hasSigned(instr, uint32(i), proofs, identity) {
+				continue
+			}
+			d, err := getInstanceDarc(st, instr.InstanceID, config.DarcContractIDs)
+			if err != nil {
+				continue
+			}
+			expr := d.Rules.Get(darc.Action(instr.Action()))
+			if expr != nil && exprIncludes(make(map[string]bool), expr, getDarc, identity.String()) {
+				indexes = append(indexes, uint32(i))
+			}
+		}
+
+		if len(indexes) > 0 {
+			pending = append(pending, PendingDeferred{
+				InstanceID:          ld.id,
+				ProposedTransaction: ld.data.ProposedTransaction,
+				InstructionHashes:   ld.data.InstructionHashes,
+				ExpireBlockIndex:    ld.data.ExpireBlockIndex,
+				Indexes:             indexes,
+			})
+		}
+	}
+	return pending, nil
+}
+
+// hasSigned returns true if the identity signed the instruction, on-chain or
+// off-chain.
+func hasSigned(instr Instruction, index uint32, proofs []DeferredProof, identity darc.Identity) bool {
+	for _, id := range instr.SignerIdentities {
+		if id.Equal(&identity) {
+			return true
+		}
+	}
+	for _, proof := range proofs {
+		if proof.Index == index && proof.Identity.Equal(&identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetPendingDeferred returns the live deferred instances waiting for the
+// signature of the identity.
+func (s *Service) GetPendingDeferred(req *GetPendingDeferred) (*GetPendingDeferredResponse, error) {
+	if !s.hasByzCoinVerification(req.ByzCoinID) {
+		return nil, xerrors.New("unknown byzcoin ID")
+	}
+	st, err := s.GetReadOnlyStateTrie(req.ByzCoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	live, err := s.deferredIdx.live(req.ByzCoinID, st)
+	if err != nil {
+		return nil, xerrors.Errorf("getting deferred instances: %v", err)
+	}
+	pending, err := s.pendingDeferred(req.ByzCoinID, st, live, req.Identity)
+	if err != nil {
+		return nil, err
+	}
+	return &GetPendingDeferredResponse{Pending: pending}, nil
+}
+
+type pendingDeferredListener struct {
+	identity darc.Identity
+	out      chan *GetPendingDeferredResponse
+	// last holds the instances and indexes of the latest response, so that
+	// only the changes are sent.
+	last []byte
+	sent bool
+}
+
+// pendingDeferredManager holds the listeners of StreamPendingDeferred for
+// each chain.
+type pendingDeferredManager struct {
+	sync.Mutex
+	listeners map[string][]*pendingDeferredListener
+	// notifying holds the chains whose listeners are being notified, with
+	// true if a new block arrived in the meantime.
+	notifying map[string]bool
+}
+
+func (m *pendingDeferredManager) newListener(scID string, identity darc.Identity) *pendingDeferredListener {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.listeners == nil {
+		m.listeners = make(map[string][]*pendingDeferredListener)
+	}
+	l := &pendingDeferredListener{
+		identity: identity,
+		out:      make(chan *GetPendingDeferredResponse, 1),
+	}
+	m.listeners[scID] = append(m.listeners[scID], l)
+	return l
+}
+
+func (m *pendingDeferredManager) stopListener(scID string, l *pendingDeferredListener) {
+	m.Lock()
+	defer m.Unlock()
+
+	ls := m.listeners[scID]
+	for i, listener := range ls {
+		if listener == l {
+			close(l.out)
+			m.listeners[scID] = append(ls[:i], ls[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *pendingDeferredManager) stopAll() {
+	m.Lock()
+	defer m.Unlock()
+
+	for key, ls := range m.listeners {
+		for _, l := range ls {
+			close(l.out)
+		}
+		delete(m.listeners, key)
+	}
+}
+
+// pendingDeferredKey summarizes the response so that two responses can be
+// compared.
+func pendingDeferredKey(pending []PendingDeferred) []byte {
+	var key bytes.Buffer
+	for _, p := range pending {
+		key.Write(p.InstanceID.Slice())
+		for _, idx := range p.Indexes {
+			key.WriteByte(byte(idx >> 24))
+			key.WriteByte(byte(idx >> 16))
+			key.WriteByte(byte(idx >> 8))
+			key.WriteByte(byte(idx))
+		}
+		key.WriteByte('|')
+	}
+	return key.Bytes()
+}
+
+// notify computes the pending instances of each listener of the chain and
+// sends them if they changed since the latest response. A listener that is
+// too slow to read the responses misses the intermediate ones.
+func (m *pendingDeferredManager) notify(s *Service, scID skipchain.SkipBlockID, st ReadOnlyStateTrie) {
+	m.Lock()
+	defer m.Unlock()
+
+	ls := m.listeners[string(scID)]
+	if len(ls) == 0 {
+		return
+	}
+
+	live, err := s.deferredIdx.live(scID, st)
+	if err != nil {
+		log.Errorf("couldn't get deferred instances: %v", err)
+		return
+	}
+	for _, l := range ls {
+		pending, err := s.pendingDeferred(scID, st, live, l.identity)
+		if err != nil {
+			log.Errorf("couldn't get pending deferred instances: %v", err)
+			continue
+		}
+		key := pendingDeferredKey(pending)
+		if l.sent && bytes.Equal(key, l.last) {
+			continue
+		}
+		select {
+		case l.out <- &GetPendingDeferredResponse{Pending: pending}:
+			l.last = key
+			l.sent = true
+		default:
+		}
+	}
+}
+
+// notifyBlock notifies the listeners of the chain in the background, so that
+// the blocks are applied without waiting for them. The blocks applied while
+// the listeners are notified lead to a single new notification.
+func (m *pendingDeferredManager) notifyBlock(s *Service, scID skipchain.SkipBlockID) {
+	key := string(scID)
+	m.Lock()
+	if len(m.listeners[key]) == 0 {
+		m.Unlock()
+		return
+	}
+	if m.notifying == nil {
+		m.notifying = make(map[string]bool)
+	}
+	if _, ok := m.notifying[key]; ok {
+		m.notifying[key] = true
+		m.Unlock()
+		return
+	}
+	m.notifying[key] = false
+	m.Unlock()
+
+	s.closedMutex.Lock()
+	if s.closed {
+		s.closedMutex.Unlock()
+		return
+	}
+	s.working.Add(1)
+	s.closedMutex.Unlock()
+
+	go func() {
+		defer s.working.Done()
+		for {
+			st, err := s.GetReadOnlyStateTrie(scID)
+			if err != nil {
+				log.Errorf("couldn't get trie: %v", err)
+			} else {
+				m.notify(s, scID, st)
+			}
+
+			m.Lock()
+			if !m.notifying[key] {
+				delete(m.notifying, key)
+				m.Unlock()
+				return
+			}
+			m.notifying[key] = false
+			m.Unlock()
+		}
+	}()
+}
+
+// StreamPendingDeferred sends the live deferred instances waiting for the
+// signature of the identity, first when the request is received and then each
+// time they change, until the client closes the connection.
+func (s *Service) StreamPendingDeferred(req *StreamPendingDeferred) (chan *GetPendingDeferredResponse, chan bool, error) {
+	if !s.hasByzCoinVerification(req.ByzCoinID) {
+		return nil, nil, xerrors.New("unknown byzcoin ID")
+	}
+	st, err := s.GetReadOnlyStateTrie(req.ByzCoinID)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("getting trie: %v", err)
+	}
+
+	stopChan := make(chan bool)
+	key := string(req.ByzCoinID)
+	l := s.pendingDeferredMan.newListener(key, req.Identity)
+	s.pendingDeferredMan.notify(s, req.ByzCoinID, st)
+
+	go func() {
+		s.closedMutex.Lock()
+		if s.closed {
+			s.closedMutex.Unlock()
+			return
+		}
+		s.working.Add(1)
+		defer s.working.Done()
+		s.closedMutex.Unlock()
+
+		<-stopChan
+		s.pendingDeferredMan.stopListener(key, l)
+	}()
+	return l.out, stopChan, nil
+}
@@ -0,0 +1,97 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+func TestDeferredPending_ExprIncludes(t *testing.T) {
+	a := darc.NewSignerEd25519(nil, nil).Identity().String()
+	b := darc.NewSignerEd25519(nil, nil).Identity().String()
+	c := darc.NewSignerEd25519(nil, nil).Identity().String()
+
+	// d1 can be signed by b or d2, which delegates back to d1.
+	d1 := darc.NewDarc(darc.InitRules(nil, nil), []byte("d1"))
+	d1.Version, d1.BaseID = 1, darc.ID([]byte("base of d1"))
+	d2 := darc.NewDarc(darc.InitRules(nil, nil), []byte("d2"))
+	d2.Version, d2.BaseID = 1, darc.ID([]byte("base of d2"))
+	require.NoError(t, d1.Rules.UpdateSign(expression.InitOrExpr(b, d2.GetIdentityString())))
+	require.NoError(t, d2.Rules.UpdateSign(expression.Expr(d1.GetIdentityString())))
+	getDarc := func(s string, latest bool) *darc.Darc {
+		switch s {
+		case d1.GetIdentityString():
+			return d1
+		case d2.GetIdentityString():
+			return d2
+		}
+		return nil
+	}
+
+	expr := expression.Expr(a + " & (" + d2.GetIdentityString() + " | " + a + ")")
+	require.True(t, exprIncludes(make(map[string]bool), expr, getDarc, a))
+	require.True(t, exprIncludes(make(map[string]bool), expr, getDarc, b))
+	require.True(t, exprIncludes(make(map[string]bool), expr, getDarc, d1.GetIdentityString()))
+	require.False(t, exprIncludes(make(map[string]bool), expr, getDarc, c))
+	require.False(t, exprIncludes(make(map[string]bool), expression.Expr("invalid &"), getDarc, a))
+}
+
+func TestDeferredPending_Key(t *testing.T) {
+	p1 := []PendingDeferred{{InstanceID: NewInstanceID([]byte("a")), Indexes: []uint32{0, 1}}}
+	p2 := []PendingDeferred{{InstanceID: NewInstanceID([]byte("a")), Indexes: []uint32{1}}}
+	require.Equal(t, pendingDeferredKey(p1), pendingDeferredKey(p1))
+	require.NotEqual(t, pendingDeferredKey(p1), pendingDeferredKey(p2))
+	require.NotEqual(t, pendingDeferredKey(p1), pendingDeferredKey(nil))
+}
+
+func TestDeferredPending_Index(t *testing.T) {
+	scID := skipchain.SkipBlockID("chain")
+	st, err := newMemStateTrie([]byte("nonce"))
+	require.NoError(t, err)
+
+	newChange := func(action StateAction, key string, dd DeferredData) StateChange {
+		buf, err := protobuf.Encode(&dd)
+		require.NoError(t, err)
+		return NewStateChange(action, NewInstanceID([]byte(key)), ContractDeferredID, buf, darc.ID("darc"))
+	}
+
+	scs := StateChanges{
+		newChange(Create, "a", DeferredData{MaxNumExecution: 1, ExpireBlockIndex: 10}),
+		newChange(Create, "b", DeferredData{MaxNumExecution: 1, ExpireBlockIndex: 1}),
+		newChange(Create, "c", DeferredData{MaxNumExecution: 0, ExpireBlockIndex: 10}),
+	}
+	require.NoError(t, st.StoreAll(scs, 0, CurrentVersion))
+
+	di := newDeferredIndex()
+	live, err := di.live(scID, st)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(live))
+
+	// The entries are read from the global state only once per block.
+	di.chains[string(scID)].entries["x"] = DeferredData{MaxNumExecution: 1, ExpireBlockIndex: 10}
+	live, err = di.live(scID, st)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(live))
+	delete(di.chains[string(scID)].entries, "x")
+
+	// The changes of the next blocks are applied to the entries, and the
+	// expired instances are dropped.
+	executed := newChange(Update, "a", DeferredData{MaxNumExecution: 0, ExpireBlockIndex: 10})
+	require.NoError(t, st.StoreAll(StateChanges{executed}, 1, CurrentVersion))
+	di.update(scID, 1, StateChanges{executed})
+	require.NoError(t, st.StoreAll(nil, 2, CurrentVersion))
+	di.update(scID, 2, nil)
+	live, err = di.live(scID, st)
+	require.NoError(t, err)
+	require.Empty(t, live)
+	require.Equal(t, 2, di.chains[string(scID)].index)
+
+	// A missing block drops the entries.
+	di.update(scID, 5, nil)
+	_, ok := di.chains[string(scID)]
+	require.False(t, ok)
+}
@@ -0,0 +1,162 @@
+package byzcoin
+
+import (
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// defaultHealthBlocks is the number of blocks used to compute the statistics
+// of GetChainHealth when the request doesn't give any.
+const defaultHealthBlocks = 100
+
+// GetChainHealth returns the health metrics of a chain as seen by this node.
+// The statistics about the block interval, the transactions and the view
+// changes are computed over the latest blocks. The other members of the
+// roster are asked for their latest block so that lagging nodes can be
+// detected.
+func (s *Service) GetChainHealth(req *GetChainHealth) (*GetChainHealthResponse, error) {
+	if !s.hasByzCoinVerification(req.ByzCoinID) {
+		return nil, xerrors.New("unknown byzcoin ID")
+	}
+
+	latest, err := s.db().GetLatestByID(req.ByzCoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest block: %v", err)
+	}
+	header, err := decodeBlockHeader(latest)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding header: %v", err)
+	}
+	interval, _, err := s.LoadBlockInfo(req.ByzCoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("loading block info: %v", err)
+	}
+	st, err := s.getStateTrie(req.ByzCoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+
+	s.updateTrieLock.Lock()
+	catchingUp := s.catchingUp
+	s.updateTrieLock.Unlock()
+
+	resp := &GetChainHealthResponse{
+		LatestIndex:     latest.Index,
+		TrieIndex:       st.GetIndex(),
+		LatestTimestamp: header.Timestamp,
+		SinceLatest:     time.Since(time.Unix(0, header.Timestamp)),
+		BlockInterval:   interval,
+		PendingTxs:      s.txBuffer.count(string(req.ByzCoinID)),
+		CatchingUp:      catchingUp,
+	}
+
+	err = s.fillChainHealthWindow(resp, latest, req.Blocks)
+	if err != nil {
+		return nil, xerrors.Errorf("reading blocks: %v", err)
+	}
+
+	resp.Nodes = s.getRosterLag(latest, req.ByzCoinID)
+
+	return resp, nil
+}
+
+// fillChainHealthWindow walks back the chain from the latest block and fills
+// the statistics of the response with at most n blocks.
+func (s *Service) fillChainHealthWindow(resp *GetChainHealthResponse, latest *skipchain.SkipBlock, n int) error {
+	if n <= 0 {
+		n = defaultHealthBlocks
+	}
+
+	sb := latest
+	first := resp.LatestTimestamp
+	for sb != nil && resp.WindowBlocks < n {
+		header, err := decodeBlockHeader(sb)
+		if err != nil {
+			return xerrors.Errorf("decoding header: %v", err)
+		}
+		var body DataBody
+		err = protobuf.Decode(sb.Payload, &body)
+		if err != nil {
+			return xerrors.Errorf("decoding body: %v", err)
+		}
+
+		for _, tx := range body.TxResults {
+			if tx.Accepted {
+				resp.AcceptedTxs++
+			} else {
+				resp.RefusedTxs++
+			}
+		}
+		if isViewChangeTx(body.TxResults) != nil {
+			resp.ViewChanges++
+		}
+
+		first = header.Timestamp
+		resp.WindowBlocks++
+
+		if len(sb.BackLinkIDs) == 0 {
+			break
+		}
+		sb = s.db().GetByID(sb.BackLinkIDs[0])
+	}
+
+	if resp.WindowBlocks > 1 {
+		elapsed := resp.LatestTimestamp - first
+		resp.ObservedInterval = time.Duration(elapsed / int64(resp.WindowBlocks-1))
+	}
+	if total := resp.AcceptedTxs + resp.RefusedTxs; total > 0 {
+		resp.RefusedRate = float64(resp.RefusedTxs) / float64(total)
+	}
+
+	return nil
+}
+
+// getRosterLag asks each member of the roster of the latest block for its
+// latest block and compares the index with the one of this node. The members
+// are contacted in parallel so that an offline node doesn't delay the others.
+func (s *Service) getRosterLag(latest *skipchain.SkipBlock, scID skipchain.SkipBlockID) []ChainHealthNode {
+	nodes := make([]ChainHealthNode, len(latest.Roster.List))
+
+	var wg sync.WaitGroup
+	for i, si := range latest.Roster.List {
+		nodes[i].ServerIdentity = si
+
+		if si.Equal(s.ServerIdentity()) {
+			nodes[i].LatestIndex = latest.Index
+			continue
+		}
+
+		wg.Add(1)
+		go func(node *ChainHealthNode) {
+			defer wg.Done()
+
+			ro := onet.NewRoster([]*network.ServerIdentity{node.ServerIdentity})
+			reply, err := skipchain.NewClient().GetUpdateChain(ro, scID)
+			if err != nil {
+				node.Error = err.Error()
+				return
+			}
+			if len(reply.Update) == 0 {
+				node.Error = "no block found in chain update"
+				return
+			}
+
+			node.LatestIndex = reply.Update[len(reply.Update)-1].Index
+		}(&nodes[i])
+	}
+	wg.Wait()
+
+	for i := range nodes {
+		if nodes[i].Error == "" {
+			nodes[i].Lag = latest.Index - nodes[i].LatestIndex
+		}
+	}
+
+	return nodes
+}
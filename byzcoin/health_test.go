@@ -0,0 +1,54 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_GetChainHealth(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	s.waitPropagation(t, 1)
+
+	resp, err := s.service().GetChainHealth(&GetChainHealth{
+		ByzCoinID: s.genesis.SkipChainID(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.LatestIndex)
+	require.Equal(t, 1, resp.TrieIndex)
+	require.Equal(t, testInterval, resp.BlockInterval)
+	require.Equal(t, 2, resp.WindowBlocks)
+	require.Equal(t, 2, resp.AcceptedTxs)
+	require.Equal(t, 0, resp.RefusedTxs)
+	require.Equal(t, 0.0, resp.RefusedRate)
+	require.Equal(t, 0, resp.PendingTxs)
+	require.False(t, resp.CatchingUp)
+	require.True(t, resp.ObservedInterval > 0)
+
+	require.Equal(t, len(s.roster.List), len(resp.Nodes))
+	for _, node := range resp.Nodes {
+		require.Empty(t, node.Error)
+		require.Equal(t, 1, node.LatestIndex)
+		require.Equal(t, 0, node.Lag)
+	}
+
+	// The window can be limited to the latest block only.
+	resp, err = s.service().GetChainHealth(&GetChainHealth{
+		ByzCoinID: s.genesis.SkipChainID(),
+		Blocks:    1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.WindowBlocks)
+	require.Equal(t, 1, resp.AcceptedTxs)
+	require.Equal(t, int64(0), int64(resp.ObservedInterval))
+
+	_, err = s.service().GetChainHealth(&GetChainHealth{
+		ByzCoinID: []byte{1, 2, 3},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,229 @@
+package byzcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// The JSON encoding of the messages uses the names of the fields of the Go
+// structures. The identifiers of instances and darcs, and the hashes, are
+// written in hexadecimal, the darc identities as parsed by
+// darc.ParseIdentity, and the other byte slices in base64. The skipblock and
+// the forward links of a Proof are kept in their protobuf encoding, as their
+// hashes and signatures are computed on it.
+
+// jsonPathSuffix is appended to the path of an endpoint to send the request
+// and to receive the reply in JSON instead of protobuf, e.g.
+// "/ByzCoin/GetProof.json".
+const jsonPathSuffix = ".json"
+
+// MarshalText implements encoding.TextMarshaler, so that the ID is written in
+// hexadecimal in JSON.
+func (iID InstanceID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(iID[:])), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (iID *InstanceID) UnmarshalText(text []byte) error {
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return xerrors.Errorf("decoding instance ID: %v", err)
+	}
+	if len(buf) != len(iID) {
+		return xerrors.Errorf("instance ID of length %d instead of %d",
+			len(buf), len(iID))
+	}
+	copy(iID[:], buf)
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the action is
+// written as its name in JSON.
+func (sc StateAction) MarshalText() ([]byte, error) {
+	switch sc {
+	case Create, Update, Remove:
+		return []byte(sc.String()), nil
+	}
+	return nil, xerrors.Errorf("invalid state action %d", sc)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (sc *StateAction) UnmarshalText(text []byte) error {
+	for _, action := range []StateAction{Create, Update, Remove} {
+		if string(text) == action.String() {
+			*sc = action
+			return nil
+		}
+	}
+	return xerrors.Errorf("invalid state action '%s'", text)
+}
+
+type jsonStateChange struct {
+	StateAction StateAction
+	InstanceID  string
+	ContractID  string
+	Value       []byte
+	DarcID      darc.ID
+	Version     uint64
+}
+
+// MarshalJSON implements json.Marshaler, the instance ID is written in
+// hexadecimal.
+func (sc StateChange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonStateChange{
+		StateAction: sc.StateAction,
+		InstanceID:  hex.EncodeToString(sc.InstanceID),
+		ContractID:  sc.ContractID,
+		Value:       sc.Value,
+		DarcID:      sc.DarcID,
+		Version:     sc.Version,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (sc *StateChange) UnmarshalJSON(buf []byte) error {
+	var jsc jsonStateChange
+	err := json.Unmarshal(buf, &jsc)
+	if err != nil {
+		return xerrors.Errorf("decoding state change: %v", err)
+	}
+	iid, err := hex.DecodeString(jsc.InstanceID)
+	if err != nil {
+		return xerrors.Errorf("decoding instance ID: %v", err)
+	}
+	*sc = StateChange{
+		StateAction: jsc.StateAction,
+		InstanceID:  iid,
+		ContractID:  jsc.ContractID,
+		Value:       jsc.Value,
+		DarcID:      jsc.DarcID,
+		Version:     jsc.Version,
+	}
+	return nil
+}
+
+type jsonProof struct {
+	InclusionProof json.RawMessage
+	Latest         []byte
+	Links          [][]byte
+}
+
+// MarshalJSON implements json.Marshaler. The inclusion proof is written in
+// JSON, the latest skipblock and the forward links in protobuf.
+func (p Proof) MarshalJSON() ([]byte, error) {
+	ip, err := json.Marshal(p.InclusionProof)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding inclusion proof: %v", err)
+	}
+	jp := jsonProof{InclusionProof: ip, Links: make([][]byte, len(p.Links))}
+	if p.Latest.SkipBlockFix != nil {
+		jp.Latest, err = protobuf.Encode(&p.Latest)
+		if err != nil {
+			return nil, xerrors.Errorf("encoding skipblock: %v", err)
+		}
+	}
+	for i := range p.Links {
+		jp.Links[i], err = protobuf.Encode(&p.Links[i])
+		if err != nil {
+			return nil, xerrors.Errorf("encoding forward link: %v", err)
+		}
+	}
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Proof) UnmarshalJSON(buf []byte) error {
+	var jp jsonProof
+	err := json.Unmarshal(buf, &jp)
+	if err != nil {
+		return xerrors.Errorf("decoding proof: %v", err)
+	}
+	*p = Proof{}
+	if len(jp.InclusionProof) > 0 {
+		err = json.Unmarshal(jp.InclusionProof, &p.InclusionProof)
+		if err != nil {
+			return xerrors.Errorf("decoding inclusion proof: %v", err)
+		}
+	}
+	constructors := network.DefaultConstructors(cothority.Suite)
+	if len(jp.Latest) > 0 {
+		err = protobuf.DecodeWithConstructors(jp.Latest, &p.Latest, constructors)
+		if err != nil {
+			return xerrors.Errorf("decoding skipblock: %v", err)
+		}
+	}
+	if len(jp.Links) > 0 {
+		p.Links = make([]skipchain.ForwardLink, len(jp.Links))
+		for i, link := range jp.Links {
+			err = protobuf.DecodeWithConstructors(link, &p.Links[i], constructors)
+			if err != nil {
+				return xerrors.Errorf("decoding forward link: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonHandler is an endpoint of the service that can be called in JSON.
+type jsonHandler struct {
+	request reflect.Type
+	handler reflect.Value
+}
+
+// registerJSONHandlers makes the handlers available in JSON, under the path of
+// their request followed by jsonPathSuffix. The handlers are the same as the
+// ones given to RegisterHandlers, taking a pointer to the request and
+// returning the reply and an error.
+func (s *Service) registerJSONHandlers(handlers ...interface{}) error {
+	s.jsonHandlers = make(map[string]jsonHandler)
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	for _, h := range handlers {
+		v := reflect.ValueOf(h)
+		t := v.Type()
+		if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 2 ||
+			t.In(0).Kind() != reflect.Ptr || t.Out(1) != errType {
+			return xerrors.Errorf("invalid JSON handler %v", t)
+		}
+		req := t.In(0).Elem()
+		s.jsonHandlers[req.Name()] = jsonHandler{request: req, handler: v}
+	}
+	return nil
+}
+
+// processJSONRequest decodes the JSON request, calls the handler of the path
+// and returns the JSON reply.
+func (s *Service) processJSONRequest(path string, buf []byte) ([]byte, error) {
+	name := strings.TrimSuffix(path, jsonPathSuffix)
+	h, ok := s.jsonHandlers[name]
+	if !ok {
+		return nil, xerrors.Errorf("no JSON endpoint for %s", name)
+	}
+
+	req := reflect.New(h.request)
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(req.Interface())
+	if err != nil {
+		return nil, xerrors.Errorf("decoding %s: %v", name, err)
+	}
+
+	out := h.handler.Call([]reflect.Value{req})
+	if err, _ := out[1].Interface().(error); err != nil {
+		return nil, err
+	}
+	reply, err := json.Marshal(out[0].Interface())
+	if err != nil {
+		return nil, xerrors.Errorf("encoding reply: %v", err)
+	}
+	return reply, nil
+}
@@ -0,0 +1,130 @@
+package byzcoin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestClientTransaction_JSON(t *testing.T) {
+	signer := darc.NewSignerEd25519(nil, nil)
+	dID := darc.ID(genID().Slice())
+	spawn := createSpawnInstr(dID, "value", "value", []byte("a value"))
+	spawn.SignerCounter = []uint64{1}
+	invoke := createInvokeInstr(genID(), "value", "update", "value", []byte("b"))
+	invoke.SignerCounter = []uint64{2}
+	del := Instruction{
+		InstanceID:    genID(),
+		Delete:        &Delete{ContractID: "value"},
+		SignerCounter: []uint64{3},
+	}
+	tx, err := combineInstrsAndSign(signer, spawn, invoke, del)
+	require.NoError(t, err)
+
+	buf, err := json.Marshal(tx)
+	require.NoError(t, err)
+	require.Contains(t, string(buf), `"InstanceID":"`+spawn.InstanceID.String()+`"`)
+	require.Contains(t, string(buf), `"`+signer.Identity().String()+`"`)
+
+	var decoded ClientTransaction
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	decoded.Instructions.SetVersion(CurrentVersion)
+	require.Equal(t, tx.Instructions.Hash(), decoded.Instructions.Hash())
+	for _, instr := range decoded.Instructions {
+		require.NoError(t, instr.SignerIdentities[0].Verify(
+			decoded.Instructions.Hash(), instr.Signatures[0]))
+	}
+
+	// The encoding is canonical.
+	buf2, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	require.Equal(t, buf, buf2)
+
+	var arg Argument
+	require.NoError(t, json.Unmarshal([]byte(`{"Name":"value","Value":"YQ=="}`), &arg))
+	require.Equal(t, Argument{Name: "value", Value: []byte("a")}, arg)
+
+	var iid InstanceID
+	require.Error(t, json.Unmarshal([]byte(`"0102"`), &iid))
+}
+
+func TestStateChange_JSON(t *testing.T) {
+	sc := NewStateChange(Update, genID(), "value", []byte("a value"),
+		darc.ID(genID().Slice()))
+	sc.Version = 3
+
+	buf, err := json.Marshal(sc)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf, &fields))
+	require.Equal(t, "Update", fields["StateAction"])
+	require.Equal(t, NewInstanceID(sc.InstanceID).String(), fields["InstanceID"])
+
+	var decoded StateChange
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	require.Equal(t, sc, decoded)
+
+	require.Error(t, json.Unmarshal([]byte(`{"StateAction":"Unknown"}`), &decoded))
+	_, err = json.Marshal(StateChange{})
+	require.Error(t, err)
+}
+
+func TestService_JSON(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	in := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte("json"))
+	in.SignerCounter = []uint64{1}
+	tx, err := combineInstrsAndSign(s.signer, in)
+	require.NoError(t, err)
+
+	// The transaction is sent in JSON.
+	buf, err := json.Marshal(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.genesis.SkipChainID(),
+		Transaction:   tx,
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	reply, stream, err := s.service().ProcessClientRequest(&http.Request{},
+		"AddTxRequest"+jsonPathSuffix, buf)
+	require.NoError(t, err)
+	require.Nil(t, stream)
+	var txResp AddTxResponse
+	require.NoError(t, json.Unmarshal(reply, &txResp))
+	require.Empty(t, txResp.Error)
+
+	// The proof received in JSON is the same as the one in protobuf.
+	key := tx.Instructions[0].DeriveID("").Slice()
+	req := &GetProof{Version: CurrentVersion, Key: key, ID: s.genesis.SkipChainID()}
+	buf, err = json.Marshal(req)
+	require.NoError(t, err)
+	reply, _, err = s.service().ProcessClientRequest(&http.Request{},
+		"GetProof"+jsonPathSuffix, buf)
+	require.NoError(t, err)
+	var proofResp GetProofResponse
+	require.NoError(t, json.Unmarshal(reply, &proofResp))
+	require.NoError(t, proofResp.Proof.Verify(s.genesis.SkipChainID()))
+	value, _, _, err := proofResp.Proof.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, []byte("json"), value)
+
+	expected, err := s.service().GetProof(req)
+	require.NoError(t, err)
+	require.Equal(t, expected.Proof.Latest.Hash, proofResp.Proof.Latest.Hash)
+	require.Equal(t, expected.Proof.InclusionProof.GetRoot(),
+		proofResp.Proof.InclusionProof.GetRoot())
+	require.Equal(t, len(expected.Proof.Links), len(proofResp.Proof.Links))
+
+	// Only the registered endpoints are available in JSON, and unknown
+	// fields are refused.
+	_, _, err = s.service().ProcessClientRequest(&http.Request{},
+		"Debug"+jsonPathSuffix, []byte("{}"))
+	require.Error(t, err)
+	_, _, err = s.service().ProcessClientRequest(&http.Request{},
+		"GetProof"+jsonPathSuffix, []byte(`{"Unknown":1}`))
+	require.Error(t, err)
+}
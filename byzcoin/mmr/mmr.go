@@ -0,0 +1,160 @@
+// Package mmr implements an append-only Merkle Mountain Range.
+//
+// A range of n leaves is made of perfect binary trees, one for each bit set in
+// n, from the highest to the lowest. The roots of these trees are the peaks
+// of the range and its root is the hash of the peaks. Appending a leaf only
+// needs the peaks, and the nodes never change once they have been created, so
+// that they can be stored anywhere and be used later to prove that a leaf is
+// in the range.
+//
+// A node is identified by its height, 0 for the leaves, and its index among
+// the nodes of the same height.
+package mmr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/bits"
+
+	"golang.org/x/xerrors"
+)
+
+// The prefixes prevent a leaf from being taken for an inner node.
+const (
+	leafPrefix   = 0
+	parentPrefix = 1
+)
+
+// NodeID identifies a node of the range.
+type NodeID struct {
+	Height uint32
+	Index  uint64
+}
+
+// Node is a node created by an append.
+type Node struct {
+	NodeID
+	Hash []byte
+}
+
+// LeafHash returns the hash of the leaf holding the data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// ParentHash returns the hash of the node having the given children.
+func ParentHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{parentPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Root returns the root of the range having the given peaks, or nil if the
+// range is empty. The peaks are folded from the right to the left.
+func Root(peaks [][]byte) []byte {
+	if len(peaks) == 0 {
+		return nil
+	}
+	root := peaks[len(peaks)-1]
+	for i := len(peaks) - 2; i >= 0; i-- {
+		root = ParentHash(peaks[i], root)
+	}
+	return root
+}
+
+// Peaks returns the IDs of the peaks of a range of the given size.
+func Peaks(size uint64) []NodeID {
+	var ids []NodeID
+	var start uint64
+	for h := 63; h >= 0; h-- {
+		if size&(1<<uint(h)) == 0 {
+			continue
+		}
+		ids = append(ids, NodeID{Height: uint32(h), Index: start >> uint(h)})
+		start += 1 << uint(h)
+	}
+	return ids
+}
+
+// Append adds the data as a new leaf to the range of the given size and
+// peaks. It returns the new peaks and the created nodes: the leaf first, then
+// its parents.
+func Append(size uint64, peaks [][]byte, data []byte) ([][]byte, []Node, error) {
+	if len(peaks) != bits.OnesCount64(size) {
+		return nil, nil, xerrors.Errorf("%d peaks for a range of %d leaves", len(peaks), size)
+	}
+	if size == ^uint64(0) {
+		return nil, nil, xerrors.New("range is full")
+	}
+
+	newPeaks := append([][]byte{}, peaks...)
+	node := Node{NodeID: NodeID{Index: size}, Hash: LeafHash(data)}
+	nodes := []Node{node}
+	// Every trailing bit set in the size is a peak of the same height as the
+	// new node, which merges with it.
+	for n := size; n&1 == 1; n >>= 1 {
+		left := newPeaks[len(newPeaks)-1]
+		newPeaks = newPeaks[:len(newPeaks)-1]
+		node = Node{
+			NodeID: NodeID{Height: node.Height + 1, Index: node.Index >> 1},
+			Hash:   ParentHash(left, node.Hash),
+		}
+		nodes = append(nodes, node)
+	}
+	return append(newPeaks, node.Hash), nodes, nil
+}
+
+// Path returns the IDs of the siblings of the leaf, from the leaf up to its
+// peak, and the position of the peak in the peaks of the range.
+func Path(index, size uint64) ([]NodeID, int, error) {
+	if index >= size {
+		return nil, 0, xerrors.Errorf("leaf %d is not in a range of %d leaves", index, size)
+	}
+
+	for pos, peak := range Peaks(size) {
+		start := peak.Index << peak.Height
+		if index-start >= 1<<peak.Height {
+			continue
+		}
+		siblings := make([]NodeID, peak.Height)
+		for h := range siblings {
+			siblings[h] = NodeID{Height: uint32(h), Index: (index >> uint(h)) ^ 1}
+		}
+		return siblings, pos, nil
+	}
+	return nil, 0, xerrors.New("no peak found")
+}
+
+// Verify checks that the data is the leaf at the index of the range of the
+// given size and peaks. The siblings are the hashes of the nodes returned by
+// Path. The caller must check the peaks against the root of the range.
+func Verify(data []byte, index, size uint64, siblings, peaks [][]byte) error {
+	ids, pos, err := Path(index, size)
+	if err != nil {
+		return xerrors.Errorf("getting path: %v", err)
+	}
+	if len(siblings) != len(ids) {
+		return xerrors.Errorf("got %d siblings instead of %d", len(siblings), len(ids))
+	}
+	if len(peaks) != bits.OnesCount64(size) {
+		return xerrors.Errorf("%d peaks for a range of %d leaves", len(peaks), size)
+	}
+
+	hash := LeafHash(data)
+	for h, sibling := range siblings {
+		if (index>>uint(h))&1 == 0 {
+			hash = ParentHash(hash, sibling)
+		} else {
+			hash = ParentHash(sibling, hash)
+		}
+	}
+	if !bytes.Equal(hash, peaks[pos]) {
+		return xerrors.New("leaf doesn't match its peak")
+	}
+	return nil
+}
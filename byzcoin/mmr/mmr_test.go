@@ -0,0 +1,83 @@
+package mmr
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildRange appends n leaves and returns the peaks and all the nodes.
+func buildRange(t *testing.T, n uint64) ([][]byte, map[NodeID][]byte) {
+	var peaks [][]byte
+	nodes := make(map[NodeID][]byte)
+	for i := uint64(0); i < n; i++ {
+		var created []Node
+		var err error
+		peaks, created, err = Append(i, peaks, []byte(fmt.Sprintf("leaf %d", i)))
+		require.NoError(t, err)
+		require.Equal(t, NodeID{Index: i}, created[0].NodeID)
+		for _, node := range created {
+			_, ok := nodes[node.NodeID]
+			require.False(t, ok)
+			nodes[node.NodeID] = node.Hash
+		}
+	}
+	return peaks, nodes
+}
+
+func TestPeaks(t *testing.T) {
+	require.Empty(t, Peaks(0))
+	require.Equal(t, []NodeID{{Height: 0, Index: 0}}, Peaks(1))
+	require.Equal(t, []NodeID{{Height: 1, Index: 0}}, Peaks(2))
+	require.Equal(t, []NodeID{{Height: 2, Index: 0}, {Height: 1, Index: 2},
+		{Height: 0, Index: 6}}, Peaks(7))
+}
+
+func TestAppend(t *testing.T) {
+	_, _, err := Append(1, nil, []byte("a"))
+	require.Error(t, err)
+
+	for n := uint64(0); n < 20; n++ {
+		peaks, nodes := buildRange(t, n)
+		ids := Peaks(n)
+		require.Equal(t, len(ids), len(peaks))
+		for i, id := range ids {
+			require.Equal(t, nodes[id], peaks[i])
+		}
+	}
+
+	peaks, _ := buildRange(t, 3)
+	root := ParentHash(ParentHash(LeafHash([]byte("leaf 0")), LeafHash([]byte("leaf 1"))),
+		LeafHash([]byte("leaf 2")))
+	require.Equal(t, root, Root(peaks))
+	require.Nil(t, Root(nil))
+}
+
+func TestVerify(t *testing.T) {
+	_, _, err := Path(3, 3)
+	require.Error(t, err)
+
+	for n := uint64(1); n < 20; n++ {
+		peaks, nodes := buildRange(t, n)
+		for i := uint64(0); i < n; i++ {
+			ids, _, err := Path(i, n)
+			require.NoError(t, err)
+			siblings := make([][]byte, len(ids))
+			for j, id := range ids {
+				siblings[j] = nodes[id]
+				require.NotNil(t, siblings[j])
+			}
+
+			data := []byte(fmt.Sprintf("leaf %d", i))
+			require.NoError(t, Verify(data, i, n, siblings, peaks))
+			require.Error(t, Verify([]byte("other"), i, n, siblings, peaks))
+			if n > 1 {
+				require.Error(t, Verify(data, (i+1)%n, n, siblings, peaks))
+			}
+		}
+	}
+
+	peaks, _ := buildRange(t, 2)
+	require.Error(t, Verify([]byte("leaf 0"), 0, 2, nil, peaks))
+}
@@ -24,42 +24,55 @@ func NewProof(c ReadOnlyStateTrie, s *skipchain.SkipBlockDB, id skipchain.SkipBl
 		return nil, xerrors.Errorf("couldn't get proof: %+v", err)
 	}
 	p.InclusionProof = *pr
+	links, sb, err := proofLinks(s, id, c.GetIndex())
+	if err != nil {
+		return nil, xerrors.Errorf("getting links: %v", err)
+	}
+	if c.GetIndex() != sb.Index {
+		return nil, xerrors.New("didn't find skipblock with same index as state-trie")
+	}
+	p.Links = links
+	p.Latest = *sb
+	return
+}
+
+// proofLinks returns the forward links going from the block with the given id
+// to the block at the given index, and that block. The first link is the
+// synthetic one holding the roster of the first block.
+func proofLinks(s *skipchain.SkipBlockDB, id skipchain.SkipBlockID,
+	index int) ([]skipchain.ForwardLink, *skipchain.SkipBlock, error) {
 	sb := s.GetByID(id)
 	if sb == nil {
-		return nil, xerrors.New("didn't find skipchain")
+		return nil, nil, xerrors.New("didn't find skipchain")
 	}
-	p.Links = []skipchain.ForwardLink{{
+	links := []skipchain.ForwardLink{{
 		From:      []byte{},
 		To:        id,
 		NewRoster: sb.Roster,
 	}}
-	for len(sb.ForwardLink) > 0 && sb.Index < c.GetIndex() {
+	for len(sb.ForwardLink) > 0 && sb.Index < index {
 		var link *skipchain.ForwardLink
 		// Corner-case when the database is downloading blocks and a proof is
 		// requested before all blocks are stored - then we need to make sure that
 		// we don't get the latest block, but the block corresponding to the
-		// StateTrie.Index
+		// requested index
 		for height := len(sb.ForwardLink) - 1; height >= 0; height-- {
 			link = sb.ForwardLink[height]
 			sbTemp := s.GetByID(link.To)
 			if sbTemp == nil {
-				return nil, xerrors.New("missing block in chain")
+				return nil, nil, xerrors.New("missing block in chain")
 			}
 			if sbTemp.Index <= sb.Index {
-				return nil, cothority.ErrorOrNil(skipchain.ErrorInconsistentForwardLink, "")
+				return nil, nil, cothority.ErrorOrNil(skipchain.ErrorInconsistentForwardLink, "")
 			}
-			if sbTemp.Index <= c.GetIndex() {
+			if sbTemp.Index <= index {
 				sb = sbTemp
 				break
 			}
 		}
-		p.Links = append(p.Links, *link)
-	}
-	if c.GetIndex() != sb.Index {
-		return nil, xerrors.New("didn't find skipblock with same index as state-trie")
+		links = append(links, *link)
 	}
-	p.Latest = *sb
-	return
+	return links, sb, nil
 }
 
 // ErrorVerifyTrie is returned if the proof itself is not properly set up.
@@ -118,19 +131,26 @@ func (p Proof) Verify(sbID skipchain.SkipBlockID) error {
 		return cothority.WrapError(err)
 	}
 
-	if len(p.Links) == 0 {
+	return verifyLinks(p.Links, sbID, &p.Latest)
+}
+
+// verifyLinks verifies that the links go from the block with the given ID to
+// the latest block. The roster of the first link must have been verified by
+// the caller.
+func verifyLinks(links []skipchain.ForwardLink, sbID skipchain.SkipBlockID, latest *skipchain.SkipBlock) error {
+	if len(links) == 0 {
 		return cothority.WrapError(ErrorMissingForwardLinks)
 	}
-	if p.Links[0].NewRoster == nil {
+	if links[0].NewRoster == nil {
 		return cothority.WrapError(ErrorMalformedForwardLink)
 	}
 
 	// Get the first from the synthetic link which is assumed to be verified
 	// before against the block with ID stored in the To field by the caller.
-	publics := p.Links[0].NewRoster.ServicePublics(skipchain.ServiceName)
+	publics := links[0].NewRoster.ServicePublics(skipchain.ServiceName)
 
-	for _, l := range p.Links[1:] {
-		if err = l.VerifyWithScheme(pairing.NewSuiteBn256(), publics, p.Latest.SignatureScheme); err != nil {
+	for _, l := range links[1:] {
+		if err := l.VerifyWithScheme(pairing.NewSuiteBn256(), publics, latest.SignatureScheme); err != nil {
 			return cothority.WrapError(ErrorVerifySkipchain)
 		}
 		if !l.From.Equal(sbID) {
@@ -143,7 +163,7 @@ func (p Proof) Verify(sbID skipchain.SkipBlockID) error {
 	}
 
 	// Check that the given latest block matches the last forward link target
-	if !p.Latest.CalculateHash().Equal(sbID) {
+	if !latest.CalculateHash().Equal(sbID) {
 		return cothority.WrapError(ErrorVerifyHash)
 	}
 
@@ -228,3 +248,73 @@ func (p Proof) VerifyAndDecode(suite network.Suite, cid string, value interface{
 	err = protobuf.DecodeWithConstructors(buf, value, network.DefaultConstructors(suite))
 	return cothority.ErrorOrNil(err, "decoding")
 }
+
+// ErrorKeyPresent is returned when a proof of absence contains the key.
+var ErrorKeyPresent = xerrors.New("key is present in the trie")
+
+// VerifyAbsence checks that the key is absent from the global state of the
+// latest block of the proof. Like KeyValue, it does not verify the proof
+// itself, which must be done by the caller with Verify or VerifyFromBlock.
+func (p Proof) VerifyAbsence(key []byte) error {
+	ok, err := p.InclusionProof.Exists(key)
+	if err != nil {
+		return xerrors.Errorf("invalid proof: %v", err)
+	}
+	if ok {
+		return cothority.WrapError(ErrorKeyPresent)
+	}
+	return nil
+}
+
+// Verify checks that the deletion proof is valid for the skipchain with the
+// given ID: the links go from that block to the block of the removal, the
+// state changes of that block match its header and remove the instance, and
+// the instance is absent from the global state of a later block. As for
+// Proof.Verify, the roster of the first links must be verified by the caller,
+// see VerifyFromBlock.
+func (dp DeletionProof) Verify(sbID skipchain.SkipBlockID, id InstanceID) error {
+	err := verifyLinks(dp.Links, sbID, &dp.Block)
+	if err != nil {
+		return xerrors.Errorf("verifying block: %v", err)
+	}
+
+	var header DataHeader
+	err = protobuf.Decode(dp.Block.Data, &header)
+	if err != nil {
+		return xerrors.Errorf("decoding header: %v", err)
+	}
+	if !bytes.Equal(StateChanges(dp.StateChanges).Hash(), header.StateChangesHash) {
+		return xerrors.New("state changes don't match the block")
+	}
+	removed := false
+	for _, sc := range dp.StateChanges {
+		if bytes.Equal(sc.InstanceID, id.Slice()) {
+			removed = sc.StateAction == Remove
+		}
+	}
+	if !removed {
+		return xerrors.New("instance is not removed by the block")
+	}
+
+	err = dp.Absence.Verify(sbID)
+	if err != nil {
+		return xerrors.Errorf("verifying absence: %v", err)
+	}
+	if dp.Absence.Latest.Index < dp.Block.Index {
+		return xerrors.New("absence proof is older than the removal")
+	}
+	return cothority.ErrorOrNil(dp.Absence.VerifyAbsence(id.Slice()), "verifying absence")
+}
+
+// VerifyFromBlock verifies the deletion proof like Verify, taking the roster
+// of the first links from the given block, which must have been verified
+// before.
+func (dp DeletionProof) VerifyFromBlock(verifiedBlock *skipchain.SkipBlock, id InstanceID) error {
+	if len(dp.Links) > 0 {
+		dp.Links[0].NewRoster = verifiedBlock.Roster
+	}
+	if len(dp.Absence.Links) > 0 {
+		dp.Absence.Links[0].NewRoster = verifiedBlock.Roster
+	}
+	return cothority.ErrorOrNil(dp.Verify(verifiedBlock.Hash, id), "verification failed")
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
 	"go.dedis.ch/cothority/v3/byzcoinx"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/kyber/v3"
@@ -95,7 +96,7 @@ func createSC(t *testing.T) (s sc) {
 		return err
 	})
 	require.Nil(t, err)
-	s.c, err = newStateTrie(db, bucketName, []byte("nonce string"))
+	s.c, err = newStateTrie(trie.NewDiskDB(db, bucketName), []byte("nonce string"))
 	require.NoError(t, err)
 
 	s.key = []byte("key")
@@ -162,3 +163,33 @@ func genRoster(num int) (*onet.Roster, []kyber.Scalar) {
 	}
 	return onet.NewRoster(ids), privs
 }
+
+func TestProof_VerifyAbsence(t *testing.T) {
+	s := createSC(t)
+	p, err := NewProof(s.c, s.s, s.genesis.Hash, []byte{1})
+	require.NoError(t, err)
+	require.NoError(t, p.Verify(s.genesis.SkipChainID()))
+	require.NoError(t, p.VerifyAbsence([]byte{1}))
+
+	p, err = NewProof(s.c, s.s, s.genesis.Hash, s.key)
+	require.NoError(t, err)
+	require.True(t, xerrors.Is(p.VerifyAbsence(s.key), ErrorKeyPresent))
+}
+
+func TestProofLinks(t *testing.T) {
+	s := createSC(t)
+	links, sb, err := proofLinks(s.s, s.genesis.Hash, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(links))
+	require.Equal(t, s.genesis.Hash, sb.Hash)
+
+	links, sb, err = proofLinks(s.s, s.genesis.Hash, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(links))
+	require.Equal(t, s.sb2.Hash, sb.Hash)
+	require.NoError(t, verifyLinks(links, s.genesis.Hash, sb))
+	require.True(t, xerrors.Is(verifyLinks(links, s.genesis.Hash, s.genesis), ErrorVerifyHash))
+
+	_, _, err = proofLinks(s.s, getSBID("unknown"), 1)
+	require.Error(t, err)
+}
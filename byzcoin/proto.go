@@ -7,6 +7,7 @@ import (
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
 )
 
 // PROTOSTART
@@ -23,6 +24,7 @@ import (
 // import "onet.proto";
 // import "darc.proto";
 // import "trie.proto";
+// import "network.proto";
 //
 // option java_package = "ch.epfl.dedis.lib.proto";
 // option java_outer_classname = "ByzCoinProto";
@@ -166,6 +168,17 @@ type ChainConfig struct {
 	Roster          onet.Roster
 	MaxBlockSize    int
 	DarcContractIDs []string
+	// ContractVersions lists the upgrades of contracts that have been
+	// accepted by the chain, in the order they were accepted.
+	ContractVersions []ContractVersion `protobuf:"opt"`
+}
+
+// ContractVersion is a version of a contract that is used by the chain from
+// the block with the given index.
+type ContractVersion struct {
+	ContractID string
+	Version    int
+	Index      int
 }
 
 // Proof represents everything necessary to verify a given
@@ -465,6 +478,380 @@ type ResolvedInstanceID struct {
 	InstanceID InstanceID
 }
 
+// NamedInstance is a name given to an instance with the naming contract.
+type NamedInstance struct {
+	DarcID     darc.ID
+	Name       string
+	InstanceID InstanceID
+}
+
+// ListNames is the request for the names given under a darc. Only the names
+// that are equal to the prefix or below it in the hierarchy are returned, or
+// all of them if the prefix is empty.
+type ListNames struct {
+	SkipChainID skipchain.SkipBlockID
+	DarcID      darc.ID
+	Prefix      string `protobuf:"opt"`
+}
+
+// ListNamesResponse contains the names sorted in alphabetical order.
+type ListNamesResponse struct {
+	Names []NamedInstance
+}
+
+// ResolveNames is the request for the names given to an instance.
+type ResolveNames struct {
+	SkipChainID skipchain.SkipBlockID
+	InstanceID  InstanceID
+}
+
+// ResolvedNames contains the names of the instance, sorted by darc and name.
+type ResolvedNames struct {
+	Names []NamedInstance
+}
+
+// GetLogEntry is the request for an entry of a log instance.
+type GetLogEntry struct {
+	SkipChainID skipchain.SkipBlockID
+	LogID       InstanceID
+	Index       uint64
+}
+
+// GetLogEntryResponse contains the entry and the hashes proving its
+// inclusion in the Merkle Mountain Range of the log, whose root is in the
+// instance of the proof.
+type GetLogEntryResponse struct {
+	Entry    []byte
+	Siblings [][]byte
+	Proof    Proof
+}
+
+// GetAbsenceProof is the request for the proof of the absence of a key from
+// the global state of a block. The response is a GetProofResponse.
+type GetAbsenceProof struct {
+	// ID is the block where the proof starts, usually the genesis block.
+	ID  skipchain.SkipBlockID
+	Key []byte
+	// Index is the index of the block of the global state.
+	Index int
+}
+
+// GetDeletionProof is the request for the proof that an instance has been
+// removed and is still absent from the global state.
+type GetDeletionProof struct {
+	// ID is the block where the proof starts, usually the genesis block.
+	ID         skipchain.SkipBlockID
+	InstanceID InstanceID
+}
+
+// GetDeletionProofResponse contains the proof of the latest removal of the
+// instance.
+type GetDeletionProofResponse struct {
+	Proof DeletionProof
+}
+
+// DeletionProof proves that an instance has been removed in a block, and
+// that it is absent from the global state of a later block.
+type DeletionProof struct {
+	// Links go from the first block to the block of the removal, the first
+	// one being synthetic as in Proof.
+	Links []skipchain.ForwardLink
+	// Block is the block where the instance has been removed.
+	Block skipchain.SkipBlock
+	// StateChanges are all the state changes of the block, whose hash is
+	// stored in its header.
+	StateChanges []StateChange
+	// Absence proves that the instance is absent from the global state of
+	// its latest block.
+	Absence Proof
+}
+
+// GetStateDiff is the request for the instances which differ between the
+// global states of two blocks of a chain.
+type GetStateDiff struct {
+	// ID is a block of the chain, usually the genesis block.
+	ID skipchain.SkipBlockID
+	// From is the index of the block of the older state.
+	From int
+	// To is the index of the block of the newer state.
+	To int
+	// Timestamp is the time of the request in nanoseconds, the requests
+	// older than a few minutes are refused.
+	Timestamp int64
+	// Signature is the schnorr signature of the hash of the request by a
+	// member of the roster of the latest block.
+	Signature []byte
+}
+
+// GetStateDiffResponse contains the instances which differ between the two
+// states.
+type GetStateDiffResponse struct {
+	Diffs []StateDiff
+}
+
+// StateDiff is an instance which differs between two states.
+type StateDiff struct {
+	InstanceID InstanceID
+	// Old is the instance in the older state, nil if it has been created.
+	Old *StateChangeBody `protobuf:"opt"`
+	// New is the instance in the newer state, nil if it has been removed.
+	New *StateChangeBody `protobuf:"opt"`
+}
+
+// GetTrieState is the request for the global state of the node receiving it
+// at a block, which is rebuilt from the history of the state changes.
+type GetTrieState struct {
+	// ID is a block of the chain, usually the genesis block.
+	ID skipchain.SkipBlockID
+	// Index is the index of the block.
+	Index int
+	// Keys are the instances whose values are returned.
+	Keys []InstanceID `protobuf:"opt"`
+	// Timestamp is the time of the request in nanoseconds, the requests
+	// older than a few minutes are refused.
+	Timestamp int64
+	// Signature is the schnorr signature of the hash of the request by a
+	// member of the roster of the latest block.
+	Signature []byte
+}
+
+// GetTrieStateResponse contains the global state of the node at the block.
+type GetTrieStateResponse struct {
+	// TrieIndex is the index of the latest block of the global state.
+	TrieIndex int
+	// Root is the root of the global state at the block.
+	Root []byte
+	// Values are the values of the keys of the request in the global state,
+	// empty if the instance doesn't exist.
+	Values [][]byte
+	// ChangedKeys are the instances changed by the block, as stored by the
+	// node.
+	ChangedKeys []InstanceID
+}
+
+// VerifyRosterConsistency is the request for the comparison of the global
+// states of the members of the roster.
+type VerifyRosterConsistency struct {
+	// ID is a block of the chain, usually the genesis block.
+	ID skipchain.SkipBlockID
+	// Index is the index of the block whose global state is compared. If
+	// it is negative, the latest block is used.
+	Index int
+	// Timestamp is the time of the request in nanoseconds, the requests
+	// older than a few minutes are refused.
+	Timestamp int64
+	// Signature is the schnorr signature of the hash of the request by the
+	// private key of the node receiving it.
+	Signature []byte
+}
+
+// VerifyRosterConsistencyResponse holds the global state of each member of
+// the roster of the block.
+type VerifyRosterConsistencyResponse struct {
+	// Index is the index of the block.
+	Index int
+	// TrieRoot is the root of the global state stored in the block.
+	TrieRoot []byte
+	Nodes    []RosterConsistencyNode
+}
+
+// RosterConsistencyNode is the global state of a member of the roster.
+type RosterConsistencyNode struct {
+	ServerIdentity *network.ServerIdentity
+	// Root is the root of the global state of the node at the block.
+	Root []byte
+	// Consistent is true if the root is the one of the block.
+	Consistent bool
+	// FirstDivergence is the index of the first block where the global state
+	// of the node is different than the one of the block, if it is not
+	// consistent.
+	FirstDivergence int
+	// DivergentInstances are the instances changed by the first divergent
+	// block whose values are different on the node.
+	DivergentInstances []InstanceID
+	// Error is set if the node couldn't be verified.
+	Error string `protobuf:"opt"`
+}
+
+// GetChainHealth is a request for the health metrics of a chain, as seen by
+// the node receiving the request.
+type GetChainHealth struct {
+	ByzCoinID skipchain.SkipBlockID
+	// Blocks is the number of latest blocks used to compute the statistics. If
+	// it is 0, a default window is used.
+	Blocks int `protobuf:"opt"`
+}
+
+// GetChainHealthResponse holds the health metrics of a chain.
+type GetChainHealthResponse struct {
+	// LatestIndex is the index of the latest block known to the node.
+	LatestIndex int
+	// TrieIndex is the index of the latest block applied to the global state.
+	TrieIndex int
+	// LatestTimestamp is the timestamp of the latest block, in nanoseconds.
+	LatestTimestamp int64
+	// SinceLatest is the time elapsed since the timestamp of the latest block.
+	SinceLatest time.Duration
+	// BlockInterval is the block interval stored in the configuration.
+	BlockInterval time.Duration
+	// ObservedInterval is the mean time between two blocks of the window.
+	ObservedInterval time.Duration
+	// WindowBlocks is the number of blocks used for the statistics.
+	WindowBlocks int
+	// PendingTxs is the number of transactions waiting in the buffer of
+	// the node.
+	PendingTxs int
+	// AcceptedTxs is the number of accepted transactions in the window.
+	AcceptedTxs int
+	// RefusedTxs is the number of refused transactions in the window.
+	RefusedTxs int
+	// RefusedRate is the ratio of refused transactions in the window.
+	RefusedRate float64
+	// ViewChanges is the number of view-change blocks in the window.
+	ViewChanges int
+	// CatchingUp is true if the node is currently catching up.
+	CatchingUp bool
+	// Nodes holds the latest block index of each member of the roster.
+	Nodes []ChainHealthNode
+}
+
+// ChainHealthNode holds the latest block index known by one member of the
+// roster.
+type ChainHealthNode struct {
+	ServerIdentity *network.ServerIdentity
+	LatestIndex    int
+	// Lag is the number of blocks the member is behind the node answering
+	// the request. It is negative if the member is ahead.
+	Lag int
+	// Error is set if the member couldn't be contacted.
+	Error string `protobuf:"opt"`
+}
+
+// GetTxTrace is a request for the spans recorded during the lifecycle of a
+// transaction.
+type GetTxTrace struct {
+	ByzCoinID skipchain.SkipBlockID
+	// TxHash is the hash of the instructions of the transaction, as
+	// returned by ClientTransaction.Instructions.Hash.
+	TxHash []byte
+	// Local is set to only get the spans of the node receiving the request,
+	// instead of the spans of the whole roster.
+	Local bool `protobuf:"opt"`
+}
+
+// GetTxTraceResponse holds the spans of a transaction sorted by their start.
+type GetTxTraceResponse struct {
+	Spans []TxSpan
+	// Errors holds the members of the roster that couldn't be contacted.
+	Errors []string `protobuf:"opt"`
+}
+
+// TxSpan is one stage of the lifecycle of a transaction on one node.
+type TxSpan struct {
+	ServerIdentity *network.ServerIdentity
+	// Stage is the name of the stage, one of the Trace constants.
+	Stage string
+	// Start is the start of the stage, in nanoseconds.
+	Start    int64
+	Duration time.Duration
+	// BlockIndex is the index of the block holding the transaction, or -1 if
+	// it is not known yet.
+	BlockIndex int
+	// Error is set if the transaction failed at this stage.
+	Error string `protobuf:"opt"`
+}
+
+// ProposeDeferred registers a deferred instance in the signature collection
+// service, so that the co-signers of its proposed transaction can submit
+// their signatures off-chain instead of invoking addProof.
+type ProposeDeferred struct {
+	ByzCoinID  skipchain.SkipBlockID
+	InstanceID InstanceID
+	// Local is set when the request is forwarded to the other members of the
+	// roster.
+	Local bool `protobuf:"opt"`
+}
+
+// GetDeferredProposal is a request for the signatures collected off-chain for
+// a deferred instance.
+type GetDeferredProposal struct {
+	ByzCoinID  skipchain.SkipBlockID
+	InstanceID InstanceID
+}
+
+// AddDeferredSignature submits the signature of an instruction of the
+// proposed transaction of a deferred instance.
+type AddDeferredSignature struct {
+	ByzCoinID  skipchain.SkipBlockID
+	InstanceID InstanceID
+	Proof      DeferredProof
+	// Local is set when the request is forwarded to the other members of the
+	// roster.
+	Local bool `protobuf:"opt"`
+}
+
+// DeferredProposalResponse holds the state of a proposal in the signature
+// collection service.
+type DeferredProposalResponse struct {
+	// ProposedTransaction is the transaction stored in the deferred
+	// instance, with the signatures already added on-chain.
+	ProposedTransaction ClientTransaction
+	// InstructionHashes are the hashes to be signed for each instruction.
+	InstructionHashes [][]byte
+	ExpireBlockIndex  uint64
+	// Proofs are the signatures collected off-chain.
+	Proofs []DeferredProof
+	// Ready is true if the signatures satisfy the rules of the darcs of all
+	// the instructions, so that execProposedTx can be invoked with the
+	// proofs.
+	Ready bool
+}
+
+// DeferredProof is the signature of an identity on the hash of one
+// instruction of a proposed transaction.
+type DeferredProof struct {
+	Index     uint32
+	Identity  darc.Identity
+	Signature []byte
+}
+
+// DeferredProofs is the value of the "proofs" argument of execProposedTx.
+type DeferredProofs struct {
+	Proofs []DeferredProof
+}
+
+// GetPendingDeferred is a request for the deferred instances waiting for the
+// signature of an identity.
+type GetPendingDeferred struct {
+	ByzCoinID skipchain.SkipBlockID
+	Identity  darc.Identity
+}
+
+// StreamPendingDeferred is a request to receive the deferred instances
+// waiting for the signature of an identity, each time they change.
+type StreamPendingDeferred struct {
+	ByzCoinID skipchain.SkipBlockID
+	Identity  darc.Identity
+}
+
+// GetPendingDeferredResponse holds the deferred instances waiting for the
+// signature of an identity.
+type GetPendingDeferredResponse struct {
+	Pending []PendingDeferred
+}
+
+// PendingDeferred is a deferred instance whose proposed transaction needs the
+// signature of an identity.
+type PendingDeferred struct {
+	InstanceID          InstanceID
+	ProposedTransaction ClientTransaction
+	InstructionHashes   [][]byte
+	ExpireBlockIndex    uint64
+	// Indexes are the instructions whose darc rules include the identity,
+	// and which haven't been signed by it yet.
+	Indexes []uint32
+}
+
 // DebugRequest returns the list of all byzcoins if byzcoinid is empty, else it returns
 // a dump of all instances if byzcoinid is given and exists.
 type DebugRequest struct {
@@ -0,0 +1,238 @@
+package byzcoin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"sync"
+
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// maxScheduledPerBlock is the number of scheduled instructions the leader
+// executes in one block. The others are executed in the next blocks.
+const maxScheduledPerBlock = 64
+
+type scheduledEntry struct {
+	blockIndex uint64
+	timestamp  int64
+}
+
+type scheduledChain struct {
+	// index is the index of the block of the global state the entries
+	// correspond to.
+	index   int
+	entries map[string]scheduledEntry
+}
+
+// scheduledIndex keeps the pending scheduler instances of each chain so that
+// the leader doesn't have to go through the global state for every block. It
+// is only a hint: the instances are always read from the global state before
+// being executed.
+type scheduledIndex struct {
+	sync.Mutex
+	chains map[string]*scheduledChain
+}
+
+func newScheduledIndex() *scheduledIndex {
+	return &scheduledIndex{chains: make(map[string]*scheduledChain)}
+}
+
+// load returns the entries of the chain, reading them from the global state if
+// they are missing or don't match the state.
+func (si *scheduledIndex) load(scID skipchain.SkipBlockID, st ReadOnlyStateTrie) (*scheduledChain, error) {
+	sc, ok := si.chains[string(scID)]
+	if ok && sc.index == st.GetIndex() {
+		return sc, nil
+	}
+
+	sc = &scheduledChain{index: st.GetIndex(), entries: make(map[string]scheduledEntry)}
+	err := st.ForEach(func(k, v []byte) error {
+		body, err := decodeStateChangeBody(v)
+		if err != nil || body.ContractID != ContractSchedulerID {
+			return nil
+		}
+		sc.add(k, body.Value)
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("iterating trie: %v", err)
+	}
+	si.chains[string(scID)] = sc
+	return sc, nil
+}
+
+func (sc *scheduledChain) add(key []byte, value []byte) {
+	var sd ScheduledData
+	if err := protobuf.Decode(value, &sd); err != nil {
+		log.Warnf("invalid scheduler instance %x: %v", key, err)
+		return
+	}
+	if sd.pending() {
+		sc.entries[string(key)] = scheduledEntry{blockIndex: sd.BlockIndex, timestamp: sd.Timestamp}
+	} else {
+		delete(sc.entries, string(key))
+	}
+}
+
+// update applies the state changes of the block to the entries of the chain.
+// If a block is missing, the entries will be read again from the global state.
+func (si *scheduledIndex) update(scID skipchain.SkipBlockID, index int, scs StateChanges) {
+	si.Lock()
+	defer si.Unlock()
+
+	sc, ok := si.chains[string(scID)]
+	if !ok {
+		return
+	}
+	if sc.index+1 != index {
+		delete(si.chains, string(scID))
+		return
+	}
+	for _, change := range scs {
+		if change.ContractID != ContractSchedulerID {
+			continue
+		}
+		if change.StateAction == Remove {
+			delete(sc.entries, string(change.InstanceID))
+		} else {
+			sc.add(change.InstanceID, change.Value)
+		}
+	}
+	sc.index = index
+}
+
+// due returns the pending scheduler instances that can be executed in the
+// block following the state with the given timestamp, sorted by instance ID.
+func (si *scheduledIndex) due(scID skipchain.SkipBlockID, st ReadOnlyStateTrie, timestamp int64) []InstanceID {
+	si.Lock()
+	defer si.Unlock()
+
+	sc, err := si.load(scID, st)
+	if err != nil {
+		log.Errorf("couldn't load scheduler instances: %v", err)
+		return nil
+	}
+
+	index := uint64(st.GetIndex() + 1)
+	var ids []InstanceID
+	for key, entry := range sc.entries {
+		if index < entry.blockIndex || timestamp < entry.timestamp {
+			continue
+		}
+		value, _, contractID, _, err := st.GetValues([]byte(key))
+		if err != nil || contractID != ContractSchedulerID {
+			continue
+		}
+		var sd ScheduledData
+		if err := protobuf.Decode(value, &sd); err != nil {
+			continue
+		}
+		if sd.pending() && sd.isDue(index, timestamp) {
+			ids = append(ids, NewInstanceID([]byte(key)))
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return bytes.Compare(ids[i].Slice(), ids[j].Slice()) < 0
+	})
+	if len(ids) > maxScheduledPerBlock {
+		ids = ids[:maxScheduledPerBlock]
+	}
+	return ids
+}
+
+// newScheduledTx returns the transaction that executes the scheduled
+// instruction of the instance in a block with the given timestamp.
+func newScheduledTx(id InstanceID, timestamp int64) ClientTransaction {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(timestamp))
+	return ClientTransaction{
+		Instructions: Instructions{{
+			InstanceID: id,
+			Invoke: &Invoke{
+				ContractID: ContractSchedulerID,
+				Command:    cmdSchedulerExecute,
+				Args:       Arguments{{Name: "timestamp", Value: buf}},
+			},
+		}},
+	}
+}
+
+// isScheduledExecution returns true if the instruction executes a scheduled
+// instruction.
+func isScheduledExecution(instr Instruction) bool {
+	return instr.Invoke != nil && instr.Invoke.ContractID == ContractSchedulerID &&
+		instr.Invoke.Command == cmdSchedulerExecute
+}
+
+// hasScheduledExecution returns true if one of the instructions of the
+// transaction executes a scheduled instruction.
+func hasScheduledExecution(tx ClientTransaction) bool {
+	for _, instr := range tx.Instructions {
+		if isScheduledExecution(instr) {
+			return true
+		}
+	}
+	return false
+}
+
+// isScheduledTx returns true if the transaction is an execution of a
+// scheduled instruction added by the leader.
+func isScheduledTx(tx ClientTransaction) bool {
+	return len(tx.Instructions) == 1 && isScheduledExecution(tx.Instructions[0])
+}
+
+// scheduledTxsSize is the space of a block reserved for the executions of the
+// scheduled instructions, so that they don't make the block exceed its
+// maximum size.
+var scheduledTxsSize = maxScheduledPerBlock * txSize(TxResult{
+	ClientTransaction: newScheduledTx(InstanceID{}, 0),
+	Accepted:          true,
+})
+
+// scheduledTxs returns the transactions executing the scheduled instructions
+// that are due in the block following the state with the given timestamp.
+func (s *Service) scheduledTxs(scID skipchain.SkipBlockID, st ReadOnlyStateTrie, timestamp int64) TxResults {
+	var txs TxResults
+	for _, id := range s.scheduled.due(scID, st, timestamp) {
+		txs = append(txs, TxResult{ClientTransaction: newScheduledTx(id, timestamp)})
+	}
+	return txs
+}
+
+// checkScheduledTxs verifies that the executions of the scheduled
+// instructions are alone in their transaction, that they are the first
+// transactions of the block, that they use the timestamp of the block and
+// that they are accepted, which means they were due.
+func checkScheduledTxs(txs TxResults, timestamp int64) error {
+	head := true
+	count := 0
+	for i, tx := range txs {
+		if !hasScheduledExecution(tx.ClientTransaction) {
+			head = false
+			continue
+		}
+		if !isScheduledTx(tx.ClientTransaction) {
+			return xerrors.Errorf("scheduled execution %d is not alone in its transaction", i)
+		}
+		if !head {
+			return xerrors.Errorf("scheduled execution %d is not at the beginning of the block", i)
+		}
+		buf := tx.ClientTransaction.Instructions[0].Invoke.Args.Search("timestamp")
+		if len(buf) != 8 || int64(binary.LittleEndian.Uint64(buf)) != timestamp {
+			return xerrors.Errorf("scheduled execution %d has the wrong timestamp", i)
+		}
+		if !tx.Accepted {
+			return xerrors.Errorf("scheduled execution %d has been refused", i)
+		}
+		count++
+		if count > maxScheduledPerBlock {
+			return xerrors.New("too many scheduled executions")
+		}
+	}
+	return nil
+}
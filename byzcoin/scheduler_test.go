@@ -0,0 +1,94 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+func TestScheduledIndex(t *testing.T) {
+	scID := skipchain.SkipBlockID("chain")
+	st, err := newMemStateTrie([]byte("nonce"))
+	require.NoError(t, err)
+
+	newChange := func(action StateAction, key string, sd ScheduledData) StateChange {
+		buf, err := protobuf.Encode(&sd)
+		require.NoError(t, err)
+		return NewStateChange(action, NewInstanceID([]byte(key)), ContractSchedulerID, buf, darc.ID("darc"))
+	}
+
+	scs := StateChanges{
+		newChange(Create, "a", ScheduledData{BlockIndex: 1}),
+		newChange(Create, "b", ScheduledData{BlockIndex: 5}),
+		newChange(Create, "c", ScheduledData{Timestamp: 100}),
+		newChange(Create, "d", ScheduledData{BlockIndex: 1, Cancelled: true}),
+	}
+	require.NoError(t, st.StoreAll(scs, 0, CurrentVersion))
+
+	si := newScheduledIndex()
+	ids := si.due(scID, st, 0)
+	require.Equal(t, []InstanceID{NewInstanceID([]byte("a"))}, ids)
+	ids = si.due(scID, st, 100)
+	require.Equal(t, 2, len(ids))
+
+	// The entries are read from the global state only once per block.
+	si.chains[string(scID)].entries["x"] = scheduledEntry{}
+	require.Equal(t, 2, len(si.due(scID, st, 100)))
+
+	// The changes of the next block are applied to the entries.
+	executed := newChange(Update, "a", ScheduledData{BlockIndex: 1, Executed: true})
+	require.NoError(t, st.StoreAll(StateChanges{executed}, 1, CurrentVersion))
+	si.update(scID, 1, StateChanges{executed})
+	require.Equal(t, 1, si.chains[string(scID)].index)
+	_, ok := si.chains[string(scID)].entries[string(NewInstanceID([]byte("a")).Slice())]
+	require.False(t, ok)
+
+	// A missing block drops the entries.
+	si.update(scID, 5, nil)
+	_, ok = si.chains[string(scID)]
+	require.False(t, ok)
+}
+
+func TestCheckScheduledTxs(t *testing.T) {
+	id := NewInstanceID([]byte("scheduler"))
+	other, err := createOneClientTx(darc.ID("darc"), dummyContract, []byte{}, darc.NewSignerEd25519(nil, nil))
+	require.NoError(t, err)
+
+	txs := TxResults{
+		{ClientTransaction: newScheduledTx(id, 10), Accepted: true},
+		{ClientTransaction: other, Accepted: true},
+	}
+	require.NoError(t, checkScheduledTxs(txs, 10))
+	require.Error(t, checkScheduledTxs(txs, 11))
+
+	txs[0].Accepted = false
+	require.Error(t, checkScheduledTxs(txs, 10))
+	txs[0].Accepted = true
+
+	txs = append(txs, TxResult{ClientTransaction: newScheduledTx(id, 10), Accepted: true})
+	require.Error(t, checkScheduledTxs(txs, 10))
+
+	// An execution can't be hidden in a transaction with other
+	// instructions, as it would be executed without the timestamp of the
+	// block.
+	bypass := newScheduledTx(id, 1e18)
+	bypass.Instructions = append(bypass.Instructions, other.Instructions...)
+	require.True(t, hasScheduledExecution(bypass))
+	require.False(t, isScheduledTx(bypass))
+	txs = TxResults{{ClientTransaction: bypass, Accepted: true}}
+	require.Error(t, checkScheduledTxs(txs, 10))
+	txs = TxResults{
+		{ClientTransaction: newScheduledTx(id, 10), Accepted: true},
+		{ClientTransaction: bypass, Accepted: false},
+	}
+	require.Error(t, checkScheduledTxs(txs, 10))
+
+	txs = nil
+	for i := 0; i <= maxScheduledPerBlock; i++ {
+		txs = append(txs, TxResult{ClientTransaction: newScheduledTx(id, 10), Accepted: true})
+	}
+	require.Error(t, checkScheduledTxs(txs, 10))
+}
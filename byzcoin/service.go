@@ -18,9 +18,11 @@ import (
 
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/blscosi/protocol"
+	"go.dedis.ch/cothority/v3/byzcoin/mmr"
 	"go.dedis.ch/cothority/v3/byzcoin/trie"
 	"go.dedis.ch/cothority/v3/byzcoin/viewchange"
 	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/metrics"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign/schnorr"
@@ -67,6 +69,23 @@ const viewChangeFtCosi = "viewchange_ftcosi"
 
 var viewChangeMsgID network.MessageTypeID
 
+var (
+	metricBlockCreation = metrics.NewHistogram("byzcoin_block_creation_seconds",
+		"Time taken by the leader to create and sign a new block.", nil)
+	metricTxBuffer = metrics.NewGauge("byzcoin_tx_buffer_size",
+		"Number of transactions waiting to be collected by the leader.")
+	metricTxQueue = metrics.NewGauge("byzcoin_tx_pipeline_queue_size",
+		"Number of collected transactions waiting to be processed by the leader.")
+	metricTxDropped = metrics.NewCounter("byzcoin_tx_pipeline_dropped_total",
+		"Number of collected transactions dropped because the queue was full.")
+	metricTxs = metrics.NewCounter("byzcoin_transactions_total",
+		"Number of transactions stored in the blocks, by result.", "result")
+	metricViewChangeReqs = metrics.NewCounter("byzcoin_view_change_requests_total",
+		"Number of view-change requests sent by the node.")
+	metricViewChanges = metrics.NewCounter("byzcoin_view_changes_total",
+		"Number of view-change blocks applied by the node.")
+)
+
 // ByzCoinID can be used to refer to this service.
 var ByzCoinID onet.ServiceID
 
@@ -97,6 +116,18 @@ func init() {
 	if err != nil {
 		panic(err)
 	}
+	err = RegisterGlobalContractVersion(ContractNamingID, ContractNamingIndexedVersion, contractNamingIndexedFromBytes)
+	if err != nil {
+		panic(err)
+	}
+	err = RegisterGlobalContract(ContractSchedulerID, contractSchedulerFromBytes)
+	if err != nil {
+		panic(err)
+	}
+	err = RegisterGlobalContract(ContractLogID, contractLogFromBytes)
+	if err != nil {
+		panic(err)
+	}
 }
 
 // GenNonce returns a random nonce.
@@ -114,6 +145,9 @@ type Service struct {
 	// responsible for, one for each skipchain.
 	stateTries     map[string]*stateTrie
 	stateTriesLock sync.Mutex
+	// trieStore holds the global states, in the backend selected by
+	// TrieDBEnv.
+	trieStore trieStore
 	// We need to store the state changes for keeping track
 	// of the history of an instance
 	stateChangeStorage *stateChangeStorage
@@ -155,6 +189,10 @@ type Service struct {
 
 	streamingMan streamingManager
 
+	// pendingDeferredMan holds the listeners of the deferred instances
+	// waiting for a signature.
+	pendingDeferredMan pendingDeferredManager
+
 	updateTrieLock        sync.Mutex
 	catchingLock          sync.Mutex
 	catchingUp            bool
@@ -166,6 +204,21 @@ type Service struct {
 	rotationWindow time.Duration
 
 	txErrorBuf ringBuf
+	txTracer   *txTracer
+
+	// deferredProposals holds the signatures collected off-chain for the
+	// deferred instances.
+	deferredProposals *deferredProposals
+
+	// scheduled holds the pending scheduler instances of each chain.
+	scheduled *scheduledIndex
+
+	// deferredIdx holds the live deferred instances of each chain.
+	deferredIdx *deferredIndex
+
+	// jsonHandlers are the endpoints which can be called in JSON. It is
+	// only written while the service is created.
+	jsonHandlers map[string]jsonHandler
 
 	// defaultVersion is the new version to use for new
 	// ByzCoin chains.
@@ -380,6 +433,7 @@ func (s *Service) prepareTxResponse(req *AddTxRequest, tx *TxResult) (*AddTxResp
 // AddTxResponse.Error even if the error return value is nil.
 func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 	addtx := monitor.NewTimeMeasure("add_tx")
+	start := time.Now()
 	if len(req.Transaction.Instructions) == 0 {
 		return nil, xerrors.New("no transactions to add")
 	}
@@ -413,6 +467,7 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 	// Upgrade the instructions with the byzcoin protocol version
 	// to use the correct hash function.
 	req.Transaction.Instructions.SetVersion(header.Version)
+	txHash := req.Transaction.Instructions.Hash()
 
 	_, maxsz, err := s.LoadBlockInfo(req.SkipchainID)
 	if err != nil {
@@ -420,12 +475,17 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 	}
 	txsz := txSize(TxResult{ClientTransaction: req.Transaction})
 	if txsz > maxsz {
-		return nil, xerrors.New("transaction too large")
+		err = xerrors.New("transaction too large")
+		s.txTracer.record(txHash, TraceAddTransaction, start, -1, err)
+		return nil, err
 	}
 
 	for i, instr := range req.Transaction.Instructions {
 		log.Lvlf2("Instruction[%d]: %s on instance ID %s", i, instr.Action(), instr.InstanceID.String())
 	}
+	if hasScheduledExecution(req.Transaction) {
+		return nil, xerrors.New("scheduled instructions are executed by the leader")
+	}
 
 	// Note to my future self: s.txBuffer.add used to be out here. It used to work
 	// even. But while investigating other race conditions, we realized that
@@ -445,10 +505,11 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 			return nil, xerrors.Errorf("couldn't get block info: %v", err)
 		}
 
-		ctxHash := req.Transaction.Instructions.Hash()
 		ch := s.notifications.registerForBlocks()
 		defer s.notifications.unregisterForBlocks(ch)
 
+		s.txTracer.record(txHash, TraceAddTransaction, start, -1, nil)
+		s.txTracer.open(txHash, TraceTxBuffer)
 		s.txBuffer.add(string(req.SkipchainID), req.Transaction)
 
 		// In case we don't have any blocks, because there are no transactions,
@@ -462,7 +523,7 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 		for {
 			select {
 			case notif := <-ch:
-				if tx := notif.getTx(ctxHash); tx != nil {
+				if tx := notif.getTx(txHash); tx != nil {
 					return s.prepareTxResponse(req, tx)
 				}
 
@@ -477,6 +538,8 @@ func (s *Service) AddTransaction(req *AddTxRequest) (*AddTxResponse, error) {
 			}
 		}
 	} else {
+		s.txTracer.record(txHash, TraceAddTransaction, start, -1, nil)
+		s.txTracer.open(txHash, TraceTxBuffer)
 		s.txBuffer.add(string(req.SkipchainID), req.Transaction)
 	}
 	addtx.Record()
@@ -631,26 +694,32 @@ func (s *Service) DownloadState(req *DownloadState) (resp *DownloadStateResponse
 		s.downloadState.nonce = nonce
 		total := make(chan int)
 		go func(ds downloadState) {
-			idStr := fmt.Sprintf("%x", ds.id)
-			db, bucketName := s.GetAdditionalBucket([]byte(idStr))
-			err := db.View(func(tx *bbolt.Tx) error {
-				bucket := tx.Bucket(bucketName)
-				total <- bucket.Stats().KeyN
-				return bucket.ForEach(func(k []byte, v []byte) error {
-					key := make([]byte, len(k))
-					copy(key, k)
-					value := make([]byte, len(v))
-					copy(value, v)
-					select {
-					case ds.read <- DBKeyValue{key, value}:
-					case <-ds.stop:
-						return xerrors.New("closed")
-					case <-time.After(time.Minute):
-						return xerrors.New("timed out while waiting for next read")
-					}
-					return nil
+			// The global state is opened first, as it might need to be
+			// migrated before being counted.
+			db, err := s.trieStore.open(ds.id)
+			n := 0
+			if err == nil {
+				n, err = s.trieStore.count(ds.id)
+			}
+			total <- n
+			if err == nil {
+				err = db.View(func(bucket trie.Bucket) error {
+					return bucket.ForEach(func(k []byte, v []byte) error {
+						key := make([]byte, len(k))
+						copy(key, k)
+						value := make([]byte, len(v))
+						copy(value, v)
+						select {
+						case ds.read <- DBKeyValue{key, value}:
+						case <-ds.stop:
+							return xerrors.New("closed")
+						case <-time.After(time.Minute):
+							return xerrors.New("timed out while waiting for next read")
+						}
+						return nil
+					})
 				})
-			})
+			}
 			if err != nil {
 				log.Error("while serving current database:", err)
 			}
@@ -796,6 +865,210 @@ func (s *Service) ResolveInstanceID(req *ResolveInstanceID) (*ResolvedInstanceID
 	return &ResolvedInstanceID{valStruct.IID}, nil
 }
 
+// ListNames returns the names given under the darc of the request. Only the
+// names added once the version 1 of the naming contract is active are listed.
+func (s *Service) ListNames(req *ListNames) (*ListNamesResponse, error) {
+	st, err := s.GetReadOnlyStateTrie(req.SkipChainID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+
+	if len(req.DarcID) == 0 {
+		return nil, xerrors.New("darc ID must be set")
+	}
+
+	idx, _, err := loadNamingIndex(st, namingDarcIndexID(req.DarcID))
+	if err != nil {
+		return nil, xerrors.Errorf("loading index: %v", err)
+	}
+
+	resp := &ListNamesResponse{}
+	for _, named := range idx.Names {
+		if hasNamePrefix(named.Name, req.Prefix) {
+			resp.Names = append(resp.Names, named)
+		}
+	}
+	return resp, nil
+}
+
+// ResolveNames returns the names given to the instance of the request. As for
+// ListNames, only the names added with the version 1 of the naming contract
+// are returned.
+func (s *Service) ResolveNames(req *ResolveNames) (*ResolvedNames, error) {
+	st, err := s.GetReadOnlyStateTrie(req.SkipChainID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+
+	idx, _, err := loadNamingIndex(st, namingInstanceIndexID(req.InstanceID))
+	if err != nil {
+		return nil, xerrors.Errorf("loading index: %v", err)
+	}
+	return &ResolvedNames{Names: idx.Names}, nil
+}
+
+// GetLogEntry returns the entry of a log instance with the proof of its
+// inclusion, linked to the proof of the instance from the genesis block.
+func (s *Service) GetLogEntry(req *GetLogEntry) (*GetLogEntryResponse, error) {
+	st, err := s.GetReadOnlyStateTrie(req.SkipChainID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	proof, err := NewProof(st, s.db(), req.SkipChainID, req.LogID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("making proof: %v", err)
+	}
+
+	var ld LogData
+	err = proof.VerifyAndDecode(cothority.Suite, ContractLogID, &ld)
+	if err != nil {
+		return nil, xerrors.Errorf("reading log: %v", err)
+	}
+	// The nodes never change once created, so the ones of the log in the
+	// proof are still there even if blocks have been added since.
+	ids, _, err := mmr.Path(req.Index, ld.Size)
+	if err != nil {
+		return nil, xerrors.Errorf("getting path: %v", err)
+	}
+
+	leaf, err := loadLogNode(st, req.LogID, mmr.NodeID{Index: req.Index})
+	if err != nil {
+		return nil, xerrors.Errorf("loading entry: %v", err)
+	}
+	resp := &GetLogEntryResponse{Entry: leaf.Data, Proof: *proof}
+	for _, id := range ids {
+		node, err := loadLogNode(st, req.LogID, id)
+		if err != nil {
+			return nil, xerrors.Errorf("loading sibling: %v", err)
+		}
+		resp.Siblings = append(resp.Siblings, node.Hash)
+	}
+	return resp, nil
+}
+
+// maxAbsenceProofBlocks is how many blocks before the latest one the global
+// state can be rebuilt to prove the absence of a key, as the requests are not
+// authenticated and rebuilding older states is expensive.
+const maxAbsenceProofBlocks = 1000
+
+// GetAbsenceProof returns the proof of the key in the global state of the
+// block at the index. The global states of the blocks before the latest one
+// are rebuilt from the history of the state changes, so it must not have been
+// pruned since that block.
+func (s *Service) GetAbsenceProof(req *GetAbsenceProof) (*GetProofResponse, error) {
+	sb := s.db().GetByID(req.ID)
+	if sb == nil {
+		return nil, xerrors.New("cannot find skipblock while getting proof")
+	}
+	scID := sb.SkipChainID()
+
+	// The global state must not change while the older one is rebuilt.
+	s.updateTrieLock.Lock()
+	defer s.updateTrieLock.Unlock()
+	st, err := s.getStateTrie(scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	latest := st.GetIndex()
+	if req.Index < sb.Index || req.Index > latest {
+		return nil, xerrors.Errorf("invalid block index %d, latest is %d",
+			req.Index, latest)
+	}
+	if latest-req.Index > maxAbsenceProofBlocks {
+		return nil, xerrors.Errorf("block %d is more than %d blocks before the latest one",
+			req.Index, maxAbsenceProofBlocks)
+	}
+
+	var proof *Proof
+	if req.Index == latest {
+		proof, err = NewProof(st, s.db(), req.ID, req.Key)
+		if err != nil {
+			return nil, xerrors.Errorf("making proof: %v", err)
+		}
+	} else {
+		sst, err := s.stagingTrieAt(st, scID, req.Index, latest)
+		if err != nil {
+			return nil, xerrors.Errorf("rebuilding state of block %d: %v", req.Index, err)
+		}
+		pr, err := sst.GetProof(req.Key)
+		if err != nil {
+			return nil, xerrors.Errorf("getting proof: %v", err)
+		}
+		links, block, err := proofLinks(s.db(), req.ID, req.Index)
+		if err != nil {
+			return nil, xerrors.Errorf("getting links: %v", err)
+		}
+		if block.Index != req.Index {
+			return nil, xerrors.New("didn't find the block at the index")
+		}
+		proof = &Proof{InclusionProof: *pr, Links: links, Latest: *block}
+	}
+
+	log.Lvlf2("%s: Returning absence proof for %x at index %v", s.ServerIdentity(),
+		req.Key, req.Index)
+	return &GetProofResponse{
+		Version: CurrentVersion,
+		Proof:   *proof,
+	}, nil
+}
+
+// GetDeletionProof returns the proof of the latest removal of an instance,
+// using the history of the state changes, together with the proof of its
+// absence from the current global state.
+func (s *Service) GetDeletionProof(req *GetDeletionProof) (*GetDeletionProofResponse, error) {
+	sb := s.db().GetByID(req.ID)
+	if sb == nil {
+		return nil, xerrors.New("cannot find skipblock while getting proof")
+	}
+	scID := sb.SkipChainID()
+
+	sce, ok, err := s.stateChangeStorage.getLast(req.InstanceID[:], scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting state change: %v", err)
+	}
+	if !ok || sce.StateChange.StateAction != Remove {
+		return nil, xerrors.New("no removal of the instance in the history")
+	}
+
+	links, block, err := proofLinks(s.db(), req.ID, sce.BlockIndex)
+	if err != nil {
+		return nil, xerrors.Errorf("getting links: %v", err)
+	}
+	if block.Index != sce.BlockIndex {
+		return nil, xerrors.New("didn't find the block of the removal")
+	}
+	sces, err := s.stateChangeStorage.getByBlock(scID, sce.BlockIndex)
+	if err != nil {
+		return nil, xerrors.Errorf("getting state changes: %v", err)
+	}
+
+	absence, err := s.GetProof(&GetProof{
+		Version: CurrentVersion,
+		Key:     req.InstanceID.Slice(),
+		ID:      req.ID,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("getting absence proof: %v", err)
+	}
+	err = absence.Proof.VerifyAbsence(req.InstanceID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("instance exists again: %v", err)
+	}
+
+	resp := &GetDeletionProofResponse{Proof: DeletionProof{
+		Links:        links,
+		Block:        *block,
+		StateChanges: make([]StateChange, len(sces)),
+		Absence:      absence.Proof,
+	}}
+	for i, e := range sces {
+		resp.Proof.StateChanges[i] = e.StateChange.Copy()
+	}
+	log.Lvlf2("%s: Returning deletion proof for %x at index %v", s.ServerIdentity(),
+		req.InstanceID.Slice(), block.Index)
+	return resp, nil
+}
+
 type leafNode struct {
 	Prefix []bool
 	Key    []byte
@@ -804,7 +1077,8 @@ type leafNode struct {
 
 // ProcessClientRequest implements onet.Service. We override the version
 // we normally get from embedding onet.ServiceProcessor in order to
-// hook it and get a look at the http.Request.
+// hook it and get a look at the http.Request, and to answer the requests
+// sent in JSON.
 func (s *Service) ProcessClientRequest(req *http.Request, path string, buf []byte) ([]byte, *onet.StreamingTunnel, error) {
 	if path == "Debug" {
 		h, _, err := net.SplitHostPort(req.RemoteAddr)
@@ -818,6 +1092,11 @@ func (s *Service) ProcessClientRequest(req *http.Request, path string, buf []byt
 		}
 	}
 
+	if strings.HasSuffix(path, jsonPathSuffix) {
+		reply, err := s.processJSONRequest(path, buf)
+		return reply, nil, cothority.ErrorOrNil(err, "processing JSON request")
+	}
+
 	buf, stream, err := s.ServiceProcessor.ProcessClientRequest(req, path, buf)
 	return buf, stream, cothority.ErrorOrNil(err, "processing request")
 }
@@ -903,15 +1182,9 @@ func (s *Service) DebugRemove(req *DebugRemoveRequest) (*DebugResponse, error) {
 	_, exists = s.stateTries[idStrHex]
 	if exists {
 		log.Lvl2("Removing state-trie")
-		db, bn := s.GetAdditionalBucket([]byte(idStrHex))
-		if db == nil {
-			return nil, xerrors.New("didn't find trie for this byzcoin-ID")
-		}
-		err := db.Update(func(tx *bbolt.Tx) error {
-			return tx.DeleteBucket(bn)
-		})
+		err := s.trieStore.remove(req.ByzCoinID)
 		if err != nil {
-			return nil, xerrors.Errorf("deleting bucket: %v", err)
+			return nil, xerrors.Errorf("deleting trie: %v", err)
 		}
 		delete(s.stateTries, idStr)
 		err = s.db().RemoveSkipchain(req.ByzCoinID)
@@ -953,6 +1226,8 @@ func (s *Service) SetPropagationTimeout(p time.Duration) {
 // inform all nodes to update their internal trie
 // to include the new transactions.
 func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx []TxResult) (*skipchain.SkipBlock, error) {
+	start := time.Now()
+	timestamp := start.UnixNano()
 	var sb *skipchain.SkipBlock
 	var mr []byte
 	var sst *stagingStateTrie
@@ -1010,6 +1285,10 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		}
 
 		version = header.Version
+
+		// The scheduled instructions that are due are executed first. The
+		// pipeline leaves scheduledTxsSize bytes for them in the block.
+		tx = append(s.scheduledTxs(scID, sst, timestamp), tx...)
 	}
 
 	// Create header of skipblock containing only hashes
@@ -1022,6 +1301,11 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 	if len(txRes) == 0 {
 		return nil, xerrors.New("no transactions")
 	}
+	// The nodes refuse a block whose scheduled executions are invalid, so
+	// it is not proposed.
+	if err := checkScheduledTxs(txRes, timestamp); err != nil {
+		return nil, xerrors.Errorf("invalid scheduled executions: %v", err)
+	}
 
 	// Store transactions in the body
 	body := &DataBody{TxResults: txRes}
@@ -1034,7 +1318,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		TrieRoot:              mr,
 		ClientTransactionHash: txRes.Hash(),
 		StateChangesHash:      scs.Hash(),
-		Timestamp:             time.Now().UnixNano(),
+		Timestamp:             timestamp,
 		Version:               version,
 	}
 	sb.Data, err = protobuf.Encode(header)
@@ -1052,6 +1336,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 
 	log.Lvlf3("Storing skipblock with %d transactions.", len(txRes))
 	var ssbReply *skipchain.StoreSkipBlockReply
+	signStart := time.Now()
 
 	if sb.Roster.List[0].Equal(s.ServerIdentity()) {
 		ssbReply, err = s.skService().StoreSkipBlockInternal(&ssb)
@@ -1060,11 +1345,17 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		ssbReply = &skipchain.StoreSkipBlockReply{}
 		err = skipchain.NewClient().SendProtobuf(sb.Roster.List[0], &ssb, ssbReply)
 		if err != nil {
-			return nil, xerrors.Errorf("store request: %v", err)
+			err = xerrors.Errorf("store request: %v", err)
+			s.txTracer.traceTxs(txRes, TraceBFTSigning, signStart, -1, err)
+			s.txTracer.traceTxs(txRes, TraceCreateNewBlock, start, -1, err)
+			return nil, err
 		}
 
 		if ssbReply.Latest == nil {
-			return nil, xerrors.New("got an empty reply")
+			err = xerrors.New("got an empty reply")
+			s.txTracer.traceTxs(txRes, TraceBFTSigning, signStart, -1, err)
+			s.txTracer.traceTxs(txRes, TraceCreateNewBlock, start, -1, err)
+			return nil, err
 		}
 
 		// we're not doing more verification because the block should not be used
@@ -1074,8 +1365,12 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 	}
 
 	if err != nil {
-		return nil, xerrors.Errorf("storing block: %v", err)
+		err = xerrors.Errorf("storing block: %v", err)
+		s.txTracer.traceTxs(txRes, TraceBFTSigning, signStart, -1, err)
+		s.txTracer.traceTxs(txRes, TraceCreateNewBlock, start, -1, err)
+		return nil, err
 	}
+	s.txTracer.traceTxs(txRes, TraceBFTSigning, signStart, ssbReply.Latest.Index, nil)
 
 	// State changes are cached only when the block is confirmed
 	err = s.stateChangeStorage.append(scs, ssbReply.Latest)
@@ -1083,6 +1378,7 @@ func (s *Service) createNewBlock(scID skipchain.SkipBlockID, r *onet.Roster, tx
 		log.Error(err)
 	}
 
+	s.txTracer.traceTxs(txRes, TraceCreateNewBlock, start, ssbReply.Latest.Index, nil)
 	return ssbReply.Latest, nil
 }
 
@@ -1151,10 +1447,7 @@ func (s *Service) downloadDB(sb *skipchain.SkipBlock) error {
 		_, err := s.getStateTrie(sb.SkipChainID())
 		if err == nil {
 			// Suppose we _do_ have a statetrie
-			db, stBucket := s.GetAdditionalBucket(sb.SkipChainID())
-			err := db.Update(func(tx *bbolt.Tx) error {
-				return cothority.ErrorOrNil(tx.DeleteBucket(stBucket), "deleting bucket")
-			})
+			err := s.trieStore.remove(sb.SkipChainID())
 			if err != nil {
 				return xerrors.Errorf("Cannot delete existing trie while trying to download: %v", err)
 			}
@@ -1166,8 +1459,7 @@ func (s *Service) downloadDB(sb *skipchain.SkipBlock) error {
 		// Then start downloading the stateTrie over the network.
 		cl := NewClient(sb.SkipChainID(), *sb.Roster)
 		cl.DontContact(s.ServerIdentity())
-		var db *bbolt.DB
-		var bucketName []byte
+		var db trie.DB
 		var nonce uint64
 		var cursor int
 		for {
@@ -1181,12 +1473,14 @@ func (s *Service) downloadDB(sb *skipchain.SkipBlock) error {
 				cl.noncesSI[resp.Nonce])
 			cursor += len(resp.KeyValues)
 			if db == nil {
-				db, bucketName = s.GetAdditionalBucket([]byte(idStr))
+				db, err = s.trieStore.open(sb.SkipChainID())
+				if err != nil {
+					return xerrors.Errorf("opening trie storage: %v", err)
+				}
 				nonce = resp.Nonce
 			}
 			// And store all entries in our local database.
-			err = db.Update(func(tx *bbolt.Tx) error {
-				bucket := tx.Bucket(bucketName)
+			err = db.Update(func(bucket trie.Bucket) error {
 				for _, kv := range resp.KeyValues {
 					err := bucket.Put(kv.Key, kv.Value)
 					if err != nil {
@@ -1204,7 +1498,7 @@ func (s *Service) downloadDB(sb *skipchain.SkipBlock) error {
 		}
 
 		// Check the new trie is correct
-		st, err := loadStateTrie(db, bucketName)
+		st, err := loadStateTrie(db)
 		if err != nil {
 			return xerrors.Errorf("couldn't load state trie: %v", err)
 		}
@@ -1581,6 +1875,14 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 	}
 
 	log.Lvlf2("%s Updating %d transactions for %x on index %v", s.ServerIdentity(), len(body.TxResults), sb.SkipChainID(), sb.Index)
+	updateStart := time.Now()
+	for _, tx := range body.TxResults {
+		if tx.Accepted {
+			metricTxs.Inc("accepted")
+		} else {
+			metricTxs.Inc("refused")
+		}
+	}
 	_, _, scs, _ := s.createStateChanges(st.MakeStagingStateTrie(), sb.SkipChainID(), body.TxResults, noTimeout, header.Version)
 
 	log.Lvlf3("%s Storing index %d with %d state changes %v", s.ServerIdentity(), sb.Index, len(scs), scs.ShortStrings())
@@ -1588,6 +1890,8 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 	if err = st.VerifiedStoreAll(scs, sb.Index, header.Version, header.TrieRoot); err != nil {
 		return xerrors.Errorf("storing state changes: %v", err)
 	}
+	s.scheduled.update(sb.SkipChainID(), sb.Index, scs)
+	s.deferredIdx.update(sb.SkipChainID(), sb.Index, scs)
 
 	err = s.stateChangeStorage.append(scs, sb)
 	if err != nil {
@@ -1596,6 +1900,17 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 			"mean that the db is broken.")
 	}
 
+	for _, tx := range body.TxResults {
+		var txErr error
+		if !tx.Accepted {
+			txErr = xerrors.New("transaction refused")
+			if msg, ok := s.txErrorBuf.get(tx.ClientTransaction.Instructions.HashWithSignatures()); ok {
+				txErr = xerrors.Errorf("transaction refused: %v", msg)
+			}
+		}
+		s.txTracer.record(tx.ClientTransaction.Instructions.Hash(), TraceUpdateTrie, updateStart, sb.Index, txErr)
+	}
+
 	// If we are adding a genesis block, then look into it for the darc ID
 	// and add it to the darcToSc hash map.
 	if sb.Index == 0 {
@@ -1666,6 +1981,9 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 
 		// If it is a view-change transaction, confirm it's done
 		view := isViewChangeTx(body.TxResults)
+		if view != nil {
+			metricViewChanges.Inc()
+		}
 
 		if s.viewChangeMan.started(sb.SkipChainID()) && view != nil {
 			s.viewChangeMan.done(*view)
@@ -1695,6 +2013,7 @@ func (s *Service) updateTrieCallback(sbID skipchain.SkipBlockID) error {
 
 	// At this point everything should be stored.
 	s.streamingMan.notify(string(sb.SkipChainID()), sb)
+	s.pendingDeferredMan.notifyBlock(s, sb.SkipChainID())
 
 	log.Lvlf2("%s updated trie for %x with root %x", s.ServerIdentity(), sb.SkipChainID(), st.GetRoot())
 	return nil
@@ -1751,8 +2070,11 @@ func (s *Service) getStateTrie(id skipchain.SkipBlockID) (*stateTrie, error) {
 	idStr := fmt.Sprintf("%x", id)
 	col := s.stateTries[idStr]
 	if col == nil {
-		db, name := s.GetAdditionalBucket([]byte(idStr))
-		st, err := loadStateTrie(db, name)
+		db, err := s.trieStore.open(id)
+		if err != nil {
+			return nil, xerrors.Errorf("opening trie storage: %v", err)
+		}
+		st, err := loadStateTrie(db)
 		if err != nil {
 			return nil, xerrors.Errorf("getting trie: %v", err)
 		}
@@ -1772,8 +2094,11 @@ func (s *Service) createStateTrie(id skipchain.SkipBlockID, nonce []byte) (*stat
 	if s.stateTries[idStr] != nil {
 		return nil, xerrors.New("state trie already exists")
 	}
-	db, name := s.GetAdditionalBucket([]byte(idStr))
-	st, err := newStateTrie(db, name, nonce)
+	db, err := s.trieStore.open(id)
+	if err != nil {
+		return nil, xerrors.Errorf("opening trie storage: %v", err)
+	}
+	st, err := newStateTrie(db, nonce)
 	if err != nil {
 		return nil, xerrors.Errorf("making trie: %v", err)
 	}
@@ -1998,6 +2323,11 @@ func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool
 		}
 	}
 
+	if err := checkScheduledTxs(txOut, header.Timestamp); err != nil {
+		log.Error(s.ServerIdentity(), err)
+		return false
+	}
+
 	// Check that the hashes in DataHeader are right.
 	if bytes.Compare(header.ClientTransactionHash, txOut.Hash()) != 0 {
 		log.Lvl2(s.ServerIdentity(), "Client Transaction Hash doesn't verify")
@@ -2025,6 +2355,14 @@ func (s *Service) verifySkipBlock(newID []byte, newSB *skipchain.SkipBlock) bool
 		log.Error(s.ServerIdentity(), err)
 		return false
 	}
+	// Refuse to sign a block that activates a contract version this node
+	// doesn't have, as it would not be able to follow the chain.
+	for _, cv := range config.ContractVersions {
+		if _, ok := s.contracts.SearchVersion(cv.ContractID, cv.Version); !ok {
+			log.Errorf("%s doesn't support %s", s.ServerIdentity(), cv)
+			return false
+		}
+	}
 	if newSB.Index > 0 {
 		if err := config.checkNewRoster(*newSB.Roster); err != nil {
 			log.Error("Didn't accept the new roster:", err)
@@ -2294,6 +2632,30 @@ func (s *Service) GetContractInstance(contractName string, in []byte) (Contract,
 	return c, nil
 }
 
+// getChainContracts returns the view of the contract registry with the
+// versions of the contracts that are active in the block following the state
+// of the trie. As an upgrade is only activated in a later block, the versions
+// are loaded once for the staging trie of a block.
+func (s *Service) getChainContracts(st ReadOnlyStateTrie) chainContractRegistry {
+	cr := chainContractRegistry{contractRegistry: s.contracts}
+	sst, staging := st.(*stagingStateTrie)
+	if staging && sst.active != nil && sst.activeIndex == st.GetIndex() {
+		cr.active = sst.active
+		return cr
+	}
+	// Before the genesis block is applied, there is no config and all
+	// the contracts use their version 0.
+	config, err := LoadConfigFromTrie(st)
+	if err == nil {
+		cr.active = config.activeContractVersions(st.GetIndex() + 1)
+		if staging {
+			sst.active = cr.active
+			sst.activeIndex = st.GetIndex()
+		}
+	}
+	return cr
+}
+
 func (s *Service) executeInstruction(st ReadOnlyStateTrie, cin []Coin, instr Instruction, ctxHash []byte, scID skipchain.SkipBlockID) (scs StateChanges, cout []Coin, err error) {
 	defer func() {
 		if re := recover(); re != nil {
@@ -2311,17 +2673,24 @@ func (s *Service) executeInstruction(st ReadOnlyStateTrie, cin []Coin, instr Ins
 		return
 	}
 
-	contractFactory, exists := s.GetContractConstructor(contractID)
+	contracts := s.getChainContracts(st)
+	contractFactory, exists := contracts.Search(contractID)
 	if !exists {
 		if ConfigInstanceID.Equal(instr.InstanceID) {
 			// Special case 1: first time call to
 			// genesis-configuration must return correct contract
 			// type.
-			contractFactory, exists = s.GetContractConstructor(ContractConfigID)
+			contractFactory, exists = contracts.Search(ContractConfigID)
 		} else if NamingInstanceID.Equal(instr.InstanceID) {
 			// Special case 2: first time call to the naming
 			// contract must return the correct type too.
-			contractFactory, exists = s.GetContractConstructor(ContractNamingID)
+			contractFactory, exists = contracts.Search(ContractNamingID)
+		} else if _, known := s.contracts.Search(contractID); known {
+			// The contract is known but not the version activated
+			// by the chain, so the instruction cannot be executed.
+			err = xerrors.Errorf("version %d of contract \"%s\" is not supported by this node",
+				contracts.active[contractID], contractID)
+			return
 		} else {
 			// If the leader does not have a verifier for this
 			// contract, it drops the transaction.
@@ -2345,7 +2714,7 @@ func (s *Service) executeInstruction(st ReadOnlyStateTrie, cin []Coin, instr Ins
 		return
 	}
 	if sc, ok := c.(ContractWithRegistry); ok {
-		sc.SetRegistry(s.contracts)
+		sc.SetRegistry(contracts)
 	}
 
 	err = c.VerifyInstruction(gs, instr, ctxHash)
@@ -2452,7 +2821,11 @@ func (s *Service) getTxs(leader *network.ServerIdentity, roster *onet.Roster, sc
 
 	s.heartbeats.beat(string(scID))
 
-	return s.txBuffer.take(string(scID), maxNumTxs)
+	txs := s.txBuffer.take(string(scID), maxNumTxs)
+	for _, tx := range txs {
+		s.txTracer.close(tx.Instructions.Hash(), TraceTxBuffer, -1, nil)
+	}
+	return txs
 }
 
 // loadNonceFromTxs gets the nonce from a TxResults. This only works for the genesis-block.
@@ -2484,6 +2857,9 @@ func (s *Service) TestClose() {
 		s.closedMutex.Unlock()
 		s.cleanupGoroutines()
 		s.working.Wait()
+		if err := s.trieStore.close(); err != nil {
+			log.Error(s.ServerIdentity(), "closing trie storage:", err)
+		}
 	} else {
 		s.closedMutex.Unlock()
 	}
@@ -2495,6 +2871,7 @@ func (s *Service) cleanupGoroutines() {
 	s.closeLeaderMonitorChan <- true
 	s.viewChangeMan.closeAll()
 	s.streamingMan.stopAll()
+	s.pendingDeferredMan.stopAll()
 
 	s.pollChanMut.Lock()
 	for k, c := range s.pollChan {
@@ -2867,10 +3244,20 @@ func newService(c *onet.Context) (onet.Service, error) {
 		defaultVersion:         CurrentVersion,
 		// We need a large enough buffer for all errors in 2 blocks
 		// where each block might be 1 MB in size and each tx is 1 KB.
-		txErrorBuf: newRingBuf(2048),
+		txErrorBuf:        newRingBuf(2048),
+		txTracer:          newTxTracer(defaultTxTraceSize),
+		deferredProposals: newDeferredProposals(),
+		scheduled:         newScheduledIndex(),
+		deferredIdx:       newDeferredIndex(),
 	}
 
-	err := s.RegisterHandlers(
+	var err error
+	s.trieStore, err = newTrieStore(c)
+	if err != nil {
+		return nil, xerrors.Errorf("opening trie storage: %v", err)
+	}
+
+	err = s.RegisterHandlers(
 		s.GetAllByzCoinIDs,
 		s.CreateGenesisBlock,
 		s.AddTransaction,
@@ -2883,13 +3270,41 @@ func newService(c *onet.Context) (onet.Service, error) {
 		s.GetAllInstanceVersion,
 		s.CheckStateChangeValidity,
 		s.ResolveInstanceID,
+		s.ListNames,
+		s.ResolveNames,
+		s.GetLogEntry,
+		s.GetAbsenceProof,
+		s.GetDeletionProof,
+		s.GetStateDiff,
+		s.GetTrieState,
+		s.VerifyRosterConsistency,
+		s.GetChainHealth,
+		s.GetTxTrace,
+		s.ProposeDeferred,
+		s.GetDeferredProposal,
+		s.AddDeferredSignature,
+		s.GetPendingDeferred,
 		s.Debug,
 		s.DebugRemove)
 	if err != nil {
 		return nil, err
 	}
+	err = s.registerJSONHandlers(
+		s.GetAllByzCoinIDs,
+		s.AddTransaction,
+		s.GetProof,
+		s.GetSignerCounters,
+		s.GetInstanceVersion,
+		s.GetLastInstanceVersion,
+		s.GetAllInstanceVersion,
+		s.CheckStateChangeValidity,
+		s.ResolveInstanceID)
+	if err != nil {
+		return nil, xerrors.Errorf("registering JSON handlers: %v", err)
+	}
 
-	if err := s.RegisterStreamingHandlers(s.StreamTransactions, s.PaginateBlocks); err != nil {
+	if err := s.RegisterStreamingHandlers(s.StreamTransactions, s.PaginateBlocks,
+		s.StreamPendingDeferred); err != nil {
 		return nil, xerrors.Errorf("registering handlers: %v", err)
 	}
 	s.RegisterProcessorFunc(viewChangeMsgID, s.handleViewChangeReq)
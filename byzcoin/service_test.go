@@ -2172,6 +2172,66 @@ func TestService_SetBadConfig(t *testing.T) {
 	}
 }
 
+func TestService_UpgradeContract(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	latest, err := s.service().db().GetLatestByID(s.genesis.SkipChainID())
+	require.NoError(t, err)
+
+	// Only the leader supports the new version so the upgrade is dropped.
+	err = s.service().contracts.registerVersion(dummyContract, 1, adaptor(dummyContractV1Func), true)
+	require.NoError(t, err)
+	cv := ContractVersion{ContractID: dummyContract, Version: 1, Index: latest.Index + 10}
+	s.sendTx(t, createUpgradeContractTx(t, s, cv, 2))
+	for i := 0; i < 5; i++ {
+		time.Sleep(s.interval)
+		config, err := s.service().LoadConfig(s.genesis.SkipChainID())
+		require.NoError(t, err)
+		require.Empty(t, config.ContractVersions)
+	}
+
+	for _, service := range s.services[1:] {
+		err = service.contracts.registerVersion(dummyContract, 1, adaptor(dummyContractV1Func), true)
+		require.NoError(t, err)
+	}
+
+	// The upgrade is in the next block and each of the following
+	// transactions creates its own block.
+	cv.Index = latest.Index + 3
+	s.sendTxAndWait(t, createUpgradeContractTx(t, s, cv, 2), 10)
+	config, err := s.service().LoadConfig(s.genesis.SkipChainID())
+	require.NoError(t, err)
+	require.Equal(t, []ContractVersion{cv}, config.ContractVersions)
+
+	tx1, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, 3)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx1, 10)
+	tx2, err := createOneClientTxWithCounter(s.darc.GetBaseID(), dummyContract, s.value, s.signer, 4)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx2, 10)
+
+	pr := s.waitProofWithIdx(t, tx1.Instructions[0].Hash(), 0)
+	_, v0, _, _, err := pr.KeyValue()
+	require.NoError(t, err)
+	require.Equal(t, s.value, v0)
+
+	pr = s.waitProofWithIdx(t, tx2.Instructions[0].Hash(), 0)
+	_, v0, _, _, err = pr.KeyValue()
+	require.NoError(t, err)
+	require.Equal(t, append([]byte("v1:"), s.value...), v0)
+
+	// An upgrade cannot be activated in the past.
+	resp, err := s.service().AddTransaction(&AddTxRequest{
+		Version:       CurrentVersion,
+		SkipchainID:   s.genesis.SkipChainID(),
+		Transaction:   createUpgradeContractTx(t, s, ContractVersion{dummyContract, 1, 1}, 5),
+		InclusionWait: 10,
+	})
+	require.NoError(t, err)
+	require.Contains(t, resp.Error, "activation index")
+}
+
 func TestService_DarcToSc(t *testing.T) {
 	s := newSer(t, 1, testInterval)
 	defer s.local.CloseAll()
@@ -2394,6 +2454,103 @@ func TestService_StateChangeStorage(t *testing.T) {
 	}
 }
 
+func TestService_GetDeletionProof(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	in1 := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte("revoked"))
+	in1.SignerIdentities = []darc.Identity{s.signer.Identity()}
+	in1.SignerCounter = []uint64{1}
+	id := NewInstanceID(in1.Hash())
+	tx, err := combineInstrsAndSign(s.signer, in1)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+
+	// The instance exists so its absence can't be proven.
+	req := &GetDeletionProof{ID: s.genesis.Hash, InstanceID: id}
+	_, err = s.service().GetDeletionProof(req)
+	require.Error(t, err)
+	p, err := s.service().GetProof(&GetProof{Version: CurrentVersion, Key: id.Slice(), ID: s.genesis.Hash})
+	require.NoError(t, err)
+	require.True(t, xerrors.Is(p.Proof.VerifyAbsence(id.Slice()), ErrorKeyPresent))
+	require.NoError(t, p.Proof.VerifyAbsence([]byte("unknown")))
+
+	in2 := Instruction{
+		InstanceID: id,
+		Delete: &Delete{
+			ContractID: dummyContract,
+		},
+		SignerIdentities: []darc.Identity{s.signer.Identity()},
+		SignerCounter:    []uint64{2},
+	}
+	tx, err = combineInstrsAndSign(s.signer, in2)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+
+	resp, err := s.service().GetDeletionProof(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Proof.VerifyFromBlock(s.genesis, id))
+	require.True(t, resp.Proof.Block.Index <= resp.Proof.Absence.Latest.Index)
+	require.Error(t, resp.Proof.VerifyFromBlock(s.genesis, NewInstanceID([]byte("unknown"))))
+
+	// The state changes must match the block.
+	resp.Proof.StateChanges = resp.Proof.StateChanges[1:]
+	require.Error(t, resp.Proof.VerifyFromBlock(s.genesis, id))
+}
+
+func TestService_GetAbsenceProof(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	st, err := s.service().getStateTrie(s.genesis.SkipChainID())
+	require.NoError(t, err)
+	before := st.GetIndex()
+
+	in1 := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte("revoked"))
+	in1.SignerIdentities = []darc.Identity{s.signer.Identity()}
+	in1.SignerCounter = []uint64{1}
+	id := NewInstanceID(in1.Hash())
+	tx, err := combineInstrsAndSign(s.signer, in1)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	spawned := st.GetIndex()
+
+	in2 := Instruction{
+		InstanceID: id,
+		Delete: &Delete{
+			ContractID: dummyContract,
+		},
+		SignerIdentities: []darc.Identity{s.signer.Identity()},
+		SignerCounter:    []uint64{2},
+	}
+	tx, err = combineInstrsAndSign(s.signer, in2)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	latest := st.GetIndex()
+
+	cl := NewClient(s.genesis.SkipChainID(), *s.roster)
+	p, err := cl.GetAbsenceProof(id.Slice(), before)
+	require.NoError(t, err)
+	require.Equal(t, before, p.Proof.Latest.Index)
+	_, err = cl.GetAbsenceProof(id.Slice(), spawned)
+	require.Error(t, err)
+	p, err = cl.GetAbsenceProof(id.Slice(), latest)
+	require.NoError(t, err)
+	require.Equal(t, latest, p.Proof.Latest.Index)
+	_, err = cl.GetAbsenceProof(id.Slice(), latest+1)
+	require.Error(t, err)
+
+	// The proof of an older block holds the instance.
+	resp, err := s.service().GetAbsenceProof(&GetAbsenceProof{
+		ID:    s.genesis.Hash,
+		Key:   id.Slice(),
+		Index: spawned,
+	})
+	require.NoError(t, err)
+	require.NoError(t, resp.Proof.VerifyFromBlock(s.genesis))
+	require.True(t, xerrors.Is(resp.Proof.VerifyAbsence(id.Slice()), ErrorKeyPresent))
+}
+
 // Tests that the state change storage will be caught up by a new conode
 func TestService_StateChangeStorageCatchUp(t *testing.T) {
 	cda := catchupDownloadAll
@@ -2562,6 +2719,28 @@ func createConfigTxWithCounter(t *testing.T, interval time.Duration, roster onet
 	return ctx, config
 }
 
+func createUpgradeContractTx(t *testing.T, s *ser, cv ContractVersion, counter uint64) ClientTransaction {
+	cvBuf, err := protobuf.Encode(&cv)
+	require.NoError(t, err)
+
+	instr := Instruction{
+		InstanceID: ConfigInstanceID,
+		Invoke: &Invoke{
+			ContractID: ContractConfigID,
+			Command:    cmdConfigUpgradeContract,
+			Args: []Argument{{
+				Name:  "version",
+				Value: cvBuf,
+			}},
+		},
+		SignerCounter: []uint64{counter},
+		version:       CurrentVersion,
+	}
+	ctx, err := combineInstrsAndSign(s.signer, instr)
+	require.NoError(t, err)
+	return ctx
+}
+
 func darcToTx(t *testing.T, d2 darc.Darc, signer darc.Signer, ctr uint64) ClientTransaction {
 	d2Buf, err := d2.ToProto()
 	require.NoError(t, err)
@@ -2755,6 +2934,12 @@ func newSerWithVersion(t *testing.T, step int, interval time.Duration, n int, rw
 			"spawn:" + versionContract,
 			"spawn:" + stateChangeCacheContract,
 			"delete:" + dummyContract,
+			"spawn:" + ContractSchedulerID,
+			"invoke:" + ContractSchedulerID + "." + cmdSchedulerCancel,
+			"spawn:" + ContractNamingID,
+			"_name:" + ContractDarcID,
+			"spawn:" + ContractLogID,
+			"invoke:" + ContractLogID + "." + cmdLogAppend,
 		}, s.signer.Identity())
 	require.NoError(t, err)
 	s.darc = &genesisMsg.GenesisDarc
@@ -2879,6 +3064,16 @@ func dummyContractFunc(cdb ReadOnlyStateTrie, inst Instruction, c []Coin) ([]Sta
 	}
 }
 
+// Same as the dummy contract but the values of the spawned instances are
+// prefixed so that the version can be checked.
+func dummyContractV1Func(cdb ReadOnlyStateTrie, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
+	scs, cout, err := dummyContractFunc(cdb, inst, c)
+	if err == nil && inst.GetType() == SpawnType {
+		scs[0].Value = append([]byte("v1:"), scs[0].Value...)
+	}
+	return scs, cout, err
+}
+
 func slowContractFunc(cdb ReadOnlyStateTrie, inst Instruction, c []Coin) ([]StateChange, []Coin, error) {
 	// This has to sleep for less than testInterval / 2 or else it will
 	// block the system from processing txs. See #1359.
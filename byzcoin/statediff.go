@@ -0,0 +1,182 @@
+package byzcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Hash returns the hash of the request, which is signed by the member of the
+// roster sending it.
+func (req *GetStateDiff) Hash() []byte {
+	h := sha256.New()
+	h.Write(req.ID)
+	binary.Write(h, binary.LittleEndian, int64(req.From))
+	binary.Write(h, binary.LittleEndian, int64(req.To))
+	binary.Write(h, binary.LittleEndian, req.Timestamp)
+	return h.Sum(nil)
+}
+
+// GetStateDiff returns the instances which differ between the global states
+// of two blocks. The states of older blocks are rebuilt from the current one
+// by undoing the state changes of the later blocks, and their roots are
+// checked against the ones stored in the blocks, so the history of the state
+// changes must not be pruned. As for GetTrieState, only the members of the
+// roster of the latest block can send the request.
+func (s *Service) GetStateDiff(req *GetStateDiff) (*GetStateDiffResponse, error) {
+	sb := s.db().GetByID(req.ID)
+	if sb == nil {
+		return nil, xerrors.New("cannot find skipblock while getting state diff")
+	}
+	scID := sb.SkipChainID()
+
+	latestSB, err := s.db().GetLatestByID(scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest block: %v", err)
+	}
+	err = verifySignedRequest(req.Hash(), req.Timestamp, req.Signature, latestSB.Roster.Publics())
+	if err != nil {
+		return nil, xerrors.Errorf("refusing request: %v", err)
+	}
+
+	st, err := s.getStateTrie(scID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting trie: %v", err)
+	}
+	latest := st.GetIndex()
+	if req.From < 0 || req.From > req.To || req.To > latest {
+		return nil, xerrors.Errorf("invalid block indexes %d and %d, latest is %d",
+			req.From, req.To, latest)
+	}
+
+	from, err := s.stagingTrieAt(st, scID, req.From, latest)
+	if err != nil {
+		return nil, xerrors.Errorf("rebuilding state of block %d: %v", req.From, err)
+	}
+	to, err := s.stagingTrieAt(st, scID, req.To, latest)
+	if err != nil {
+		return nil, xerrors.Errorf("rebuilding state of block %d: %v", req.To, err)
+	}
+
+	diffs, err := from.Diff(to)
+	if err != nil {
+		return nil, xerrors.Errorf("diff failed: %v", err)
+	}
+
+	resp := &GetStateDiffResponse{Diffs: make([]StateDiff, len(diffs))}
+	for i, d := range diffs {
+		sd := StateDiff{InstanceID: NewInstanceID(d.Key)}
+		if d.Old != nil {
+			body, err := decodeStateChangeBody(d.Old)
+			if err != nil {
+				return nil, xerrors.Errorf("decoding body: %v", err)
+			}
+			sd.Old = &body
+		}
+		if d.New != nil {
+			body, err := decodeStateChangeBody(d.New)
+			if err != nil {
+				return nil, xerrors.Errorf("decoding body: %v", err)
+			}
+			sd.New = &body
+		}
+		resp.Diffs[i] = sd
+	}
+	log.Lvlf2("%s: Returning %d differences between blocks %d and %d",
+		s.ServerIdentity(), len(resp.Diffs), req.From, req.To)
+	return resp, nil
+}
+
+// stagingTrieAt returns a staging trie holding the global state of the block
+// at the index, whose root is checked against the one of the block.
+func (s *Service) stagingTrieAt(st *stateTrie, scID skipchain.SkipBlockID, index, latest int) (*trie.StagingTrie, error) {
+	sst, err := s.rebuildStagingTrie(st, scID, index, latest)
+	if err != nil {
+		return nil, err
+	}
+
+	sb, err := s.skService().GetSingleBlockByIndex(&skipchain.GetSingleBlockByIndex{
+		Genesis: scID,
+		Index:   index,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("getting block: %v", err)
+	}
+	header, err := decodeBlockHeader(sb.SkipBlock)
+	if err != nil {
+		return nil, xerrors.Errorf("decoding header: %v", err)
+	}
+	if !bytes.Equal(sst.GetRoot(), header.TrieRoot) {
+		return nil, xerrors.New("rebuilt state doesn't match the block, " +
+			"the state changes might have been pruned")
+	}
+	return sst, nil
+}
+
+// rebuildStagingTrie returns a staging trie holding the global state of the
+// node at the block at the index, built by undoing the state changes of the
+// blocks after it up to the latest one.
+func (s *Service) rebuildStagingTrie(st *stateTrie, scID skipchain.SkipBlockID, index, latest int) (*trie.StagingTrie, error) {
+	// The instances changed after the block, in a deterministic order.
+	var iids []InstanceID
+	seen := make(map[InstanceID]bool)
+	for idx := index + 1; idx <= latest; idx++ {
+		sces, err := s.stateChangeStorage.getByBlock(scID, idx)
+		if err != nil {
+			return nil, xerrors.Errorf("getting state changes: %v", err)
+		}
+		for _, sce := range sces {
+			iid := NewInstanceID(sce.StateChange.InstanceID)
+			if !seen[iid] {
+				seen[iid] = true
+				iids = append(iids, iid)
+			}
+		}
+	}
+
+	undo := make(StateChanges, 0, len(iids))
+	for _, iid := range iids {
+		sc, err := s.stateChangeAt(iid, scID, index)
+		if err != nil {
+			return nil, xerrors.Errorf("instance %x: %v", iid[:], err)
+		}
+		undo = append(undo, sc)
+	}
+
+	sst := st.MakeStagingTrie()
+	pairs := make([]trie.KVPair, len(undo))
+	for i := range pairs {
+		pairs[i] = &undo[i]
+	}
+	if err := sst.Batch(pairs); err != nil {
+		return nil, xerrors.Errorf("batch failed: %v", err)
+	}
+	return sst, nil
+}
+
+// stateChangeAt returns the state change which sets the instance as it was in
+// the global state of the block at the index, or removes it if it didn't
+// exist yet.
+func (s *Service) stateChangeAt(iid InstanceID, scID skipchain.SkipBlockID, index int) (StateChange, error) {
+	sces, err := s.stateChangeStorage.getAll(iid[:], scID)
+	if err != nil {
+		return StateChange{}, xerrors.Errorf("getting state changes: %v", err)
+	}
+	if len(sces) == 0 {
+		return StateChange{}, xerrors.New("no state change in the history")
+	}
+	for i := len(sces) - 1; i >= 0; i-- {
+		if sces[i].BlockIndex <= index {
+			return sces[i].StateChange.Copy(), nil
+		}
+	}
+	if sces[0].StateChange.Version != 0 {
+		return StateChange{}, xerrors.New("the earliest state changes have been pruned")
+	}
+	return StateChange{StateAction: Remove, InstanceID: iid.Slice()}, nil
+}
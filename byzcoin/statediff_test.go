@@ -0,0 +1,87 @@
+package byzcoin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestService_GetStateDiff(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	st, err := s.service().getStateTrie(s.genesis.SkipChainID())
+	require.NoError(t, err)
+
+	in1 := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte("first"))
+	in1.SignerIdentities = []darc.Identity{s.signer.Identity()}
+	in1.SignerCounter = []uint64{1}
+	id1 := NewInstanceID(in1.Hash())
+	tx, err := combineInstrsAndSign(s.signer, in1)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	spawned := st.GetIndex()
+
+	in2 := createSpawnInstr(s.darc.GetBaseID(), dummyContract, "data", []byte("second"))
+	in2.SignerIdentities = []darc.Identity{s.signer.Identity()}
+	in2.SignerCounter = []uint64{2}
+	id2 := NewInstanceID(in2.Hash())
+	in3 := Instruction{
+		InstanceID: id1,
+		Delete: &Delete{
+			ContractID: dummyContract,
+		},
+		SignerIdentities: []darc.Identity{s.signer.Identity()},
+		SignerCounter:    []uint64{3},
+	}
+	tx, err = combineInstrsAndSign(s.signer, in2, in3)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	latest := st.GetIndex()
+
+	cl := NewClient(s.genesis.SkipChainID(), *s.roster)
+	private := s.service().getPrivateKey()
+	diffs := func(from, to int) map[InstanceID]StateDiff {
+		resp, err := cl.GetStateDiff(from, to, private)
+		require.NoError(t, err)
+		m := make(map[InstanceID]StateDiff)
+		for _, d := range resp.Diffs {
+			m[d.InstanceID] = d
+		}
+		return m
+	}
+
+	require.Empty(t, diffs(latest, latest))
+
+	d := diffs(0, spawned)
+	require.Nil(t, d[id1].Old)
+	require.Equal(t, []byte("first"), d[id1].New.Value)
+	require.NotContains(t, d, id2)
+
+	d = diffs(spawned, latest)
+	require.Equal(t, []byte("first"), d[id1].Old.Value)
+	require.Nil(t, d[id1].New)
+	require.Nil(t, d[id2].Old)
+	require.Equal(t, []byte("second"), d[id2].New.Value)
+	require.Equal(t, dummyContract, d[id2].New.ContractID)
+
+	// The instance spawned and removed between the blocks is not a
+	// difference.
+	d = diffs(0, latest)
+	require.NotContains(t, d, id1)
+	require.Contains(t, d, id2)
+
+	_, err = cl.GetStateDiff(latest, spawned, private)
+	require.Error(t, err)
+	_, err = cl.GetStateDiff(0, latest+1, private)
+	require.Error(t, err)
+
+	// Only the members of the roster can rebuild the old states.
+	_, err = s.service().GetStateDiff(&GetStateDiff{ID: s.genesis.Hash, From: 0, To: latest})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "refusing request")
+	_, err = cl.GetStateDiff(0, latest, cothority.Suite.Scalar().Pick(cothority.Suite.RandomStream()))
+	require.Error(t, err)
+}
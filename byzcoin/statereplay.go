@@ -11,6 +11,7 @@ import (
 	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/onet/v3"
 	"go.dedis.ch/onet/v3/log"
@@ -23,6 +24,9 @@ type BlockFetcherFunc func(sib skipchain.SkipBlockID) (*skipchain.SkipBlock, err
 
 // BlockFetcher is an interface that can be passed to ReplayStateLog so that
 // the output of the replay can be adapted to what the user wants.
+// BlockFetcherFunc is called in the background to fetch the next blocks
+// while the current one is applied, the other methods are called in the
+// order of the blocks.
 type BlockFetcher interface {
 	BlockFetcherFunc(sid skipchain.SkipBlockID) (*skipchain.SkipBlock, error)
 	LogNewBlock(sb *skipchain.SkipBlock)
@@ -30,6 +34,34 @@ type BlockFetcher interface {
 	LogWarn(sb *skipchain.SkipBlock, msg, dump string)
 }
 
+// ReplayCheckpointer can be implemented by a BlockFetcher to choose how
+// often the replay writes a checkpoint.
+type ReplayCheckpointer interface {
+	// CheckpointInterval returns the number of blocks between two
+	// checkpoints.
+	CheckpointInterval() int
+	// LogCheckpoint is called once a checkpoint is written.
+	LogCheckpoint(cp ReplayCheckpoint)
+}
+
+// ReplayCheckpoint is written to the global state of a replay created by
+// ReplayStateDB, with all the blocks applied since the previous one, so that
+// an interrupted replay can continue from it.
+type ReplayCheckpoint struct {
+	// Index is the index of the latest block applied.
+	Index int
+	// BlockID is the ID of the latest block applied.
+	BlockID skipchain.SkipBlockID
+	// TrieRoot is the root of the global state after the block.
+	TrieRoot []byte
+}
+
+// replayCheckpointKey is the metadata key of the latest checkpoint.
+const replayCheckpointKey = "replayCheckpoint"
+
+// replayPrefetch is the number of blocks fetched in advance during a replay.
+const replayPrefetch = 64
+
 func replayError(sb *skipchain.SkipBlock, err error) error {
 	return cothority.ErrorOrNilSkip(err, fmt.Sprintf("replay failed in block at index %d with message", sb.Index), 2)
 }
@@ -52,13 +84,19 @@ func (s *Service) ReplayStateDB(db *bbolt.DB, bucket []byte,
 	if len(s.stateTries) == 0 {
 		s.stateTries = make(map[string]*stateTrie)
 	}
+	// The global state is only stored at the checkpoints.
+	bdb := trie.NewBufferedDB(trie.NewDiskDB(db, bucket))
 	var st *stateTrie
 	if genesis == nil {
 		var err error
-		st, err = loadStateTrie(db, bucket)
+		st, err = loadStateTrie(bdb)
 		if err != nil {
 			return 0, xerrors.Errorf("couldn't load state trie: %+v", err)
 		}
+		err = verifyReplayCheckpoint(st)
+		if err != nil {
+			return 0, xerrors.Errorf("invalid checkpoint: %v", err)
+		}
 	} else {
 		var dBody DataBody
 		err := protobuf.Decode(genesis.Payload, &dBody)
@@ -69,10 +107,14 @@ func (s *Service) ReplayStateDB(db *bbolt.DB, bucket []byte,
 		if err != nil {
 			return 0, xerrors.Errorf("couldn't get nonce: %+v", err)
 		}
-		st, err = newStateTrie(db, bucket, nonce)
+		st, err = newStateTrie(bdb, nonce)
 		if err != nil {
 			return 0, xerrors.Errorf("couldn't get new state trie: %+v", err)
 		}
+		err = bdb.Flush()
+		if err != nil {
+			return 0, xerrors.Errorf("couldn't store state trie: %+v", err)
+		}
 	}
 	s.stateTries[replayTrie] = st
 	return st.GetIndex(), nil
@@ -106,7 +148,21 @@ func (s *Service) ReplayStateContLog(id skipchain.SkipBlockID,
 			" index %d", sb.Index, st.GetIndex()+1)
 	}
 
-	for sb != nil {
+	interval := 1
+	cpr, ok := bf.(ReplayCheckpointer)
+	if ok && cpr.CheckpointInterval() > 1 {
+		interval = cpr.CheckpointInterval()
+	}
+	var last *skipchain.SkipBlock
+	pending := 0
+
+	done := make(chan struct{})
+	defer close(done)
+	for next := range prefetchBlocks(sb, bf, done) {
+		if next.err != nil {
+			return nil, xerrors.Errorf("replay failed to get the next block: %v", next.err)
+		}
+		sb = next.sb
 		bf.LogNewBlock(sb)
 
 		if sb.Payload != nil {
@@ -202,21 +258,115 @@ func (s *Service) ReplayStateContLog(id skipchain.SkipBlockID,
 				return nil, replayError(sb, err)
 			}
 			bf.LogAppliedBlock(sb, dHead, dBody)
+
+			last = sb
+			pending++
+			if pending >= interval {
+				err = writeReplayCheckpoint(st, last, cpr)
+				if err != nil {
+					return nil, replayError(sb, err)
+				}
+				pending = 0
+			}
 		}
+	}
 
-		if len(sb.ForwardLink) > 0 {
+	if pending > 0 {
+		err = writeReplayCheckpoint(st, last, cpr)
+		if err != nil {
+			return nil, replayError(last, err)
+		}
+	}
+	return st, nil
+}
+
+type replayBlock struct {
+	sb  *skipchain.SkipBlock
+	err error
+}
+
+// prefetchBlocks sends sb and the blocks following it, fetched in the
+// background so that the next blocks are fetched while the current one is
+// applied. It stops after the last block, after an error or once done is
+// closed.
+func prefetchBlocks(sb *skipchain.SkipBlock, bf BlockFetcher, done <-chan struct{}) <-chan replayBlock {
+	blocks := make(chan replayBlock, replayPrefetch)
+	go func() {
+		defer close(blocks)
+		for sb != nil {
+			select {
+			case blocks <- replayBlock{sb: sb}:
+			case <-done:
+				return
+			}
+			if len(sb.ForwardLink) == 0 {
+				return
+			}
 			// The level 0 forward link must be used as we need to rebuild the global
 			// states for each block.
+			var err error
 			sb, err = bf.BlockFetcherFunc(sb.ForwardLink[0].To)
 			if err != nil {
-				return nil, xerrors.Errorf("replay failed to get the next block: %v", err)
+				select {
+				case blocks <- replayBlock{err: err}:
+				case <-done:
+				}
+				return
 			}
-		} else {
-			sb = nil
 		}
+	}()
+	return blocks
+}
+
+// writeReplayCheckpoint stores the checkpoint of the latest block applied
+// with the blocks applied since the previous checkpoint.
+func writeReplayCheckpoint(st *stateTrie, sb *skipchain.SkipBlock, cpr ReplayCheckpointer) error {
+	cp := ReplayCheckpoint{
+		Index:    sb.Index,
+		BlockID:  sb.Hash,
+		TrieRoot: st.GetRoot(),
+	}
+	buf, err := protobuf.Encode(&cp)
+	if err != nil {
+		return xerrors.Errorf("encoding checkpoint: %v", err)
+	}
+	err = st.SetMetadata([]byte(replayCheckpointKey), buf)
+	if err != nil {
+		return xerrors.Errorf("storing checkpoint: %v", err)
 	}
+	if bdb, ok := st.DB().(*trie.BufferedDB); ok {
+		err = bdb.Flush()
+		if err != nil {
+			return xerrors.Errorf("flushing checkpoint: %v", err)
+		}
+	}
+	if cpr != nil {
+		cpr.LogCheckpoint(cp)
+	}
+	return nil
+}
 
-	return st, nil
+// verifyReplayCheckpoint makes sure that the global state of a replay is the
+// one of its latest checkpoint, if it has one.
+func verifyReplayCheckpoint(st *stateTrie) error {
+	buf := st.GetMetadata([]byte(replayCheckpointKey))
+	if buf == nil {
+		return nil
+	}
+	var cp ReplayCheckpoint
+	err := protobuf.Decode(buf, &cp)
+	if err != nil {
+		return xerrors.Errorf("decoding checkpoint: %v", err)
+	}
+	if cp.Index != st.GetIndex() {
+		return xerrors.Errorf("checkpoint of block %d but state of block %d",
+			cp.Index, st.GetIndex())
+	}
+	if !bytes.Equal(cp.TrieRoot, st.GetRoot()) {
+		return xerrors.New("state doesn't match the checkpoint")
+	}
+	log.Lvlf2("Continuing replay from checkpoint of block %d", cp.Index)
+	return nil
 }
 
 // ReplayStateCont is a wrapper over ReplayStateContLog and outputs every
@@ -1,11 +1,16 @@
 package byzcoin
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/protobuf"
+	"go.etcd.io/bbolt"
 	"golang.org/x/xerrors"
 )
 
@@ -37,6 +42,91 @@ func TestService_StateReplay(t *testing.T) {
 	require.Equal(t, 2, st.GetIndex())
 }
 
+type checkpointFetcher struct {
+	stdFetcher
+	interval    int
+	checkpoints []ReplayCheckpoint
+}
+
+func (cf *checkpointFetcher) CheckpointInterval() int {
+	return cf.interval
+}
+
+func (cf *checkpointFetcher) LogCheckpoint(cp ReplayCheckpoint) {
+	cf.checkpoints = append(cf.checkpoints, cp)
+}
+
+// Test that a replay writes checkpoints and can continue from them
+func TestService_StateReplayCheckpoints(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	n := 3
+	for i := 0; i < n; i++ {
+		tx, err := createClientTxWithTwoInstrWithCounter(s.darc.GetBaseID(), dummyContract, []byte{}, s.signer, uint64(i*2+1))
+		require.NoError(t, err)
+		s.sendTxAndWait(t, tx, 10)
+	}
+
+	dir, err := ioutil.TempDir("", "replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bbolt.Open(filepath.Join(dir, "replay.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	bucket := []byte("replay")
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket(bucket)
+		return err
+	}))
+
+	// The first replay is interrupted after the block at index 2.
+	stop := 2
+	cb := func(sib skipchain.SkipBlockID) (*skipchain.SkipBlock, error) {
+		sb, err := s.service().skService().GetSingleBlock(&skipchain.GetSingleBlock{ID: sib})
+		if err != nil || sb.Index > stop {
+			return nil, err
+		}
+		return sb, nil
+	}
+	_, err = s.service().ReplayStateDB(db, bucket, s.genesis)
+	require.NoError(t, err)
+	cf := &checkpointFetcher{stdFetcher: stdFetcher{cb}, interval: 2}
+	st, err := s.service().ReplayStateContLog(s.genesis.Hash, cf)
+	require.NoError(t, err)
+	require.Equal(t, stop, st.GetIndex())
+	require.Len(t, cf.checkpoints, 2)
+	require.Equal(t, 1, cf.checkpoints[0].Index)
+	require.Equal(t, stop, cf.checkpoints[1].Index)
+	require.Equal(t, st.(*stateTrie).GetRoot(), cf.checkpoints[1].TrieRoot)
+
+	// The replay continues from the stored checkpoint.
+	stop = n
+	index, err := s.service().ReplayStateDB(db, bucket, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, index)
+	next, err := s.service().skService().GetSingleBlockByIndex(&skipchain.GetSingleBlockByIndex{
+		Genesis: s.genesis.Hash,
+		Index:   index + 1,
+	})
+	require.NoError(t, err)
+	cf = &checkpointFetcher{stdFetcher: stdFetcher{cb}, interval: 2}
+	st, err = s.service().ReplayStateContLog(next.SkipBlock.Hash, cf)
+	require.NoError(t, err)
+	require.Equal(t, n, st.GetIndex())
+	require.Len(t, cf.checkpoints, 1)
+	require.Equal(t, next.SkipBlock.Hash, cf.checkpoints[0].BlockID)
+
+	// A state which is not the one of its checkpoint is refused.
+	stored, err := loadStateTrie(trie.NewDiskDB(db, bucket))
+	require.NoError(t, err)
+	buf, err := protobuf.Encode(&ReplayCheckpoint{Index: 1})
+	require.NoError(t, err)
+	require.NoError(t, stored.SetMetadata([]byte(replayCheckpointKey), buf))
+	_, err = s.service().ReplayStateDB(db, bucket, nil)
+	require.Error(t, err)
+}
+
 func tryReplay(t *testing.T, s *ser, cb BlockFetcherFunc, msg string) {
 	_, err := s.service().ReplayState(s.genesis.Hash, s.roster, cb)
 	require.Error(t, err)
@@ -14,6 +14,12 @@ import (
 
 var errKeyNotSet = xerrors.New("key not set")
 
+// IsKeyNotSet returns true if the error comes from reading a key that is not
+// in the trie.
+func IsKeyNotSet(err error) bool {
+	return xerrors.Is(err, errKeyNotSet)
+}
+
 // GlobalState is used to query for any data in byzcoin.
 type GlobalState interface {
 	ReadOnlyStateTrie
@@ -61,6 +67,10 @@ var _ GlobalState = (*globalState)(nil)
 // byzcoin.
 type stagingStateTrie struct {
 	trie.StagingTrie
+	// active caches the contract versions active in the block following
+	// activeIndex, as a block cannot change them.
+	active      map[string]int
+	activeIndex int
 }
 
 // Clone makes a copy of the staged data of the structure, the source Trie is
@@ -68,6 +78,8 @@ type stagingStateTrie struct {
 func (t *stagingStateTrie) Clone() *stagingStateTrie {
 	return &stagingStateTrie{
 		StagingTrie: *t.StagingTrie.Clone(),
+		active:      t.active,
+		activeIndex: t.activeIndex,
 	}
 }
 
@@ -148,8 +160,8 @@ type stateTrie struct {
 
 // loadStateTrie loads an existing StateTrie, an error is returned if no trie
 // exists in db
-func loadStateTrie(db *bbolt.DB, bucket []byte) (*stateTrie, error) {
-	t, err := trie.LoadTrie(trie.NewDiskDB(db, bucket))
+func loadStateTrie(db trie.DB) (*stateTrie, error) {
+	t, err := trie.LoadTrie(db)
 	if err != nil {
 		return nil, xerrors.Errorf("loading trie: %v", err)
 	}
@@ -158,8 +170,8 @@ func loadStateTrie(db *bbolt.DB, bucket []byte) (*stateTrie, error) {
 
 // newStateTrie creates a new, disk-based trie.Trie, an error is returned if
 // the db already contains a trie.
-func newStateTrie(db *bbolt.DB, bucket, nonce []byte) (*stateTrie, error) {
-	t, err := trie.NewTrie(trie.NewDiskDB(db, bucket), nonce)
+func newStateTrie(db trie.DB, nonce []byte) (*stateTrie, error) {
+	t, err := trie.NewTrie(db, nonce)
 	if err != nil {
 		return nil, xerrors.Errorf("creating trie: %v", err)
 	}
@@ -47,6 +47,8 @@ func TestStateTrie(t *testing.T) {
 
 	_, _, _, _, err = st.GetValues(append(key, byte(0)))
 	require.True(t, xerrors.Is(err, errKeyNotSet))
+	require.True(t, IsKeyNotSet(xerrors.Errorf("wrapped: %w", err)))
+	require.False(t, IsKeyNotSet(xerrors.New("other")))
 
 	val, ver, cid, did, err := st.GetValues(key)
 	require.Equal(t, value, val)
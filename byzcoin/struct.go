@@ -677,6 +677,60 @@ func (c ChainConfig) checkNewRoster(newRoster onet.Roster) error {
 	return nil
 }
 
+// checkContractUpgrade makes sure that the upgrade can be accepted in the
+// block with the given index:
+//   - the upgrade is activated in a later block
+//   - the version is higher than any version previously accepted for the
+//     contract
+func (c ChainConfig) checkContractUpgrade(cv ContractVersion, index int) error {
+	if cv.ContractID == "" {
+		return xerrors.New("missing contract ID")
+	}
+	if cv.Version <= 0 {
+		return xerrors.New("version must be strictly positive")
+	}
+	if cv.Index <= index {
+		return xerrors.Errorf("activation index %d must be higher than the current block index %d",
+			cv.Index, index)
+	}
+	for _, old := range c.ContractVersions {
+		if old.ContractID == cv.ContractID && old.Version >= cv.Version {
+			return xerrors.Errorf("version %d of %s is already accepted", old.Version, cv.ContractID)
+		}
+	}
+	return nil
+}
+
+// activeContractVersions returns the version of each upgraded contract that
+// must be used to execute the instructions of the block with the given index.
+// The contracts that are not in the map use the version 0.
+func (c ChainConfig) activeContractVersions(index int) map[string]int {
+	active := make(map[string]int)
+	for _, cv := range c.ContractVersions {
+		if cv.Index <= index && cv.Version > active[cv.ContractID] {
+			active[cv.ContractID] = cv.Version
+		}
+	}
+	return active
+}
+
+func contractVersionsEqual(a, b []ContractVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns a human readable representation of the contract version.
+func (cv ContractVersion) String() string {
+	return fmt.Sprintf("%s version %d from block %d", cv.ContractID, cv.Version, cv.Index)
+}
+
 // String implements a nicer text representation of a Chainconfig.
 //
 // Here is an example of what it outputs:
@@ -701,5 +755,11 @@ func (c ChainConfig) String() string {
 	for i, darcID := range c.DarcContractIDs {
 		fmt.Fprintf(res, "--- darc contract ID %d: %s\n", i, darcID)
 	}
+	if len(c.ContractVersions) > 0 {
+		res.WriteString("-- ContractVersions:\n")
+		for _, cv := range c.ContractVersions {
+			fmt.Fprintf(res, "--- %s\n", cv)
+		}
+	}
 	return res.String()
 }
@@ -678,6 +678,8 @@ func (r *txBuffer) take(key string, max int) []ClientTransaction {
 	ret := make([]ClientTransaction, out)
 	copy(ret, txs)
 
+	metricTxBuffer.Add(-float64(out))
+
 	if out == max {
 		// Keep the overflow for the next collection.
 		r.txsMap[key] = txs[max:]
@@ -688,12 +690,22 @@ func (r *txBuffer) take(key string, max int) []ClientTransaction {
 	return ret
 }
 
+// count returns the number of transactions waiting in the buffer for the
+// given key.
+func (r *txBuffer) count(key string) int {
+	r.Lock()
+	defer r.Unlock()
+
+	return len(r.txsMap[key])
+}
+
 func (r *txBuffer) add(key string, newTx ClientTransaction) {
 	r.Lock()
 	defer r.Unlock()
 
 	if txs, ok := r.txsMap[key]; !ok {
 		r.txsMap[key] = []ClientTransaction{newTx}
+		metricTxBuffer.Add(1)
 	} else {
 		if len(txs) >= defaultMaxBufferSize {
 			// Drop transactions if the buffer is full. We cannot drop earlier
@@ -704,5 +716,6 @@ func (r *txBuffer) add(key string, newTx ClientTransaction) {
 
 		txs = append(txs, newTx)
 		r.txsMap[key] = txs
+		metricTxBuffer.Add(1)
 	}
 }
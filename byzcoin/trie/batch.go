@@ -0,0 +1,119 @@
+package trie
+
+import "sort"
+
+// batchBucket buffers the writes of the trie to a bucket, so that the nodes
+// written and deleted again during a batch, like the interior nodes close to
+// the root, never reach the storage. The remaining writes are applied sorted
+// by key by flush, which is what the storages handle best.
+//
+// It relies on the trie putting a node only if it is not stored yet, as the
+// nodes are stored under their hash: a key whose first write of the batch is
+// a Put is not in the bucket, so if it is deleted afterwards, the batch can
+// forget about it.
+type batchBucket struct {
+	b Bucket
+	// writes maps the keys to their new value, or to nil if they are
+	// deleted.
+	writes map[string][]byte
+	// created holds the keys whose first write is a Put. It is nil for the
+	// overlays, which make no assumption about the writes.
+	created map[string]bool
+}
+
+func newBatchBucket(b Bucket) *batchBucket {
+	return &batchBucket{
+		b:       b,
+		writes:  make(map[string][]byte),
+		created: make(map[string]bool),
+	}
+}
+
+// newOverlayBucket returns a batchBucket that can be used for any writes, as
+// it keeps all the deletions. It gives the read-your-writes view of a
+// transaction over a read-only bucket.
+func newOverlayBucket(b Bucket) *batchBucket {
+	return &batchBucket{
+		b:      b,
+		writes: make(map[string][]byte),
+	}
+}
+
+func (r *batchBucket) Delete(k []byte) error {
+	if r.created[string(k)] {
+		delete(r.writes, string(k))
+		delete(r.created, string(k))
+		return nil
+	}
+	r.writes[string(k)] = nil
+	return nil
+}
+
+// Put buffers the write, as for the other buckets the value must remain valid
+// during the transaction.
+func (r *batchBucket) Put(k, v []byte) error {
+	if v == nil {
+		v = []byte{}
+	}
+	if _, ok := r.writes[string(k)]; !ok && r.created != nil {
+		r.created[string(k)] = true
+	}
+	r.writes[string(k)] = v
+	return nil
+}
+
+func (r *batchBucket) Get(k []byte) []byte {
+	if v, ok := r.writes[string(k)]; ok {
+		return v
+	}
+	return r.b.Get(k)
+}
+
+func (r *batchBucket) ForEach(f func(k, v []byte) error) error {
+	err := r.b.ForEach(func(k, v []byte) error {
+		if _, ok := r.writes[string(k)]; ok {
+			return nil
+		}
+		return f(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range r.sortedKeys() {
+		if v := r.writes[k]; v != nil {
+			if err := f([]byte(k), v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush applies the buffered writes to the bucket.
+func (r *batchBucket) flush() error {
+	for _, k := range r.sortedKeys() {
+		var err error
+		if v := r.writes[k]; v == nil {
+			err = r.b.Delete([]byte(k))
+		} else {
+			err = r.b.Put([]byte(k), v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.writes = make(map[string][]byte)
+	if r.created != nil {
+		r.created = make(map[string]bool)
+	}
+	return nil
+}
+
+func (r *batchBucket) sortedKeys() []string {
+	keys := make([]string, 0, len(r.writes))
+	for k := range r.writes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,156 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchBucket(t *testing.T) {
+	db := NewMemDB()
+	defer db.Close()
+
+	err := db.Update(func(b Bucket) error {
+		require.NoError(t, b.Put([]byte("a"), []byte("a")))
+		require.NoError(t, b.Put([]byte("b"), []byte("b")))
+
+		batch := newBatchBucket(b)
+		require.NoError(t, batch.Put([]byte("c"), []byte("c")))
+		require.NoError(t, batch.Put([]byte("d"), nil))
+		require.NoError(t, batch.Delete([]byte("a")))
+
+		// The writes are only visible through the batch.
+		require.Nil(t, batch.Get([]byte("a")))
+		require.Equal(t, []byte("c"), batch.Get([]byte("c")))
+		require.NotNil(t, batch.Get([]byte("d")))
+		require.Equal(t, []byte("a"), b.Get([]byte("a")))
+		require.Nil(t, b.Get([]byte("c")))
+
+		kvs := make(map[string]string)
+		require.NoError(t, batch.ForEach(func(k, v []byte) error {
+			kvs[string(k)] = string(v)
+			return nil
+		}))
+		require.Equal(t, map[string]string{"b": "b", "c": "c", "d": ""}, kvs)
+
+		require.NoError(t, batch.flush())
+		require.Nil(t, b.Get([]byte("a")))
+		require.Equal(t, []byte("c"), b.Get([]byte("c")))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestBatch(t *testing.T) {
+	testMemAndDisk(t, testBatch)
+}
+
+func testBatch(t *testing.T, db DB) {
+	nonce := genNonce()
+	testTrie, err := NewTrie(db, nonce)
+	require.NoError(t, err)
+	mem := NewMemDB()
+	defer mem.Close()
+	memTrie, err := NewTrie(mem, nonce)
+	require.NoError(t, err)
+
+	// The batch gives the same trie as the operations done one by one,
+	// including when a key is set and deleted in the same batch.
+	var pairs []KVPair
+	for i := 0; i < 50; i++ {
+		k := []byte(fmt.Sprintf("key%d", i))
+		pairs = append(pairs, kvPair{OpSet, k, k})
+	}
+	for i := 0; i < 50; i += 3 {
+		pairs = append(pairs, kvPair{OpDel, []byte(fmt.Sprintf("key%d", i)), nil})
+	}
+	pairs = append(pairs, kvPair{OpSet, []byte("key1"), []byte("new value")})
+	require.NoError(t, testTrie.Batch(pairs))
+	for _, p := range pairs {
+		if p.Op() == OpSet {
+			require.NoError(t, memTrie.Set(p.Key(), p.Val()))
+		} else {
+			require.NoError(t, memTrie.Delete(p.Key()))
+		}
+	}
+
+	require.Equal(t, memTrie.GetRoot(), testTrie.GetRoot())
+	require.NoError(t, testTrie.IsValid())
+	val, err := testTrie.Get([]byte("key1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("new value"), val)
+	val, err = testTrie.Get([]byte("key3"))
+	require.NoError(t, err)
+	require.Nil(t, val)
+}
+
+// benchDBs are the storages on which the benchmarks are run.
+var benchDBs = []struct {
+	name  string
+	open  func(testing.TB) DB
+	close func(testing.TB, DB)
+}{
+	{"bbolt", newDiskDB, delDiskDB},
+	{"leveldb", newLevelDB, delLevelDB},
+}
+
+// BenchmarkBatch compares the commit of a block of state changes done one
+// by one without the node cache, as it was done before, and done with Batch.
+func BenchmarkBatch(b *testing.B) {
+	single := func(tr *Trie, pairs []KVPair) error {
+		return tr.DB().Update(func(bucket Bucket) error {
+			for _, p := range pairs {
+				if err := tr.SetWithBucket(p.Key(), p.Val(), bucket); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	batch := func(tr *Trie, pairs []KVPair) error {
+		return tr.Batch(pairs)
+	}
+
+	for _, bdb := range benchDBs {
+		b.Run(bdb.name+"/single", func(b *testing.B) {
+			benchmarkBatch(b, bdb.open, bdb.close, 0, single)
+		})
+		b.Run(bdb.name+"/batch", func(b *testing.B) {
+			benchmarkBatch(b, bdb.open, bdb.close, DefaultCacheSize, batch)
+		})
+	}
+}
+
+func benchmarkBatch(b *testing.B, open func(testing.TB) DB, close func(testing.TB, DB),
+	cacheSize int, commit func(*Trie, []KVPair) error) {
+	db := open(b)
+	defer close(b, db)
+	testTrie, err := NewTrie(db, genNonce())
+	require.NoError(b, err)
+	testTrie.SetCacheSize(cacheSize)
+	fillBenchTrie(b, testTrie)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pairs := make([]KVPair, 100)
+		for j := range pairs {
+			k := []byte(fmt.Sprintf("block%d-%d", i, j))
+			pairs[j] = kvPair{OpSet, k, k}
+		}
+		require.NoError(b, commit(testTrie, pairs))
+	}
+}
+
+// fillBenchTrie adds 10000 keys to the trie, so that it has the depth of the
+// global state of a busy chain.
+func fillBenchTrie(b *testing.B, testTrie *Trie) {
+	for i := 0; i < 100; i++ {
+		pairs := make([]KVPair, 100)
+		for j := range pairs {
+			k := []byte(fmt.Sprintf("key%d-%d", i, j))
+			pairs[j] = kvPair{OpSet, k, k}
+		}
+		require.NoError(b, testTrie.Batch(pairs))
+	}
+}
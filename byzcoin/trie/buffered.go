@@ -0,0 +1,93 @@
+package trie
+
+import "sync"
+
+// BufferedDB keeps the writes of the transactions to a database in memory
+// until Flush is called, which commits them all in a single transaction. The
+// database is then only modified by Flush, so it always holds the state of
+// one of the flushes, even if the process is interrupted. It is meant for
+// the tries which are written much more often than they need to be stored,
+// like when replaying a chain.
+type BufferedDB struct {
+	db DB
+	sync.RWMutex
+	// writes and created are those of a batchBucket over the buckets of
+	// the transactions of db.
+	writes  map[string][]byte
+	created map[string]bool
+}
+
+// NewBufferedDB creates a database buffering the writes to db.
+func NewBufferedDB(db DB) *BufferedDB {
+	return &BufferedDB{
+		db:      db,
+		writes:  make(map[string][]byte),
+		created: make(map[string]bool),
+	}
+}
+
+// pending returns a batch holding the buffered writes over the bucket.
+func (r *BufferedDB) pending(b Bucket) *batchBucket {
+	return &batchBucket{b: b, writes: r.writes, created: r.created}
+}
+
+// Update executes the function in a transaction whose writes are added to the
+// buffered ones if no error is returned.
+func (r *BufferedDB) Update(f func(Bucket) error) error {
+	r.Lock()
+	defer r.Unlock()
+	return r.db.View(func(b Bucket) error {
+		tx := newBatchBucket(r.pending(b))
+		if err := f(tx); err != nil {
+			return err
+		}
+		return tx.flush()
+	})
+}
+
+// View executes the function in a read-only transaction which sees the
+// buffered writes.
+func (r *BufferedDB) View(f func(Bucket) error) error {
+	r.RLock()
+	defer r.RUnlock()
+	return r.db.View(func(b Bucket) error {
+		// The writes are discarded, so the buffered ones can be shared.
+		return f(newBatchBucket(r.pending(b)))
+	})
+}
+
+// UpdateDryRun is similar to Update but the writes are discarded.
+func (r *BufferedDB) UpdateDryRun(f func(Bucket) error) error {
+	return r.View(f)
+}
+
+// Flush commits the buffered writes to the database.
+func (r *BufferedDB) Flush() error {
+	r.Lock()
+	defer r.Unlock()
+	err := r.db.Update(func(b Bucket) error {
+		return r.pending(b).flush()
+	})
+	if err != nil {
+		return err
+	}
+	r.writes = make(map[string][]byte)
+	r.created = make(map[string]bool)
+	return nil
+}
+
+// Pending returns the number of buffered writes.
+func (r *BufferedDB) Pending() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.writes)
+}
+
+// Close closes the database, the writes which are not flushed are lost.
+func (r *BufferedDB) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	r.writes = make(map[string][]byte)
+	r.created = make(map[string]bool)
+	return r.db.Close()
+}
@@ -0,0 +1,72 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestBufferedDB(t *testing.T) {
+	testMemAndDisk(t, testBufferedDB)
+}
+
+func testBufferedDB(t *testing.T, db DB) {
+	count := func() int {
+		n := 0
+		require.NoError(t, db.View(func(b Bucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				n++
+				return nil
+			})
+		}))
+		return n
+	}
+
+	bdb := NewBufferedDB(db)
+	testTrie, err := NewTrie(bdb, genNonce())
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		k := []byte(fmt.Sprintf("key%d", i))
+		require.NoError(t, testTrie.Set(k, k))
+	}
+	require.Equal(t, 0, count())
+	require.NotEqual(t, 0, bdb.Pending())
+
+	// A failed transaction is not buffered.
+	pending := bdb.Pending()
+	err = bdb.Update(func(b Bucket) error {
+		require.NoError(t, b.Put([]byte("failed"), []byte("value")))
+		return xerrors.New("failed")
+	})
+	require.Error(t, err)
+	require.Equal(t, pending, bdb.Pending())
+
+	root := testTrie.GetRoot()
+	require.NoError(t, bdb.Flush())
+	require.Equal(t, 0, bdb.Pending())
+	stored, err := LoadTrie(db)
+	require.NoError(t, err)
+	require.Equal(t, root, stored.GetRoot())
+	require.NoError(t, stored.IsValid())
+
+	// The database keeps the state of the flush until the next one.
+	n := count()
+	require.NoError(t, testTrie.Delete([]byte("key0")))
+	require.NoError(t, testTrie.Set([]byte("key20"), []byte("key20")))
+	require.Equal(t, n, count())
+	val, err := testTrie.Get([]byte("key20"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key20"), val)
+
+	root = testTrie.GetRoot()
+	require.NoError(t, bdb.Flush())
+	stored, err = LoadTrie(db)
+	require.NoError(t, err)
+	require.Equal(t, root, stored.GetRoot())
+	require.NoError(t, stored.IsValid())
+	val, err = stored.Get([]byte("key0"))
+	require.NoError(t, err)
+	require.Nil(t, val)
+}
@@ -0,0 +1,143 @@
+package trie
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheSize is the number of bytes of nodes kept in memory by a trie.
+const DefaultCacheSize = 32 << 20
+
+// nodeCache is a least recently used cache of the decoded nodes of a trie,
+// bounded by the total size of the encoded nodes.
+//
+// The nodes are stored under their hash, so the value of a key never changes
+// and the cache stays correct whatever the transaction that read or wrote the
+// node, even if it was rolled back. A deleted node can still be in the cache,
+// but it is never looked up again as no node refers to it anymore, so it is
+// only evicted as it ages.
+type nodeCache struct {
+	sync.Mutex
+	size    int
+	maxSize int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key string
+	buf []byte
+	// node is buf decoded, or nil if it is not decoded yet.
+	node interface{}
+}
+
+func newNodeCache(maxSize int) *nodeCache {
+	return &nodeCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the decoded node stored under the key, or nil if it is not in
+// the cache. The content of the slices of the node must not be modified.
+func (c *nodeCache) get(key []byte) (interface{}, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.Lock()
+	defer c.Unlock()
+	e, ok := c.entries[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	c.order.MoveToFront(e)
+	entry := e.Value.(*cacheEntry)
+	if entry.node == nil {
+		// The written nodes are only decoded once they are read.
+		node, err := decodeNode(entry.buf)
+		if err != nil {
+			return nil, err
+		}
+		entry.node = node
+	}
+	return entry.node, nil
+}
+
+// add stores the encoded node under the key, with the decoded node if it is
+// known. They must not be modified afterwards.
+func (c *nodeCache) add(key, buf []byte, node interface{}) {
+	if c == nil || len(buf) > c.maxSize {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	if e, ok := c.entries[string(key)]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[string(key)] = c.order.PushFront(&cacheEntry{string(key), buf, node})
+	c.size += len(buf)
+	for c.size > c.maxSize {
+		e := c.order.Back()
+		entry := e.Value.(*cacheEntry)
+		c.order.Remove(e)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.buf)
+	}
+}
+
+// len returns the number of nodes in the cache.
+func (c *nodeCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.Lock()
+	defer c.Unlock()
+	return len(c.entries)
+}
+
+// SetCacheSize sets the number of bytes of nodes kept in memory to speed up
+// the reads of the trie, DefaultCacheSize being used by default. The cache is
+// shared by the copies of the trie and its staging tries. A size of zero
+// disables the cache.
+func (t *Trie) SetCacheSize(size int) {
+	if size <= 0 {
+		t.cache = nil
+		return
+	}
+	t.cache = newNodeCache(size)
+}
+
+// getNode reads and decodes the node stored under the key, from the cache if
+// possible. It returns nil if the node doesn't exist. The node is shared with
+// the cache, so the content of its slices must not be modified.
+func (t *Trie) getNode(key []byte, b Bucket) (interface{}, error) {
+	node, err := t.cache.get(key)
+	if node != nil || err != nil {
+		return node, err
+	}
+	buf := b.Get(key)
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	// The value returned by the bucket is only valid during the
+	// transaction.
+	buf = clone(buf)
+	node, err = decodeNode(buf)
+	if err != nil {
+		return nil, err
+	}
+	t.cache.add(key, buf, node)
+	return node, nil
+}
+
+// putNode writes the encoded node under the key and caches it, as the nodes
+// written for a block are the first to be read for the next one.
+func (t *Trie) putNode(key, buf []byte, b Bucket) error {
+	if err := b.Put(key, buf); err != nil {
+		return err
+	}
+	t.cache.add(key, buf, nil)
+	return nil
+}
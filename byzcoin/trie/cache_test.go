@@ -0,0 +1,125 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeCache(t *testing.T) {
+	get := func(c *nodeCache, key string) interface{} {
+		node, err := c.get([]byte(key))
+		require.NoError(t, err)
+		return node
+	}
+
+	c := newNodeCache(10)
+	c.add([]byte("a"), []byte("1234"), "a")
+	c.add([]byte("b"), []byte("1234"), "b")
+	require.Equal(t, "a", get(c, "a"))
+
+	// Adding c evicts b, the least recently used node.
+	c.add([]byte("c"), []byte("1234"), "c")
+	require.Equal(t, 2, c.len())
+	require.Nil(t, get(c, "b"))
+	require.Equal(t, "a", get(c, "a"))
+	require.Equal(t, "c", get(c, "c"))
+
+	// A node bigger than the cache is not kept.
+	c.add([]byte("d"), make([]byte, 11), "d")
+	require.Nil(t, get(c, "d"))
+	require.Equal(t, 2, c.len())
+
+	// The nodes added without being decoded are decoded when read.
+	c = newNodeCache(DefaultCacheSize)
+	interior := newInteriorNode([]byte("left"), []byte("right"))
+	buf, err := interior.encode()
+	require.NoError(t, err)
+	c.add(interior.hash(), buf, nil)
+	node, err := c.get(interior.hash())
+	require.NoError(t, err)
+	require.Equal(t, interior, node)
+	c.add([]byte("invalid"), []byte{0}, nil)
+	_, err = c.get([]byte("invalid"))
+	require.Error(t, err)
+
+	// A disabled cache is nil.
+	var disabled *nodeCache
+	disabled.add([]byte("a"), []byte("1234"), "a")
+	require.Nil(t, get(disabled, "a"))
+}
+
+func TestTrieCache(t *testing.T) {
+	testMemAndDisk(t, testTrieCache)
+}
+
+func testTrieCache(t *testing.T, db DB) {
+	testTrie, err := NewTrie(db, genNonce())
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		k := []byte(fmt.Sprintf("key%d", i))
+		require.NoError(t, testTrie.Set(k, k))
+	}
+
+	// The staging tries read through the cache of the source.
+	testTrie.SetCacheSize(DefaultCacheSize)
+	require.Equal(t, 0, testTrie.cache.len())
+	sTrie := testTrie.MakeStagingTrie()
+	require.NoError(t, sTrie.Set([]byte("key20"), []byte("key20")))
+	_, err = sTrie.GetProof([]byte("key1"))
+	require.NoError(t, err)
+	require.NotEqual(t, 0, testTrie.cache.len())
+
+	// The cached nodes give the same results as the storage.
+	for _, size := range []int{DefaultCacheSize, 0} {
+		testTrie.SetCacheSize(size)
+		for i := 0; i < 2; i++ {
+			val, err := testTrie.Get([]byte("key1"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("key1"), val)
+			p, err := testTrie.GetProof([]byte("key2"))
+			require.NoError(t, err)
+			ok, err := p.Exists([]byte("key2"))
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+	}
+
+	// Discarded writes don't corrupt the cache.
+	testTrie.SetCacheSize(DefaultCacheSize)
+	root := testTrie.GetRoot()
+	require.NoError(t, db.UpdateDryRun(func(b Bucket) error {
+		return testTrie.SetWithBucket([]byte("key1"), []byte("new"), b)
+	}))
+	require.Equal(t, root, testTrie.GetRoot())
+	val, err := testTrie.Get([]byte("key1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key1"), val)
+	require.NoError(t, sTrie.Commit())
+	require.NoError(t, testTrie.IsValid())
+}
+
+// BenchmarkGetProof compares the proofs read from the storage and from the
+// node cache.
+func BenchmarkGetProof(b *testing.B) {
+	for _, bdb := range benchDBs {
+		for _, size := range []int{0, DefaultCacheSize} {
+			b.Run(fmt.Sprintf("%s/cache=%d", bdb.name, size), func(b *testing.B) {
+				db := bdb.open(b)
+				defer bdb.close(b, db)
+				testTrie, err := NewTrie(db, genNonce())
+				require.NoError(b, err)
+				testTrie.SetCacheSize(size)
+				fillBenchTrie(b, testTrie)
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					key := []byte(fmt.Sprintf("key%d-%d", i%100, i%97))
+					_, err := testTrie.GetProof(key)
+					require.NoError(b, err)
+				}
+			})
+		}
+	}
+}
@@ -44,3 +44,23 @@ type Bucket interface {
 	// the error is returned to the caller.
 	ForEach(func(k, v []byte) error) error
 }
+
+// Clear removes all the key/value pairs of the database.
+func Clear(db DB) error {
+	return db.Update(func(b Bucket) error {
+		var keys [][]byte
+		err := b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, clone(k))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -147,4 +147,31 @@ func testMemAndDisk(t *testing.T, f func(*testing.T, DB)) {
 	disk := newDiskDB(t)
 	defer delDiskDB(t, disk)
 	f(t, disk)
+
+	level := newLevelDB(t)
+	defer delLevelDB(t, level)
+	f(t, level)
+}
+
+func TestClear(t *testing.T) {
+	testMemAndDisk(t, func(t *testing.T, db DB) {
+		err := db.Update(func(b Bucket) error {
+			for i := 0; i < 10; i++ {
+				k := []byte{byte(i)}
+				if err := b.Put(k, k); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, Clear(db))
+		err = db.View(func(b Bucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				return xerrors.New("found a key after clear")
+			})
+		})
+		require.NoError(t, err)
+	})
 }
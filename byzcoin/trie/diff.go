@@ -0,0 +1,191 @@
+package trie
+
+import (
+	"bytes"
+
+	"golang.org/x/xerrors"
+)
+
+// DiffType is the way a key differs between two tries.
+type DiffType int
+
+const (
+	// DiffAdded is a key which is only in the new trie.
+	DiffAdded DiffType = iota + 1
+	// DiffModified is a key whose value is different in the new trie.
+	DiffModified
+	// DiffRemoved is a key which is only in the old trie.
+	DiffRemoved
+)
+
+// Difference is a key which differs between two tries.
+type Difference struct {
+	Type DiffType
+	Key  []byte
+	// Old is the value in the old trie, nil if the key was added.
+	Old []byte
+	// New is the value in the new trie, nil if the key was removed.
+	New []byte
+}
+
+// Diff returns the keys which differ between the trie under oldRoot and the
+// trie under newRoot, both of which must be stored in the database of t. Only
+// the subtrees which differ are walked, as equal subtrees have the same hash.
+func (t *Trie) Diff(oldRoot, newRoot []byte) ([]Difference, error) {
+	var diffs []Difference
+	err := t.db.View(func(b Bucket) error {
+		var err error
+		diffs, err = t.DiffWithBuckets(oldRoot, b, newRoot, b)
+		return err
+	})
+	return diffs, err
+}
+
+// DiffWithBuckets is similar to Diff, but the old trie is read from oldB and
+// the new trie from newB, which must be used inside their transactions. The
+// tries must have the same nonce, e.g., the global states of the same chain
+// on two nodes.
+func (t *Trie) DiffWithBuckets(oldRoot []byte, oldB Bucket, newRoot []byte, newB Bucket) ([]Difference, error) {
+	var diffs []Difference
+	err := t.diff(oldRoot, oldB, newRoot, newB, &diffs)
+	if err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// Diff returns the keys which differ between the staging trie and the newer
+// one, which must have the same source.
+func (t *StagingTrie) Diff(newer *StagingTrie) ([]Difference, error) {
+	if t.source != newer.source {
+		return nil, xerrors.New("staging tries with different sources")
+	}
+	oldInstrs := t.instructions()
+	newInstrs := newer.instructions()
+	var diffs []Difference
+	err := t.source.db.UpdateDryRun(func(b Bucket) error {
+		// Each staging trie applies its instructions in its own batch,
+		// so both see the unmodified nodes of the source.
+		oldB, err := t.source.applyInstructions(oldInstrs, b)
+		if err != nil {
+			return err
+		}
+		newB, err := t.source.applyInstructions(newInstrs, b)
+		if err != nil {
+			return err
+		}
+		diffs, err = t.source.DiffWithBuckets(t.source.GetRootWithBucket(oldB), oldB,
+			t.source.GetRootWithBucket(newB), newB)
+		return err
+	})
+	return diffs, err
+}
+
+func (t *StagingTrie) instructions() []instr {
+	t.Lock()
+	defer t.Unlock()
+	return append([]instr{}, t.instrList...)
+}
+
+// applyInstructions applies the instructions in a batch over the bucket,
+// which is returned.
+func (t *Trie) applyInstructions(instrs []instr, b Bucket) (Bucket, error) {
+	batch := newBatchBucket(b)
+	for _, instr := range instrs {
+		switch instr.ty {
+		case OpSet:
+			if err := t.SetWithBucket(instr.k, instr.v, batch); err != nil {
+				return nil, err
+			}
+		case OpDel:
+			if err := t.DeleteWithBucket(instr.k, batch); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, xerrors.New("invalid instruction during diff")
+		}
+	}
+	return batch, nil
+}
+
+func (t *Trie) diff(oldKey []byte, oldB Bucket, newKey []byte, newB Bucket, diffs *[]Difference) error {
+	if bytes.Equal(oldKey, newKey) {
+		return nil
+	}
+	oldNode, err := t.getNode(oldKey, oldB)
+	if err != nil {
+		return err
+	}
+	newNode, err := t.getNode(newKey, newB)
+	if err != nil {
+		return err
+	}
+	if oldNode == nil || newNode == nil {
+		return xerrors.New("node key does not exist in diff")
+	}
+
+	oldInterior, ok1 := oldNode.(interiorNode)
+	newInterior, ok2 := newNode.(interiorNode)
+	if ok1 && ok2 {
+		if err := t.diff(oldInterior.Left, oldB, newInterior.Left, newB, diffs); err != nil {
+			return err
+		}
+		return t.diff(oldInterior.Right, oldB, newInterior.Right, newB, diffs)
+	}
+
+	// At least one side is a leaf or an empty node, so the subtrees hold
+	// few keys and they are compared one by one.
+	var oldLeaves, newLeaves []leafNode
+	if err := t.leaves(oldNode, oldB, &oldLeaves); err != nil {
+		return err
+	}
+	if err := t.leaves(newNode, newB, &newLeaves); err != nil {
+		return err
+	}
+	old := make(map[string][]byte)
+	for _, l := range oldLeaves {
+		old[string(l.Key)] = l.Value
+	}
+	for _, l := range newLeaves {
+		oldVal, ok := old[string(l.Key)]
+		switch {
+		case !ok:
+			*diffs = append(*diffs, Difference{DiffAdded, clone(l.Key), nil, clone(l.Value)})
+		case !bytes.Equal(oldVal, l.Value):
+			*diffs = append(*diffs, Difference{DiffModified, clone(l.Key), clone(oldVal), clone(l.Value)})
+		}
+		delete(old, string(l.Key))
+	}
+	for _, l := range oldLeaves {
+		if _, ok := old[string(l.Key)]; ok {
+			*diffs = append(*diffs, Difference{DiffRemoved, clone(l.Key), clone(l.Value), nil})
+		}
+	}
+	return nil
+}
+
+// leaves appends the leaves of the subtree of the node to out.
+func (t *Trie) leaves(n interface{}, b Bucket, out *[]leafNode) error {
+	switch node := n.(type) {
+	case emptyNode:
+		return nil
+	case leafNode:
+		*out = append(*out, node)
+		return nil
+	case interiorNode:
+		for _, key := range [][]byte{node.Left, node.Right} {
+			child, err := t.getNode(key, b)
+			if err != nil {
+				return err
+			}
+			if child == nil {
+				return xerrors.New("node key does not exist in diff")
+			}
+			if err := t.leaves(child, b, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return xerrors.New("invalid node type")
+}
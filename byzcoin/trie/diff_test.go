@@ -0,0 +1,117 @@
+package trie
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	testMemAndDisk(t, testDiff)
+}
+
+func testDiff(t *testing.T, db DB) {
+	testTrie, err := NewTrie(db, genNonce())
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		k := []byte(fmt.Sprintf("key%d", i))
+		require.NoError(t, testTrie.Set(k, k))
+	}
+
+	diffs, err := testTrie.Diff(testTrie.GetRoot(), testTrie.GetRoot())
+	require.NoError(t, err)
+	require.Empty(t, diffs)
+
+	older := testTrie.MakeStagingTrie()
+	require.NoError(t, older.Set([]byte("key0"), []byte("older")))
+	newer := testTrie.MakeStagingTrie()
+	require.NoError(t, newer.Set([]byte("key0"), []byte("newer")))
+	require.NoError(t, newer.Set([]byte("key20"), []byte("key20")))
+	require.NoError(t, newer.Delete([]byte("key1")))
+
+	diffs, err = older.Diff(newer)
+	require.NoError(t, err)
+	sort.Slice(diffs, func(i, j int) bool {
+		return string(diffs[i].Key) < string(diffs[j].Key)
+	})
+	require.Equal(t, []Difference{
+		{DiffModified, []byte("key0"), []byte("older"), []byte("newer")},
+		{DiffRemoved, []byte("key1"), []byte("key1"), nil},
+		{DiffAdded, []byte("key20"), nil, []byte("key20")},
+	}, diffs)
+
+	// The source is not modified.
+	val, err := testTrie.Get([]byte("key1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key1"), val)
+	require.NoError(t, testTrie.IsValid())
+
+	other, err := NewTrie(NewMemDB(), genNonce())
+	require.NoError(t, err)
+	_, err = older.Diff(other.MakeStagingTrie())
+	require.Error(t, err)
+}
+
+// TestDiffRandom compares the differences found by walking two tries
+// holding random keys with the ones of their key/value pairs.
+func TestDiffRandom(t *testing.T) {
+	nonce := genNonce()
+	oldTrie, err := NewTrie(NewMemDB(), nonce)
+	require.NoError(t, err)
+	newTrie, err := NewTrie(NewMemDB(), nonce)
+	require.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(1))
+	oldKVs := make(map[string]string)
+	newKVs := make(map[string]string)
+	for i := 0; i < 500; i++ {
+		k := fmt.Sprintf("key%d", rnd.Intn(200))
+		v := fmt.Sprintf("value%d", rnd.Intn(3))
+		switch rnd.Intn(4) {
+		case 0:
+			require.NoError(t, oldTrie.Set([]byte(k), []byte(v)))
+			oldKVs[k] = v
+		case 1:
+			require.NoError(t, newTrie.Set([]byte(k), []byte(v)))
+			newKVs[k] = v
+		case 2:
+			require.NoError(t, oldTrie.Delete([]byte(k)))
+			delete(oldKVs, k)
+		default:
+			require.NoError(t, newTrie.Delete([]byte(k)))
+			delete(newKVs, k)
+		}
+	}
+
+	expected := make(map[string]DiffType)
+	for k, v := range newKVs {
+		oldV, ok := oldKVs[k]
+		if !ok {
+			expected[k] = DiffAdded
+		} else if oldV != v {
+			expected[k] = DiffModified
+		}
+	}
+	for k := range oldKVs {
+		if _, ok := newKVs[k]; !ok {
+			expected[k] = DiffRemoved
+		}
+	}
+
+	found := make(map[string]DiffType)
+	err = oldTrie.DB().View(func(oldB Bucket) error {
+		return newTrie.DB().View(func(newB Bucket) error {
+			diffs, err := oldTrie.DiffWithBuckets(oldTrie.GetRootWithBucket(oldB), oldB,
+				newTrie.GetRootWithBucket(newB), newB)
+			for _, d := range diffs {
+				found[string(d.Key)] = d.Type
+			}
+			return err
+		})
+	})
+	require.NoError(t, err)
+	require.Equal(t, expected, found)
+}
@@ -0,0 +1,107 @@
+package trie
+
+import (
+	"crypto/sha256"
+
+	"golang.org/x/xerrors"
+)
+
+// GCResult reports the nodes found by a garbage collection of the trie.
+type GCResult struct {
+	// Reachable is the number of nodes of the trie.
+	Reachable int
+	// Garbage is the number of stored nodes that are not part of the trie.
+	Garbage int
+	// GarbageSize is the number of bytes of the keys and values of the
+	// garbage nodes.
+	GarbageSize int
+}
+
+// GC removes the nodes which are stored but are not reachable from the root
+// anymore, which can be left behind by older versions of the trie. It marks
+// the nodes of the trie and sweeps the other ones in a single transaction, so
+// the trie can be used during the collection.
+func (t *Trie) GC() (GCResult, error) {
+	var res GCResult
+	err := t.db.Update(func(b Bucket) error {
+		var err error
+		res, err = t.GCWithBucket(b, false)
+		return err
+	})
+	return res, err
+}
+
+// FindGarbage is similar to GC but only reports the nodes that would be
+// removed.
+func (t *Trie) FindGarbage() (GCResult, error) {
+	var res GCResult
+	err := t.db.View(func(b Bucket) error {
+		var err error
+		res, err = t.GCWithBucket(b, true)
+		return err
+	})
+	return res, err
+}
+
+// GCWithBucket removes the unreachable nodes, or only reports them if dryRun
+// is true. It must be called inside a DB.Update transaction, or a DB.View
+// transaction for a dry run.
+func (t *Trie) GCWithBucket(b Bucket, dryRun bool) (GCResult, error) {
+	var res GCResult
+	rootKey := t.GetRootWithBucket(b)
+	if rootKey == nil {
+		return res, xerrors.New("no root key")
+	}
+	reachable := make(map[string]bool)
+	if err := t.mark(rootKey, reachable, b); err != nil {
+		return res, xerrors.Errorf("marking nodes: %v", err)
+	}
+	res.Reachable = len(reachable)
+
+	// The nodes are stored under their hash, while the other keys, the
+	// entry, the nonce and the metadata, are shorter.
+	var garbage [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if len(k) != sha256.Size || reachable[string(k)] {
+			return nil
+		}
+		garbage = append(garbage, clone(k))
+		res.GarbageSize += len(k) + len(v)
+		return nil
+	})
+	if err != nil {
+		return res, xerrors.Errorf("listing nodes: %v", err)
+	}
+	res.Garbage = len(garbage)
+	if dryRun {
+		return res, nil
+	}
+	for _, k := range garbage {
+		if err := b.Delete(k); err != nil {
+			return res, xerrors.Errorf("deleting node: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// mark adds the key of the node and the keys of its descendants to
+// reachable. It reads the nodes from the storage, as a node missing from it
+// must not be hidden by the cache.
+func (t *Trie) mark(nodeKey []byte, reachable map[string]bool, b Bucket) error {
+	nodeVal := b.Get(nodeKey)
+	if len(nodeVal) == 0 {
+		return xerrors.Errorf("node %x does not exist", nodeKey)
+	}
+	reachable[string(nodeKey)] = true
+	if nodeType(nodeVal[0]) != typeInterior {
+		return nil
+	}
+	node, err := decodeInteriorNode(nodeVal)
+	if err != nil {
+		return err
+	}
+	if err := t.mark(node.Left, reachable, b); err != nil {
+		return err
+	}
+	return t.mark(node.Right, reachable, b)
+}
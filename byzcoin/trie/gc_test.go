@@ -0,0 +1,58 @@
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGC(t *testing.T) {
+	testMemAndDisk(t, testGC)
+}
+
+func testGC(t *testing.T, db DB) {
+	testTrie, err := NewTrie(db, genNonce())
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		k := []byte(fmt.Sprintf("key%d", i))
+		require.NoError(t, testTrie.Set(k, k))
+	}
+	require.NoError(t, testTrie.Delete([]byte("key0")))
+	require.NoError(t, testTrie.SetMetadata([]byte("meta"), []byte("data")))
+
+	// A clean trie has no garbage.
+	res, err := testTrie.GC()
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Garbage)
+	require.NotEqual(t, 0, res.Reachable)
+	reachable := res.Reachable
+
+	// Leave a leaf behind, as an older version of the trie could do.
+	leaf := newLeafNode([]bool{true}, []byte("old"), []byte("value"))
+	leafBuf, err := leaf.encode()
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(b Bucket) error {
+		return b.Put(leaf.hash(testTrie.nonce), leafBuf)
+	}))
+
+	res, err = testTrie.FindGarbage()
+	require.NoError(t, err)
+	require.Equal(t, GCResult{
+		Reachable:   reachable,
+		Garbage:     1,
+		GarbageSize: 32 + len(leafBuf),
+	}, res)
+
+	res, err = testTrie.GC()
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Garbage)
+	require.Equal(t, []byte("data"), testTrie.GetMetadata([]byte("meta")))
+	val, err := testTrie.Get([]byte("key1"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("key1"), val)
+
+	res, err = testTrie.FindGarbage()
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Garbage)
+}
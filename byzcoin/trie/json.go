@@ -0,0 +1,130 @@
+package trie
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// hexBytes is written in hexadecimal in JSON.
+type hexBytes []byte
+
+func (h hexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+func (h *hexBytes) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*h = nil
+		return nil
+	}
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return xerrors.Errorf("decoding hex: %v", err)
+	}
+	*h = buf
+	return nil
+}
+
+// bitPrefix is a prefix written as a string of '0' and '1' in JSON.
+type bitPrefix []bool
+
+func (b bitPrefix) MarshalText() ([]byte, error) {
+	var out strings.Builder
+	for _, bit := range b {
+		if bit {
+			out.WriteByte('1')
+		} else {
+			out.WriteByte('0')
+		}
+	}
+	return []byte(out.String()), nil
+}
+
+func (b *bitPrefix) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*b = nil
+		return nil
+	}
+	bits := make([]bool, len(text))
+	for i, c := range text {
+		switch c {
+		case '0':
+		case '1':
+			bits[i] = true
+		default:
+			return xerrors.Errorf("invalid bit '%c' in prefix", c)
+		}
+	}
+	*b = bits
+	return nil
+}
+
+type jsonInteriorNode struct {
+	Left  hexBytes
+	Right hexBytes
+}
+
+type jsonEmptyNode struct {
+	Prefix bitPrefix
+}
+
+type jsonLeafNode struct {
+	Prefix bitPrefix
+	Key    hexBytes
+	Value  []byte
+}
+
+type jsonProof struct {
+	Interiors []jsonInteriorNode
+	Leaf      jsonLeafNode
+	Empty     jsonEmptyNode
+	Nonce     hexBytes
+}
+
+// MarshalJSON implements json.Marshaler. The hashes, the key and the nonce
+// are written in hexadecimal, the value in base64 and the prefixes as strings
+// of '0' and '1'.
+func (p Proof) MarshalJSON() ([]byte, error) {
+	jp := jsonProof{
+		Interiors: make([]jsonInteriorNode, len(p.Interiors)),
+		Leaf: jsonLeafNode{
+			Prefix: p.Leaf.Prefix,
+			Key:    p.Leaf.Key,
+			Value:  p.Leaf.Value,
+		},
+		Empty: jsonEmptyNode{Prefix: p.Empty.Prefix},
+		Nonce: p.Nonce,
+	}
+	for i, n := range p.Interiors {
+		jp.Interiors[i] = jsonInteriorNode{Left: n.Left, Right: n.Right}
+	}
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *Proof) UnmarshalJSON(buf []byte) error {
+	var jp jsonProof
+	err := json.Unmarshal(buf, &jp)
+	if err != nil {
+		return xerrors.Errorf("decoding proof: %v", err)
+	}
+	*p = Proof{
+		Leaf: leafNode{
+			Prefix: jp.Leaf.Prefix,
+			Key:    jp.Leaf.Key,
+			Value:  jp.Leaf.Value,
+		},
+		Empty: emptyNode{Prefix: jp.Empty.Prefix},
+		Nonce: jp.Nonce,
+	}
+	if len(jp.Interiors) > 0 {
+		p.Interiors = make([]interiorNode, len(jp.Interiors))
+		for i, n := range jp.Interiors {
+			p.Interiors[i] = interiorNode{Left: n.Left, Right: n.Right}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package trie
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProof_JSON(t *testing.T) {
+	testTrie, err := NewTrie(NewMemDB(), genNonce())
+	require.NoError(t, err)
+	for i := 10; i < 20; i++ {
+		k := []byte{byte(i)}
+		require.NoError(t, testTrie.Set(k, k))
+	}
+
+	// Proofs of inclusion and of absence.
+	for i := 5; i < 15; i++ {
+		k := []byte{byte(i)}
+		p, err := testTrie.GetProof(k)
+		require.NoError(t, err)
+		buf, err := json.Marshal(p)
+		require.NoError(t, err)
+
+		var decoded Proof
+		require.NoError(t, json.Unmarshal(buf, &decoded))
+		ok, err := decoded.Exists(k)
+		require.NoError(t, err)
+		require.Equal(t, i >= 10, ok)
+		require.Equal(t, testTrie.GetRoot(), decoded.GetRoot())
+
+		// The encoding is canonical.
+		buf2, err := json.Marshal(decoded)
+		require.NoError(t, err)
+		require.Equal(t, buf, buf2)
+	}
+
+	var p Proof
+	require.Error(t, json.Unmarshal([]byte(`{"Leaf":{"Prefix":"012"}}`), &p))
+	require.Error(t, json.Unmarshal([]byte(`{"Nonce":"xyz"}`), &p))
+}
@@ -0,0 +1,151 @@
+package trie
+
+import (
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"golang.org/x/xerrors"
+)
+
+var errReadOnly = xerrors.New("bucket is read-only")
+
+// levelDB is the DB implementation for LevelDB. As LevelDB has no buckets,
+// the keys of a bucket are prefixed with its name.
+//
+// The transactions of LevelDB block all the other writes to the database, so
+// an update instead buffers its writes over a snapshot and writes them in a
+// single batch. The updates of a bucket are serialized by its lock, while
+// the buckets sharing the database are updated concurrently.
+type levelDB struct {
+	db     *leveldb.DB
+	prefix []byte
+	sync.Mutex
+}
+
+// NewLevelDB creates a new LevelDB-backed database. Many buckets can share
+// the same LevelDB database. The updates are serialized only within the
+// returned instance, so a bucket must be opened once and the instance shared
+// by its users.
+func NewLevelDB(db *leveldb.DB, bucket []byte) DB {
+	// The separator prevents a bucket from seeing the keys of another bucket
+	// whose name starts with its name.
+	prefix := append(clone(bucket), 0)
+	return &levelDB{
+		db:     db,
+		prefix: prefix,
+	}
+}
+
+func (r *levelDB) Update(f func(Bucket) error) error {
+	r.Lock()
+	defer r.Unlock()
+	snap, err := r.db.GetSnapshot()
+	if err != nil {
+		return xerrors.Errorf("getting snapshot: %v", err)
+	}
+	defer snap.Release()
+
+	overlay := newOverlayBucket(&levelBucket{r.prefix, snap, nil})
+	err = f(overlay)
+	if err != nil {
+		return err
+	}
+	batch := new(leveldb.Batch)
+	overlay.b = &levelBucket{r.prefix, snap, batch}
+	err = overlay.flush()
+	if err != nil {
+		return err
+	}
+	err = r.db.Write(batch, nil)
+	if err != nil {
+		return xerrors.Errorf("writing batch: %v", err)
+	}
+	return nil
+}
+
+func (r *levelDB) View(f func(Bucket) error) error {
+	snap, err := r.db.GetSnapshot()
+	if err != nil {
+		return xerrors.Errorf("getting snapshot: %v", err)
+	}
+	defer snap.Release()
+	return f(&levelBucket{r.prefix, snap, nil})
+}
+
+// UpdateDryRun executes the given transaction and then discards it, so that
+// the database stays in its earlier state. As for diskDB, the values must be
+// copied if they need to be used after the dry-run.
+func (r *levelDB) UpdateDryRun(f func(Bucket) error) error {
+	snap, err := r.db.GetSnapshot()
+	if err != nil {
+		return xerrors.Errorf("getting snapshot: %v", err)
+	}
+	defer snap.Release()
+	return f(newOverlayBucket(&levelBucket{r.prefix, snap, nil}))
+}
+
+// Close does nothing, as the LevelDB database is shared by the buckets and
+// belongs to the caller of NewLevelDB, which closes it.
+func (r *levelDB) Close() error {
+	return nil
+}
+
+// levelReader is implemented by the snapshots.
+type levelReader interface {
+	Get([]byte, *opt.ReadOptions) ([]byte, error)
+	NewIterator(*util.Range, *opt.ReadOptions) iterator.Iterator
+}
+
+type levelBucket struct {
+	prefix []byte
+	r      levelReader
+	// w is nil for read-only buckets.
+	w *leveldb.Batch
+}
+
+func (r *levelBucket) key(k []byte) []byte {
+	return append(clone(r.prefix), k...)
+}
+
+func (r *levelBucket) Delete(k []byte) error {
+	if r.w == nil {
+		return errReadOnly
+	}
+	r.w.Delete(r.key(k))
+	return nil
+}
+
+func (r *levelBucket) Put(k, v []byte) error {
+	if r.w == nil {
+		return errReadOnly
+	}
+	r.w.Put(r.key(k), v)
+	return nil
+}
+
+func (r *levelBucket) Get(k []byte) []byte {
+	v, err := r.r.Get(r.key(k), nil)
+	if err != nil {
+		// Either leveldb.ErrNotFound or a failure of the storage, which the
+		// interface can't report, so it is handled like bbolt does.
+		return nil
+	}
+	return v
+}
+
+func (r *levelBucket) ForEach(f func(k, v []byte) error) error {
+	it := r.r.NewIterator(util.BytesPrefix(r.prefix), nil)
+	defer it.Release()
+	for it.Next() {
+		// The iterator reuses its buffers, while the keys and values of
+		// bbolt stay valid during the whole transaction.
+		err := f(clone(it.Key()[len(r.prefix):]), clone(it.Value()))
+		if err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
@@ -0,0 +1,160 @@
+package trie
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"golang.org/x/xerrors"
+)
+
+const testLevelDBName = "test_trie.leveldb"
+
+func newLevelDB(t testing.TB) DB {
+	db, err := leveldb.OpenFile(testLevelDBName, nil)
+	require.NoError(t, err)
+	return NewLevelDB(db, []byte(bucketName))
+}
+
+func delLevelDB(t testing.TB, db DB) {
+	require.NoError(t, db.Close())
+	require.NoError(t, db.(*levelDB).db.Close())
+	require.NoError(t, os.RemoveAll(testLevelDBName))
+}
+
+func TestLevelDB_Buckets(t *testing.T) {
+	db, err := leveldb.OpenFile(testLevelDBName, nil)
+	require.NoError(t, err)
+	defer os.RemoveAll(testLevelDBName)
+	defer db.Close()
+
+	// A bucket doesn't see the keys of a bucket whose name is longer.
+	short := NewLevelDB(db, []byte("a"))
+	long := NewLevelDB(db, []byte("ab"))
+	require.NoError(t, long.Update(func(b Bucket) error {
+		return b.Put([]byte("key"), []byte("long"))
+	}))
+	require.NoError(t, short.Update(func(b Bucket) error {
+		return b.Put([]byte("bkey"), []byte("short"))
+	}))
+
+	var keys []string
+	require.NoError(t, short.View(func(b Bucket) error {
+		require.Nil(t, b.Get([]byte("key")))
+		return b.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	}))
+	require.Equal(t, []string{"bkey"}, keys)
+
+	require.NoError(t, Clear(short))
+	require.NoError(t, long.View(func(b Bucket) error {
+		require.Equal(t, []byte("long"), b.Get([]byte("key")))
+		return nil
+	}))
+}
+
+func TestLevelDB_Rollback(t *testing.T) {
+	db := newLevelDB(t)
+	defer delLevelDB(t, db)
+
+	err := db.Update(func(b Bucket) error {
+		if err := b.Put([]byte("key"), []byte("value")); err != nil {
+			return err
+		}
+		return xerrors.New("abort")
+	})
+	require.Error(t, err)
+	require.NoError(t, db.View(func(b Bucket) error {
+		require.Nil(t, b.Get([]byte("key")))
+		return nil
+	}))
+}
+
+func TestLevelDB_Overlay(t *testing.T) {
+	db := newLevelDB(t)
+	defer delLevelDB(t, db)
+
+	require.NoError(t, db.Update(func(b Bucket) error {
+		return b.Put([]byte("key"), []byte("value"))
+	}))
+
+	// The writes are visible during the update, and a key overwritten and
+	// then deleted is removed from the storage.
+	require.NoError(t, db.Update(func(b Bucket) error {
+		require.NoError(t, b.Put([]byte("key"), []byte("new value")))
+		require.Equal(t, []byte("new value"), b.Get([]byte("key")))
+		require.NoError(t, b.Delete([]byte("key")))
+		require.Nil(t, b.Get([]byte("key")))
+		return b.Put([]byte("other"), []byte("other"))
+	}))
+	require.NoError(t, db.View(func(b Bucket) error {
+		require.Nil(t, b.Get([]byte("key")))
+		require.Equal(t, []byte("other"), b.Get([]byte("other")))
+		return nil
+	}))
+
+	require.NoError(t, db.UpdateDryRun(func(b Bucket) error {
+		require.NoError(t, b.Delete([]byte("other")))
+		require.Nil(t, b.Get([]byte("other")))
+		return nil
+	}))
+	require.NoError(t, db.View(func(b Bucket) error {
+		require.Equal(t, []byte("other"), b.Get([]byte("other")))
+		return nil
+	}))
+}
+
+func TestLevelDB_Trie(t *testing.T) {
+	db := newLevelDB(t)
+	defer delLevelDB(t, db)
+
+	testTrie, err := NewTrie(db, genNonce())
+	require.NoError(t, err)
+	require.NoError(t, testTrie.Set([]byte("key"), []byte("value")))
+
+	mem := NewMemDB()
+	defer mem.Close()
+	err = mem.Update(func(b Bucket) error {
+		return testTrie.CopyTo(b)
+	})
+	require.NoError(t, err)
+	memTrie, err := LoadTrie(mem)
+	require.NoError(t, err)
+	require.Equal(t, testTrie.GetRoot(), memTrie.GetRoot())
+
+	val, err := memTrie.Get([]byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), val)
+}
+
+// BenchmarkUpdate compares the updates of bbolt and LevelDB, each writing
+// and then reading back a set of keys.
+func BenchmarkUpdate(b *testing.B) {
+	for _, bdb := range benchDBs {
+		b.Run(bdb.name, func(b *testing.B) {
+			db := bdb.open(b)
+			defer bdb.close(b, db)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := db.Update(func(bucket Bucket) error {
+					for j := 0; j < 100; j++ {
+						k := []byte(fmt.Sprintf("update%d-%d", i, j))
+						if err := bucket.Put(k, k); err != nil {
+							return err
+						}
+						if bucket.Get(k) == nil {
+							return xerrors.New("missing key")
+						}
+					}
+					return nil
+				})
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -139,3 +139,38 @@ func decodeLeafNode(buf []byte) (node leafNode, err error) {
 	}
 	return
 }
+
+// decodeNode decodes a node of any type. As the slices of the node refer to
+// buf, they are clipped so that appending to them never modifies buf.
+func decodeNode(buf []byte) (interface{}, error) {
+	if len(buf) == 0 {
+		return nil, xerrors.New("empty buffer")
+	}
+	switch nodeType(buf[0]) {
+	case typeEmpty:
+		node, err := decodeEmptyNode(buf)
+		if err != nil {
+			return nil, err
+		}
+		node.Prefix = node.Prefix[:len(node.Prefix):len(node.Prefix)]
+		return node, nil
+	case typeLeaf:
+		node, err := decodeLeafNode(buf)
+		if err != nil {
+			return nil, err
+		}
+		node.Prefix = node.Prefix[:len(node.Prefix):len(node.Prefix)]
+		node.Key = node.Key[:len(node.Key):len(node.Key)]
+		node.Value = node.Value[:len(node.Value):len(node.Value)]
+		return node, nil
+	case typeInterior:
+		node, err := decodeInteriorNode(buf)
+		if err != nil {
+			return nil, err
+		}
+		node.Left = node.Left[:len(node.Left):len(node.Left)]
+		node.Right = node.Right[:len(node.Right):len(node.Right)]
+		return node, nil
+	}
+	return nil, xerrors.New("invalid node type")
+}
@@ -117,31 +117,23 @@ func (t *Trie) GetProof(key []byte) (*Proof, error) {
 
 // getProof updates Proof p as it traverses the tree.
 func (t *Trie) getProof(depth int, nodeKey []byte, bits []bool, p *Proof, b Bucket) error {
-	nodeVal := clone(b.Get(nodeKey))
-	if len(nodeVal) == 0 {
+	n, err := t.getNode(nodeKey, b)
+	if err != nil {
+		return err
+	}
+	if n == nil {
 		return xerrors.New("invalid node key")
 	}
-	switch nodeType(nodeVal[0]) {
-	case typeEmpty:
-		node, err := decodeEmptyNode(nodeVal)
-		if err != nil {
-			return err
-		}
-		p.Empty = node
+	switch node := n.(type) {
+	// The nodes are copied as they are shared with the cache.
+	case emptyNode:
+		p.Empty = newEmptyNode(append([]bool{}, node.Prefix...))
 		return nil
-	case typeLeaf:
-		node, err := decodeLeafNode(nodeVal)
-		if err != nil {
-			return err
-		}
-		p.Leaf = node
+	case leafNode:
+		p.Leaf = newLeafNode(append([]bool{}, node.Prefix...), clone(node.Key), clone(node.Value))
 		return nil
-	case typeInterior:
-		node, err := decodeInteriorNode(nodeVal)
-		if err != nil {
-			return err
-		}
-		p.Interiors = append(p.Interiors, node)
+	case interiorNode:
+		p.Interiors = append(p.Interiors, newInteriorNode(clone(node.Left), clone(node.Right)))
 		if bits[depth] {
 			return t.getProof(depth+1, node.Left, bits, p, b)
 		}
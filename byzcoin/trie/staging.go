@@ -151,21 +151,22 @@ func (t *StagingTrie) Commit() error {
 	t.Lock()
 	defer t.Unlock()
 	err := t.source.db.Update(func(b Bucket) error {
+		batch := newBatchBucket(b)
 		for _, instr := range t.instrList {
 			switch instr.ty {
 			case OpSet:
-				if err := t.source.SetWithBucket(instr.k, instr.v, b); err != nil {
+				if err := t.source.SetWithBucket(instr.k, instr.v, batch); err != nil {
 					return err
 				}
 			case OpDel:
-				if err := t.source.DeleteWithBucket(instr.k, b); err != nil {
+				if err := t.source.DeleteWithBucket(instr.k, batch); err != nil {
 					return err
 				}
 			default:
 				return xerrors.New("invalid instruction during commit")
 			}
 		}
-		return nil
+		return batch.flush()
 	})
 	if err != nil {
 		return err
@@ -182,6 +183,8 @@ func (t *StagingTrie) GetRoot() []byte {
 	defer t.Unlock()
 	var root []byte
 	err := t.source.db.UpdateDryRun(func(b Bucket) error {
+		// The writes are discarded anyway, so they are only buffered.
+		b = newBatchBucket(b)
 		for _, instr := range t.instrList {
 			switch instr.ty {
 			case OpSet:
@@ -211,6 +214,8 @@ func (t *StagingTrie) GetProof(key []byte) (*Proof, error) {
 	defer t.Unlock()
 	p := &Proof{}
 	err := t.source.db.UpdateDryRun(func(b Bucket) error {
+		// The writes are discarded anyway, so they are only buffered.
+		b = newBatchBucket(b)
 		// run the pending instructions
 		for _, instr := range t.instrList {
 			switch instr.ty {
@@ -17,6 +17,8 @@ type Trie struct {
 	// flag, which should only be used in the unit test. (There is a copy of
 	// it in Proof as well.)
 	noHashKey bool
+	// cache holds the most recently used nodes, it is nil if disabled.
+	cache *nodeCache
 }
 
 // GetNonce returns the stored nonce.
@@ -54,6 +56,7 @@ func LoadTrie(db DB) (*Trie, error) {
 	return &Trie{
 		nonce: nonce,
 		db:    db,
+		cache: newNodeCache(DefaultCacheSize),
 	}, nil
 }
 
@@ -87,6 +90,7 @@ func NewTrie(db DB, nonce []byte) (*Trie, error) {
 	return &Trie{
 		nonce: nonce,
 		db:    db,
+		cache: newNodeCache(DefaultCacheSize),
 	}, nil
 }
 
@@ -175,23 +179,25 @@ func (t *Trie) Batch(pairs []KVPair) error {
 }
 
 // BatchWithBucket is similar to SetWithBucket, but for multiple key-value
-// pairs.
+// pairs. The modified nodes are written to the bucket at the end, in a single
+// batch sorted by key.
 func (t *Trie) BatchWithBucket(pairs []KVPair, b Bucket) error {
+	batch := newBatchBucket(b)
 	for _, p := range pairs {
 		switch p.Op() {
 		case OpSet:
-			if err := t.SetWithBucket(p.Key(), p.Val(), b); err != nil {
+			if err := t.SetWithBucket(p.Key(), p.Val(), batch); err != nil {
 				return err
 			}
 		case OpDel:
-			if err := t.DeleteWithBucket(p.Key(), b); err != nil {
+			if err := t.DeleteWithBucket(p.Key(), batch); err != nil {
 				return err
 			}
 		default:
 			return xerrors.New("no such operation")
 		}
 	}
-	return nil
+	return batch.flush()
 }
 
 // SetWithBucket sets or overwrites a key-value pair. It must be called inside
@@ -205,25 +211,19 @@ func (t *Trie) SetWithBucket(key []byte, value []byte, b Bucket) error {
 }
 
 func (t *Trie) set(nodeKey []byte, bits []bool, depth int, key, value []byte, b Bucket) ([]byte, error) {
-	nodeVal := b.Get(nodeKey)
-	if len(nodeVal) == 0 {
+	n, err := t.getNode(nodeKey, b)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
 		return nil, xerrors.New("node key does not exist in set")
 	}
-	switch nodeType(nodeVal[0]) {
-	case typeEmpty:
+	switch node := n.(type) {
+	case emptyNode:
 		// base case 1
-		node, err := decodeEmptyNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
 		return t.emptyToLeaf(node, key, value, b)
-	case typeLeaf:
+	case leafNode:
 		// base case 2
-		node, err := decodeLeafNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
-
 		// If the key is the same, then we don't need to create a new
 		// internal node, just update the value and hash.
 		if bytes.Equal(node.Key, key) {
@@ -235,7 +235,7 @@ func (t *Trie) set(nodeKey []byte, bits []bool, depth int, key, value []byte, b
 			if err != nil {
 				return nil, err
 			}
-			if err := b.Put(node.hash(t.nonce), leafBuf); err != nil {
+			if err := t.putNode(node.hash(t.nonce), leafBuf, b); err != nil {
 				return nil, err
 			}
 			return node.hash(t.nonce), nil
@@ -253,7 +253,7 @@ func (t *Trie) set(nodeKey []byte, bits []bool, depth int, key, value []byte, b
 		if err != nil {
 			return nil, err
 		}
-		if err := b.Put(interior.hash(), interiorBuff); err != nil {
+		if err := t.putNode(interior.hash(), interiorBuff, b); err != nil {
 			return nil, err
 		}
 		// Delete the old leaf node.
@@ -261,12 +261,8 @@ func (t *Trie) set(nodeKey []byte, bits []bool, depth int, key, value []byte, b
 			return nil, err
 		}
 		return interior.hash(), nil
-	case typeInterior:
+	case interiorNode:
 		// recursive case
-		node, err := decodeInteriorNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
 		oldHash := node.hash()
 		var retHash []byte
 		if bits[depth] {
@@ -290,7 +286,7 @@ func (t *Trie) set(nodeKey []byte, bits []bool, depth int, key, value []byte, b
 		if err != nil {
 			return nil, err
 		}
-		err = b.Put(node.hash(), newNodeBuf)
+		err = t.putNode(node.hash(), newNodeBuf, b)
 		if err != nil {
 			return nil, err
 		}
@@ -310,7 +306,7 @@ func (t *Trie) emptyToLeaf(empty emptyNode, key []byte, value []byte, b Bucket)
 	if err := b.Delete(empty.hash(t.nonce)); err != nil {
 		return nil, err
 	}
-	if err := b.Put(leaf.hash(t.nonce), leafBuf); err != nil {
+	if err := t.putNode(leaf.hash(t.nonce), leafBuf, b); err != nil {
 		return nil, err
 	}
 	return leaf.hash(t.nonce), nil
@@ -335,10 +331,10 @@ func (t *Trie) extendLeaf(currPrefix []bool,
 		if err != nil {
 			return nil, nil, err
 		}
-		if err := b.Put(left.hash(t.nonce), leftBuf); err != nil {
+		if err := t.putNode(left.hash(t.nonce), leftBuf, b); err != nil {
 			return nil, nil, err
 		}
-		if err := b.Put(right.hash(t.nonce), rightBuf); err != nil {
+		if err := t.putNode(right.hash(t.nonce), rightBuf, b); err != nil {
 			return nil, nil, err
 		}
 		if bits1[i] {
@@ -357,7 +353,7 @@ func (t *Trie) extendLeaf(currPrefix []bool,
 	if err != nil {
 		return nil, nil, err
 	}
-	if err = b.Put(interior.hash(), interiorBuf); err != nil {
+	if err = t.putNode(interior.hash(), interiorBuf, b); err != nil {
 		return nil, nil, err
 	}
 	empty := newEmptyNode(append(currPrefix, !bits1[i]))
@@ -365,7 +361,7 @@ func (t *Trie) extendLeaf(currPrefix []bool,
 	if err != nil {
 		return nil, nil, err
 	}
-	if err = b.Put(empty.hash(t.nonce), emptyBuf); err != nil {
+	if err = t.putNode(empty.hash(t.nonce), emptyBuf, b); err != nil {
 		return nil, nil, err
 	}
 	if bits1[i] {
@@ -429,30 +425,25 @@ func (t *Trie) GetWithBucket(key []byte, b Bucket) ([]byte, error) {
 }
 
 func (t *Trie) get(depth int, nodeKey []byte, bits []bool, key []byte, b Bucket) ([]byte, error) {
-	nodeVal := b.Get(nodeKey)
-	if len(nodeVal) == 0 {
+	n, err := t.getNode(nodeKey, b)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
 		return nil, xerrors.New("node key does not exist in get")
 	}
-	switch nodeType(nodeVal[0]) {
-	case typeEmpty:
+	switch node := n.(type) {
+	case emptyNode:
 		// base case 1
 		return nil, nil
-	case typeLeaf:
+	case leafNode:
 		// base case 2
-		node, err := decodeLeafNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
 		if !bytes.Equal(key, node.Key) {
 			return nil, nil
 		}
 		return node.Value, nil
-	case typeInterior:
+	case interiorNode:
 		// recursive case
-		node, err := decodeInteriorNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
 		if bits[depth] {
 			return t.get(depth+1, node.Left, bits, key, b)
 		}
@@ -486,19 +477,18 @@ func (t *Trie) CopyTo(target Bucket) error {
 // TODO for now we just replace leafs with empty nodes, which is ok but it'll
 // be better if we can "shrink" the tree as well.
 func (t *Trie) del(depth int, nodeKey []byte, bits []bool, key []byte, b Bucket) ([]byte, error) {
-	nodeVal := b.Get(nodeKey)
-	if len(nodeVal) == 0 {
+	n, err := t.getNode(nodeKey, b)
+	if err != nil {
+		return nil, err
+	}
+	if n == nil {
 		return nil, xerrors.New("node key does not exist in del")
 	}
-	switch nodeType(nodeVal[0]) {
-	case typeEmpty:
+	switch node := n.(type) {
+	case emptyNode:
 		// base case 1, nothing to delete
 		return nil, nil
-	case typeLeaf:
-		node, err := decodeLeafNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
+	case leafNode:
 		if !bytes.Equal(key, node.Key) {
 			// key doesn't exist, nothing to delete
 			return nil, nil
@@ -511,15 +501,11 @@ func (t *Trie) del(depth int, nodeKey []byte, bits []bool, key []byte, b Bucket)
 		if err != nil {
 			return nil, err
 		}
-		if err := b.Put(empty.hash(t.nonce), emptyBuf); err != nil {
+		if err := t.putNode(empty.hash(t.nonce), emptyBuf, b); err != nil {
 			return nil, err
 		}
 		return empty.hash(t.nonce), nil
-	case typeInterior:
-		node, err := decodeInteriorNode(nodeVal)
-		if err != nil {
-			return nil, err
-		}
+	case interiorNode:
 		// update this interior node
 		if bits[depth] {
 			// look left
@@ -541,7 +527,7 @@ func (t *Trie) del(depth int, nodeKey []byte, bits []bool, key []byte, b Bucket)
 			if err != nil {
 				return nil, err
 			}
-			return node.hash(), b.Put(node.hash(), nodeBuf)
+			return node.hash(), t.putNode(node.hash(), nodeBuf, b)
 		}
 		// look right
 		res, err := t.del(depth+1, node.Right, bits, key, b)
@@ -562,7 +548,7 @@ func (t *Trie) del(depth int, nodeKey []byte, bits []bool, key []byte, b Bucket)
 		if err != nil {
 			return nil, err
 		}
-		return node.hash(), b.Put(node.hash(), nodeBuf)
+		return node.hash(), t.putNode(node.hash(), nodeBuf, b)
 	}
 	return nil, xerrors.New("invalid node type")
 }
@@ -595,9 +581,12 @@ func (t *Trie) IsValid() error {
 		return err
 	}
 
-	// We can get proof for all the leaves.
+	// We can get proof for all the leaves, which must be read from the
+	// storage and not from the cache.
+	stored := *t
+	stored.cache = nil
 	for _, leave := range p.leaves {
-		proof, err := t.GetProof(leave.Key)
+		proof, err := stored.GetProof(leave.Key)
 		if err != nil {
 			return err
 		}
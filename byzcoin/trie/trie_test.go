@@ -520,7 +520,7 @@ func TestCopy(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func newDiskDB(t *testing.T) DB {
+func newDiskDB(t testing.TB) DB {
 	db, err := bbolt.Open(testDBName, 0600, nil)
 	require.NoError(t, err)
 	err = db.Update(func(tx *bbolt.Tx) error {
@@ -531,7 +531,7 @@ func newDiskDB(t *testing.T) DB {
 	return NewDiskDB(db, []byte(bucketName))
 }
 
-func delDiskDB(t *testing.T, db DB) {
+func delDiskDB(t testing.TB, db DB) {
 	require.NoError(t, db.Close())
 	require.NoError(t, os.Remove(testDBName))
 }
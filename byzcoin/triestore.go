@@ -0,0 +1,334 @@
+package byzcoin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/xerrors"
+)
+
+// TrieDBEnv is the environment variable selecting where a conode stores the
+// global states of its chains:
+//   - "bbolt", the default, stores them in the database of the conode
+//   - "leveldb" stores them in a LevelDB database next to it, whose path is
+//     given by TrieLevelDBPath. This avoids the write amplification and the
+//     single writer of bbolt when committing the blocks of large chains.
+//
+// When switching to "leveldb", the global states found in the bbolt database
+// are migrated the first time they are used. MigrateTrieDB can be used to
+// migrate them offline.
+const TrieDBEnv = "COTHORITY_BYZCOIN_TRIE_DB"
+
+// TrieLevelDBPath returns the path of the LevelDB database holding the
+// global states, given the path of the database of the conode.
+func TrieLevelDBPath(dbPath string) string {
+	return dbPath + ".trie"
+}
+
+// trieStore gives access to the storage of the global states of the chains.
+type trieStore interface {
+	// open returns the storage of the global state of the chain, which is
+	// empty if the chain has no global state yet.
+	open(id skipchain.SkipBlockID) (trie.DB, error)
+	// remove deletes the global state of the chain.
+	remove(id skipchain.SkipBlockID) error
+	// count returns the number of key/value pairs of the global state of
+	// the chain.
+	count(id skipchain.SkipBlockID) (int, error)
+	// close releases the storage, once the service is done with it.
+	close() error
+}
+
+// newTrieStore returns the storage selected by TrieDBEnv.
+func newTrieStore(c *onet.Context) (trieStore, error) {
+	bolt := boltTrieStore{c}
+	switch backend := os.Getenv(TrieDBEnv); backend {
+	case "", "bbolt":
+		return bolt, nil
+	case "leveldb":
+		// Any bucket gives the path of the database of the conode, so the
+		// one of the state changes is used, which always exists.
+		db, _ := c.GetAdditionalBucket(bucketStateChangeStorage)
+		path := TrieLevelDBPath(db.Path())
+		ldb, err := leveldb.OpenFile(path, nil)
+		if err != nil {
+			return nil, xerrors.Errorf("opening %s: %v", path, err)
+		}
+		log.Lvl2("Storing the global states in", path)
+		return newLevelTrieStore(ldb, bolt), nil
+	default:
+		return nil, xerrors.Errorf("unknown %s: %s", TrieDBEnv, backend)
+	}
+}
+
+// trieBucketName returns the name of the bucket of the global state of the
+// chain, as given to onet.Context.GetAdditionalBucket.
+func trieBucketName(id skipchain.SkipBlockID) []byte {
+	return []byte(fmt.Sprintf("%x", id))
+}
+
+// conodeBucketName returns the name under which the conode stores the bucket
+// of the service. It mirrors onet.Context.GetAdditionalBucket, for the tools
+// that open the database of a stopped conode.
+func conodeBucketName(name []byte) []byte {
+	return append([]byte(ServiceName+"_"), name...)
+}
+
+// boltTrieStore stores the global states in buckets of the database of the
+// conode.
+type boltTrieStore struct {
+	c *onet.Context
+}
+
+func (s boltTrieStore) open(id skipchain.SkipBlockID) (trie.DB, error) {
+	db, name := s.c.GetAdditionalBucket(trieBucketName(id))
+	return trie.NewDiskDB(db, name), nil
+}
+
+func (s boltTrieStore) remove(id skipchain.SkipBlockID) error {
+	db, name := s.c.GetAdditionalBucket(trieBucketName(id))
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(name)
+	})
+}
+
+func (s boltTrieStore) count(id skipchain.SkipBlockID) (int, error) {
+	db, name := s.c.GetAdditionalBucket(trieBucketName(id))
+	n := 0
+	err := db.View(func(tx *bbolt.Tx) error {
+		n = tx.Bucket(name).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// close does nothing, as the database belongs to the conode.
+func (s boltTrieStore) close() error {
+	return nil
+}
+
+// levelTrieStore stores the global states in a LevelDB database shared by
+// all the chains. The updates of a global state are serialized by its
+// trie.DB, so there is a single one per chain.
+type levelTrieStore struct {
+	db   *leveldb.DB
+	bolt boltTrieStore
+	sync.Mutex
+	dbs map[string]trie.DB
+}
+
+func newLevelTrieStore(db *leveldb.DB, bolt boltTrieStore) *levelTrieStore {
+	return &levelTrieStore{
+		db:   db,
+		bolt: bolt,
+		dbs:  make(map[string]trie.DB),
+	}
+}
+
+// get returns the trie.DB of the chain, which is created the first time.
+// The caller must hold the lock.
+func (s *levelTrieStore) get(id skipchain.SkipBlockID) trie.DB {
+	key := string(id)
+	db, ok := s.dbs[key]
+	if !ok {
+		db = trie.NewLevelDB(s.db, trieBucketName(id))
+		s.dbs[key] = db
+	}
+	return db
+}
+
+func (s *levelTrieStore) open(id skipchain.SkipBlockID) (trie.DB, error) {
+	s.Lock()
+	defer s.Unlock()
+	db := s.get(id)
+	empty, err := isEmptyTrieDB(db)
+	if err != nil {
+		return nil, xerrors.Errorf("reading db: %v", err)
+	}
+	if !empty {
+		return db, nil
+	}
+
+	// Migrate the global state stored by the bbolt backend, if any.
+	old, err := s.bolt.open(id)
+	if err != nil {
+		return nil, xerrors.Errorf("opening bbolt db: %v", err)
+	}
+	empty, err = isEmptyTrieDB(old)
+	if err != nil {
+		return nil, xerrors.Errorf("reading bbolt db: %v", err)
+	}
+	if empty {
+		return db, nil
+	}
+	log.Lvlf1("Migrating the global state of %x to LevelDB", id)
+	err = migrateTrieDB(db, old)
+	if err != nil {
+		return nil, xerrors.Errorf("migrating: %v", err)
+	}
+	err = s.bolt.remove(id)
+	if err != nil {
+		return nil, xerrors.Errorf("removing bbolt db: %v", err)
+	}
+	return db, nil
+}
+
+func (s *levelTrieStore) remove(id skipchain.SkipBlockID) error {
+	s.Lock()
+	defer s.Unlock()
+	err := trie.Clear(s.get(id))
+	if err != nil {
+		return err
+	}
+	delete(s.dbs, string(id))
+	return nil
+}
+
+// count iterates over the global state, as LevelDB keeps no count of the
+// keys.
+func (s *levelTrieStore) count(id skipchain.SkipBlockID) (int, error) {
+	s.Lock()
+	db := s.get(id)
+	s.Unlock()
+	n := 0
+	err := db.View(func(b trie.Bucket) error {
+		return b.ForEach(func([]byte, []byte) error {
+			n++
+			return nil
+		})
+	})
+	return n, err
+}
+
+func (s *levelTrieStore) close() error {
+	return s.db.Close()
+}
+
+// MigrateTrieDB copies the global state of the chain from the bbolt database
+// of a conode to the LevelDB database used when TrieDBEnv is "leveldb", and
+// then removes it from the bbolt database. The conode must be stopped.
+func MigrateTrieDB(db *bbolt.DB, id skipchain.SkipBlockID) error {
+	name := conodeBucketName(trieBucketName(id))
+	err := db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(name) == nil {
+			return xerrors.Errorf("no global state for %x", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ldb, err := leveldb.OpenFile(TrieLevelDBPath(db.Path()), nil)
+	if err != nil {
+		return xerrors.Errorf("opening LevelDB: %v", err)
+	}
+	defer ldb.Close()
+	dst := trie.NewLevelDB(ldb, trieBucketName(id))
+	empty, err := isEmptyTrieDB(dst)
+	if err != nil {
+		return xerrors.Errorf("reading LevelDB: %v", err)
+	}
+	if !empty {
+		return xerrors.Errorf("global state of %x already in LevelDB", id)
+	}
+
+	err = migrateTrieDB(dst, trie.NewDiskDB(db, name))
+	if err != nil {
+		return xerrors.Errorf("migrating: %v", err)
+	}
+	return db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(name)
+	})
+}
+
+// CollectTrieGarbage removes the unreachable nodes of the global state of the
+// chain stored by a stopped conode, either in its bbolt database or in its
+// LevelDB database if it has been migrated. If dryRun is true, the nodes are
+// only counted. There is no online collection: the service never calls it,
+// as it opens the databases of the conode itself.
+func CollectTrieGarbage(db *bbolt.DB, id skipchain.SkipBlockID, dryRun bool) (trie.GCResult, error) {
+	var res trie.GCResult
+	name := conodeBucketName(trieBucketName(id))
+	var inBolt bool
+	err := db.View(func(tx *bbolt.Tx) error {
+		inBolt = tx.Bucket(name) != nil
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+
+	var tdb trie.DB
+	if inBolt {
+		tdb = trie.NewDiskDB(db, name)
+	} else {
+		path := TrieLevelDBPath(db.Path())
+		if _, err := os.Stat(path); err != nil {
+			return res, xerrors.Errorf("no global state for %x", id)
+		}
+		ldb, err := leveldb.OpenFile(path, nil)
+		if err != nil {
+			return res, xerrors.Errorf("opening LevelDB: %v", err)
+		}
+		defer ldb.Close()
+		tdb = trie.NewLevelDB(ldb, trieBucketName(id))
+	}
+
+	t, err := trie.LoadTrie(tdb)
+	if err != nil {
+		return res, xerrors.Errorf("loading trie: %v", err)
+	}
+	if dryRun {
+		return t.FindGarbage()
+	}
+	return t.GC()
+}
+
+// migrateTrieDB copies the trie in src to dst, and checks that the copy has
+// the same root.
+func migrateTrieDB(dst, src trie.DB) error {
+	t, err := trie.LoadTrie(src)
+	if err != nil {
+		return xerrors.Errorf("loading trie: %v", err)
+	}
+	err = dst.Update(func(b trie.Bucket) error {
+		return t.CopyTo(b)
+	})
+	if err != nil {
+		return xerrors.Errorf("copying trie: %v", err)
+	}
+	copied, err := trie.LoadTrie(dst)
+	if err != nil {
+		return xerrors.Errorf("loading copy: %v", err)
+	}
+	if !bytes.Equal(t.GetRoot(), copied.GetRoot()) {
+		return xerrors.New("copy has a different root")
+	}
+	return nil
+}
+
+// isEmptyTrieDB returns whether the database has no key/value pair.
+func isEmptyTrieDB(db trie.DB) (bool, error) {
+	empty := true
+	err := db.View(func(b trie.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			empty = false
+			return errStopIteration
+		})
+	})
+	if err != nil && err != errStopIteration {
+		return false, err
+	}
+	return empty, nil
+}
+
+var errStopIteration = xerrors.New("stop iteration")
@@ -0,0 +1,174 @@
+package byzcoin
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/syndtr/goleveldb/leveldb"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin/trie"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	bbolt "go.etcd.io/bbolt"
+)
+
+func storeTestTrie(t *testing.T, db trie.DB) *stateTrie {
+	st, err := newStateTrie(db, []byte("nonce"))
+	require.NoError(t, err)
+	require.NoError(t, st.StoreAll([]StateChange{{
+		StateAction: Create,
+		InstanceID:  []byte("key"),
+		Value:       []byte("value"),
+	}}, 1, CurrentVersion))
+	return st
+}
+
+func requireEmptyTrieDB(t *testing.T, db trie.DB) {
+	empty, err := isEmptyTrieDB(db)
+	require.NoError(t, err)
+	require.True(t, empty)
+}
+
+func TestTrieStore_LevelDB(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+	s := local.GenServers(1)[0].Service(ServiceName).(*Service)
+	id := skipchain.SkipBlockID("chain")
+
+	bolt := boltTrieStore{s.Context}
+	db, err := bolt.open(id)
+	require.NoError(t, err)
+	st := storeTestTrie(t, db)
+	n, err := bolt.count(id)
+	require.NoError(t, err)
+	require.NotZero(t, n)
+
+	dir, err := ioutil.TempDir("", "trie")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ldb, err := leveldb.OpenFile(dir, nil)
+	require.NoError(t, err)
+	level := newLevelTrieStore(ldb, bolt)
+	defer level.close()
+
+	// The global state is migrated when it is opened.
+	db, err = level.open(id)
+	require.NoError(t, err)
+	migrated, err := loadStateTrie(db)
+	require.NoError(t, err)
+	require.Equal(t, st.GetRoot(), migrated.GetRoot())
+	require.Equal(t, 1, migrated.GetIndex())
+	// The updates of a chain are serialized by a single instance.
+	again, err := level.open(id)
+	require.NoError(t, err)
+	require.True(t, db == again)
+	levelN, err := level.count(id)
+	require.NoError(t, err)
+	require.Equal(t, n, levelN)
+	db, err = bolt.open(id)
+	require.NoError(t, err)
+	requireEmptyTrieDB(t, db)
+
+	// A new chain starts empty.
+	db, err = level.open(skipchain.SkipBlockID("other"))
+	require.NoError(t, err)
+	requireEmptyTrieDB(t, db)
+
+	require.NoError(t, level.remove(id))
+	db, err = level.open(id)
+	require.NoError(t, err)
+	requireEmptyTrieDB(t, db)
+}
+
+func TestTrieStore_MigrateTrieDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conode")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bbolt.Open(filepath.Join(dir, "conode.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	id := skipchain.SkipBlockID("chain")
+	require.Error(t, MigrateTrieDB(db, id))
+
+	name := conodeBucketName(trieBucketName(id))
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket(name)
+		return err
+	}))
+	st := storeTestTrie(t, trie.NewDiskDB(db, name))
+
+	require.NoError(t, MigrateTrieDB(db, id))
+	require.NoError(t, db.View(func(tx *bbolt.Tx) error {
+		require.Nil(t, tx.Bucket(name))
+		return nil
+	}))
+
+	ldb, err := leveldb.OpenFile(TrieLevelDBPath(db.Path()), nil)
+	require.NoError(t, err)
+	defer ldb.Close()
+	migrated, err := loadStateTrie(trie.NewLevelDB(ldb, trieBucketName(id)))
+	require.NoError(t, err)
+	require.Equal(t, st.GetRoot(), migrated.GetRoot())
+}
+
+func TestTrieStore_Env(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+	s := local.GenServers(1)[0].Service(ServiceName).(*Service)
+
+	defer os.Unsetenv(TrieDBEnv)
+	require.NoError(t, os.Setenv(TrieDBEnv, "unknown"))
+	_, err := newTrieStore(s.Context)
+	require.Error(t, err)
+
+	require.NoError(t, os.Setenv(TrieDBEnv, "bbolt"))
+	store, err := newTrieStore(s.Context)
+	require.NoError(t, err)
+	require.IsType(t, boltTrieStore{}, store)
+}
+
+func TestTrieStore_CollectTrieGarbage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conode")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	db, err := bbolt.Open(filepath.Join(dir, "conode.db"), 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	id := skipchain.SkipBlockID("chain")
+	_, err = CollectTrieGarbage(db, id, true)
+	require.Error(t, err)
+
+	name := conodeBucketName(trieBucketName(id))
+	require.NoError(t, db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucket(name)
+		return err
+	}))
+	tdb := trie.NewDiskDB(db, name)
+	storeTestTrie(t, tdb)
+	garbage := make([]byte, 32)
+	require.NoError(t, tdb.Update(func(b trie.Bucket) error {
+		return b.Put(garbage, []byte("node"))
+	}))
+
+	res, err := CollectTrieGarbage(db, id, true)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Garbage)
+	res, err = CollectTrieGarbage(db, id, false)
+	require.NoError(t, err)
+	require.Equal(t, 1, res.Garbage)
+	res, err = CollectTrieGarbage(db, id, true)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Garbage)
+
+	// The global state is found once migrated to LevelDB.
+	require.NoError(t, MigrateTrieDB(db, id))
+	res, err = CollectTrieGarbage(db, id, true)
+	require.NoError(t, err)
+	require.Equal(t, 0, res.Garbage)
+	require.NotEqual(t, 0, res.Reachable)
+}
@@ -48,6 +48,9 @@ type txProcessor interface {
 	GetBlockSize() int
 	// GetInterval should return the block interval.
 	GetInterval() time.Duration
+	// HasScheduledTxs should return true if scheduled instructions are due,
+	// so that a block is created even without new transactions.
+	HasScheduledTxs() bool
 	// Stop stops the txProcessor. Once it is called, the caller should not
 	// expect the other functions in the interface to work as expected.
 	Stop()
@@ -97,10 +100,15 @@ type defaultTxProcessor struct {
 	stopCollect chan bool
 	scID        skipchain.SkipBlockID
 	latest      *skipchain.SkipBlock
+	// contractVersions holds the contract versions supported by the roster
+	// during the latest collection of transactions, or nil if they were not
+	// received.
+	contractVersions *contractVersionBuffer
 	sync.Mutex
 }
 
 func (s *defaultTxProcessor) CollectTx() (*collectTxResult, error) {
+	start := time.Now()
 	// Need to update the config, as in the meantime a new block should have
 	// arrived with a possible new configuration.
 	bcConfig, err := s.LoadConfig(s.scID)
@@ -159,9 +167,15 @@ func (s *defaultTxProcessor) CollectTx() (*collectTxResult, error) {
 	// interval, because we'll use the other half to process the
 	// transactions.
 	protocolTimeout := time.After(bcConfig.BlockInterval / 2)
+	// finishTimeout bounds the wait for the protocol to stop once it has
+	// been told to finish.
+	var finishTimeout <-chan time.Time
 
 	var txs []ClientTransaction
 	commonVersion := Version(0)
+	// The contract versions are the ones of this collection only, so that
+	// an upgrade is never accepted because of an earlier roster.
+	var contractVersions *contractVersionBuffer
 
 collectTxLoop:
 	for {
@@ -170,9 +184,18 @@ collectTxLoop:
 			// The value gives a version that is the same for a threshold of conodes but it
 			// can be the latest version available so it needs to check that to not create a
 			// block to upgrade from version x to x (which is not an upgrade per se).
+		case cvb := <-root.ContractVersionsChan:
+			contractVersions = &cvb
 		case newTxs, more := <-root.TxsChan:
 			if more {
 				for _, ct := range newTxs {
+					// Only the leader adds the scheduled executions, and
+					// the nodes refuse a block with other ones, so a
+					// faulty node could otherwise halt the chain.
+					if hasScheduledExecution(ct) {
+						log.Lvl2(s.ServerIdentity(), "dropping collected scheduled execution")
+						continue
+					}
 					txsz := txSize(TxResult{ClientTransaction: ct})
 					if txsz < bcConfig.MaxBlockSize {
 						txs = append(txs, ct)
@@ -181,19 +204,43 @@ collectTxLoop:
 					}
 				}
 			} else {
+				// The protocol sends the contract versions before
+				// closing the channel, so they are already buffered.
+				select {
+				case cvb := <-root.ContractVersionsChan:
+					contractVersions = &cvb
+				default:
+				}
 				break collectTxLoop
 			}
 		case <-protocolTimeout:
 			log.Lvl2(s.ServerIdentity(), "timeout while collecting transactions from other nodes")
+			// The protocol stops waiting for the other nodes and sends
+			// the contract versions of the nodes which replied, before
+			// closing TxsChan.
 			close(root.Finish)
+			protocolTimeout = nil
+			finishTimeout = time.After(time.Second)
+		case <-finishTimeout:
+			log.Lvl2(s.ServerIdentity(), "collection protocol didn't finish")
 			break collectTxLoop
 		case <-s.stopCollect:
 			log.Lvl2(s.ServerIdentity(), "abort collection of transactions")
-			close(root.Finish)
+			if finishTimeout == nil {
+				close(root.Finish)
+			}
 			break collectTxLoop
 		}
 	}
 
+	s.Lock()
+	s.contractVersions = contractVersions
+	s.Unlock()
+
+	for _, tx := range txs {
+		s.txTracer.record(tx.Instructions.Hash(), TraceCollectTx, start, -1, nil)
+	}
+
 	return &collectTxResult{Txs: txs, CommonVersion: commonVersion}, nil
 }
 
@@ -212,7 +259,17 @@ func (s *defaultTxProcessor) ProcessTx(tx ClientTransaction, inState *txProcesso
 
 	tx.Instructions.SetVersion(header.Version)
 
+	start := time.Now()
+	if err := s.checkContractUpgrades(tx); err != nil {
+		// The block would be refused by the nodes that cannot execute the
+		// new version of the contract, so the transaction is dropped.
+		log.Lvl2(s.ServerIdentity(), "dropping transaction:", err)
+		s.txTracer.record(tx.Instructions.Hash(), TraceProcessTx, start, -1, err)
+		return []*txProcessorState{inState}, nil
+	}
+
 	scsOut, sstOut, err := s.processOneTx(inState.sst, tx, s.scID)
+	s.txTracer.record(tx.Instructions.Hash(), TraceProcessTx, start, -1, err)
 
 	// try to create a new state
 	newState := func() *txProcessorState {
@@ -257,6 +314,36 @@ func (s *defaultTxProcessor) ProcessTx(tx ClientTransaction, inState *txProcesso
 	return newStates, nil
 }
 
+// checkContractUpgrades returns an error if the transaction activates a
+// version of a contract that is not supported by the leader or by a threshold
+// of the roster.
+func (s *defaultTxProcessor) checkContractUpgrades(tx ClientTransaction) error {
+	s.Lock()
+	cvb := s.contractVersions
+	s.Unlock()
+
+	for _, instr := range tx.Instructions {
+		if instr.Invoke == nil || !instr.InstanceID.Equal(ConfigInstanceID) ||
+			instr.Invoke.Command != cmdConfigUpgradeContract {
+			continue
+		}
+
+		var cv ContractVersion
+		err := protobuf.Decode(instr.Invoke.Args.Search("version"), &cv)
+		if err != nil {
+			// The config contract will refuse the instruction.
+			continue
+		}
+		if _, ok := s.contracts.SearchVersion(cv.ContractID, cv.Version); !ok {
+			return xerrors.Errorf("leader doesn't support %s", cv)
+		}
+		if cvb == nil || !cvb.hasThresholdFor(cv.ContractID, cv.Version) {
+			return xerrors.Errorf("not enough nodes support %s", cv)
+		}
+	}
+	return nil
+}
+
 // ProposeBlock basically calls s.createNewBlock which might block. There is
 // nothing we can do about it other than waiting for the timeout.
 func (s *defaultTxProcessor) ProposeBlock(state *txProcessorState) error {
@@ -264,10 +351,24 @@ func (s *defaultTxProcessor) ProposeBlock(state *txProcessorState) error {
 	if err != nil {
 		return xerrors.Errorf("reading trie: %v", err)
 	}
+	start := time.Now()
 	_, err = s.createNewBlock(s.scID, &config.Roster, state.txs)
+	if err == nil {
+		metricBlockCreation.ObserveSince(start)
+	}
 	return cothority.ErrorOrNil(err, "creating block")
 }
 
+// HasScheduledTxs returns true if the next block will execute scheduled
+// instructions.
+func (s *defaultTxProcessor) HasScheduledTxs() bool {
+	st, err := s.getStateTrie(s.scID)
+	if err != nil {
+		return false
+	}
+	return len(s.scheduled.due(s.scID, st, time.Now().UnixNano())) > 0
+}
+
 func (s *defaultTxProcessor) ProposeUpgradeBlock(version Version) error {
 	_, err := s.createUpgradeVersionBlock(s.scID, version)
 	return cothority.ErrorOrNil(err, "creating block")
@@ -302,9 +403,11 @@ func (s *defaultTxProcessor) GetBlockSize() int {
 	if err != nil {
 		log.Error(s.ServerIdentity(), "couldn't get configuration - this is bad and probably "+
 			"a problem with the database! ", err)
-		return defaultMaxBlockSize
+		return defaultMaxBlockSize - scheduledTxsSize
 	}
-	return bcConfig.MaxBlockSize
+	// The executions of the scheduled instructions are added to the block
+	// when it is created.
+	return bcConfig.MaxBlockSize - scheduledTxsSize
 }
 
 func (s *defaultTxProcessor) Stop() {
@@ -362,8 +465,10 @@ func (p *txPipeline) collectTx() {
 						// channel not full, do nothing
 					default:
 						log.Warn("dropping transactions because there are too many")
+						metricTxDropped.Inc()
 					}
 				}
+				metricTxQueue.Set(float64(len(p.ctxChan)))
 			}
 		}
 	}()
@@ -435,7 +540,7 @@ func (p *txPipeline) processTxs(initialState *txProcessorState) {
 				// we do not check for the length because currentState
 				// should always be non-empty, otherwise it's a
 				// programmer error
-				if len(currentState[0].txs) == 0 {
+				if len(currentState[0].txs) == 0 && !p.processor.HasScheduledTxs() {
 					break
 				}
 
@@ -475,6 +580,7 @@ func (p *txPipeline) processTxs(initialState *txProcessorState) {
 					log.Lvl3("stopping txs processor")
 					return
 				}
+				metricTxQueue.Set(float64(len(p.ctxChan)))
 				txh := tx.Instructions.HashWithSignatures()
 				for _, txHash := range txHashes {
 					if bytes.Compare(txHash, txh) == 0 {
@@ -117,6 +117,10 @@ func (p *defaultMockTxProc) GetInterval() time.Duration {
 	return 100 * time.Millisecond
 }
 
+func (p *defaultMockTxProc) HasScheduledTxs() bool {
+	return false
+}
+
 func (p *defaultMockTxProc) Stop() {
 }
 
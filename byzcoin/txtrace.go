@@ -0,0 +1,213 @@
+package byzcoin
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+	"golang.org/x/xerrors"
+)
+
+// These are the stages of the lifecycle of a transaction that are recorded
+// in the spans returned by GetTxTrace.
+const (
+	// TraceAddTransaction is the verification of the transaction by the node
+	// receiving it from the client, until it is stored in the buffer.
+	TraceAddTransaction = "AddTransaction"
+	// TraceTxBuffer is the time spent in the buffer of the node until the
+	// leader collects the transaction.
+	TraceTxBuffer = "txBuffer"
+	// TraceCollectTx is the collection of the transaction by the leader.
+	TraceCollectTx = "CollectTx"
+	// TraceProcessTx is the execution of the transaction by the leader.
+	TraceProcessTx = "ProcessTx"
+	// TraceCreateNewBlock is the creation of the block holding the
+	// transaction, including the signature of the block.
+	TraceCreateNewBlock = "createNewBlock"
+	// TraceBFTSigning is the collective signature of the block holding the
+	// transaction.
+	TraceBFTSigning = "BFTSigning"
+	// TraceUpdateTrie is the application of the block holding the
+	// transaction to the global state of a node.
+	TraceUpdateTrie = "updateTrieCallback"
+)
+
+// defaultTxTraceSize is the number of spans kept by each node.
+const defaultTxTraceSize = 8192
+
+// txTracePendingTimeout is the time after which an opened span that never got
+// closed can be dropped.
+const txTracePendingTimeout = 10 * time.Minute
+
+type txTraceElem struct {
+	hash []byte
+	span TxSpan
+}
+
+// txTracer records the spans of the transactions seen by the node in a ring
+// buffer, so that the memory used stays bounded. Spans that cover more than
+// one function, like the time spent in the buffer, are first opened and
+// then closed when the transaction leaves the stage.
+type txTracer struct {
+	sync.Mutex
+	current int
+	items   []txTraceElem
+	pending map[string]time.Time
+}
+
+func newTxTracer(size int) *txTracer {
+	return &txTracer{
+		items:   make([]txTraceElem, size),
+		pending: make(map[string]time.Time),
+	}
+}
+
+// record adds the span of a stage that started at the given time and ends
+// now. The block index is ignored if it is negative.
+func (t *txTracer) record(hash []byte, stage string, start time.Time, index int, err error) {
+	span := TxSpan{
+		Stage:      stage,
+		Start:      start.UnixNano(),
+		Duration:   time.Since(start),
+		BlockIndex: -1,
+	}
+	if index >= 0 {
+		span.BlockIndex = index
+	}
+	if err != nil {
+		span.Error = err.Error()
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	t.items[t.current] = txTraceElem{hash: append([]byte{}, hash...), span: span}
+	t.current = (t.current + 1) % len(t.items)
+}
+
+// open starts a span that will be recorded when close is called with the
+// same hash and stage.
+func (t *txTracer) open(hash []byte, stage string) {
+	t.Lock()
+	defer t.Unlock()
+
+	if len(t.pending) >= len(t.items) {
+		// Drop the spans that will never be closed, e.g. because the
+		// buffer of transactions was full.
+		for k, start := range t.pending {
+			if time.Since(start) > txTracePendingTimeout {
+				delete(t.pending, k)
+			}
+		}
+		if len(t.pending) >= len(t.items) {
+			return
+		}
+	}
+	t.pending[stage+string(hash)] = time.Now()
+}
+
+// close records a span previously opened. It does nothing if the span
+// doesn't exist.
+func (t *txTracer) close(hash []byte, stage string, index int, err error) {
+	key := stage + string(hash)
+
+	t.Lock()
+	start, ok := t.pending[key]
+	delete(t.pending, key)
+	t.Unlock()
+
+	if ok {
+		t.record(hash, stage, start, index, err)
+	}
+}
+
+// get returns the spans recorded for the transaction, sorted by their start.
+func (t *txTracer) get(hash []byte) []TxSpan {
+	t.Lock()
+	defer t.Unlock()
+
+	var spans []TxSpan
+	for _, item := range t.items {
+		if bytes.Equal(item.hash, hash) {
+			spans = append(spans, item.span)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+	return spans
+}
+
+// traceTxs records the same span for all the transactions.
+func (t *txTracer) traceTxs(txs TxResults, stage string, start time.Time, index int, err error) {
+	for _, tx := range txs {
+		t.record(tx.ClientTransaction.Instructions.Hash(), stage, start, index, err)
+	}
+}
+
+// GetTxTrace returns the spans recorded for a transaction. Unless the request
+// is local, the spans of all the members of the roster are aggregated.
+func (s *Service) GetTxTrace(req *GetTxTrace) (*GetTxTraceResponse, error) {
+	if !s.hasByzCoinVerification(req.ByzCoinID) {
+		return nil, xerrors.New("unknown byzcoin ID")
+	}
+
+	resp := &GetTxTraceResponse{}
+	for _, span := range s.txTracer.get(req.TxHash) {
+		span.ServerIdentity = s.ServerIdentity()
+		resp.Spans = append(resp.Spans, span)
+	}
+
+	if req.Local {
+		return resp, nil
+	}
+
+	latest, err := s.db().GetLatestByID(req.ByzCoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("getting latest block: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, si := range latest.Roster.List {
+		if si.Equal(s.ServerIdentity()) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(si *network.ServerIdentity) {
+			defer wg.Done()
+
+			localReq := &GetTxTrace{
+				ByzCoinID: req.ByzCoinID,
+				TxHash:    req.TxHash,
+				Local:     true,
+			}
+			reply := &GetTxTraceResponse{}
+			cl := onet.NewClient(cothority.Suite, ServiceName)
+			err := cl.SendProtobuf(si, localReq, reply)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				log.Lvlf2("%v couldn't get trace of %v: %v", s.ServerIdentity(), si, err)
+				resp.Errors = append(resp.Errors, si.Address.String()+": "+err.Error())
+				return
+			}
+			resp.Spans = append(resp.Spans, reply.Spans...)
+		}(si)
+	}
+	wg.Wait()
+
+	sort.SliceStable(resp.Spans, func(i, j int) bool {
+		return resp.Spans[i].Start < resp.Spans[j].Start
+	})
+	sort.Strings(resp.Errors)
+
+	return resp, nil
+}
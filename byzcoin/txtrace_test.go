@@ -0,0 +1,85 @@
+package byzcoin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+)
+
+func TestTxTracer(t *testing.T) {
+	tr := newTxTracer(3)
+	h1 := []byte{1}
+	h2 := []byte{2}
+
+	start := time.Now()
+	tr.record(h1, TraceProcessTx, start.Add(time.Second), -1, xerrors.New("oops"))
+	tr.record(h1, TraceCollectTx, start, 3, nil)
+	tr.record(h2, TraceCollectTx, start, -1, nil)
+
+	spans := tr.get(h1)
+	require.Equal(t, 2, len(spans))
+	require.Equal(t, TraceCollectTx, spans[0].Stage)
+	require.Equal(t, 3, spans[0].BlockIndex)
+	require.Equal(t, TraceProcessTx, spans[1].Stage)
+	require.Equal(t, -1, spans[1].BlockIndex)
+	require.Equal(t, "oops", spans[1].Error)
+
+	// The oldest span is overwritten.
+	tr.record(h2, TraceProcessTx, start, -1, nil)
+	require.Equal(t, 1, len(tr.get(h1)))
+	require.Equal(t, 2, len(tr.get(h2)))
+
+	// Only opened spans are recorded when closed.
+	tr.close(h1, TraceTxBuffer, -1, nil)
+	require.Equal(t, 1, len(tr.get(h1)))
+	tr.open(h2, TraceTxBuffer)
+	tr.close(h2, TraceTxBuffer, -1, nil)
+	spans = tr.get(h2)
+	require.Equal(t, 3, len(spans))
+	require.Equal(t, TraceTxBuffer, spans[2].Stage)
+	require.Equal(t, 0, len(tr.pending))
+}
+
+func TestService_GetTxTrace(t *testing.T) {
+	s := newSer(t, 1, testInterval)
+	defer s.local.CloseAll()
+
+	tx, err := createOneClientTx(s.darc.GetBaseID(), dummyContract, s.value, s.signer)
+	require.NoError(t, err)
+	s.sendTxAndWait(t, tx, 10)
+	s.waitPropagation(t, 1)
+
+	resp, err := s.service().GetTxTrace(&GetTxTrace{
+		ByzCoinID: s.genesis.SkipChainID(),
+		TxHash:    tx.Instructions.Hash(),
+	})
+	require.NoError(t, err)
+	require.Empty(t, resp.Errors)
+
+	stages := make(map[string]int)
+	for _, span := range resp.Spans {
+		require.Empty(t, span.Error)
+		require.NotNil(t, span.ServerIdentity)
+		stages[span.Stage]++
+	}
+	require.Equal(t, 1, stages[TraceAddTransaction])
+	require.Equal(t, 1, stages[TraceTxBuffer])
+	require.Equal(t, 1, stages[TraceCollectTx])
+	require.Equal(t, 1, stages[TraceProcessTx])
+	require.Equal(t, 1, stages[TraceCreateNewBlock])
+	require.Equal(t, 1, stages[TraceBFTSigning])
+	require.Equal(t, len(s.roster.List), stages[TraceUpdateTrie])
+
+	// A local request only returns the spans of the node.
+	resp, err = s.services[1].GetTxTrace(&GetTxTrace{
+		ByzCoinID: s.genesis.SkipChainID(),
+		TxHash:    tx.Instructions.Hash(),
+		Local:     true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(resp.Spans))
+	require.Equal(t, TraceUpdateTrie, resp.Spans[0].Stage)
+	require.Equal(t, 1, resp.Spans[0].BlockIndex)
+}
@@ -135,6 +135,7 @@ func (s *Service) sendViewChangeReq(view viewchange.View) error {
 	if err := req.Sign(s.getPrivateKey()); err != nil {
 		return xerrors.Errorf("signing request: %v", err)
 	}
+	metricViewChangeReqs.Inc()
 	for _, sid := range latest.Roster.List {
 		if sid.Equal(s.ServerIdentity()) {
 			continue
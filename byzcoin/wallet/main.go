@@ -65,6 +65,24 @@ var cmds = cli.Commands{
 				Value: 1,
 			}},
 	},
+	{
+		Name:  "token",
+		Usage: "handle the token accounts guarded by the key of the wallet",
+		Subcommands: cli.Commands{
+			{
+				Name:      "show",
+				Usage:     "shows the balance of a token account",
+				ArgsUsage: "account",
+				Action:    tokenShow,
+			},
+			{
+				Name:      "transfer",
+				Usage:     "transfer tokens from an account to another one",
+				ArgsUsage: "account amount destination",
+				Action:    tokenTransfer,
+			},
+		},
+	},
 }
 
 type config struct {
@@ -275,6 +293,133 @@ func transfer(c *cli.Context) error {
 	return lib.WaitPropagation(c, cl)
 }
 
+// getTokenAccount returns the token account of the instance and its token.
+func getTokenAccount(cl *byzcoin.Client, id []byte) (account contracts.TokenAccount, token contracts.Token, err error) {
+	resp, err := cl.GetProofFromLatest(id)
+	if err != nil {
+		return
+	}
+	_, value, cid, _, err := resp.Proof.KeyValue()
+	if err != nil {
+		return
+	}
+	if !resp.Proof.InclusionProof.Match(id) || cid != contracts.ContractTokenAccountID {
+		err = xerrors.New("not a token account")
+		return
+	}
+	err = protobuf.Decode(value, &account)
+	if err != nil {
+		return
+	}
+
+	resp, err = cl.GetProofFromLatest(account.Coin.Name.Slice())
+	if err != nil {
+		return
+	}
+	_, value, _, _, err = resp.Proof.KeyValue()
+	if err != nil {
+		return
+	}
+	err = protobuf.Decode(value, &token)
+	return
+}
+
+func tokenShow(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return xerrors.New("please give the address of the account")
+	}
+	id, err := hex.DecodeString(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	_, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	account, token, err := getTokenAccount(cl, id)
+	if err != nil {
+		return err
+	}
+	log.Infof("Token is: %s (%s)", token.Name, account.Coin.Name)
+	log.Info("Balance is:", token.FormatAmount(account.Coin.Value))
+	return nil
+}
+
+func tokenTransfer(c *cli.Context) error {
+	if c.NArg() < 3 {
+		return xerrors.New("please give the following arguments: account amount destination")
+	}
+	id, err := hex.DecodeString(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.ParseUint(c.Args().Get(1), 10, 64)
+	if err != nil {
+		return err
+	}
+	target, err := hex.DecodeString(c.Args().Get(2))
+	if err != nil {
+		return err
+	}
+
+	cfg, cl, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	account, _, err := getTokenAccount(cl, id)
+	if err != nil {
+		return err
+	}
+	if amount > account.Coin.Value {
+		return xerrors.New("your account doesn't have enough tokens in it")
+	}
+
+	signer := darc.NewSignerEd25519(cfg.KeyPair.Public, cfg.KeyPair.Private)
+	counters, err := cl.GetSignerCounters(signer.Identity().String())
+	if err != nil {
+		return err
+	}
+	amountBuf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(amountBuf, amount)
+	ctx, err := cl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(id),
+		Invoke: &byzcoin.Invoke{
+			ContractID: contracts.ContractTokenAccountID,
+			Command:    "transfer",
+			Args: byzcoin.Arguments{
+				{
+					Name:  "coins",
+					Value: amountBuf,
+				},
+				{
+					Name:  "destination",
+					Value: target,
+				},
+			},
+		},
+		SignerCounter: []uint64{counters.Counters[0] + 1},
+	})
+	if err != nil {
+		return err
+	}
+	err = ctx.FillSignersAndSignWith(signer)
+	if err != nil {
+		return err
+	}
+
+	_, err = cl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Transaction succeeded")
+
+	return lib.WaitPropagation(c, cl)
+}
+
 func coinHashPub(pub kyber.Point) (iid byzcoin.InstanceID, err error) {
 	buf, err := pub.MarshalBinary()
 	if err != nil {
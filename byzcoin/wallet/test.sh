@@ -18,6 +18,7 @@ main(){
   run testMulti
   run testLoadSave
   run testCoin
+  run testToken
   stopTest
 }
 
@@ -80,6 +81,35 @@ testCoin(){
   testGrep "Balance is: 1100" runWallet 1 show
 }
 
+testToken(){
+  rm -rf config wallet{1,2}
+  runCoBG 1 2 3
+  testOK runBA create public.toml --interval .5s
+  export BC=$( ls config/bc*cfg )
+  testOK runWallet 1 join $BC
+  runGrepSed "Public key is:" "s/.* //" runWallet 1 show
+  PUB=$SED
+
+  key=config/key*cfg
+  ADMIN=ed25519:$( echo $key | sed -e "s/.*:\(.*\).cfg/\1/" )
+  for rule in spawn:token spawn:token_account invoke:token.mint; do
+    testOK runBA darc rule -rule $rule -identity $ADMIN
+  done
+  testOK runBA darc rule -rule invoke:token_account.transfer -identity ed25519:$PUB
+
+  TOKEN=$( runBA contract token spawn --name "Test token" --symbol TST --decimals 2 | grep -A 1 "instance id" | sed -n 2p )
+  ACCOUNT1=$( runBA contract token account spawn --token $TOKEN | grep -A 1 "instance id" | sed -n 2p )
+  ACCOUNT2=$( runBA contract token account spawn --token $TOKEN | grep -A 1 "instance id" | sed -n 2p )
+  testOK runBA contract token invoke mint -i $TOKEN --coins 150 --destination $ACCOUNT1
+
+  testGrep "Balance is: 1.50 TST" runWallet 1 token show $ACCOUNT1
+  testFail runWallet 1 token transfer $ACCOUNT1 200 $ACCOUNT2
+  testOK runWallet 1 token transfer $ACCOUNT1 50 $ACCOUNT2
+  testGrep "Balance is: 1.00 TST" runWallet 1 token show $ACCOUNT1
+  testGrep "Balance is: 0.50 TST" runWallet 1 token show $ACCOUNT2
+  export -n BC
+}
+
 runBA(){
   ./bcadmin -c config/ --debug $DBG_BA "$@"
 }
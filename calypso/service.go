@@ -45,6 +45,7 @@ import (
 	"go.dedis.ch/cothority/v3/calypso/protocol"
 	"go.dedis.ch/cothority/v3/darc"
 	dkgprotocol "go.dedis.ch/cothority/v3/dkg/pedersen"
+	"go.dedis.ch/cothority/v3/metrics"
 	"go.dedis.ch/cothority/v3/skipchain"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/share"
@@ -69,6 +70,9 @@ const calypsoReshareProto = "calypso_reshare_proto"
 
 var allowInsecureAdmin = false
 
+var metricDecryptions = metrics.NewCounter("calypso_decryptions_total",
+	"Number of decryption requests handled by the node, by result.", "result")
+
 // Allows one to register custom MakeAttrInterpreters for the read request
 // verify.
 var readMakeAttrInterpreter = make([]makeAttrInterpreterWrapper, 0)
@@ -497,6 +501,9 @@ func (s *Service) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error
 	reply = &DecryptKeyReply{}
 	log.Lvl2(s.ServerIdentity(), "Re-encrypt the key to the public key of the reader")
 
+	result := "error"
+	defer func() { metricDecryptions.Inc(result) }()
+
 	var read Read
 	if err := dkr.Read.VerifyAndDecode(cothority.Suite, ContractReadID, &read); err != nil {
 		return nil, xerrors.New("didn't get a read instance: " + err.Error())
@@ -576,6 +583,7 @@ func (s *Service) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error
 		return nil, xerrors.Errorf("failed to start ocs-protocol: %v", err)
 	}
 	if !<-ocsProto.Reencrypted {
+		result = "refused"
 		return nil, xerrors.New("reencryption got refused")
 	}
 	log.Lvl3("Reencryption protocol is done.")
@@ -586,6 +594,7 @@ func (s *Service) DecryptKey(dkr *DecryptKey) (reply *DecryptKeyReply, err error
 	}
 	reply.C = write.C
 	log.Lvl3("Successfully reencrypted the key")
+	result = "success"
 	return
 }
 
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path"
 	"reflect"
@@ -26,11 +27,13 @@ import (
 	cli "github.com/urfave/cli"
 	"go.dedis.ch/cothority/v3"
 	_ "go.dedis.ch/cothority/v3/authprox"
+	_ "go.dedis.ch/cothority/v3/bwasm"
 	_ "go.dedis.ch/cothority/v3/byzcoin"
 	_ "go.dedis.ch/cothority/v3/byzcoin/contracts"
 	_ "go.dedis.ch/cothority/v3/calypso"
 	_ "go.dedis.ch/cothority/v3/eventlog"
 	_ "go.dedis.ch/cothority/v3/evoting/service"
+	"go.dedis.ch/cothority/v3/metrics"
 	_ "go.dedis.ch/cothority/v3/personhood"
 	_ "go.dedis.ch/cothority/v3/skipchain"
 	status "go.dedis.ch/cothority/v3/status/service"
@@ -124,6 +127,11 @@ func main() {
 			Value: path.Join(cfgpath.GetConfigPath(DefaultName), app.DefaultServerConfig),
 			Usage: "Configuration file of the server",
 		},
+		cli.StringFlag{
+			Name:   "metrics",
+			EnvVar: "CONODE_METRICS",
+			Usage:  "address where the metrics are served over HTTP on " + metrics.Path + ", e.g. localhost:9100 (disabled if empty)",
+		},
 	}
 	cliApp.Before = func(c *cli.Context) error {
 		log.SetDebugVisible(c.Int("debug"))
@@ -156,10 +164,34 @@ func runServer(ctx *cli.Context) error {
 	if raiseFdLimit != nil {
 		raiseFdLimit()
 	}
+	if addr := ctx.GlobalString("metrics"); addr != "" {
+		go serveMetrics(addr)
+	}
 	app.RunServer(config)
 	return nil
 }
 
+// serveMetrics serves the metrics of the conode in the text exposition format
+// on the given address. They can't be served by the websocket server, as
+// onet keeps its http.ServeMux unexported and only routes the messages of
+// the services to it, and app.RunServer doesn't return the server, so the
+// metrics use their own listener. The timeouts prevent slow clients from
+// holding connections open.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle(metrics.Path, metrics.DefaultRegistry)
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	log.Lvl1("Serving metrics on", addr+metrics.Path)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Error("Couldn't serve metrics:", err)
+	}
+}
+
 // checkConfig contacts all servers and verifies if it receives a valid
 // signature from each.
 func checkConfig(c *cli.Context) error {
@@ -0,0 +1,75 @@
+package darc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"golang.org/x/xerrors"
+)
+
+// MarshalText implements encoding.TextMarshaler, so that the ID is written in
+// hexadecimal in JSON.
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(id)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *ID) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*id = nil
+		return nil
+	}
+	buf, err := hex.DecodeString(string(text))
+	if err != nil {
+		return xerrors.Errorf("decoding darc ID: %v", err)
+	}
+	*id = buf
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler, so that the identity is
+// written in JSON as it is parsed by ParseIdentity, e.g. "ed25519:<hex>". An
+// empty identity is written as an empty string.
+func (id Identity) MarshalText() ([]byte, error) {
+	if id.Type() < 0 {
+		return []byte{}, nil
+	}
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (id *Identity) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*id = Identity{}
+		return nil
+	}
+	parsed, err := ParseIdentity(string(text))
+	if err != nil {
+		return xerrors.Errorf("parsing identity: %v", err)
+	}
+	*id = parsed
+	return nil
+}
+
+type jsonRule struct {
+	Action Action
+	Expr   string
+}
+
+// MarshalJSON implements json.Marshaler, the expression is written as a
+// string.
+func (r Rule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonRule{Action: r.Action, Expr: string(r.Expr)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *Rule) UnmarshalJSON(buf []byte) error {
+	var jr jsonRule
+	err := json.Unmarshal(buf, &jr)
+	if err != nil {
+		return xerrors.Errorf("decoding rule: %v", err)
+	}
+	*r = Rule{Action: jr.Action, Expr: expression.Expr(jr.Expr)}
+	return nil
+}
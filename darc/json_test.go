@@ -0,0 +1,60 @@
+package darc
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/darc/expression"
+)
+
+func TestDarc_JSON(t *testing.T) {
+	td := createDarc(2, "testdarc")
+	d := td.darc.Copy()
+	require.NoError(t, d.Rules.AddRule("spawn:value",
+		expression.InitOrExpr(td.ids[0].String(), td.ids[1].String())))
+	require.NoError(t, localEvolution(d, td.darc, td.owners...))
+
+	buf, err := json.Marshal(d)
+	require.NoError(t, err)
+	var decoded Darc
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	require.Equal(t, d.GetID(), decoded.GetID())
+	require.Equal(t, d.BaseID, decoded.BaseID)
+	require.Equal(t, d.PrevID, decoded.PrevID)
+	require.Equal(t, d.Rules, decoded.Rules)
+	require.NoError(t, decoded.Verify(true))
+
+	// The encoding is canonical.
+	buf2, err := json.Marshal(decoded)
+	require.NoError(t, err)
+	require.Equal(t, buf, buf2)
+
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf, &fields))
+	require.Equal(t, hex.EncodeToString(d.BaseID), fields["BaseID"])
+}
+
+func TestIdentity_JSON(t *testing.T) {
+	ids := []Identity{
+		createIdentity(),
+		NewIdentityDarc(ID{1, 2, 3}),
+		NewIdentityX509EC([]byte{4, 5, 6}),
+		{},
+	}
+	buf, err := json.Marshal(ids)
+	require.NoError(t, err)
+	require.Contains(t, string(buf), `"darc:010203"`)
+	require.Contains(t, string(buf), `"x509ec:040506"`)
+
+	var decoded []Identity
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	require.Equal(t, len(ids), len(decoded))
+	for i := range ids[:3] {
+		require.True(t, ids[i].Equal(&decoded[i]))
+	}
+	require.Equal(t, -1, decoded[3].Type())
+
+	require.Error(t, json.Unmarshal([]byte(`["unknown:00"]`), &decoded))
+}
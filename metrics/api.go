@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// Client is a structure to communicate with the Metrics service.
+type Client struct {
+	*onet.Client
+}
+
+// NewClient makes a new Client.
+func NewClient() *Client {
+	return &Client{Client: onet.NewClient(cothority.Suite, ServiceName)}
+}
+
+// GetMetrics returns the metrics of the given conode in the text exposition
+// format.
+func (c *Client) GetMetrics(dst *network.ServerIdentity) (string, error) {
+	reply := &GetMetricsReply{}
+	err := c.SendProtobuf(dst, &GetMetrics{}, reply)
+	if err != nil {
+		return "", err
+	}
+	return reply.Text, nil
+}
@@ -0,0 +1,369 @@
+// Package metrics implements a registry of counters, gauges and histograms
+// used by the services of a conode to report their activity. The registry is
+// exported in the text exposition format of Prometheus, so that it can be
+// scraped by the usual monitoring tools.
+//
+// Metrics are usually declared as package variables of the service that
+// updates them:
+//
+//	var metricBlocks = metrics.NewCounter("byzcoin_blocks_total",
+//		"Number of blocks created.")
+//
+//	metricBlocks.Inc()
+//
+// Metrics can have labels, in which case the values of the labels are given
+// in the same order every time the metric is updated.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the HTTP content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the default buckets of a histogram, in seconds. They fit
+// the durations of the network operations of a conode.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// DefaultRegistry is the registry used by the package functions and served
+// by the metrics service of the conode.
+var DefaultRegistry = NewRegistry()
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// Registry holds a set of metrics identified by their names.
+type Registry struct {
+	sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// NewCounter registers a new counter in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return DefaultRegistry.NewCounter(name, help, labels...)
+}
+
+// NewGauge registers a new gauge in the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return DefaultRegistry.NewGauge(name, help, labels...)
+}
+
+// NewHistogram registers a new histogram in the default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return DefaultRegistry.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewCounter registers a new counter. A counter can only increase.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, kindCounter, labels, nil)}
+}
+
+// NewGauge registers a new gauge. A gauge holds a value that can go up and
+// down.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, kindGauge, labels, nil)}
+}
+
+// NewHistogram registers a new histogram that counts the observations in the
+// given buckets. The buckets are upper bounds in increasing order, the +Inf
+// bucket is added implicitly. If buckets is nil, DefBuckets is used.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	return &Histogram{r.register(name, help, kindHistogram, labels, buckets)}
+}
+
+// register adds a new family to the registry. Registering twice the same
+// metric returns the family already registered, so that services
+// instantiated multiple times share their metrics. It panics if the name is
+// invalid or already used by a different metric, as it is a programming
+// error.
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	if !validName.MatchString(name) {
+		panic("metrics: invalid name " + name)
+	}
+	for _, l := range labels {
+		if !validName.MatchString(l) || strings.HasPrefix(l, "__") || l == "le" {
+			panic("metrics: invalid label " + l + " for " + name)
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || strings.Join(f.labels, ",") != strings.Join(labels, ",") {
+			panic("metrics: " + name + " is already registered with a different type")
+		}
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string{}, labels...),
+		buckets: append([]float64{}, buckets...),
+		series:  make(map[string]*series),
+	}
+	if len(labels) == 0 {
+		// Metrics without labels are exported even before the first
+		// update.
+		f.get(nil)
+	}
+	r.families[name] = f
+	return f
+}
+
+// WriteText writes all the metrics of the registry in the text exposition
+// format. The metrics are sorted by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]*family, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		families[i] = r.families[name]
+	}
+	r.Unlock()
+
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Text returns all the metrics of the registry in the text exposition
+// format.
+func (r *Registry) Text() string {
+	var buf bytes.Buffer
+	// A bytes.Buffer never returns an error.
+	r.WriteText(&buf)
+	return buf.String()
+}
+
+// ServeHTTP implements http.Handler so that the registry can be scraped.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write([]byte(r.Text()))
+}
+
+// Counter is a metric that can only increase.
+type Counter struct {
+	f *family
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v. Negative values are ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.f.Lock()
+	c.f.get(labelValues).value += v
+	c.f.Unlock()
+}
+
+// Gauge is a metric that holds a value that can go up and down.
+type Gauge struct {
+	f *family
+}
+
+// Set sets the value of the gauge.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.Lock()
+	g.f.get(labelValues).value = v
+	g.f.Unlock()
+}
+
+// Add adds v to the value of the gauge. v can be negative.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.Lock()
+	g.f.get(labelValues).value += v
+	g.f.Unlock()
+}
+
+// Histogram is a metric counting observations in buckets, together with
+// their sum and their count.
+type Histogram struct {
+	f *family
+}
+
+// Observe adds a new observation to the histogram.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.Lock()
+	defer h.f.Unlock()
+
+	s := h.f.get(labelValues)
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// ObserveSince adds the time elapsed since start, in seconds, to the
+// histogram.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// family is a metric with all its series, one for each combination of label
+// values.
+type family struct {
+	sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+// series holds the value of one combination of label values. For
+// histograms, value is the sum of the observations.
+type series struct {
+	labelValues []string
+	value       float64
+	buckets     []uint64
+	count       uint64
+}
+
+// get returns the series of the label values, creating it if needed. The
+// lock of the family must be held by the caller.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",
+			f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string{}, labelValues...),
+			buckets:     make([]uint64, len(f.buckets)),
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) write(w io.Writer) error {
+	f.Lock()
+	defer f.Unlock()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(&buf, "# TYPE %s %s\n", f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := f.series[k]
+		if f.kind != kindHistogram {
+			fmt.Fprintf(&buf, "%s%s %s\n", f.name,
+				f.formatLabels(s.labelValues, ""), formatFloat(s.value))
+			continue
+		}
+
+		var cumul uint64
+		for i, upper := range f.buckets {
+			cumul += s.buckets[i]
+			fmt.Fprintf(&buf, "%s_bucket%s %d\n", f.name,
+				f.formatLabels(s.labelValues, formatFloat(upper)), cumul)
+		}
+		fmt.Fprintf(&buf, "%s_bucket%s %d\n", f.name,
+			f.formatLabels(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(&buf, "%s_sum%s %s\n", f.name,
+			f.formatLabels(s.labelValues, ""), formatFloat(s.value))
+		fmt.Fprintf(&buf, "%s_count%s %d\n", f.name,
+			f.formatLabels(s.labelValues, ""), s.count)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatLabels returns the labels of a series in the exposition format. If
+// le is not empty, it is added as the upper bound of a histogram bucket.
+func (f *family) formatLabels(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escapeLabel(v)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Counter(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "Number of tests.")
+	c.Inc()
+	c.Add(2.5)
+	c.Add(-1)
+
+	require.Equal(t, "# HELP test_total Number of tests.\n"+
+		"# TYPE test_total counter\n"+
+		"test_total 3.5\n", r.Text())
+}
+
+func TestRegistry_Labels(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("test_queue", "Size of the queue.", "chain", "kind")
+	require.Equal(t, "# HELP test_queue Size of the queue.\n"+
+		"# TYPE test_queue gauge\n", r.Text())
+
+	g.Set(3, "b", "x")
+	g.Add(4, "a", "y\"\n")
+	g.Add(-1, "a", "y\"\n")
+
+	require.Equal(t, "# HELP test_queue Size of the queue.\n"+
+		"# TYPE test_queue gauge\n"+
+		"test_queue{chain=\"a\",kind=\"y\\\"\\n\"} 3\n"+
+		"test_queue{chain=\"b\",kind=\"x\"} 3\n", r.Text())
+
+	require.Panics(t, func() { g.Set(1, "a") })
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("test_seconds", "Duration of the tests.", []float64{1, 2})
+	h.Observe(0.5)
+	h.Observe(1.5)
+	h.Observe(3)
+	h.ObserveSince(time.Now())
+
+	text := r.Text()
+	require.Contains(t, text, "# TYPE test_seconds histogram\n"+
+		"test_seconds_bucket{le=\"1\"} 2\n"+
+		"test_seconds_bucket{le=\"2\"} 3\n"+
+		"test_seconds_bucket{le=\"+Inf\"} 4\n")
+	require.Contains(t, text, "test_seconds_count 4\n")
+
+	require.Panics(t, func() { r.NewHistogram("test_unsorted", "", []float64{2, 1}) })
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	c1 := r.NewCounter("test_total", "")
+	c2 := r.NewCounter("test_total", "")
+	c1.Inc()
+	c2.Inc()
+	require.Contains(t, r.Text(), "test_total 2\n")
+
+	require.Panics(t, func() { r.NewGauge("test_total", "") })
+	require.Panics(t, func() { r.NewCounter("test_total", "", "label") })
+	require.Panics(t, func() { r.NewCounter("invalid-name", "") })
+	require.Panics(t, func() { r.NewCounter("test_le", "", "le") })
+
+	// Metrics are sorted by name.
+	r.NewGauge("a_gauge", "")
+	require.True(t, strings.HasPrefix(r.Text(), "# HELP a_gauge "))
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Number of tests.").Inc()
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + Path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, ContentType, resp.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, r.Text(), string(body))
+
+	resp, err = http.Post(srv.URL+Path, "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
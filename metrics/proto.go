@@ -0,0 +1,17 @@
+package metrics
+
+// PROTOSTART
+// package metrics;
+//
+// option java_package = "ch.epfl.dedis.lib.proto";
+// option java_outer_classname = "MetricsProto";
+
+// GetMetrics is a request for the metrics of a conode.
+type GetMetrics struct {
+}
+
+// GetMetricsReply holds the metrics of the conode in the text exposition
+// format.
+type GetMetricsReply struct {
+	Text string
+}
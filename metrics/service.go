@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// ServiceName is the name to refer to the Metrics service.
+const ServiceName = "Metrics"
+
+// Path is the HTTP path where the conode serves the metrics.
+const Path = "/metrics"
+
+func init() {
+	_, err := onet.RegisterNewService(ServiceName, newService)
+	log.ErrFatal(err)
+	network.RegisterMessages(&GetMetrics{}, &GetMetricsReply{})
+}
+
+// Service returns the metrics of the default registry to the clients.
+type Service struct {
+	*onet.ServiceProcessor
+}
+
+// GetMetrics returns the metrics of the conode in the text exposition
+// format.
+func (s *Service) GetMetrics(req *GetMetrics) (*GetMetricsReply, error) {
+	return &GetMetricsReply{Text: DefaultRegistry.Text()}, nil
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+	}
+	if err := s.RegisterHandlers(s.GetMetrics); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
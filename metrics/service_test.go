@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestMain(m *testing.M) {
+	log.MainTest(m)
+}
+
+func TestService_GetMetrics(t *testing.T) {
+	local := onet.NewLocalTest(cothority.Suite)
+	defer local.CloseAll()
+	servers, _, _ := local.GenTree(1, false)
+
+	NewCounter("metrics_test_requests_total", "Number of requests of the test.").Inc()
+
+	text, err := NewClient().GetMetrics(servers[0].ServerIdentity)
+	require.NoError(t, err)
+	require.Contains(t, text, "metrics_test_requests_total 1\n")
+}
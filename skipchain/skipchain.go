@@ -27,6 +27,7 @@ import (
 	"go.dedis.ch/cothority/v3/blscosi/protocol"
 	"go.dedis.ch/cothority/v3/byzcoinx"
 	"go.dedis.ch/cothority/v3/messaging"
+	"go.dedis.ch/cothority/v3/metrics"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing"
 	"go.dedis.ch/kyber/v3/sign/schnorr"
@@ -49,6 +50,17 @@ var suite = pairing.NewSuiteBn256()
 
 var sid onet.ServiceID
 
+var (
+	metricForwardLinkSigning = metrics.NewHistogram("skipchain_forward_link_signing_seconds",
+		"Time taken to collectively sign a forward-link.", nil)
+	metricForwardLinkFailures = metrics.NewCounter("skipchain_forward_link_failures_total",
+		"Number of forward-links that couldn't be signed.")
+	metricPropagationFailures = metrics.NewCounter("skipchain_propagation_failures_total",
+		"Number of propagations of blocks or forward-links that failed.")
+	metricPropagationMissing = metrics.NewCounter("skipchain_propagation_missing_replies_total",
+		"Number of nodes that didn't reply to a propagation.")
+)
+
 func init() {
 	sid, _ = onet.RegisterNewServiceWithSuite(ServiceName, suite, newSkipchainService)
 	network.RegisterMessages(&Storage{})
@@ -1524,6 +1536,7 @@ func (s *Service) startBFT(proto string, origRoster, newRoster *onet.Roster, msg
 	}
 
 	log.Lvl3(s.ServerIdentity(), "starts bft-cosi")
+	start := time.Now()
 	if err := node.Start(); err != nil {
 		log.Error("failed to start with error", err)
 		return nil, err
@@ -1532,12 +1545,15 @@ func (s *Service) startBFT(proto string, origRoster, newRoster *onet.Roster, msg
 	select {
 	case sig := <-root.FinalSignatureChan:
 		if sig.Sig == nil {
+			metricForwardLinkFailures.Inc()
 			return nil, errors.New("couldn't sign forward-link")
 		}
 		log.Lvl3(s.ServerIdentity(), "bft-cosi done")
+		metricForwardLinkSigning.ObserveSince(start)
 
 		return &sig, nil
 	case <-time.After(root.Timeout * 2):
+		metricForwardLinkFailures.Inc()
 		return nil, errors.New("timed out while waiting for signature")
 	case <-s.closing:
 		return nil, errors.New("closing down")
@@ -1704,11 +1720,13 @@ func (s *Service) startPropagation(propagate messaging.PropagationFunc, ro *onet
 
 	replies, err := propagate(ro, msg, s.propTimeout)
 	if err != nil {
+		metricPropagationFailures.Inc()
 		return err
 	}
 
 	if replies != len(ro.List) {
 		log.Lvl1(s.ServerIdentity(), "Only got", replies, "out of", len(ro.List))
+		metricPropagationMissing.Add(float64(len(ro.List) - replies))
 	}
 
 	return nil